@@ -0,0 +1,20 @@
+//go:build linux
+
+package main
+
+import (
+	"unsafe"
+)
+
+// overwriteArg masks an argument from the byte at from on. The arguments in os.Args share their memory with
+// the ones the kernel shows in /proc/<pid>/cmdline, so ps shows the mask from then on
+func overwriteArg(arg string, from int) bool {
+	if from >= len(arg) {
+		return false
+	}
+	bytes := unsafe.Slice(unsafe.StringData(arg), len(arg))
+	for i := from; i < len(bytes); i++ {
+		bytes[i] = '*'
+	}
+	return true
+}
@@ -0,0 +1,67 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestMaskFlagValue(t *testing.T) {
+	tests := []struct {
+		name   string
+		args   []string
+		want   []string
+		masked bool
+	}{
+		{name: "with equals", args: []string{"--gitlab-token=s3cr3t", "--depth=1"}, want: []string{"--gitlab-token=******", "--depth=1"}, masked: true},
+		{name: "single dash", args: []string{"-gitlab-token=s3cr3t"}, want: []string{"-gitlab-token=******"}, masked: true},
+		{name: "as next argument", args: []string{"--gitlab-token", "s3cr3t", "--refresh"}, want: []string{"--gitlab-token", "******", "--refresh"}, masked: true},
+		{name: "given twice", args: []string{"-gitlab-token", "first", "--gitlab-token=second"}, want: []string{"-gitlab-token", "*****", "--gitlab-token=******"}, masked: true},
+		{name: "empty value", args: []string{"--gitlab-token="}, want: []string{"--gitlab-token="}},
+		{name: "value missing", args: []string{"--gitlab-token"}, want: []string{"--gitlab-token"}},
+		{name: "other flags", args: []string{"--gitlab-token-type=job", "--gitlab-url", "gitlab-token=s3cr3t"}, want: []string{"--gitlab-token-type=job", "--gitlab-url", "gitlab-token=s3cr3t"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			args := make([]string, len(test.args))
+			for i, arg := range test.args {
+				args[i] = strings.Clone(arg) // literals are read-only
+			}
+			if masked := maskFlagValue(args, "gitlab-token"); masked != test.masked || !slices.Equal(args, test.want) {
+				t.Errorf("got %q, %t, want %q, %t", args, masked, test.want, test.masked)
+			}
+		})
+	}
+}
+
+// TestMaskFlagValueCmdline checks what ps sees, in a test process started with the token in its arguments
+func TestMaskFlagValueCmdline(t *testing.T) {
+	const secret = "glpat-cmdl1ne-s3cr3t"
+	if os.Getenv("GLS_TEST_MASK_CMDLINE") != "" {
+		if !maskFlagValue(os.Args[1:], "gitlab-token") {
+			t.Fatal("nothing was masked")
+		}
+		cmdline, err := os.ReadFile("/proc/self/cmdline")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(cmdline, []byte(secret)) {
+			t.Errorf("ps still shows the token: %q", cmdline)
+		}
+		return
+	}
+
+	for _, args := range [][]string{{"--gitlab-token=" + secret}, {"--gitlab-token", secret}} {
+		cmd := exec.Command(os.Args[0], append([]string{"-test.run=^TestMaskFlagValueCmdline$", "--"}, args...)...)
+		cmd.Env = append(os.Environ(), "GLS_TEST_MASK_CMDLINE=1")
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Errorf("%q: %v\n%s", args, err, output)
+		}
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package main
+
+// overwriteArg can't mask arguments for ps on this platform, they are copies of what the system keeps
+func overwriteArg(string, int) bool {
+	return false
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+	"gls/pkg/git"
+	"gls/pkg/gitlab"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// BranchOverride makes the projects matching a pattern live on another branch than Gitlab's default branch
+type BranchOverride struct {
+	Pattern string
+	Branch  string
+	matcher gitignore.Pattern
+}
+
+// parseBranchOverrides reads overrides written as pattern=branch, the patterns work like those in the ignore file
+func parseBranchOverrides(entries []string) ([]*BranchOverride, error) {
+	var overrides []*BranchOverride
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		pattern, branch, ok := strings.Cut(entry, "=")
+		pattern, branch = strings.TrimSpace(pattern), strings.TrimSpace(branch)
+		if !ok || pattern == "" || branch == "" {
+			return nil, fmt.Errorf("%q is not of the form pattern=branch", entry)
+		}
+		if strings.HasPrefix(pattern, "!") {
+			return nil, fmt.Errorf("%q can't be negated", entry)
+		}
+
+		overrides = append(overrides, &BranchOverride{
+			Pattern: pattern,
+			Branch:  branch,
+			matcher: gitignore.ParsePattern(pattern, nil),
+		})
+	}
+	return overrides, nil
+}
+
+// overrideBranch returns the branch of the first override matching a project or one of the directories above it,
+// or an empty string if the project stays on its default branch
+func overrideBranch(overrides []*BranchOverride, path string) string {
+	parts := strings.Split(path, "/")
+	for _, override := range overrides {
+		for i := 1; i <= len(parts); i++ {
+			if override.matcher.Match(parts[:i], true) == gitignore.Exclude {
+				return override.Branch
+			}
+		}
+	}
+	return ""
+}
+
+// branchesToTrack returns the branches of all track rules matching a project that is pulled or fetched.
+// Unlike overrides every matching rule counts, so one project can track several branches
+func branchesToTrack(tracks []*BranchOverride, task *InternalTask) []string {
+	if task.Wiki || task.Mirror || task.Skipped || (task.Action != Pull && task.Action != Fetch) {
+		return nil
+	}
+
+	parts := strings.Split(task.Key, "/")
+	var branches []string
+	for _, track := range tracks {
+		for i := 1; i <= len(parts); i++ {
+			if track.matcher.Match(parts[:i], true) == gitignore.Exclude {
+				if !slices.Contains(branches, track.Branch) {
+					branches = append(branches, track.Branch)
+				}
+				break
+			}
+		}
+	}
+	return branches
+}
+
+// effectiveBranch is the branch a project is cloned on and has to be on to be pulled.
+// Wikis only have a single branch, so they are never overridden
+func effectiveBranch(overrides []*BranchOverride, project *gitlab.Project) (string, bool) {
+	if project.Wiki {
+		return project.DefaultBranch, false
+	}
+
+	branch := overrideBranch(overrides, project.Path)
+	if branch == "" {
+		return project.DefaultBranch, false
+	}
+	return branch, true
+}
+
+// verifyDefaultBranches asks origin for the default branch of the local projects that would be skipped for being on
+// another branch, as the API can still report the old one after a rename. Where the remote disagrees it wins,
+// the disagreements are returned as warnings
+func verifyDefaultBranches(ctx context.Context, gitlabProjects []*gitlab.Project, localProjects []*git.Project, overrides []*BranchOverride, cfg Config) []string {
+	var mismatched []*ProjectPair
+	for _, pair := range pairProjects(gitlabProjects, localProjects) {
+		if pair.GitlabProject == nil || pair.LocalProject == nil || unpullableReason(pair) != "" {
+			continue
+		}
+		branch, override := effectiveBranch(overrides, pair.GitlabProject)
+		if override || pair.GitlabProject.Wiki || branch == pair.LocalProject.Branch {
+			continue // overrides are meant to differ, wikis only have a single branch anyway
+		}
+		mismatched = append(mismatched, pair)
+	}
+
+	var mu sync.Mutex
+	var warnings []string
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, max(cfg.Workers, 1))
+	for _, pair := range mismatched {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			remoteCtx := ctx
+			if cfg.TaskTimeout > 0 {
+				var cancel context.CancelFunc
+				remoteCtx, cancel = context.WithTimeout(ctx, cfg.TaskTimeout)
+				defer cancel()
+			}
+
+			head, err := git.RemoteHead(remoteCtx, filepath.Join(cfg.Local.Path, pair.LocalProject.Path))
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err != nil:
+				warnings = append(warnings, msg("sync.remote_head_failed", pair.LocalProject.Path, err))
+			case head != pair.GitlabProject.DefaultBranch:
+				warnings = append(warnings, msg("sync.default_branch_stale", pair.LocalProject.Path, pair.GitlabProject.DefaultBranch, head))
+				pair.GitlabProject.DefaultBranch = head
+			}
+		}()
+	}
+	wg.Wait()
+
+	sort.Strings(warnings)
+	return warnings
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"gls/pkg/git"
+	"gls/pkg/gitlab"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVerifyDefaultBranches(t *testing.T) {
+	tests := []struct {
+		path   string
+		listed string // the default branch the API reports
+		local  string
+		origin string // where HEAD of origin points, empty for an origin that can't be reached
+		wiki   bool
+		want   string // the default branch after verifying
+	}{
+		{path: "renamed", listed: "master", local: "main", origin: "main", want: "main"},
+		{path: "feature", listed: "main", local: "feature/login", origin: "main", want: "main"},
+		{path: "unreachable", listed: "main", local: "develop", want: "main"},
+		{path: "overridden", listed: "main", local: "release", want: "main"}, // never asked
+		{path: "handbook.wiki", listed: "", local: "master", wiki: true},     // never asked
+		{path: "current", listed: "main", local: "main", want: "main"},       // never asked
+	}
+
+	dir := t.TempDir()
+	var cfg Config
+	cfg.Local.Path = filepath.Join(dir, "local")
+	cfg.Workers = 2
+	var gitlabProjects []*gitlab.Project
+	var localProjects []*git.Project
+	for _, test := range tests {
+		origin := filepath.Join(dir, "origins", test.path)
+		if test.origin != "" {
+			initRepo(t, origin, true)
+			runGit(t, origin, "branch", "--quiet", "-M", test.origin)
+		}
+		local := filepath.Join(cfg.Local.Path, test.path)
+		initRepo(t, local, false)
+		runGit(t, local, "remote", "add", "origin", origin)
+
+		gitlabProjects = append(gitlabProjects, &gitlab.Project{Path: test.path, DefaultBranch: test.listed, Wiki: test.wiki})
+		localProjects = append(localProjects, &git.Project{Path: test.path, Branch: test.local})
+	}
+	overrides, err := parseBranchOverrides([]string{"overridden=release"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	warnings := verifyDefaultBranches(context.Background(), gitlabProjects, localProjects, overrides, cfg)
+
+	for i, test := range tests {
+		if got := gitlabProjects[i].DefaultBranch; got != test.want {
+			t.Errorf("%s: default branch %q, want %q", test.path, got, test.want)
+		}
+	}
+	failed := strings.TrimSuffix(msg("sync.remote_head_failed", "unreachable", "<err>"), "<err>")
+	if len(warnings) != 2 || !strings.HasPrefix(warnings[0], failed) || warnings[1] != msg("sync.default_branch_stale", "renamed", "master", "main") {
+		t.Errorf("warned %q", warnings)
+	}
+}
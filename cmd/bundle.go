@@ -0,0 +1,243 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/joho/godotenv"
+	"gls/pkg/storage"
+	"gopkg.in/yaml.v3"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ConfigBundle is a config file without secrets, meant to be shared within a team
+type ConfigBundle struct {
+	Version int               `yaml:"version"`
+	Config  map[string]string `yaml:"config"`
+}
+
+const (
+	mergeAsk    = "ask"
+	mergeOurs   = "ours"
+	mergeTheirs = "theirs"
+)
+
+// sanitizeConfig returns a copy of values without any secret
+func sanitizeConfig(values map[string]string) map[string]string {
+	secrets := secretConfigKeys()
+
+	sanitized := make(map[string]string, len(values))
+	for key, value := range values {
+		if key == configVersionKey || containsString(secrets, key) {
+			continue
+		}
+		sanitized[key] = value
+	}
+	return sanitized
+}
+
+// mergeConfig returns the values of theirs that should be written to our config.
+// Keys we don't have yet are always taken, for keys we set differently the strategy decides,
+// ask is only called with the ask strategy and returns true to take their value
+func mergeConfig(ours map[string]string, theirs map[string]string, strategy string, ask func(key string, ours string, theirs string) bool) map[string]string {
+	keys := make([]string, 0, len(theirs))
+	for key := range theirs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	changes := make(map[string]string)
+	for _, key := range keys {
+		ourValue, ok := ours[key]
+		switch {
+		case !ok:
+			changes[key] = theirs[key]
+		case ourValue == theirs[key]:
+		case strategy == mergeTheirs:
+			changes[key] = theirs[key]
+		case strategy == mergeAsk && ask(key, ourValue, theirs[key]):
+			changes[key] = theirs[key]
+		}
+	}
+	return changes
+}
+
+// setConfigLines replaces the values of existing keys in place and appends the new ones, keeping comments and order intact
+func setConfigLines(lines []string, changes map[string]string) []string {
+	written := make(map[string]bool)
+
+	var updated []string
+	for _, line := range lines {
+		key, _, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(key), "export "))
+
+		value, changed := changes[key]
+		if ok && changed && !strings.HasPrefix(key, "#") {
+			updated = append(updated, key+"="+quoteConfigValue(value))
+			written[key] = true
+		} else {
+			updated = append(updated, line)
+		}
+	}
+
+	var added []string
+	for key, value := range changes {
+		if !written[key] {
+			added = append(added, key+"="+quoteConfigValue(value))
+		}
+	}
+	sort.Strings(added)
+
+	return append(updated, added...)
+}
+
+func quoteConfigValue(value string) string {
+	if strings.ContainsAny(value, " \t#'\"\\\n") {
+		return strconv.Quote(value)
+	}
+	return value
+}
+
+func runConfigExport(configPath string, args []string) {
+	flags := flag.NewFlagSet("gls config export", flag.ExitOnError)
+	out := flags.String("out", "", "Write the bundle to this file instead of stdout")
+	_ = flags.Parse(args)
+
+	values, err := readConfigFile(configPath, "")
+	if err != nil {
+		log.Fatalf("Error reading config file: %v", err)
+	}
+
+	content, err := yaml.Marshal(&ConfigBundle{
+		Version: currentConfigVersion,
+		Config:  sanitizeConfig(values),
+	})
+	if err != nil {
+		log.Fatalf("Error creating bundle: %v", err)
+	}
+
+	if *out == "" {
+		fmt.Print(string(content))
+		return
+	}
+
+	err = storage.WriteFile(*out, content, 0644)
+	if err != nil {
+		log.Fatalf("Error writing bundle: %v", err)
+	}
+	println(text.FgCyan.Sprint(msg("bundle.exported", configPath, *out)))
+}
+
+// readConfigBundle reads a bundle and migrates it to the current config version
+func readConfigBundle(path string) (map[string]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var bundle ConfigBundle
+	err = yaml.Unmarshal(content, &bundle)
+	if err != nil {
+		return nil, err
+	}
+	if bundle.Version < 1 {
+		return nil, fmt.Errorf("%s is not a gls config bundle, it has no version", path)
+	}
+
+	values := make(map[string]string, len(bundle.Config)+1)
+	for key, value := range bundle.Config {
+		values[key] = value
+	}
+	values[configVersionKey] = strconv.Itoa(bundle.Version)
+
+	values, _, err = migrateConfig(values)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, warning := range unknownConfigKeys(values) {
+		println(text.FgYellow.Sprint(warning))
+	}
+	for _, key := range secretConfigKeys() {
+		if _, ok := values[key]; ok {
+			println(text.FgYellow.Sprint(msg("bundle.ignoring_secret", key)))
+		}
+	}
+	return sanitizeConfig(values), nil
+}
+
+func runConfigImport(configPath string, args []string) {
+	flags := flag.NewFlagSet("gls config import", flag.ExitOnError)
+	strategy := flags.String("strategy", mergeAsk, "How to resolve keys you set differently: ask, ours or theirs")
+	_ = flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		log.Fatalf("Usage: gls config import file [--strategy ask|ours|theirs]")
+	}
+	if *strategy != mergeAsk && *strategy != mergeOurs && *strategy != mergeTheirs {
+		log.Fatalf("Invalid strategy %s, use ask, ours or theirs", *strategy)
+	}
+
+	theirs, err := readConfigBundle(flags.Arg(0))
+	if err != nil {
+		log.Fatalf("Error reading bundle: %v", err)
+	}
+
+	content, err := os.ReadFile(configPath)
+	if err != nil && !os.IsNotExist(err) {
+		log.Fatalf("Error reading config file: %v", err)
+	}
+	existed := err == nil
+
+	ours, err := godotenv.UnmarshalBytes(content)
+	if err != nil {
+		log.Fatalf("Error parsing config file: %v", err)
+	}
+
+	version, err := configFileVersion(ours)
+	if err != nil {
+		log.Fatalf("Error reading config file: %v", err)
+	}
+	ours, _, _ = migrateConfig(ours)
+
+	var lines []string
+	if existed {
+		lines = strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+	}
+	before := lines
+	lines = migrateConfigLines(lines, version)
+
+	changes := mergeConfig(ours, theirs, *strategy, func(key string, ourValue string, theirValue string) bool {
+		return askForConfirmation(text.FgMagenta.Sprint(msg("bundle.confirm_conflict", key, ourValue, theirValue)))
+	})
+	if len(changes) == 0 && existed && version == currentConfigVersion {
+		println(text.FgCyan.Sprint(msg("bundle.nothing_to_import")))
+		return
+	}
+
+	updated := setConfigLines(lines, changes)
+	for _, line := range diffLines(before, updated) {
+		println(line)
+	}
+
+	if !askForConfirmation(text.FgMagenta.Sprint(msg("config.confirm_write", configPath))) {
+		return
+	}
+
+	if existed {
+		err = storage.WriteFile(configPath+".bak", content, 0600)
+		if err != nil {
+			log.Fatalf("Error writing backup: %v", err)
+		}
+	}
+
+	err = storage.WriteFile(configPath, []byte(strings.Join(updated, "\n")+"\n"), 0600)
+	if err != nil {
+		log.Fatalf("Error writing config file: %v", err)
+	}
+	println(text.FgCyan.Sprint(msg("bundle.imported", len(changes), configPath)))
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"gopkg.in/yaml.v3"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSanitizeConfig(t *testing.T) {
+	values := map[string]string{
+		"CONFIG_VERSION": "2",
+		"GITLAB_URL":     "https://gitlab.example.com",
+		"GITLAB_TOKEN":   "glpat-secret",
+		"GITLAB_GROUP":   "acme",
+		"LOCAL_PATH":     "~/src",
+		"WORKERS":        "",
+	}
+	want := map[string]string{
+		"GITLAB_URL":   "https://gitlab.example.com",
+		"GITLAB_GROUP": "acme",
+		"LOCAL_PATH":   "~/src",
+		"WORKERS":      "",
+	}
+
+	if got := sanitizeConfig(values); !maps.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if values["GITLAB_TOKEN"] != "glpat-secret" || values["CONFIG_VERSION"] != "2" {
+		t.Error("sanitizing changed the values it was given")
+	}
+
+	// Whatever is marked secret later is left out as well
+	for _, key := range secretConfigKeys() {
+		if _, ok := sanitizeConfig(map[string]string{key: "secret"})[key]; ok {
+			t.Errorf("%s is exported", key)
+		}
+	}
+}
+
+func TestMergeConfig(t *testing.T) {
+	ours := map[string]string{
+		"GITLAB_URL":   "https://gitlab.example.com",
+		"GITLAB_GROUP": "acme",
+		"WORKERS":      "5",
+		"LOCAL_PATH":   "~/src",
+	}
+	theirs := map[string]string{
+		"GITLAB_URL":   "https://gitlab.example.com",
+		"GITLAB_GROUP": "acme/platform",
+		"WORKERS":      "10",
+		"PRUNE":        "true",
+	}
+
+	tests := []struct {
+		name     string
+		strategy string
+		answers  map[string]bool // what is answered when asked about a key
+		asked    []string
+		want     map[string]string
+	}{
+		{
+			name:     "ours",
+			strategy: mergeOurs,
+			want:     map[string]string{"PRUNE": "true"},
+		},
+		{
+			name:     "theirs",
+			strategy: mergeTheirs,
+			want:     map[string]string{"GITLAB_GROUP": "acme/platform", "WORKERS": "10", "PRUNE": "true"},
+		},
+		{
+			name:     "ask, taking theirs",
+			strategy: mergeAsk,
+			answers:  map[string]bool{"GITLAB_GROUP": true, "WORKERS": true},
+			asked:    []string{"GITLAB_GROUP", "WORKERS"},
+			want:     map[string]string{"GITLAB_GROUP": "acme/platform", "WORKERS": "10", "PRUNE": "true"},
+		},
+		{
+			name:     "ask, keeping ours",
+			strategy: mergeAsk,
+			asked:    []string{"GITLAB_GROUP", "WORKERS"},
+			want:     map[string]string{"PRUNE": "true"},
+		},
+		{
+			name:     "ask, mixed",
+			strategy: mergeAsk,
+			answers:  map[string]bool{"WORKERS": true},
+			asked:    []string{"GITLAB_GROUP", "WORKERS"},
+			want:     map[string]string{"WORKERS": "10", "PRUNE": "true"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var asked []string
+			got := mergeConfig(ours, theirs, test.strategy, func(key string, ourValue string, theirValue string) bool {
+				if ourValue != ours[key] || theirValue != theirs[key] {
+					t.Errorf("asked about %s with %q and %q", key, ourValue, theirValue)
+				}
+				asked = append(asked, key)
+				return test.answers[key]
+			})
+			if !maps.Equal(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+			if !slices.Equal(asked, test.asked) {
+				t.Errorf("asked about %v, want %v in order", asked, test.asked)
+			}
+		})
+	}
+
+	if got := mergeConfig(ours, ours, mergeTheirs, nil); len(got) != 0 {
+		t.Errorf("merging the same config changed %v", got)
+	}
+	if got := mergeConfig(nil, theirs, mergeAsk, nil); !maps.Equal(got, theirs) {
+		t.Errorf("merging into an empty config got %v", got)
+	}
+}
+
+func TestSetConfigLines(t *testing.T) {
+	lines := []string{
+		"# Where to sync",
+		"GITLAB_GROUP=acme",
+		"export WORKERS=5",
+		"# PRUNE=false",
+		"",
+		"LOCAL_PATH = ~/src",
+	}
+	changes := map[string]string{
+		"GITLAB_GROUP":     "acme/platform",
+		"WORKERS":          "10",
+		"PRUNE":            "true",
+		"LOCAL_PATH":       "~/my src",
+		"HOOKS_POST_CLONE": `echo "cloned"`,
+	}
+	want := []string{
+		"# Where to sync",
+		"GITLAB_GROUP=acme/platform",
+		"WORKERS=10",
+		"# PRUNE=false",
+		"",
+		`LOCAL_PATH="~/my src"`,
+		`HOOKS_POST_CLONE="echo \"cloned\""`,
+		"PRUNE=true",
+	}
+
+	if got := setConfigLines(lines, changes); !slices.Equal(got, want) {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if got := setConfigLines(lines, nil); !slices.Equal(got, lines) {
+		t.Errorf("nothing to change got\n%s", strings.Join(got, "\n"))
+	}
+}
+
+func TestReadConfigBundle(t *testing.T) {
+	tests := []struct {
+		name   string
+		bundle string
+		want   map[string]string
+		err    string
+	}{
+		{
+			name:   "current",
+			bundle: "version: 2\nconfig:\n  GITLAB_GROUP: acme\n  PRUNE: \"true\"\n",
+			want:   map[string]string{"GITLAB_GROUP": "acme", "PRUNE": "true"},
+		},
+		{
+			name:   "secret left in by hand",
+			bundle: "version: 2\nconfig:\n  GITLAB_GROUP: acme\n  GITLAB_TOKEN: glpat-secret\n",
+			want:   map[string]string{"GITLAB_GROUP": "acme"},
+		},
+		{
+			name:   "older version",
+			bundle: "version: 1\nconfig:\n  GITLAB_GROUP: acme\n",
+			want:   map[string]string{"GITLAB_GROUP": "acme"},
+		},
+		{
+			name:   "without version",
+			bundle: "config:\n  GITLAB_GROUP: acme\n",
+			err:    "is not a gls config bundle, it has no version",
+		},
+		{
+			name:   "newer version",
+			bundle: "version: 99\nconfig:\n  GITLAB_GROUP: acme\n",
+			err:    "99",
+		},
+		{
+			name:   "not yaml",
+			bundle: "GITLAB_GROUP=acme\n",
+			err:    "yaml",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "bundle.yaml")
+			if err := os.WriteFile(path, []byte(test.bundle), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := readConfigBundle(path)
+			switch {
+			case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+				t.Fatalf("got %v, want %s", err, test.err)
+			case test.err == "" && err != nil:
+				t.Fatal(err)
+			}
+			if test.err == "" && !maps.Equal(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+// TestConfigBundleRoundTrip exports a config the way gls config export does and imports it again
+func TestConfigBundleRoundTrip(t *testing.T) {
+	values := map[string]string{
+		"CONFIG_VERSION":   "2",
+		"GITLAB_TOKEN":     "glpat-secret",
+		"GITLAB_GROUP":     "acme",
+		"HOOKS_POST_CLONE": "make setup # with a comment: and colons\n",
+	}
+
+	content, err := yaml.Marshal(&ConfigBundle{Version: currentConfigVersion, Config: sanitizeConfig(values)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(content), "glpat-secret") {
+		t.Fatalf("the token is exported:\n%s", content)
+	}
+	path := filepath.Join(t.TempDir(), "bundle.yaml")
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := readConfigBundle(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := sanitizeConfig(values); !maps.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
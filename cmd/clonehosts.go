@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"gls/pkg/git"
+	"gls/pkg/gitlab"
+	"strings"
+)
+
+// CloneHosts is what the clone urls of the tasks are checked against before anything runs
+type CloneHosts struct {
+	allowlist *git.HostAllowlist
+	rule      string // the rewrite clone urls went through, named when one points somewhere else
+}
+
+// cloneHosts allows the host of the Gitlab url and the configured extra hosts. Not following an instance move
+// leaves clone urls on the old host, so it stays allowed then
+func cloneHosts(cfg Config, move *InstanceMove) *CloneHosts {
+	var hosts []git.AllowedHost
+	if gitlabHost, err := git.ParseAllowedHost(cfg.Gitlab.Url); err == nil {
+		gitlabHost.Port = "" // the port of the api says nothing about the one of ssh
+		hosts = append(hosts, gitlabHost)
+	}
+	if move != nil && !cfg.FollowInstanceMove {
+		hosts = append(hosts, git.AllowedHost{Host: strings.ToLower(move.OldHost)})
+	}
+	for _, value := range cfg.Git.AllowedHosts {
+		host, _ := git.ParseAllowedHost(value) // loadConfig made sure they parse
+		hosts = append(hosts, host)
+	}
+
+	return &CloneHosts{
+		allowlist: git.NewHostAllowlist(hosts),
+		rule:      cloneUrlRule(cfg, move),
+	}
+}
+
+// cloneUrlRule names the rewrites applied to the clone urls Gitlab lists
+func cloneUrlRule(cfg Config, move *InstanceMove) string {
+	var rules []string
+	if cfg.Gitlab.Https || cfg.Gitlab.TokenType == gitlab.JobToken {
+		rules = append(rules, "https (--gitlab-https)")
+	}
+	if move != nil && cfg.FollowInstanceMove {
+		rules = append(rules, fmt.Sprintf("instance move %s → %s (--follow-instance-move)", move.OldHost, move.NewHost))
+	}
+	if len(rules) == 0 {
+		return "none, the url is as Gitlab listed it"
+	}
+	return strings.Join(rules, ", ")
+}
+
+// check fails tasks whose clone url points at a host that isn't allowed
+func (c *CloneHosts) check(task *Task) error {
+	if c == nil || task.CloneUrl == "" || task.Skipped || task.Action == Delete {
+		return nil
+	}
+	err := c.allowlist.Check(task.CloneUrl)
+	if err != nil {
+		return fmt.Errorf("%w, rewrite rule: %s. Add the host to --git-allowed-hosts if it's right", err, c.rule)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCloneHosts(t *testing.T) {
+	move := &InstanceMove{OldHost: "Old.Example.com", NewHost: "gitlab.example.com"}
+
+	tests := []struct {
+		name    string
+		move    *InstanceMove
+		follow  bool
+		https   bool
+		allowed []string
+		task    *Task
+		err     string
+	}{
+		{name: "gitlab host over ssh", task: &Task{Action: Clone, CloneUrl: "git@gitlab.example.com:acme/api.git"}},
+		{name: "any port of the gitlab host", task: &Task{Action: Pull, CloneUrl: "ssh://git@gitlab.example.com:2222/acme/api.git"}},
+		{name: "other host", task: &Task{Action: Clone, CloneUrl: "git@elsewhere.example.com:acme/api.git"},
+			err: "clone url host elsewhere.example.com isn't allowed, rewrite rule: none, the url is as Gitlab listed it. Add the host to --git-allowed-hosts"},
+		{name: "allowed extra host", allowed: []string{"mirror.example.com:8443"}, task: &Task{Action: Fetch, CloneUrl: "https://mirror.example.com:8443/acme/api.git"}},
+		{name: "extra host on another port", allowed: []string{"mirror.example.com:8443"}, task: &Task{Action: Fetch, CloneUrl: "https://mirror.example.com/acme/api.git"},
+			err: "mirror.example.com isn't allowed"},
+		{name: "old host while the move isn't followed", move: move, task: &Task{Action: Pull, CloneUrl: "git@old.example.com:acme/api.git"}},
+		{name: "old host once the move is followed", move: move, follow: true, task: &Task{Action: Pull, CloneUrl: "git@old.example.com:acme/api.git"},
+			err: "rewrite rule: instance move Old.Example.com → gitlab.example.com (--follow-instance-move)"},
+		{name: "https rewrite named", https: true, task: &Task{Action: Clone, CloneUrl: "https://gitlab@elsewhere.example.com/acme/api.git"},
+			err: "rewrite rule: https (--gitlab-https)"},
+		{name: "deletions aren't checked", task: &Task{Action: Delete, CloneUrl: "git@elsewhere.example.com:acme/api.git"}},
+		{name: "skipped tasks aren't checked", task: &Task{Action: Clone, Skipped: true, CloneUrl: "git@elsewhere.example.com:acme/api.git"}},
+		{name: "local path", task: &Task{Action: Clone, CloneUrl: "/srv/mirrors/acme/api.git"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var cfg Config
+			cfg.Gitlab.Url = "https://gitlab.example.com:8443" // the port of the api says nothing about ssh
+			cfg.Gitlab.Https = test.https
+			cfg.FollowInstanceMove = test.follow
+			cfg.Git.AllowedHosts = test.allowed
+
+			err := cloneHosts(cfg, test.move).check(test.task)
+			switch {
+			case test.err == "" && err != nil:
+				t.Errorf("got %v", err)
+			case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+				t.Errorf("got %v, want %s", err, test.err)
+			}
+		})
+	}
+
+	var none *CloneHosts
+	if err := none.check(&Task{Action: Clone, CloneUrl: "git@elsewhere.example.com:acme/api.git"}); err != nil {
+		t.Errorf("without an allowlist got %v", err)
+	}
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"flag"
+	"github.com/cristalhq/aconfig"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/joho/godotenv"
+	"gls/pkg/git"
+	"gls/pkg/gitlab"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	ConfigVersion int `default:"2" flag:"-" usage:"Layout version of the config file"`
+
+	Workers      int           `default:"5" usage:"Number of parallel workers"`
+	CloneWorkers int           `flag:"clone-workers" usage:"Number of parallel clones, once this or pull-workers is set clones get workers of their own"`
+	PullWorkers  int           `flag:"pull-workers" usage:"Number of parallel pulls, fetches and deletes, once this or clone-workers is set they get workers of their own"`
+	TaskTimeout  time.Duration `default:"10m" flag:"task-timeout" usage:"Abort a single clone or pull after this long, 0 disables the timeout"`
+	Gitlab       struct {
+		Url   string `default:"https://gitlab.com" usage:"Gitlab URL"`
+		Token string `required:"true" secret:"true" usage:"Gitlab token for authentication"`
+		Group string `usage:"Gitlab group to clone recursively, or a username to clone their personal projects"`
+
+		Source    string `default:"group" usage:"Where the projects to sync come from: group (the group above), starred (the projects the user of the token starred) or ids:1,2,3 (projects by id)"`
+		TokenType string `default:"pat" flag:"token-type" usage:"Kind of token: pat (personal), group (group access token) or job (CI_JOB_TOKEN)"`
+		Https     bool   `usage:"Clone over https with the token instead of ssh, always the case for job tokens"`
+
+		IncludeTopics []string `flag:"include-topics" usage:"Only sync projects with at least one of these comma separated topics"`
+		ExcludeTopics []string `flag:"exclude-topics" usage:"Ignore projects with any of these comma separated topics, keeping their local copies"`
+
+		IncludeArchived bool `flag:"include-archived" usage:"Also sync archived projects, otherwise they are ignored and their local copies kept"`
+		IncludeShared   bool `flag:"include-shared" usage:"Also sync projects shared with other groups, otherwise they are ignored and their local copies kept"`
+
+		Timeout     time.Duration `default:"30s" usage:"Abort a single Gitlab API request after this long, 0 disables the timeout"`
+		ListTimeout time.Duration `default:"5m" flag:"list-timeout" usage:"Stop listing Gitlab projects after this long, 0 disables the timeout"`
+		Concurrency int           `default:"20" usage:"Most Gitlab API requests at once while listing, 0 is unlimited"`
+
+		ResumeWindow  time.Duration `default:"1h" flag:"resume-window" usage:"Resume a listing that failed part way if it started less than this long ago, deletions wait for a listing done within it, 0 always lists from scratch"`
+		ListingMaxAge time.Duration `flag:"listing-max-age" usage:"Use the listing of the last sync instead of listing Gitlab if it is less than this old, needs the local state, 0 always lists, except for gls resume using a listing of up to 1h"`
+
+		AuditDays int `default:"30" flag:"audit-days" usage:"Look this many days back in the audit events of the group to tell who deleted or moved a project, 0 disables it"`
+	}
+	Branch struct {
+		Overrides []string `usage:"Comma separated pattern=branch rules, matching projects are cloned and pulled on that branch instead of the default branch, e.g. team-x/*=develop"`
+		Track     []string `usage:"Comma separated pattern=branch rules, matching projects also keep that local branch fast-forwarded to origin without checking it out, e.g. team-x/api=release/current"`
+	}
+	Depth       int  `default:"-1" usage:"How many levels of subgroups to sync, 0 only syncs the group itself, -1 is unlimited"`
+	NoRecursive bool `flag:"no-recursive" usage:"Only sync the projects directly in the group, same as depth 0"`
+
+	Local struct {
+		Path  string `required:"true" usage:"Local path to clone to"`
+		State bool   `usage:"Cache local projects in .gls-state.json to speed up subsequent runs"`
+	}
+	Hooks struct {
+		PostClone string        `flag:"post-clone" usage:"Shell command to run inside a project after it was cloned"`
+		PostPull  string        `flag:"post-pull" usage:"Shell command to run inside a project after a pull brought in new commits"`
+		PrePlan   string        `flag:"pre-plan" usage:"Shell command that gets the plan as JSON on stdin and answers which tasks to skip, e.g. to enforce policies. Nothing runs if it fails"`
+		Timeout   time.Duration `default:"5m" usage:"Abort a hook after this long, 0 disables the timeout"`
+	}
+	NoHooks bool `flag:"no-hooks" usage:"Don't run any hooks"`
+
+	Git struct {
+		Backend string `default:"cli" usage:"How to clone, pull and fetch: cli runs the git binary, native uses go-git and refuses to pull over local changes"`
+		SshKey  string `flag:"ssh-key" usage:"Private key for ssh clone urls with the native backend, the SSH agent is used without one"`
+
+		AllowedHosts []string `flag:"allowed-hosts" usage:"Hosts clone urls may point at besides the one of the Gitlab url, e.g. an ssh host or alias, as host or host:port"`
+	}
+
+	Delete struct {
+		Shadow bool `usage:"Neither delete nor ask, record what would have been deleted for gls shadow-report instead, turning it off clears the records"`
+	}
+
+	Notes struct {
+		Retention time.Duration `default:"2160h" usage:"Keep the notes of projects gone from Gitlab this long, 0 keeps them forever"`
+	}
+
+	PruneEmptyDirs bool `flag:"prune-empty-dirs" usage:"Remove directories left empty after deleting projects"`
+
+	LogFile     string `flag:"log-file" usage:"Write the full output of every task to this file"`
+	Metrics     bool   `usage:"Print transfer durations and rates per host after the run"`
+	MetricsFile string `flag:"metrics-file" usage:"Write transfer durations and rates per host to this file as JSON"`
+
+	Events struct {
+		File    string `usage:"Append every decision and task outcome to this file as JSON lines"`
+		MaxSize int64  `default:"10485760" flag:"max-size" usage:"Rotate the events file once it is bigger than this many bytes, 0 disables rotation"`
+		Keep    int    `default:"3" usage:"Number of rotated events files to keep"`
+	}
+
+	Refresh   bool `usage:"Ignore the state cache and walk the whole local path"`
+	FetchOnly bool `flag:"fetch-only" usage:"Fetch instead of pull, leaving working trees untouched"`
+	Mirror    bool `usage:"Clone missing projects as bare mirrors, only used together with fetch-only"`
+	Wikis     bool `usage:"Also sync the wikis of projects, next to them as <project>.wiki"`
+	Repair    bool `usage:"Clone projects again whose pull failed because the repository is corrupted, moving the broken copy to the trash, needs the git binary with either backend"`
+
+	Prune             bool `usage:"Remove remote-tracking branches deleted on Gitlab when pulling, and tags when fetching"`
+	RemoteBranchLimit int  `default:"200" flag:"remote-branch-limit" usage:"List projects with more remote-tracking branches than this after the run, 0 disables it"`
+
+	FixRemotes  bool `flag:"fix-remotes" usage:"Point origins still at an old host or protocol at the clone url from Gitlab, such projects are skipped otherwise"`
+	DetectMoves bool `flag:"detect-moves" usage:"Move local copies of projects moved or renamed on Gitlab to their new path, instead of cloning them again and asking to delete the old copy"`
+
+	VerifyDefaultBranch bool `flag:"verify-default-branch" usage:"Ask origin for the default branch of projects on another branch before skipping them, Gitlab can report an outdated one"`
+	CleanPartial        bool `default:"true" flag:"clean-partial" usage:"Remove what's left of interrupted clones before cloning again, directories with other content are never touched"`
+
+	Watch time.Duration `usage:"Sync again after this long until interrupted, 0 syncs once"`
+
+	Lock struct {
+		Remote   bool          `usage:"Hold a lock in a Gitlab project while syncing, so machines syncing the same group take turns"`
+		Project  string        `usage:"Path of the Gitlab project keeping the lock file, it needs at least one commit"`
+		File     string        `default:"gls.lock" usage:"Path of the lock file in that project"`
+		Lease    time.Duration `default:"10m" usage:"How long the lock is held without renewal, others take it over once it expired"`
+		Required bool          `usage:"Don't sync when the lock can't be reached, instead of warning and syncing without it"`
+	}
+
+	ForceUnlock bool `flag:"force-unlock" usage:"Remove the lock of another gls run on the local path, after it crashed without releasing it"`
+
+	DryRun bool   `flag:"dry-run" usage:"Only print the plan, nothing is cloned, pulled or deleted"`
+	Record string `usage:"Save the Gitlab listing and the local projects into this directory, to plan with them again later"`
+	Replay string `usage:"Plan with the listing and local projects recorded in this directory instead of asking Gitlab, only with dry-run"`
+
+	GroupBySubgroup bool   `flag:"group-by-subgroup" usage:"Group the progress and failures by the first path segment of the projects"`
+	Diagnostics     bool   `usage:"Print how listing Gitlab went: requests, peak concurrency, queue waits and group latencies"`
+	Lang            string `usage:"Language of the output, e.g. de, english is used for anything not translated"`
+	Profile         string `usage:"Use the keys of this profile in the config file, e.g. WORK_GITLAB_URL for profile work, over the plain ones"`
+
+	Interactive        bool `usage:"Review and adjust the plan before anything is executed"`
+	FollowInstanceMove bool `flag:"follow-instance-move" usage:"When Gitlab redirects to a new host, move clone urls and local origins there too"`
+}
+
+func configPath() string {
+	homedir, err := os.UserHomeDir()
+	if err != nil {
+		log.Fatalf("Error getting homedir: %v", err)
+	}
+	return filepath.Join(homedir, ".gls")
+}
+
+// trashPath is where removed repositories are moved to, outside of the local path so they aren't synced
+func trashPath() string {
+	homedir, err := os.UserHomeDir()
+	if err != nil {
+		log.Fatalf("Error getting homedir: %v", err)
+	}
+	return filepath.Join(homedir, ".gls-trash")
+}
+
+func loadConfig(args []string) Config {
+	homedir, err := os.UserHomeDir()
+	if err != nil {
+		log.Fatalf("Error getting homedir: %v", err)
+	}
+
+	// The file is only read once the flags are parsed, as they may select a profile in it
+	fileDecoder := &configFileDecoder{}
+
+	var cfg Config
+	loader := aconfig.LoaderFor(&cfg, aconfig.Config{
+		EnvPrefix:     "GLS",
+		FlagDelimiter: "-",
+		Args:          args,
+
+		Files: []string{configPath()},
+		FileDecoders: map[string]aconfig.FileDecoder{
+			".gls": fileDecoder,
+		},
+	})
+
+	flags := loader.Flags()
+	boolFlags(loader, flags)
+	helpFlag := flags.Bool("help", false, "Display help message")
+	showConfigFlag := flags.Bool("show-config", false, "Print every config value and where it came from")
+
+	err = flags.Parse(args)
+	if err != nil {
+		log.Fatalf("Error parsing flags: %v", err)
+	}
+
+	if *helpFlag {
+		println(renderHelp())
+		os.Exit(0)
+	}
+
+	profile := flags.Lookup("profile").Value.String()
+	if profile == "" {
+		profile = os.Getenv("GLS_PROFILE")
+	}
+	fileDecoder.values, err = readConfigFile(configPath(), profile)
+	if err != nil {
+		log.Fatalf("Error loading config: %v", err)
+	}
+
+	err = loader.Load()
+	if err != nil {
+		log.Fatalf("Error loading config: %v", err)
+	}
+
+	setLang(cfg.Lang)
+
+	sources := configSources(flags, fileDecoder.values)
+	protectTokenFlag(&cfg, sources)
+
+	source, err := gitlab.ParseSource(cfg.Gitlab.Source)
+	if err != nil {
+		log.Fatalf("Error loading config: %v", err)
+	}
+	if source.Group() && cfg.Gitlab.Group == "" {
+		log.Fatalf("Error loading config: the gitlab group is required, set GLS_GITLAB_GROUP or pick another gitlab source")
+	}
+	for _, host := range cfg.Git.AllowedHosts {
+		if _, err := git.ParseAllowedHost(host); err != nil {
+			log.Fatalf("Error loading config: allowed hosts: %v", err)
+		}
+	}
+
+	if cfg.NoRecursive {
+		cfg.Depth = 0
+	}
+
+	cfg.Local.Path = expandHome(homedir, cfg.Local.Path)
+	cfg.LogFile = expandHome(homedir, cfg.LogFile)
+	cfg.MetricsFile = expandHome(homedir, cfg.MetricsFile)
+	cfg.Events.File = expandHome(homedir, cfg.Events.File)
+	cfg.Git.SshKey = expandHome(homedir, cfg.Git.SshKey)
+	cfg.Record = expandHome(homedir, cfg.Record)
+	cfg.Replay = expandHome(homedir, cfg.Replay)
+
+	if *showConfigFlag {
+		println(showConfig(cfg, sources))
+		os.Exit(0)
+	}
+
+	return cfg
+}
+
+// readConfigFile reads the config file, migrates it to the current version in memory and drops unknown keys.
+// The keys of profile replace the plain ones, without a profile the PROFILE key of the file picks one
+func readConfigFile(path string, profile string) (map[string]string, error) {
+	values, err := godotenv.Read(path)
+	if os.IsNotExist(err) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	values, version, err := migrateConfig(values)
+	if err != nil {
+		return nil, err
+	}
+	if version < currentConfigVersion {
+		println(text.FgYellow.Sprint(msg("config.migrated_in_memory", path, version)))
+	}
+
+	profiles := splitProfiles(values)
+	if profile == "" {
+		profile = values[profileKey]
+	}
+	if profile != "" {
+		err = applyProfile(values, profiles, profile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, warning := range unknownConfigKeys(values) {
+		println(text.FgYellow.Sprint(warning))
+	}
+
+	return values, nil
+}
+
+// configFileDecoder hands aconfig the values of the config file after readConfigFile prepared them
+type configFileDecoder struct {
+	values map[string]string
+}
+
+func (d *configFileDecoder) Format() string {
+	return "env"
+}
+
+func (d *configFileDecoder) DecodeFile(string) (map[string]any, error) {
+	values := make(map[string]any, len(d.values))
+	for key, value := range d.values {
+		values[key] = value
+	}
+	return values, nil
+}
+
+func expandHome(homedir string, path string) string {
+	if strings.HasPrefix(path, "~/") {
+		path = filepath.Join(homedir, path[2:])
+	}
+	return path
+}
+
+// aconfig registers every field as a string flag, so "--refresh" alone would complain about a missing value
+type boolFlag struct {
+	flag.Value
+}
+
+func (f *boolFlag) String() string {
+	if f.Value == nil {
+		return "" // zero value created by PrintDefaults
+	}
+	return f.Value.String()
+}
+
+func (f *boolFlag) IsBoolFlag() bool {
+	return true
+}
+
+func boolFlags(loader *aconfig.Loader, flags *flag.FlagSet) {
+	loader.WalkFields(func(field aconfig.Field) bool {
+		if configFieldType(field).Kind() != reflect.Bool {
+			return true
+		}
+
+		if f := flags.Lookup(flagName(field)); f != nil {
+			f.Value = &boolFlag{f.Value}
+		}
+		return true
+	})
+}
+
+// configFieldType is the type of the Config field behind an aconfig field
+func configFieldType(field aconfig.Field) reflect.Type {
+	fieldType := reflect.TypeOf(Config{})
+	for _, name := range strings.Split(field.Name(), ".") {
+		structField, _ := fieldType.FieldByName(name)
+		fieldType = structField.Type
+	}
+	return fieldType
+}
+
+// flagName is the flag aconfig registers for a field, nested ones are prefixed with the flags of their parents
+func flagName(field aconfig.Field) string {
+	name := field.Tag("flag")
+	for parent, ok := field.Parent(); ok; parent, ok = parent.Parent() {
+		name = parent.Tag("flag") + "-" + name
+	}
+	return name
+}
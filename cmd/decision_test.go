@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bufio"
+	"gls/pkg/git"
+	"gls/pkg/gitlab"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestDecisionBuckets plans a single project the way a sync would and checks what the user decided ends up where the
+// task list, the events and the summary look for it
+func TestDecisionBuckets(t *testing.T) {
+	local := []*git.Project{{Path: "acme/old", Branch: "main"}}
+	frozen := []*gitlab.Project{{Path: "acme/old", DefaultBranch: "main", CloneUrl: "git@gitlab.example.com:acme/old.git", Topics: []string{"frozen"}}}
+
+	tests := []struct {
+		name        string
+		gitlab      []*gitlab.Project
+		interactive bool
+		stale       bool
+		input       string                          // answered at the prompt
+		after       func(*testing.T, *InternalTask) // what happens between planning and running
+		decision    Decision
+		skipped     bool
+		message     string // key of the message shown for the task
+		declined    bool   // listed in the summary as declined
+	}{
+		{
+			name:     "prompt yes",
+			input:    "y\n",
+			decision: DecisionYes,
+			message:  "action.delete",
+		},
+		{
+			name:     "prompt no",
+			input:    "no\n",
+			decision: DecisionNo,
+			skipped:  true,
+			message:  "action.declined_delete",
+			declined: true,
+		},
+		{
+			name:     "prompt asked again",
+			input:    "maybe\n\nN\n",
+			decision: DecisionNo,
+			skipped:  true,
+			message:  "action.declined_delete",
+			declined: true,
+		},
+		{
+			name:        "review kept",
+			interactive: true,
+			after: func(t *testing.T, task *InternalTask) {
+				if err := toggleTasks([]*InternalTask{task}, "1"); err != nil {
+					t.Fatal(err)
+				}
+				recordReviewDecisions([]*InternalTask{task})
+			},
+			decision: DecisionReviewYes,
+			message:  "action.delete",
+		},
+		{
+			name:        "review unchecked",
+			interactive: true,
+			after: func(t *testing.T, task *InternalTask) {
+				recordReviewDecisions([]*InternalTask{task})
+			},
+			decision: DecisionReviewNo,
+			skipped:  true,
+			message:  "action.declined_delete",
+			declined: true,
+		},
+		{
+			name:        "not reviewed",
+			interactive: true,
+			skipped:     true,
+			message:     "action.skipped_delete",
+		},
+		{
+			name:  "policy skipped",
+			input: "y\n",
+			after: func(t *testing.T, task *InternalTask) {
+				planned := []*PolicyTask{policyTask(task, nil)}
+				response := &PolicyResponse{Tasks: []*PolicyTask{policyTask(task, nil)}}
+				response.Tasks[0].Skipped, response.Tasks[0].Reason = true, "frozen"
+				if _, err := applyPolicy([]*InternalTask{task}, planned, response); err != nil {
+					t.Fatal(err)
+				}
+			},
+			decision: DecisionYes,
+			skipped:  true,
+			message:  "action.ignored",
+		},
+		{
+			name:        "stale listing in the review",
+			interactive: true,
+			stale:       true,
+			after: func(t *testing.T, task *InternalTask) {
+				// Checking it in the review leaves it skipped
+				if err := toggleTasks([]*InternalTask{task}, "1"); err != nil {
+					t.Fatal(err)
+				}
+				recordReviewDecisions([]*InternalTask{task})
+			},
+			skipped: true,
+			message: "action.ignored",
+		},
+		{
+			name:    "ignore skipped",
+			gitlab:  frozen,
+			skipped: true,
+			message: "action.ignored",
+		},
+		{
+			name:        "ignore skipped in the review",
+			gitlab:      frozen,
+			interactive: true,
+			after: func(t *testing.T, task *InternalTask) {
+				recordReviewDecisions([]*InternalTask{task})
+			},
+			skipped: true,
+			message: "action.ignored",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			input := stdin
+			stdin = bufio.NewReader(strings.NewReader(test.input))
+			t.Cleanup(func() {
+				stdin = input
+			})
+
+			var cfg Config
+			cfg.Interactive = test.interactive
+			cfg.Gitlab.ExcludeTopics = []string{"frozen"}
+			tasks := planTasks(test.gitlab, local, nil, nil, nil, nil, nil, test.stale, cfg)
+			if len(tasks) != 1 {
+				t.Fatalf("planned %d tasks", len(tasks))
+			}
+			task := tasks[0]
+			if test.after != nil {
+				test.after(t, task)
+			}
+
+			if task.Decision != test.decision || task.Skipped != test.skipped {
+				t.Errorf("got decision %q, skipped %v, want %q, %v", task.Decision, task.Skipped, test.decision, test.skipped)
+			}
+			want := msg(test.message)
+			if task.Ignored != "" {
+				want = msg(test.message, task.Ignored)
+			}
+			if got := task.Message(); got != want {
+				t.Errorf("shown as %q, want %q", got, want)
+			}
+			if declined := slices.Contains(declinedTasks(tasks), "acme/old"); declined != test.declined {
+				t.Errorf("declined in the summary: %v, want %v", declined, test.declined)
+			}
+			if rest, err := stdin.ReadString('\n'); rest != "" || err == nil {
+				t.Errorf("input left unread: %q", rest)
+			}
+		})
+	}
+}
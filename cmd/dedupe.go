@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/jedib0t/go-pretty/v6/progress"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"gls/pkg/git"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type LocalRepo struct {
+	Path        string
+	Fingerprint *git.Fingerprint
+	Managed     bool // lives at the path gls would clone its origin to
+}
+
+type DuplicateGroup struct {
+	Origin string
+	Repos  []*LocalRepo
+}
+
+// groupDuplicates finds repositories cloned from the same origin, and pairs of repositories from different origins
+// sharing commits. The latter are most likely forks and only ever reported
+func groupDuplicates(repos []*LocalRepo) ([]*DuplicateGroup, [][2]*LocalRepo) {
+	byOrigin := make(map[string][]*LocalRepo)
+	byTip := make(map[string][]*LocalRepo)
+	for _, repo := range repos {
+		if repo.Fingerprint.Origin != "" {
+			byOrigin[repo.Fingerprint.Origin] = append(byOrigin[repo.Fingerprint.Origin], repo)
+		}
+		for _, tip := range repo.Fingerprint.Tips {
+			byTip[tip] = append(byTip[tip], repo)
+		}
+	}
+
+	var duplicates []*DuplicateGroup
+	for origin, repos := range byOrigin {
+		if len(repos) > 1 {
+			duplicates = append(duplicates, &DuplicateGroup{Origin: origin, Repos: repos})
+		}
+	}
+	sort.Slice(duplicates, func(i, j int) bool {
+		return duplicates[i].Origin < duplicates[j].Origin
+	})
+
+	seen := make(map[[2]string]bool)
+	var forks [][2]*LocalRepo
+	for _, repos := range byTip {
+		for i, a := range repos {
+			for _, b := range repos[i+1:] {
+				if a.Fingerprint.Origin == b.Fingerprint.Origin && a.Fingerprint.Origin != "" {
+					continue // a plain duplicate
+				}
+
+				pair := [2]*LocalRepo{a, b}
+				if a.Path > b.Path {
+					pair = [2]*LocalRepo{b, a}
+				}
+				key := [2]string{pair[0].Path, pair[1].Path}
+				if !seen[key] {
+					seen[key] = true
+					forks = append(forks, pair)
+				}
+			}
+		}
+	}
+	sort.Slice(forks, func(i, j int) bool {
+		return forks[i][0].Path+forks[i][1].Path < forks[j][0].Path+forks[j][1].Path
+	})
+
+	return duplicates, forks
+}
+
+// isManaged reports whether a repository lives where gls would clone its origin to
+func isManaged(repo *LocalRepo, groupPath string) bool {
+	managedPath := strings.ToLower(filepath.ToSlash(repo.Path))
+	if groupPath != "" {
+		managedPath = strings.ToLower(groupPath) + "/" + managedPath
+	}
+	return strings.HasSuffix(repo.Fingerprint.Origin, "/"+managedPath)
+}
+
+func runDedupe(args []string) {
+	resolve := false
+	var rest []string
+	for _, arg := range args {
+		switch arg {
+		case "--report":
+		case "--resolve":
+			resolve = true
+		default:
+			rest = append(rest, arg)
+		}
+	}
+
+	cfg := loadConfig(rest)
+
+	println(text.FgCyan.Sprint(msg("sync.loading_local", cfg.Local.Path)))
+	projects, err := git.GetLocalProjects(cfg.Local.Path, nil, cfg.Workers)
+	if err != nil {
+		log.Fatalf("Error getting local projects: %v", err)
+	}
+	projects, _ = splitBroken(projects)
+
+	var repos []*LocalRepo
+	for _, project := range projects {
+		fingerprint, err := git.GetFingerprint(filepath.Join(cfg.Local.Path, project.Path))
+		if err != nil {
+			println(text.FgYellow.Sprint(msg("dedupe.skipping", project.Path, err)))
+			continue
+		}
+
+		repo := &LocalRepo{Path: project.Path, Fingerprint: fingerprint}
+		repo.Managed = isManaged(repo, pathRoot(cfg))
+		repos = append(repos, repo)
+	}
+
+	duplicates, forks := groupDuplicates(repos)
+	if len(duplicates) == 0 && len(forks) == 0 {
+		println(text.FgCyan.Sprint(msg("dedupe.none_found")))
+		return
+	}
+
+	for _, group := range duplicates {
+		println(text.FgHiGreen.Sprint("\n" + msg("dedupe.cloned_times", group.Origin, len(group.Repos))))
+		for _, repo := range group.Repos {
+			println(describeRepo(cfg.Local.Path, repo))
+		}
+	}
+
+	if len(forks) > 0 {
+		println(text.FgHiGreen.Sprint("\n" + msg("dedupe.possible_forks")))
+		for _, pair := range forks {
+			println("  " + msg("dedupe.fork_pair", pair[0].Path, pair[1].Path))
+		}
+	}
+
+	if resolve {
+		resolveDuplicates(cfg, duplicates)
+	}
+}
+
+func describeRepo(localPath string, repo *LocalRepo) string {
+	size, err := git.Size(filepath.Join(localPath, repo.Path))
+	description := fmt.Sprintf("  %s  %s", repo.Path, progress.FormatBytes(size))
+	if err != nil {
+		description = fmt.Sprintf("  %s  %s", repo.Path, msg("dedupe.size_unknown"))
+	}
+	if repo.Managed {
+		description += text.FgCyan.Sprint("  " + msg("dedupe.managed"))
+	}
+	return description
+}
+
+// resolveDuplicates offers to trash the unmanaged copies of every duplicate with exactly one managed copy.
+// Copies with work that exists nowhere else are kept
+func resolveDuplicates(cfg Config, duplicates []*DuplicateGroup) {
+	println()
+	for _, group := range duplicates {
+		managed := 0
+		for _, repo := range group.Repos {
+			if repo.Managed {
+				managed++
+			}
+		}
+		if managed != 1 {
+			println(text.FgYellow.Sprint(msg("dedupe.keeping_all", group.Origin, managed)))
+			continue
+		}
+
+		for _, repo := range group.Repos {
+			if repo.Managed {
+				continue
+			}
+
+			path := filepath.Join(cfg.Local.Path, repo.Path)
+			work, err := git.UnpushedWork(withGitBackend(context.Background(), cfg), path)
+			if err != nil {
+				println(text.FgHiRed.Sprint(msg("dedupe.check_failed", repo.Path, err)))
+				continue
+			}
+			if len(work) > 0 {
+				println(text.FgYellow.Sprint(msg("dedupe.unpushed_work", repo.Path, strings.Join(work, ", "))))
+				continue
+			}
+
+			if !askForConfirmation(text.FgMagenta.Sprint(msg("dedupe.confirm_trash", repo.Path))) {
+				continue
+			}
+
+			target, err := git.TrashProject(trashPath(), path)
+			if err != nil {
+				println(text.FgHiRed.Sprint(msg("dedupe.trash_failed", repo.Path, err)))
+				continue
+			}
+			println(text.FgCyan.Sprint(msg("dedupe.trashed", repo.Path, target)))
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"gls/pkg/git"
+	"slices"
+	"testing"
+)
+
+func TestGroupDuplicates(t *testing.T) {
+	repo := func(path string, origin string, tips ...string) *LocalRepo {
+		return &LocalRepo{Path: path, Fingerprint: &git.Fingerprint{Origin: origin, Tips: tips}}
+	}
+
+	tests := []struct {
+		name       string
+		repos      []*LocalRepo
+		duplicates []string // origin: paths
+		forks      []string // path+path
+	}{
+		{name: "distinct", repos: []*LocalRepo{
+			repo("api", "gitlab.example.com/acme/api", "a1"),
+			repo("web", "gitlab.example.com/acme/web", "b1"),
+		}},
+		{name: "same origin", repos: []*LocalRepo{
+			repo("api", "gitlab.example.com/acme/api", "a1"),
+			repo("old/api", "gitlab.example.com/acme/api", "a0"),
+			repo("copy/api", "gitlab.example.com/acme/api", "a1", "a2"),
+		}, duplicates: []string{"gitlab.example.com/acme/api: api old/api copy/api"}},
+		{name: "shared commit from another origin", repos: []*LocalRepo{
+			repo("api", "gitlab.example.com/acme/api", "a1", "a2"),
+			repo("fork", "github.com/someone/api", "a2", "f1"),
+		}, forks: []string{"api+fork"}},
+		{name: "without origin", repos: []*LocalRepo{
+			repo("scratch", "", "a1"),
+			repo("scratch2", "", "a1"),
+			repo("api", "gitlab.example.com/acme/api", "a1"),
+		}, forks: []string{"api+scratch", "api+scratch2", "scratch+scratch2"}},
+		{name: "pair reported once", repos: []*LocalRepo{
+			repo("b", "gitlab.example.com/acme/b", "x", "y"),
+			repo("a", "gitlab.example.com/acme/a", "x", "y"),
+		}, forks: []string{"a+b"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			duplicates, forks := groupDuplicates(test.repos)
+
+			var gotDuplicates, gotForks []string
+			for _, group := range duplicates {
+				line := group.Origin + ":"
+				for _, repo := range group.Repos {
+					line += " " + repo.Path
+				}
+				gotDuplicates = append(gotDuplicates, line)
+			}
+			for _, fork := range forks {
+				gotForks = append(gotForks, fork[0].Path+"+"+fork[1].Path)
+			}
+			if !slices.Equal(gotDuplicates, test.duplicates) || !slices.Equal(gotForks, test.forks) {
+				t.Errorf("got %q and forks %q, want %q and %q", gotDuplicates, gotForks, test.duplicates, test.forks)
+			}
+		})
+	}
+}
+
+func TestIsManaged(t *testing.T) {
+	tests := []struct {
+		path    string
+		group   string
+		origin  string
+		managed bool
+	}{
+		{path: "team/api", group: "acme", origin: "gitlab.example.com/acme/team/api", managed: true},
+		{path: "Team/API", group: "ACME", origin: "gitlab.example.com/acme/team/api", managed: true},
+		{path: "api", group: "acme", origin: "gitlab.example.com/acme/team/api"},
+		{path: "copy/team/api", group: "acme", origin: "gitlab.example.com/acme/team/api"},
+		{path: "acme/api", origin: "gitlab.example.com/acme/api", managed: true},
+		{path: "api", group: "acme", origin: ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.path+" in "+test.group, func(t *testing.T) {
+			repo := &LocalRepo{Path: test.path, Fingerprint: &git.Fingerprint{Origin: test.origin}}
+			if managed := isManaged(repo, test.group); managed != test.managed {
+				t.Errorf("got %t for origin %s", managed, test.origin)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"gls/pkg/gitlab"
+	"time"
+)
+
+// printDiagnostics shows how the listing went after --diagnostics, and keeps the same numbers in the log file
+func printDiagnostics(d *gitlab.ListDiagnostics, logFile *LogFile) {
+	if d == nil {
+		return
+	}
+
+	limit := msg("diagnostics.unlimited")
+	if d.Limit > 0 {
+		limit = fmt.Sprint(d.Limit)
+	}
+
+	println(text.FgMagenta.Sprint(msg("diagnostics.header")))
+	println(msg("diagnostics.requests", d.Requests.Load(), d.PeakInFlight.Load(), limit))
+	println(msg("diagnostics.goroutines", d.Goroutines.Load()))
+	println(msg("diagnostics.queue_wait", describeLatency(&d.QueueWait)))
+	println(msg("diagnostics.group_latency", describeLatency(&d.GroupLatency), d.SlowestGroup()))
+
+	if logFile != nil {
+		logFile.Line(fmt.Sprintf("[gls] listing: requests=%d peak=%d limit=%d goroutines=%d", d.Requests.Load(), d.PeakInFlight.Load(), d.Limit, d.Goroutines.Load()))
+		logFile.Line(fmt.Sprintf("[gls] listing queue wait: %s", describeLatency(&d.QueueWait)))
+		logFile.Line(fmt.Sprintf("[gls] listing group latency: %s, slowest %s", describeLatency(&d.GroupLatency), d.SlowestGroup()))
+	}
+}
+
+// describeLatency shows the median, 95th percentile and maximum, the percentiles are bucket bounds
+func describeLatency(h *gitlab.Histogram) string {
+	return fmt.Sprintf("p50 ≤%s p95 ≤%s max %s", h.Quantile(0.5), h.Quantile(0.95), h.Max().Round(time.Millisecond))
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/jedib0t/go-pretty/v6/progress"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"gls/pkg/gitlab"
+	"gls/pkg/storage"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// failingProjects is how many of the projects that failed most often the digest lists
+const failingProjects = 10
+
+// Inventory is what a complete listing found, kept in the events so digests can tell how it changed
+type Inventory struct {
+	Time      time.Time `json:"time"`
+	Projects  int       `json:"projects"`
+	Size      int64     `json:"size"` // of the projects whose size Gitlab shares
+	Stale     int       `json:"stale"`
+	VeryStale int       `json:"very_stale"`
+}
+
+func takeInventory(projects []*gitlab.Project, now time.Time) *Inventory {
+	inventory := &Inventory{Time: now, Projects: len(projects)}
+	for _, project := range projects {
+		inventory.Size += project.Size
+	}
+	inventory.Stale, inventory.VeryStale = staleCounts(projects, now)
+	return inventory
+}
+
+// Digest sums up the runs recorded in the events file over a period
+type Digest struct {
+	Since      time.Time
+	Until      time.Time
+	Runs       int
+	Cycles     int
+	Cloned     []string
+	Deleted    []string
+	Days       []*DayFailures
+	Failing    []*ProjectFailures
+	First      *Inventory // the earliest and latest inventory of the period, nil without any
+	Last       *Inventory
+	Unreadable int // lines of the events file that weren't events
+}
+
+type DayFailures struct {
+	Day    string
+	Tasks  int
+	Failed int
+}
+
+type ProjectFailures struct {
+	Project   string
+	Failures  int
+	LastError string
+}
+
+// runDigest writes a Markdown digest of the runs recorded in the events file, for pasting into a wiki.
+// Nothing is asked of Gitlab, everything comes from the events file and its rotated predecessors
+func runDigest(args []string) {
+	flags := flag.NewFlagSet("gls digest", flag.ExitOnError)
+	since := flags.String("since", "7d", "Sum up this far back, in days like 7d or as duration like 36h")
+	out := flags.String("out", "", "Write the digest to this file instead of stdout")
+	eventsFile := flags.String("events-file", "", "The events file to read, EVENTS_FILE of the config by default")
+	_ = flags.Parse(args)
+
+	period, err := parseSince(*since)
+	if err != nil {
+		log.Fatalf("Error in --since: %v", err)
+	}
+
+	path := *eventsFile
+	if path == "" {
+		path = configuredEventsFile()
+	}
+	if path == "" {
+		log.Fatalf("The digest is made from the events file, set EVENTS_FILE or pass --events-file")
+	}
+	homedir, _ := os.UserHomeDir()
+	path = expandHome(homedir, path)
+
+	events, unreadable, err := readEvents(path)
+	if err != nil {
+		log.Fatalf("Error reading events: %v", err)
+	}
+
+	until := time.Now()
+	digest := aggregateDigest(events, until.Add(-period), until)
+	digest.Unreadable = unreadable
+	content := renderDigest(digest)
+
+	if *out == "" {
+		fmt.Print(content)
+		return
+	}
+	err = storage.WriteFile(*out, []byte(content), 0644)
+	if err != nil {
+		log.Fatalf("Error writing digest: %v", err)
+	}
+	println(text.FgCyan.Sprint(msg("digest.written", *out, path)))
+}
+
+// configuredEventsFile is the events file of the environment or the config file, without loading the whole
+// config, which would insist on a token the digest doesn't need
+func configuredEventsFile() string {
+	if path := os.Getenv("GLS_EVENTS_FILE"); path != "" {
+		return path
+	}
+	values, err := readConfigFile(configPath(), os.Getenv("GLS_PROFILE"))
+	if err != nil {
+		return ""
+	}
+	return values["EVENTS_FILE"]
+}
+
+// parseSince reads a period given in days, like 7d, or as duration, like 36h
+func parseSince(value string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		count, err := strconv.Atoi(days)
+		if err != nil || count <= 0 {
+			return 0, fmt.Errorf("%q is no number of days", value)
+		}
+		return time.Duration(count) * 24 * time.Hour, nil
+	}
+	period, err := time.ParseDuration(value)
+	if err == nil && period <= 0 {
+		err = fmt.Errorf("%q isn't positive", value)
+	}
+	return period, err
+}
+
+// readEvents reads the events file and the rotated ones next to it, oldest first. Lines that aren't events,
+// e.g. cut off by a crash, are counted and skipped
+func readEvents(path string) ([]*Event, int, error) {
+	var paths []string
+	for i := 1; ; i++ {
+		if _, err := os.Stat(rotatedPath(path, i)); err != nil {
+			break
+		}
+		paths = append([]string{rotatedPath(path, i)}, paths...)
+	}
+	paths = append(paths, path)
+
+	var events []*Event
+	unreadable := 0
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		for scanner.Scan() {
+			var event Event
+			if json.Unmarshal(scanner.Bytes(), &event) != nil {
+				unreadable++
+				continue
+			}
+			events = append(events, &event)
+		}
+		err = scanner.Err()
+		_ = file.Close()
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+	return events, unreadable, nil
+}
+
+// aggregateDigest sums up the events from since until until. Days are those of the events' own time zone
+func aggregateDigest(events []*Event, since time.Time, until time.Time) *Digest {
+	digest := &Digest{Since: since, Until: until}
+
+	runs := make(map[string]bool)
+	cloned := make(map[string]bool)
+	deleted := make(map[string]bool)
+	days := make(map[string]*DayFailures)
+	failing := make(map[string]*ProjectFailures)
+
+	for _, event := range events {
+		if event.Time.Before(since) || event.Time.After(until) {
+			continue
+		}
+
+		switch event.Type {
+		case EventCycleFinished:
+			runs[event.Run] = true
+			digest.Cycles++
+			if event.Inventory != nil {
+				if digest.First == nil || event.Inventory.Time.Before(digest.First.Time) {
+					digest.First = event.Inventory
+				}
+				if digest.Last == nil || !event.Inventory.Time.Before(digest.Last.Time) {
+					digest.Last = event.Inventory
+				}
+			}
+
+		case EventTaskFinished:
+			day := days[event.Time.Format(time.DateOnly)]
+			if day == nil {
+				day = &DayFailures{Day: event.Time.Format(time.DateOnly)}
+				days[day.Day] = day
+			}
+			day.Tasks++
+
+			if event.Error != "" {
+				day.Failed++
+				project := failing[event.Project]
+				if project == nil {
+					project = &ProjectFailures{Project: event.Project}
+					failing[event.Project] = project
+				}
+				project.Failures++
+				project.LastError = event.Error
+				continue
+			}
+
+			switch event.Action {
+			case Clone:
+				cloned[event.Project] = true
+			case Delete:
+				deleted[event.Project] = true
+			}
+		}
+	}
+
+	digest.Runs = len(runs)
+	digest.Cloned = sortedKeys(cloned)
+	digest.Deleted = sortedKeys(deleted)
+	for _, day := range days {
+		digest.Days = append(digest.Days, day)
+	}
+	sort.Slice(digest.Days, func(i, j int) bool {
+		return digest.Days[i].Day < digest.Days[j].Day
+	})
+	for _, project := range failing {
+		digest.Failing = append(digest.Failing, project)
+	}
+	sort.Slice(digest.Failing, func(i, j int) bool {
+		if digest.Failing[i].Failures != digest.Failing[j].Failures {
+			return digest.Failing[i].Failures > digest.Failing[j].Failures
+		}
+		return digest.Failing[i].Project < digest.Failing[j].Project
+	})
+	digest.Failing = digest.Failing[:min(len(digest.Failing), failingProjects)]
+	return digest
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// renderDigest writes the digest as Markdown. The same digest always renders the same
+func renderDigest(d *Digest) string {
+	var b strings.Builder
+	line := func(format string, args ...any) {
+		b.WriteString(fmt.Sprintf(format, args...) + "\n")
+	}
+
+	line("# %s", msg("digest.title", d.Since.Format(time.DateOnly), d.Until.Format(time.DateOnly)))
+	line("")
+	line("%s", msg("digest.runs", d.Runs, d.Cycles))
+	if d.Unreadable > 0 {
+		line("")
+		line("%s", msg("digest.unreadable", d.Unreadable))
+	}
+
+	for _, list := range []struct {
+		title    string
+		projects []string
+	}{
+		{msg("digest.cloned", len(d.Cloned)), d.Cloned},
+		{msg("digest.deleted", len(d.Deleted)), d.Deleted},
+	} {
+		line("")
+		line("## %s", list.title)
+		line("")
+		if len(list.projects) == 0 {
+			line("%s", msg("digest.none"))
+		}
+		for _, project := range list.projects {
+			line("- `%s`", project)
+		}
+	}
+
+	line("")
+	line("## %s", msg("digest.failures"))
+	line("")
+	if len(d.Days) == 0 {
+		line("%s", msg("digest.no_tasks"))
+	} else {
+		line("| %s | %s | %s |", msg("digest.day"), msg("digest.tasks"), msg("digest.failed"))
+		line("|---|---:|---:|")
+		for _, day := range d.Days {
+			line("| %s | %d | %d |", day.Day, day.Tasks, day.Failed)
+		}
+	}
+	if len(d.Failing) > 0 {
+		line("")
+		line("%s", msg("digest.most_failing"))
+		line("")
+		line("| %s | %s | %s |", msg("header.project"), msg("digest.failed"), msg("digest.last_error"))
+		line("|---|---:|---|")
+		for _, project := range d.Failing {
+			line("| `%s` | %d | %s |", project.Project, project.Failures, markdownCell(project.LastError))
+		}
+	}
+
+	line("")
+	line("## %s", msg("digest.inventory"))
+	line("")
+	if d.First == nil {
+		line("%s", msg("digest.no_inventory"))
+		return b.String()
+	}
+	first, last := d.First, d.Last
+	line("| | %s | %s | %s |", first.Time.Format(time.DateOnly), last.Time.Format(time.DateOnly), msg("digest.change"))
+	line("|---|---:|---:|---:|")
+	line("| %s | %d | %d | %s |", msg("stats.total"), first.Projects, last.Projects, signed(int64(last.Projects-first.Projects), fmt.Sprint))
+	line("| %s | %d | %d | %s |", msg("stats.stale", int(staleAfter.Hours()/24)), first.Stale, last.Stale, signed(int64(last.Stale-first.Stale), fmt.Sprint))
+	line("| %s | %d | %d | %s |", msg("stats.stale", int(veryStaleAfter.Hours()/24)), first.VeryStale, last.VeryStale, signed(int64(last.VeryStale-first.VeryStale), fmt.Sprint))
+	line("| %s | %s | %s | %s |", msg("stats.size"), progress.FormatBytes(first.Size), progress.FormatBytes(last.Size), signed(last.Size-first.Size, func(a ...any) string {
+		return progress.FormatBytes(a[0].(int64))
+	}))
+	return b.String()
+}
+
+// signed shows a change with its sign, formatting its absolute value
+func signed(change int64, format func(...any) string) string {
+	switch {
+	case change > 0:
+		return "+" + format(change)
+	case change < 0:
+		return "-" + format(-change)
+	}
+	return "±0"
+}
+
+// markdownCell keeps an error on one line of a table and its pipes from ending the cell
+func markdownCell(value string) string {
+	value = strings.Join(strings.Fields(value), " ")
+	return strings.ReplaceAll(value, "|", `\|`)
+}
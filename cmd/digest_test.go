@@ -0,0 +1,74 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseSince(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+		err   bool
+	}{
+		{value: "7d", want: 7 * 24 * time.Hour},
+		{value: "1d", want: 24 * time.Hour},
+		{value: "36h", want: 36 * time.Hour},
+		{value: "90m", want: 90 * time.Minute},
+		{value: "0d", err: true},
+		{value: "-1d", err: true},
+		{value: "d", err: true},
+		{value: "1.5d", err: true},
+		{value: "0s", err: true},
+		{value: "-2h", err: true},
+		{value: "week", err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			got, err := parseSince(test.value)
+			if (err != nil) != test.err || got != test.want && !test.err {
+				t.Errorf("got %s, %v, want %s", got, err, test.want)
+			}
+		})
+	}
+}
+
+// TestRenderDigest sums up testdata/digest, whose events lie just inside and outside of the last 7 days before
+// 2026-03-08 12:00, partly in the rotated file and around a line cut off by a crash
+func TestRenderDigest(t *testing.T) {
+	events, unreadable, err := readEvents(filepath.Join("testdata", "digest", "events.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 12 || unreadable != 1 {
+		t.Fatalf("read %d events and %d unreadable lines", len(events), unreadable)
+	}
+
+	period, err := parseSince("7d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	until := time.Date(2026, 3, 8, 12, 0, 0, 0, time.UTC)
+
+	for _, lang := range []string{"en", "de"} {
+		t.Run(lang, func(t *testing.T) {
+			setLang(lang)
+			t.Cleanup(func() {
+				setLang(defaultLang)
+			})
+
+			digest := aggregateDigest(events, until.Add(-period), until)
+			digest.Unreadable = unreadable
+			golden(t, "digest-"+lang, renderDigest(digest))
+		})
+	}
+
+	// Both ends of the window are part of it
+	since, until := time.Date(2026, 3, 5, 8, 1, 0, 0, time.UTC), time.Date(2026, 3, 5, 9, 2, 0, 0, time.UTC)
+	digest := aggregateDigest(events, since, until)
+	if digest.Runs != 1 || digest.Cycles != 2 || len(digest.Deleted) != 0 || len(digest.Days) != 1 || digest.Days[0].Failed != 2 || digest.First != digest.Last {
+		t.Errorf("from %s until %s got %+v", since, until, digest)
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gls/pkg/gitlab"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Event is a single line of the events file. Fields are only ever added, so consumers can rely on them
+type Event struct {
+	Time    time.Time `json:"time"`
+	Run     string    `json:"run"`
+	Cycle   int       `json:"cycle"`
+	Type    string    `json:"type"`
+	Project string    `json:"project,omitempty"`
+	Action  Action    `json:"action,omitempty"`
+	Skipped bool      `json:"skipped,omitempty"`
+	Error   string    `json:"error,omitempty"`
+	Message string    `json:"message,omitempty"`
+
+	Orphan *gitlab.OrphanEvent `json:"orphan,omitempty"` // what happened on Gitlab to a project planned for deletion
+	Note   string              `json:"note,omitempty"`   // what the user noted about the project
+
+	Decision Decision `json:"decision,omitempty"` // what the user answered about a planned deletion, if asked
+
+	Duration time.Duration `json:"duration_ns,omitempty"` // how long a finished task ran
+	Bytes    int64         `json:"bytes,omitempty"`       // what a finished task received, as reported by git
+	Stats    *CycleStats   `json:"stats,omitempty"`       // only set when a cycle finished
+
+	Inventory *Inventory `json:"inventory,omitempty"` // only set when a cycle finished with a complete listing
+}
+
+const (
+	EventCycleStarted  = "cycle_started"
+	EventCycleFinished = "cycle_finished"
+	EventPlanned       = "planned"
+	EventTaskStarted   = "task_started"
+	EventTaskFinished  = "task_finished"
+	EventWarning       = "warning"
+	EventPolicySkipped = "policy_skipped"
+)
+
+// eventBuffer is how many events may queue up before the oldest ones are dropped
+const eventBuffer = 1024
+
+// EventWriter appends events as JSON lines to a file in the background, rotating it once it gets too big.
+// Emitting never blocks, when the writer can't keep up the oldest queued events are dropped.
+// All methods can be called on a nil EventWriter, which discards everything, events emitted after closing it
+// are discarded too
+type EventWriter struct {
+	Run string
+
+	path    string
+	maxSize int64
+	keep    int
+
+	cycle   atomic.Int64
+	events  chan *Event
+	dropped atomic.Int64
+	before  atomic.Int64 // dropped when the cycle started
+	done    sync.WaitGroup
+	mu      sync.RWMutex // held to send events, exclusively to close the channel
+	closed  bool
+
+	file        *os.File // nil when it couldn't be opened again after rotating
+	size        int64
+	unrotatable bool // rotating failed, the file grows past maxSize from then on
+}
+
+func OpenEventWriter(run string, path string, maxSize int64, keep int) (*EventWriter, error) {
+	w := &EventWriter{
+		Run:     run,
+		path:    path,
+		maxSize: maxSize,
+		keep:    keep,
+		events:  make(chan *Event, eventBuffer),
+	}
+
+	err := w.open()
+	if err != nil {
+		return nil, err
+	}
+
+	w.done.Add(1)
+	go w.write()
+	return w, nil
+}
+
+func newRunId() string {
+	id := make([]byte, 8)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// StartCycle begins a new cycle, every following event carries its number
+func (w *EventWriter) StartCycle(cycle int) {
+	if w == nil {
+		return
+	}
+	w.cycle.Store(int64(cycle))
+	w.before.Store(w.dropped.Load())
+	w.Emit(&Event{Type: EventCycleStarted})
+}
+
+// FinishCycle ends the cycle, stats is nil for cycles that didn't get to run any task and inventory for those
+// that didn't list Gitlab completely
+func (w *EventWriter) FinishCycle(stats *CycleStats, inventory *Inventory) {
+	w.Emit(&Event{Type: EventCycleFinished, Stats: stats, Inventory: inventory})
+}
+
+func (w *EventWriter) Warning(message string) {
+	w.Emit(&Event{Type: EventWarning, Message: message})
+}
+
+func (w *EventWriter) Emit(event *Event) {
+	if w == nil {
+		return
+	}
+
+	w.stamp(event)
+
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		return
+	}
+
+	for {
+		select {
+		case w.events <- event:
+			return
+		default:
+		}
+
+		// Full, make room by dropping the oldest event. Another goroutine may have emptied it meanwhile, so retry
+		select {
+		case <-w.events:
+			w.dropped.Add(1)
+		default:
+		}
+	}
+}
+
+func (w *EventWriter) stamp(event *Event) {
+	event.Time = time.Now()
+	event.Run = w.Run
+	event.Cycle = int(w.cycle.Load())
+}
+
+// Dropped returns how many events of the current cycle were lost because the writer couldn't keep up
+func (w *EventWriter) Dropped() int64 {
+	if w == nil {
+		return 0
+	}
+	return w.dropped.Load() - w.before.Load()
+}
+
+// Close writes all queued events and closes the file, closing it again does nothing
+func (w *EventWriter) Close() error {
+	if w == nil {
+		return nil
+	}
+
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	close(w.events)
+	w.mu.Unlock()
+
+	w.done.Wait()
+	if w.file == nil {
+		return nil
+	}
+	return w.file.Close()
+}
+
+func (w *EventWriter) write() {
+	defer w.done.Done()
+
+	for event := range w.events {
+		w.writeEvent(event)
+	}
+}
+
+func (w *EventWriter) writeEvent(event *Event) {
+	line, err := json.Marshal(event)
+	if err != nil {
+		w.dropped.Add(1)
+		return
+	}
+	line = append(line, '\n')
+
+	if w.maxSize > 0 && w.size > 0 && w.size+int64(len(line)) > w.maxSize && !w.unrotatable {
+		err = w.rotate()
+		if err != nil {
+			// Reported once and right away, the queue may be closed already. Trying again for every event would
+			// fail the same way
+			w.unrotatable = true
+			warning := &Event{Type: EventWarning, Message: msg("events.rotate_failed", err)}
+			w.stamp(warning)
+			w.writeEvent(warning)
+		}
+	}
+	if w.file == nil {
+		w.dropped.Add(1)
+		return
+	}
+
+	n, err := w.file.Write(line)
+	w.size += int64(n)
+	if err != nil {
+		w.dropped.Add(1)
+	}
+}
+
+func (w *EventWriter) open() error {
+	file, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	w.file = file
+	w.size = info.Size()
+	return nil
+}
+
+// rotate moves path to path.1, path.1 to path.2 and so on, dropping everything beyond keep. The file is opened
+// again even if moving it failed, so writing goes on
+func (w *EventWriter) rotate() error {
+	err := w.file.Close()
+	w.file = nil
+	if err == nil {
+		err = w.shift()
+	}
+
+	openErr := w.open()
+	if openErr != nil {
+		return errors.Join(err, openErr)
+	}
+	return err
+}
+
+func (w *EventWriter) shift() error {
+	_ = os.Remove(rotatedPath(w.path, w.keep))
+	for i := w.keep - 1; i >= 1; i-- {
+		_ = os.Rename(rotatedPath(w.path, i), rotatedPath(w.path, i+1))
+	}
+
+	if w.keep > 0 {
+		return os.Rename(w.path, rotatedPath(w.path, 1))
+	}
+	return os.Remove(w.path)
+}
+
+func rotatedPath(path string, i int) string {
+	return fmt.Sprintf("%s.%d", path, i)
+}
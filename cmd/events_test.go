@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// eventLines reads the events in path, failing the test on lines that aren't events
+func eventLines(t *testing.T, path string) []*Event {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var events []*Event
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var event Event
+		err := json.Unmarshal(scanner.Bytes(), &event)
+		if err != nil {
+			t.Fatalf("%s holds %q: %v", path, scanner.Text(), err)
+		}
+		events = append(events, &event)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return events
+}
+
+func TestEventRotation(t *testing.T) {
+	tests := []struct {
+		name    string
+		maxSize int64
+		keep    int
+		files   int // rotated files left
+	}{
+		{name: "unlimited", maxSize: 0, keep: 3},
+		{name: "keeps 1", maxSize: 1000, keep: 1, files: 1},
+		{name: "keeps 2", maxSize: 1000, keep: 2, files: 2},
+		{name: "keeps none", maxSize: 1000, keep: 0},
+		{name: "keeps more than there are", maxSize: 4000, keep: 10, files: 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "events.jsonl")
+			w, err := OpenEventWriter("run", path, test.maxSize, test.keep)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := range 100 {
+				w.Emit(&Event{Type: EventPlanned, Project: fmt.Sprintf("acme/project-%03d", i)})
+			}
+			err = w.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if w.Dropped() != 0 {
+				t.Fatalf("dropped %d events", w.Dropped())
+			}
+
+			// From the oldest rotated file to the current one, nothing is missing in between or written twice
+			var events []*Event
+			for i := test.keep; i >= 1; i-- {
+				rotated := rotatedPath(path, i)
+				if _, err := os.Stat(rotated); os.IsNotExist(err) {
+					if i <= test.files {
+						t.Errorf("%s is missing", rotated)
+					}
+					continue
+				}
+				if i > test.files {
+					t.Errorf("%s was kept", rotated)
+				}
+				events = append(events, eventLines(t, rotated)...)
+				if info, _ := os.Stat(rotated); test.maxSize > 0 && info.Size() > test.maxSize {
+					t.Errorf("%s grew to %d bytes", rotated, info.Size())
+				}
+			}
+			if _, err := os.Stat(rotatedPath(path, test.keep+1)); !os.IsNotExist(err) {
+				t.Errorf("more than %d rotated files were kept", test.keep)
+			}
+			events = append(events, eventLines(t, path)...)
+
+			if len(events) == 0 || events[len(events)-1].Project != "acme/project-099" {
+				t.Fatalf("the last event is missing from %d events", len(events))
+			}
+			first := 100 - len(events)
+			for i, event := range events {
+				if want := fmt.Sprintf("acme/project-%03d", first+i); event.Project != want || event.Run != "run" {
+					t.Fatalf("event %d is %s of run %s, want %s", i, event.Project, event.Run, want)
+				}
+			}
+			if test.files == 0 && test.maxSize == 0 && len(events) != 100 {
+				t.Errorf("got %d events without rotation", len(events))
+			}
+		})
+	}
+}
+
+// TestEventRotationFails blocks moving the file aside with a directory, which stops rotating even as root
+func TestEventRotationFails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	tree := filepath.Join(rotatedPath(path, 1), "blocked")
+	if err := os.MkdirAll(tree, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := OpenEventWriter("run", path, 1000, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 100 {
+		w.Emit(&Event{Type: EventPlanned, Project: fmt.Sprintf("acme/project-%03d", i)})
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if w.Dropped() != 0 {
+		t.Errorf("dropped %d events", w.Dropped())
+	}
+
+	// Every event is kept in the file that grew too big, the failure is reported among them once
+	var planned, warnings int
+	for _, event := range eventLines(t, path) {
+		switch event.Type {
+		case EventPlanned:
+			if want := fmt.Sprintf("acme/project-%03d", planned); event.Project != want {
+				t.Fatalf("event %d is %s, want %s", planned, event.Project, want)
+			}
+			planned++
+		case EventWarning:
+			if !strings.HasPrefix(event.Message, msg("events.rotate_failed", "")) {
+				t.Errorf("warned %q", event.Message)
+			}
+			warnings++
+		}
+	}
+	if planned != 100 || warnings != 1 {
+		t.Errorf("wrote %d events and %d warnings", planned, warnings)
+	}
+	if _, err := os.Stat(tree); err != nil {
+		t.Errorf("what was in the way is gone: %v", err)
+	}
+}
+
+func TestEventRotationAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	for run := range 2 {
+		w, err := OpenEventWriter(fmt.Sprint(run), path, 0, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Warning("hello")
+		w.Close()
+	}
+
+	events := eventLines(t, path)
+	if len(events) != 2 || events[0].Run != "0" || events[1].Run != "1" {
+		t.Errorf("a second run didn't append: %+v", events)
+	}
+}
+
+func TestEventBackpressure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	w := &EventWriter{Run: "run", path: path, events: make(chan *Event, eventBuffer)}
+	err := w.open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The writer isn't started yet, as if the disk stalled, so the queue overflows
+	w.StartCycle(2)
+	for i := range eventBuffer + 10 {
+		w.Emit(&Event{Type: EventPlanned, Project: fmt.Sprint(i)})
+	}
+	if dropped := w.Dropped(); dropped != 11 {
+		t.Errorf("dropped %d events, want 11", dropped)
+	}
+
+	w.done.Add(1)
+	go w.write()
+	err = w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := eventLines(t, path)
+	if len(events) != eventBuffer {
+		t.Fatalf("wrote %d events, want %d", len(events), eventBuffer)
+	}
+	if events[0].Project != "10" || events[len(events)-1].Project != fmt.Sprint(eventBuffer+9) {
+		t.Errorf("kept %s to %s, want the newest ones", events[0].Project, events[len(events)-1].Project)
+	}
+	for _, event := range events {
+		if event.Cycle != 2 {
+			t.Fatalf("got cycle %d", event.Cycle)
+		}
+	}
+
+	w.StartCycle(3)
+	if w.Dropped() != 0 {
+		t.Errorf("the next cycle starts with %d dropped events", w.Dropped())
+	}
+}
+
+func TestEmitAfterClose(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	w, err := OpenEventWriter("run", path, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 1000 {
+				w.Warning("racing")
+			}
+		}()
+	}
+	err = w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+
+	written := len(eventLines(t, path))
+	w.Warning("late")
+	w.FinishCycle(nil, nil)
+	if err := w.Close(); err != nil {
+		t.Errorf("closing again: %v", err)
+	}
+	if after := len(eventLines(t, path)); after != written {
+		t.Errorf("%d events were written after closing", after-written)
+	}
+
+	var nilWriter *EventWriter
+	nilWriter.Warning("discarded")
+	if err := nilWriter.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDroppedPerCycle(t *testing.T) {
+	w := &EventWriter{Run: "7d2e", events: make(chan *Event, eventBuffer)}
+	tests := []struct {
+		cycle   int
+		emitted int // on top of the cycle_started event
+		drained bool
+		dropped int64
+	}{
+		{cycle: 1, emitted: eventBuffer + 4, drained: true, dropped: 5},
+		{cycle: 2, emitted: 12, drained: true},
+		{cycle: 3, emitted: eventBuffer - 1},
+		{cycle: 4, emitted: 2, drained: true, dropped: 3}, // the queue is still full of cycle 3
+		{cycle: 7, drained: true},                         // watch mode skipped a few
+	}
+
+	// The writer isn't running, the queue is only emptied between cycles
+	for _, test := range tests {
+		w.StartCycle(test.cycle)
+		for i := range test.emitted {
+			w.Emit(&Event{Type: EventPlanned, Project: fmt.Sprintf("fleet/%d", i)})
+		}
+		if dropped := w.Dropped(); dropped != test.dropped {
+			t.Errorf("cycle %d dropped %d events, want %d", test.cycle, dropped, test.dropped)
+		}
+
+		for test.drained && len(w.events) > 0 {
+			if event := <-w.events; event.Cycle > test.cycle || event.Run != "7d2e" {
+				t.Fatalf("cycle %d queued %+v", test.cycle, event)
+			}
+		}
+	}
+}
@@ -0,0 +1,488 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jedib0t/go-pretty/v6/progress"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"gls/pkg/git"
+	"gls/pkg/gls"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var errCancelledByUser = errors.New("cancelled by user")
+
+// progressInterval is how often the tracker of a task takes progress, the table is only rendered every 100ms anyway
+const progressInterval = 50 * time.Millisecond
+
+// executeCycle runs the tasks of a cycle. In interactive mode the user may cancel single tasks meanwhile, the input
+// is only watched until they are done so the prompts of the next cycle get their answers
+func executeCycle(ctx context.Context, tasks []*Task, cfg Config, pw progress.Writer, logFile *LogFile, events *EventWriter) {
+	running := NewRunningTasks()
+	if cfg.Interactive {
+		watchCtx, stopWatching := context.WithCancel(ctx)
+		watching := make(chan struct{})
+		go func() {
+			watchCancellations(watchCtx, input, pw, running)
+			close(watching)
+		}()
+		defer func() {
+			stopWatching()
+			<-watching
+		}()
+		println(text.FgCyan.Sprint(msg("cancel.hint")))
+	}
+
+	executeTasks(ctx, tasks, cfg, pw, running, logFile, events)
+}
+
+func executeTasks(ctx context.Context, tasks []*Task, cfg Config, pw progress.Writer, running *RunningTasks, logFile *LogFile, events *EventWriter) {
+	var wg sync.WaitGroup
+	for _, pool := range workerPools(tasks, cfg) {
+		for i := 1; i <= pool.workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for task := range pool.queue {
+					executeQueuedTask(ctx, task, cfg, pw, running, logFile, events)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+}
+
+// workerPool runs the tasks of its queue with a fixed number of workers
+type workerPool struct {
+	workers int
+	queue   chan *Task
+}
+
+// workerPools splits the tasks into a pool for clones and one for everything else, as clones take most of the
+// bandwidth. Without clone or pull workers configured all tasks share a single pool of cfg.Workers
+func workerPools(tasks []*Task, cfg Config) []*workerPool {
+	if cfg.CloneWorkers <= 0 && cfg.PullWorkers <= 0 {
+		return []*workerPool{fillPool(cfg.Workers, tasks)}
+	}
+
+	var clones, others []*Task
+	for _, task := range tasks {
+		if task.Action == Clone {
+			clones = append(clones, task)
+		} else {
+			others = append(others, task)
+		}
+	}
+
+	cloneWorkers, pullWorkers := cfg.CloneWorkers, cfg.PullWorkers
+	if cloneWorkers <= 0 {
+		cloneWorkers = cfg.Workers
+	}
+	if pullWorkers <= 0 {
+		pullWorkers = cfg.Workers
+	}
+	return []*workerPool{fillPool(cloneWorkers, clones), fillPool(pullWorkers, others)}
+}
+
+func fillPool(workers int, tasks []*Task) *workerPool {
+	queue := make(chan *Task, len(tasks))
+	for _, task := range tasks {
+		queue <- task
+	}
+	close(queue)
+	return &workerPool{workers: workers, queue: queue}
+}
+
+func executeQueuedTask(ctx context.Context, task *Task, cfg Config, pw progress.Writer, running *RunningTasks, logFile *LogFile, events *EventWriter) {
+	pw.AppendTracker(task.Tracker)
+	if task.Error.Load() != nil {
+		task.Tracker.MarkAsErrored() // failed during planning
+		return
+	}
+	if task.Skipped {
+		task.Tracker.MarkAsDone()
+		return
+	}
+
+	task.Tracker.Start()
+	events.Emit(&Event{Type: EventTaskStarted, Project: task.Key, Action: task.Action})
+	task.StartedAt = time.Now()
+	err := runTask(ctx, task, cfg, running, logFile)
+	task.FinishedAt = time.Now()
+	finished := &Event{Type: EventTaskFinished, Project: task.Key, Action: task.Action, Duration: task.FinishedAt.Sub(task.StartedAt)}
+	if task.Metric != nil {
+		finished.Bytes = task.Metric.Bytes
+	}
+	if err != nil {
+		finished.Error = err.Error()
+	} else if task.Repaired {
+		finished.Message = msg("result.repaired")
+	} else if task.PullResult != nil {
+		finished.Message = describePull(task.PullResult)
+	}
+	events.Emit(finished)
+	if task.Repaired {
+		task.Tracker.UpdateMessage(task.Columns + text.Pad(msg("result.repaired"), resultLength+2, ' '))
+	} else if task.PullResult != nil {
+		task.Tracker.UpdateMessage(task.Columns + text.Pad(describePull(task.PullResult), resultLength+2, ' '))
+	}
+	if err != nil {
+		task.Error.Store(&err) // before the tracker is done, renderers look at the error once it is
+		task.Tracker.MarkAsErrored()
+	} else {
+		task.Tracker.MarkAsDone()
+	}
+}
+
+func describePull(result *git.PullResult) string {
+	switch {
+	case result.LocalChanges:
+		return msg("result.local_changes")
+	case result.UpToDate:
+		return msg("result.up_to_date")
+	case result.CommitsFetched == 1:
+		return msg("result.pulled_commit")
+	default:
+		return msg("result.pulled_commits", result.CommitsFetched)
+	}
+}
+
+// trackedBranches returns the remote-tracking branches before a pull or fetch, nil unless they are pruned
+func trackedBranches(task *Task, cfg Config) map[string]bool {
+	if !cfg.Prune {
+		return nil
+	}
+	branches, _ := git.RemoteBranches(task.Path)
+	return branches
+}
+
+// countBranches counts the remote-tracking branches left after a pull or fetch and those it pruned.
+// Counting reads the refs only, a failure just leaves them uncounted
+func countBranches(task *Task, cfg Config, before map[string]bool) {
+	if !cfg.Prune && cfg.RemoteBranchLimit <= 0 {
+		return
+	}
+
+	after, err := git.RemoteBranches(task.Path)
+	if err != nil {
+		return
+	}
+	task.Branches = len(after)
+	for branch := range before {
+		if !after[branch] {
+			task.Pruned++
+		}
+	}
+	if task.Pruned > 0 && task.Transcript != nil {
+		task.Transcript.Line("[gls] " + msg("result.pruned", task.Pruned))
+	}
+}
+
+// updateBranches fast-forwards the tracked branches of a project after it was pulled or fetched
+func updateBranches(ctx context.Context, task *Task, lineProcessor func(string)) error {
+	if len(task.Track) == 0 {
+		return nil
+	}
+
+	var err error
+	task.Updates, err = git.UpdateBranches(ctx, task.Path, task.Track, lineProcessor)
+	if task.Transcript != nil {
+		for _, update := range task.Updates {
+			task.Transcript.Line("[gls] " + update.Branch + ": " + describeBranchUpdate(update))
+		}
+	}
+	return err
+}
+
+// describeBranchUpdate tells what happened to a tracked branch, e.g. 3 new commits
+func describeBranchUpdate(update *git.BranchUpdate) string {
+	switch {
+	case update.Rejected:
+		return msg("track.rejected")
+	case update.Missing:
+		return msg("track.missing")
+	case update.Created:
+		return msg("track.created")
+	case update.Commits == 1:
+		return msg("track.commit")
+	case update.Commits > 1:
+		return msg("track.commits", update.Commits)
+	}
+	return msg("result.up_to_date")
+}
+
+// runTask executes a task with its own context, so it can be cancelled or time out without affecting the others
+func runTask(ctx context.Context, task *Task, cfg Config, running *RunningTasks, logFile *LogFile) (err error) {
+	taskCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	if logFile != nil {
+		task.Transcript = NewTranscript(task, logFile.CycleId())
+		taskCtx = git.WithCommandListener(taskCtx, task.Transcript)
+		defer func() {
+			task.Transcript.Finish(err)
+			logFile.WriteTranscript(task.Transcript)
+		}()
+	}
+
+	if cfg.TaskTimeout > 0 {
+		var cancelTimeout context.CancelFunc
+		taskCtx, cancelTimeout = context.WithTimeoutCause(taskCtx, cfg.TaskTimeout, fmt.Errorf("timed out after %s", cfg.TaskTimeout))
+		defer cancelTimeout()
+	}
+
+	if task.Action != Delete && task.Action != Move {
+		task.Metric = newTaskMetric(task.CloneUrl)
+		start := time.Now()
+		defer func() {
+			task.Metric.Duration = time.Since(start)
+		}()
+	}
+
+	running.Add(task, cancel)
+	defer running.Remove(task)
+
+	_, statErr := os.Stat(task.Path)
+	existed := statErr == nil
+
+	err = executeTask(taskCtx, task, cfg)
+	if err != nil && context.Cause(taskCtx) != nil {
+		if task.Action == Clone && !existed {
+			_ = os.RemoveAll(task.Path) // a killed git can't clean up its partial clone
+		}
+		return context.Cause(taskCtx) // report why it was killed rather than "signal: killed"
+	}
+	return err
+}
+
+func executeTask(ctx context.Context, task *Task, cfg Config) error {
+	var debug func(string)
+	if task.Transcript != nil {
+		debug = func(message string) {
+			task.Transcript.Line("[gls] " + message)
+		}
+	}
+
+	adapter := gls.NewTrackerAdapter(task.Tracker, progressInterval)
+	defer adapter.Flush()
+
+	parser := gls.NewParser(string(task.Action), debug)
+	lineProcessor := func(line string) {
+		if task.Transcript != nil {
+			task.Transcript.Line(line)
+		}
+		if task.Metric != nil {
+			task.Metric.parseTransfer(line)
+		}
+
+		if progress, ok := parser.Feed(line); ok {
+			adapter.Update(progress)
+		}
+	}
+
+	var err error
+	switch task.Action {
+	case Clone:
+		if task.Restart {
+			// Only gls worked in the clone so far, still nothing is removed for good
+			_, err = git.TrashProject(trashPath(), task.Path)
+			if err != nil {
+				return err
+			}
+		}
+		err = git.PrepareCloneTarget(task.Path, cfg.CleanPartial)
+		if err != nil {
+			return err
+		}
+		task.Journal.Started(task.Key)
+		if task.Mirror {
+			err = git.MirrorProject(ctx, task.CloneUrl, task.Path, lineProcessor)
+		} else {
+			err = git.CloneProject(ctx, task.CloneUrl, task.Path, task.Branch, lineProcessor)
+		}
+		if err == nil {
+			task.Journal.Finished(task.Key, task.Path)
+		}
+	case Pull:
+		before := trackedBranches(task, cfg)
+		task.PullResult, err = git.PullProject(ctx, task.Path, lineProcessor)
+		if err != nil && cfg.Repair && git.IsCorruption(err) {
+			task.Preserved, err = git.RepairProject(ctx, trashPath(), task.CloneUrl, task.Path, task.Branch, lineProcessor)
+			task.Repaired = err == nil
+		}
+		if err == nil && !task.Repaired {
+			countBranches(task, cfg, before)
+		}
+		if err == nil {
+			err = updateBranches(ctx, task, lineProcessor)
+		}
+	case Fetch:
+		before := trackedBranches(task, cfg)
+		err = git.FetchProject(ctx, task.Path, lineProcessor)
+		if err == nil {
+			countBranches(task, cfg, before)
+			err = updateBranches(ctx, task, lineProcessor)
+		}
+	case Move:
+		from := filepath.Join(cfg.Local.Path, task.From)
+		err = git.MoveProject(from, task.Path, task.CloneUrl)
+		if err == nil {
+			task.Journal.Moved(task.From, task.Key)
+		}
+		if err == nil && cfg.PruneEmptyDirs {
+			err = git.PruneEmptyDirs(cfg.Local.Path, from)
+		}
+	case Delete:
+		err = git.DeleteProject(task.Path)
+		if err == nil {
+			task.Journal.Forget(task.Key)
+		}
+		if err == nil && cfg.PruneEmptyDirs {
+			err = git.PruneEmptyDirs(cfg.Local.Path, task.Path)
+		}
+	}
+
+	if err == nil && task.Action != Delete && !listSource(cfg).Group() {
+		err = git.MarkSource(task.Path, listSource(cfg).Kind)
+		if err != nil {
+			return fmt.Errorf("marking the source of %s: %w", task.Key, err)
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+	hook := hookToRun(task, cfg)
+	if hook == "" {
+		return nil
+	}
+
+	env := append(git.SandboxEnv(os.Environ(), cfg.Gitlab.Token),
+		"GLS_PROJECT_PATH="+task.Key,
+		"GLS_ACTION="+string(task.Action),
+	)
+	adapter.Flush()
+	parser = gls.NewParser(gls.HookTask, debug)
+	return git.RunHook(ctx, hook, task.Path, env, cfg.Hooks.Timeout, func(line string) {
+		if task.Transcript != nil {
+			task.Transcript.Line(line)
+		}
+		if progress, ok := parser.Feed(line); ok {
+			adapter.Update(progress)
+		}
+	})
+}
+
+// hookToRun is the hook to run after the task succeeded, empty if there is none
+func hookToRun(task *Task, cfg Config) string {
+	if task.Hook == "" {
+		return ""
+	}
+	if task.Repaired {
+		return cfg.Hooks.PostClone // it's a fresh clone now
+	}
+	if task.Action == Pull && task.PullResult != nil && task.PullResult.UpToDate {
+		return "" // the post pull hook only runs when the pull brought in new commits
+	}
+	return task.Hook
+}
+
+// RunningTasks keeps track of the tasks currently being executed by the workers
+type RunningTasks struct {
+	mu      sync.Mutex
+	tasks   []*Task
+	cancels map[*Task]context.CancelCauseFunc
+}
+
+func NewRunningTasks() *RunningTasks {
+	return &RunningTasks{
+		cancels: make(map[*Task]context.CancelCauseFunc),
+	}
+}
+
+func (r *RunningTasks) Add(task *Task, cancel context.CancelCauseFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.tasks = append(r.tasks, task)
+	r.cancels[task] = cancel
+}
+
+func (r *RunningTasks) Remove(task *Task) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, t := range r.tasks {
+		if t == task {
+			r.tasks = append(r.tasks[:i], r.tasks[i+1:]...)
+			break
+		}
+	}
+	delete(r.cancels, task)
+}
+
+// List returns the running tasks in the order they were started
+func (r *RunningTasks) List() []*Task {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]*Task(nil), r.tasks...)
+}
+
+// Cancel stops a task if it is still running, returns false if it already finished
+func (r *RunningTasks) Cancel(task *Task, cause error) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cancel, ok := r.cancels[task]
+	if ok {
+		cancel(cause)
+	}
+	return ok
+}
+
+// watchCancellations lets the user cancel single tasks while they run, until ctx is done or the input ends.
+// Entering x lists the running tasks, entering one of the listed numbers cancels that task
+func watchCancellations(ctx context.Context, in *Input, pw progress.Writer, running *RunningTasks) {
+	var listed []*Task
+	for {
+		line, err := in.ReadLine(ctx)
+		if err != nil {
+			return
+		}
+
+		line = strings.TrimSpace(line)
+		if strings.EqualFold(line, "x") {
+			listed = running.List()
+			if len(listed) == 0 {
+				pw.Log(msg("cancel.none_running"))
+				continue
+			}
+
+			for i, task := range listed {
+				pw.Log("%d) %s %s", i+1, task.Action, task.Key)
+			}
+			pw.Log(msg("cancel.enter_number"))
+			continue
+		}
+
+		number, err := strconv.Atoi(line)
+		if err != nil || number < 1 || number > len(listed) {
+			continue
+		}
+
+		task := listed[number-1]
+		if running.Cancel(task, errCancelledByUser) {
+			pw.Log(msg("cancel.cancelled", task.Action, task.Key))
+		} else {
+			pw.Log(msg("cancel.already_finished", task.Action, task.Key))
+		}
+		listed = nil
+	}
+}
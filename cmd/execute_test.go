@@ -0,0 +1,325 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jedib0t/go-pretty/v6/progress"
+	"gls/pkg/git"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// silentRemote is a git daemon that takes connections and never answers, clones from it hang until they are killed
+func silentRemote(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip("can't listen on localhost:", err)
+	}
+
+	var mu sync.Mutex
+	var conns []net.Conn
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			conns = append(conns, conn)
+			mu.Unlock()
+		}
+	}()
+	t.Cleanup(func() {
+		_ = listener.Close()
+		mu.Lock()
+		defer mu.Unlock()
+		for _, conn := range conns {
+			_ = conn.Close()
+		}
+	})
+	return "git://" + listener.Addr().String() + "/acme/api.git"
+}
+
+// hangingClone is a clone into dir that runs until it is cancelled
+func hangingClone(t *testing.T, dir string) *Task {
+	return &Task{Key: "acme/api", Path: filepath.Join(dir, "acme", "api"), CloneUrl: silentRemote(t), Action: Clone, Tracker: &progress.Tracker{}}
+}
+
+// waitUntilRunning waits for a task to be added to running
+func waitUntilRunning(t *testing.T, running *RunningTasks, task *Task) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !slices.Contains(running.List(), task) {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s never started", task.Key)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// logWriter is a progress writer that keeps what is logged
+type logWriter struct {
+	progress.Writer
+	mu   sync.Mutex
+	logs []string
+}
+
+func newLogWriter() *logWriter {
+	pw := progress.NewWriter()
+	pw.SetOutputWriter(io.Discard)
+	return &logWriter{Writer: pw}
+}
+
+func (w *logWriter) Log(message string, a ...interface{}) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.logs = append(w.logs, fmt.Sprintf(message, a...))
+}
+
+func (w *logWriter) Logs() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return slices.Clone(w.logs)
+}
+
+func TestRunningTasks(t *testing.T) {
+	running := NewRunningTasks()
+	first, second, third := &Task{Key: "a"}, &Task{Key: "b"}, &Task{Key: "c"}
+	causes := make(map[*Task]error)
+	for _, task := range []*Task{first, second, third} {
+		running.Add(task, func(cause error) {
+			causes[task] = cause
+		})
+	}
+	running.Remove(second)
+
+	if got := running.List(); !slices.Equal(got, []*Task{first, third}) {
+		t.Errorf("listed %v", got)
+	}
+	running.List()[0] = nil // a copy the watcher may keep while tasks come and go
+	if running.List()[0] != first {
+		t.Error("the list was changed through a copy")
+	}
+
+	errStop := errors.New("stop")
+	if !running.Cancel(third, errStop) || causes[third] != errStop {
+		t.Errorf("cancelling a running task got cause %v", causes[third])
+	}
+	if running.Cancel(second, errStop) || causes[second] != nil {
+		t.Error("cancelled a finished task")
+	}
+	if causes[first] != nil {
+		t.Errorf("cancelled a task that wasn't asked for: %v", causes[first])
+	}
+}
+
+func TestRunTaskCancelledByUser(t *testing.T) {
+	var cfg Config
+	task := hangingClone(t, t.TempDir())
+	running := NewRunningTasks()
+
+	done := make(chan error)
+	go func() {
+		done <- runTask(context.Background(), task, cfg, running, nil)
+	}()
+	waitUntilRunning(t, running, task)
+	if !running.Cancel(task, errCancelledByUser) {
+		t.Fatal("the task isn't running")
+	}
+
+	select {
+	case err := <-done:
+		if err != errCancelledByUser {
+			t.Errorf("got %v, want %v", err, errCancelledByUser)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("the clone went on after it was cancelled")
+	}
+	if len(running.List()) != 0 {
+		t.Error("the cancelled task is still listed as running")
+	}
+	if _, err := os.Stat(task.Path); !os.IsNotExist(err) {
+		t.Errorf("the partial clone is left behind: %v", err)
+	}
+}
+
+func TestWatchCancellations(t *testing.T) {
+	task := hangingClone(t, t.TempDir())
+	running := NewRunningTasks()
+	done := make(chan error)
+	go func() {
+		done <- runTask(context.Background(), task, Config{}, running, nil)
+	}()
+	waitUntilRunning(t, running, task)
+
+	reader, writer := io.Pipe()
+	in := NewInput(reader)
+	pw := newLogWriter()
+	ctx, stop := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		watchCancellations(ctx, in, pw, running)
+		close(stopped)
+	}()
+
+	// Numbers before listing and out of range are ignored
+	for _, line := range []string{"1", "x", "0", "2", "one", "1"} {
+		if _, err := io.WriteString(writer, line+"\n"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	select {
+	case err := <-done:
+		if err != errCancelledByUser {
+			t.Errorf("got %v, want %v", err, errCancelledByUser)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("the task wasn't cancelled, logged %q", pw.Logs())
+	}
+
+	// Once the tasks are done the watcher stops, and what is typed next is left to the next reader
+	stop()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the watcher is still reading the input")
+	}
+	go func() {
+		_, _ = io.WriteString(writer, "y\n")
+	}()
+	if line, err := in.ReadLine(context.Background()); line != "y\n" || err != nil {
+		t.Errorf("the next reader got %q, %v", line, err)
+	}
+
+	want := []string{
+		"1) clone acme/api",
+		msg("cancel.enter_number"),
+		msg("cancel.cancelled", Clone, "acme/api"),
+	}
+	if got := pw.Logs(); !slices.Equal(got, want) {
+		t.Errorf("logged %q, want %q", got, want)
+	}
+}
+
+func TestWatchCancellationsFinished(t *testing.T) {
+	running := NewRunningTasks()
+	task := &Task{Key: "acme/web", Action: Pull}
+	running.Add(task, func(error) {})
+	pw := newLogWriter()
+
+	// The task finishes between listing and choosing it, when the input ends the watcher stops on its own
+	reader, writer := io.Pipe()
+	go func() {
+		_, _ = io.WriteString(writer, "x\n")
+		waitUntilLogged(pw, 2)
+		running.Remove(task)
+		_, _ = io.WriteString(writer, "1\n")
+		_ = writer.Close()
+	}()
+	watchCancellations(context.Background(), NewInput(reader), pw, running)
+
+	want := []string{
+		"1) pull acme/web",
+		msg("cancel.enter_number"),
+		msg("cancel.already_finished", Pull, "acme/web"),
+	}
+	if got := pw.Logs(); !slices.Equal(got, want) {
+		t.Errorf("logged %q, want %q", got, want)
+	}
+
+	pw = newLogWriter()
+	watchCancellations(context.Background(), NewInput(strings.NewReader("x\n")), pw, running)
+	if got := pw.Logs(); !slices.Equal(got, []string{msg("cancel.none_running")}) {
+		t.Errorf("logged %q with nothing running", got)
+	}
+}
+
+// waitUntilLogged waits for count lines to be logged
+func waitUntilLogged(pw *logWriter, count int) {
+	for len(pw.Logs()) < count {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestRunTaskTimeout(t *testing.T) {
+	tests := []struct {
+		name    string
+		existed bool // an empty directory was there before, e.g. made by the user to clone into
+	}{
+		{name: "new directory"},
+		{name: "existing directory", existed: true},
+	}
+
+	var cfg Config
+	cfg.TaskTimeout = 300 * time.Millisecond
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			task := hangingClone(t, t.TempDir())
+			if test.existed {
+				if err := os.MkdirAll(task.Path, 0755); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := runTask(context.Background(), task, cfg, NewRunningTasks(), nil)
+			if err == nil || err.Error() != "timed out after 300ms" {
+				t.Errorf("got %v", err)
+			}
+			_, statErr := os.Stat(task.Path)
+			if exists := statErr == nil; exists != test.existed {
+				t.Errorf("the clone directory exists: %t, want %t", exists, test.existed)
+			}
+			if _, err := os.Stat(filepath.Dir(task.Path)); err != nil {
+				t.Errorf("the group directory is gone: %v", err)
+			}
+
+			task.Error.Store(&err)
+			done := &Task{Key: "acme/web", Action: Pull}
+			if code := exitCode(summarizeCycle([]*Task{done, task}, 0, time.Second)); code != 1 {
+				t.Errorf("exits with %d", code)
+			}
+		})
+	}
+
+	if code := exitCode(summarizeCycle([]*Task{{Key: "acme/web", Action: Pull}}, 1, time.Second)); code != 0 {
+		t.Errorf("exits with %d when nothing failed", code)
+	}
+	if code := exitCode(nil); code != 0 {
+		t.Errorf("exits with %d without a summary", code)
+	}
+}
+
+func TestHookToRun(t *testing.T) {
+	var cfg Config
+	cfg.Hooks.PostClone = "make bootstrap"
+
+	tests := []struct {
+		name string
+		task *Task
+		want string
+	}{
+		{name: "clone", task: &Task{Key: "shop/cart", Action: Clone, Hook: "make bootstrap"}, want: "make bootstrap"},
+		{name: "pull with new commits", task: &Task{Key: "shop/cart", Action: Pull, Hook: "make deps", PullResult: &git.PullResult{CommitsFetched: 3}}, want: "make deps"},
+		{name: "pull up to date", task: &Task{Key: "shop/cart", Action: Pull, Hook: "make deps", PullResult: &git.PullResult{UpToDate: true}}},
+		{name: "pull without result", task: &Task{Key: "shop/cart", Action: Pull, Hook: "make deps"}, want: "make deps"},
+		{name: "repaired pull", task: &Task{Key: "shop/cart", Action: Pull, Hook: "make deps", Repaired: true}, want: "make bootstrap"},
+		{name: "no hook", task: &Task{Key: "shop/cart", Action: Pull, PullResult: &git.PullResult{CommitsFetched: 1}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := hookToRun(test.task, cfg); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
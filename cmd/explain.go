@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"gls/pkg/gitlab"
+	"log"
+	"sort"
+	"strings"
+)
+
+// runExplainFilters tells why a project is or isn't synced by asking every filter about it,
+// or with --list-excluded-by lists every project a single filter excludes
+func runExplainFilters(args []string) {
+	var path, filterName string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		path, args = args[0], args[1:]
+	}
+
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--list-excluded-by" && i+1 < len(args):
+			filterName = args[i+1]
+			i++
+		case strings.HasPrefix(arg, "--list-excluded-by="):
+			filterName = strings.TrimPrefix(arg, "--list-excluded-by=")
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	if (path == "") == (filterName == "") {
+		log.Fatalf("Usage: gls explain-filters <project-path>|--list-excluded-by <filter> [flags]")
+	}
+
+	cfg := loadConfig(rest)
+	ctx := interruptContext()
+
+	ignore, err := loadIgnoreList(cfg.Local.Path)
+	if err != nil {
+		log.Fatalf("Error reading %s: %v", ignoreFile, err)
+	}
+	filters := projectFilters(cfg, ignore)
+
+	var filter Filter
+	if filterName != "" {
+		filter = findFilter(filters, filterName)
+		if filter == nil {
+			log.Fatalf("Unknown filter %s, available filters are %s", filterName, filterNames(filters))
+		}
+	}
+
+	gl := connectGitlab(ctx, cfg)
+	println(text.FgCyan.Sprint(msg("sync.fetching_projects", cfg.Gitlab.Url)))
+	gitlabProjects, errs := gl.GetSourceProjects(ctx, listSource(cfg), cfg.Gitlab.Group, cfg.Depth, func(gitlab.Progress) {})
+	for _, err := range errs {
+		println(text.FgHiRed.Sprintf("%v", err))
+	}
+	if len(errs) > 0 {
+		log.Fatalf("Error getting gitlab projects, the explanation would be incomplete")
+	}
+	if cfg.Wikis {
+		gitlabProjects = withWikis(gitlabProjects)
+	}
+
+	if filter != nil {
+		printExcludedBy(filter, gitlabProjects)
+		return
+	}
+
+	// The path can be given as shown by gls or including the group
+	path = strings.ToLower(projectKey(cfg, path))
+	for _, project := range gitlabProjects {
+		if strings.ToLower(project.Path) == path {
+			printVerdicts(project.Path, evaluateFilters(filters, project))
+			printNote(cfg, project.Path)
+			return
+		}
+	}
+	println(text.FgYellow.Sprint(msg("explain.not_listed", path)))
+	printNote(cfg, path) // projects gone from Gitlab can still have one
+}
+
+// printVerdicts lists what every filter said, the first exclusion is the one that counts
+func printVerdicts(path string, verdicts []*FilterVerdict) {
+	println(msg("explain.filters", path))
+
+	var excludedBy Filter
+	for i, verdict := range verdicts {
+		line := fmt.Sprintf("%2d. %-16s ", i+1, verdict.Filter.Name())
+		switch {
+		case verdict.Reason == "":
+			println(line + text.FgGreen.Sprint(msg("explain.passes")))
+		case excludedBy == nil:
+			excludedBy = verdict.Filter
+			println(text.Bold.Sprint(line) + text.Colors{text.Bold, text.FgHiRed}.Sprint(msg("explain.excludes", verdict.Reason)))
+		default:
+			println(line + text.FgYellow.Sprint(msg("explain.excludes", verdict.Reason)))
+		}
+	}
+
+	if excludedBy == nil {
+		println(text.FgCyan.Sprint("\n" + msg("explain.synced", path)))
+	} else {
+		println(text.FgCyan.Sprint("\n" + msg("explain.excluded", path, excludedBy.Name())))
+	}
+}
+
+// printNote shows the note of a project below the explanation, if it has one
+func printNote(cfg Config, path string) {
+	notes := loadNotes(cfg, func(warning string) {
+		println(text.FgYellow.Sprint(warning))
+	})
+	if notes == nil {
+		return
+	}
+	for _, note := range notes.Notes {
+		if strings.EqualFold(note.Path, path) {
+			println(text.FgYellow.Sprint(describeNote(note)))
+		}
+	}
+}
+
+// printExcludedBy lists the projects a filter excludes, no matter whether an earlier filter excludes them already
+func printExcludedBy(filter Filter, gitlabProjects []*gitlab.Project) {
+	sort.Slice(gitlabProjects, func(i, j int) bool {
+		return gitlabProjects[i].Path < gitlabProjects[j].Path
+	})
+
+	count := 0
+	for _, project := range gitlabProjects {
+		reason := filter.Evaluate(project)
+		if reason != "" {
+			println(fmt.Sprintf("%s  %s", project.Path, text.FgYellow.Sprint(reason)))
+			count++
+		}
+	}
+	println(text.FgCyan.Sprint("\n" + msg("explain.excluded_count", count, filter.Name())))
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"gls/pkg/gitlab"
+	"strings"
+)
+
+// Filter is one of the rules deciding which Gitlab projects are synced
+type Filter interface {
+	// Name is how the filter is referred to on the command line, the same as its flag
+	Name() string
+	// Evaluate returns why the filter excludes a project, or an empty string if the project passes
+	Evaluate(project *gitlab.Project) string
+}
+
+// FilterVerdict is what a single filter said about a project
+type FilterVerdict struct {
+	Filter Filter
+	Reason string // empty if the project passed
+}
+
+// ignoreFileFilter drops projects from both sides before planning, as if they didn't exist at all
+type ignoreFileFilter struct {
+	ignore *IgnoreList
+}
+
+func (f *ignoreFileFilter) Name() string {
+	return "ignore-file"
+}
+
+func (f *ignoreFileFilter) Evaluate(project *gitlab.Project) string {
+	if f.ignore.Match(project.Path) {
+		return msg("plan.ignored_file", ignoreFile)
+	}
+	return ""
+}
+
+type excludeTopicsFilter struct {
+	topics []string
+}
+
+func (f *excludeTopicsFilter) Name() string {
+	return "exclude-topics"
+}
+
+func (f *excludeTopicsFilter) Evaluate(project *gitlab.Project) string {
+	for _, topic := range project.Topics {
+		if containsString(f.topics, topic) {
+			return msg("plan.ignored_topic", topic)
+		}
+	}
+	return ""
+}
+
+type includeTopicsFilter struct {
+	topics []string
+}
+
+func (f *includeTopicsFilter) Name() string {
+	return "include-topics"
+}
+
+func (f *includeTopicsFilter) Evaluate(project *gitlab.Project) string {
+	if len(f.topics) == 0 {
+		return ""
+	}
+	for _, topic := range project.Topics {
+		if containsString(f.topics, topic) {
+			return ""
+		}
+	}
+	return msg("plan.ignored_no_topic")
+}
+
+// archivedFilter drops archived projects unless they are included
+type archivedFilter struct {
+	include bool
+}
+
+func (f *archivedFilter) Name() string {
+	return "archived"
+}
+
+func (f *archivedFilter) Evaluate(project *gitlab.Project) string {
+	if project.Archived && !f.include {
+		return msg("plan.ignored_archived")
+	}
+	return ""
+}
+
+// sharedFilter drops projects shared with other groups unless they are included
+type sharedFilter struct {
+	include bool
+}
+
+func (f *sharedFilter) Name() string {
+	return "shared"
+}
+
+func (f *sharedFilter) Evaluate(project *gitlab.Project) string {
+	if project.Shared && !f.include {
+		return msg("plan.ignored_shared")
+	}
+	return ""
+}
+
+// planFilters are applied while planning, the local copies of the projects they exclude are kept
+func planFilters(cfg Config) []Filter {
+	return []Filter{
+		&archivedFilter{include: cfg.Gitlab.IncludeArchived},
+		&sharedFilter{include: cfg.Gitlab.IncludeShared},
+		&excludeTopicsFilter{topics: cfg.Gitlab.ExcludeTopics},
+		&includeTopicsFilter{topics: cfg.Gitlab.IncludeTopics},
+	}
+}
+
+// projectFilters are all filters in the order gls applies them
+func projectFilters(cfg Config, ignore *IgnoreList) []Filter {
+	return append([]Filter{&ignoreFileFilter{ignore: ignore}}, planFilters(cfg)...)
+}
+
+// evaluateFilters asks every filter about a project, also those after the first one excluding it
+func evaluateFilters(filters []Filter, project *gitlab.Project) []*FilterVerdict {
+	var verdicts []*FilterVerdict
+	for _, filter := range filters {
+		verdicts = append(verdicts, &FilterVerdict{Filter: filter, Reason: filter.Evaluate(project)})
+	}
+	return verdicts
+}
+
+// findFilter looks up a filter by its name
+func findFilter(filters []Filter, name string) Filter {
+	for _, filter := range filters {
+		if filter.Name() == name {
+			return filter
+		}
+	}
+	return nil
+}
+
+func filterNames(filters []Filter) string {
+	var names []string
+	for _, filter := range filters {
+		names = append(names, filter.Name())
+	}
+	return strings.Join(names, ", ")
+}
+
+// excludingFilter returns the first filter applied while planning that excludes a project, or nil
+func excludingFilter(project *gitlab.Project, cfg Config) (Filter, string) {
+	for _, filter := range planFilters(cfg) {
+		reason := filter.Evaluate(project)
+		if reason != "" {
+			return filter, reason
+		}
+	}
+	return nil, ""
+}
+
+// ignoredReason tells why a project is excluded while planning, or returns an empty string if it should be synced
+func ignoredReason(project *gitlab.Project, cfg Config) string {
+	_, reason := excludingFilter(project, cfg)
+	return reason
+}
+
+// excludedCounts counts the Gitlab projects each filter applied while planning excluded first, by filter name
+func excludedCounts(gitlabProjects []*gitlab.Project, cfg Config) map[string]int {
+	counts := make(map[string]int)
+	for _, project := range gitlabProjects {
+		if filter, _ := excludingFilter(project, cfg); filter != nil && !project.Wiki {
+			counts[filter.Name()]++
+		}
+	}
+	return counts
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"gls/pkg/gitlab"
+	"gls/pkg/gitlab/fakegitlab"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestArchivedAndSharedFilters(t *testing.T) {
+	fake := fakegitlab.New()
+	fake.AddProject("acme/active")
+	fake.AddProject("acme/old", fakegitlab.Archived())
+	fake.AddProject("acme/common", fakegitlab.SharedWith("partner"))
+	fake.AddProject("acme/team/both", fakegitlab.Archived(), fakegitlab.SharedWith("partner"))
+
+	projects, errs := gitlab.NewWithAPI(fake).GetActiveGitlabProjects(context.Background(), "acme", -1, func(gitlab.Progress) {})
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	tests := []struct {
+		name            string
+		includeArchived bool
+		includeShared   bool
+		synced          []string
+		excluded        map[string]int
+	}{
+		{
+			name:     "default",
+			synced:   []string{"active"},
+			excluded: map[string]int{"archived": 2, "shared": 1},
+		},
+		{
+			name:            "archived included",
+			includeArchived: true,
+			synced:          []string{"active", "old"},
+			excluded:        map[string]int{"shared": 2},
+		},
+		{
+			name:          "shared included",
+			includeShared: true,
+			synced:        []string{"active", "common"},
+			excluded:      map[string]int{"archived": 2},
+		},
+		{
+			name:            "both included",
+			includeArchived: true,
+			includeShared:   true,
+			synced:          []string{"active", "common", "old", "team/both"},
+			excluded:        map[string]int{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var cfg Config
+			cfg.Gitlab.IncludeArchived = test.includeArchived
+			cfg.Gitlab.IncludeShared = test.includeShared
+
+			var synced []string
+			for _, project := range projects {
+				if ignoredReason(project, cfg) == "" {
+					synced = append(synced, project.Path)
+				}
+			}
+			sort.Strings(synced)
+			if !reflect.DeepEqual(synced, test.synced) {
+				t.Errorf("synced %q, want %q", synced, test.synced)
+			}
+			if excluded := excludedCounts(projects, cfg); !reflect.DeepEqual(excluded, test.excluded) {
+				t.Errorf("excluded %v, want %v", excluded, test.excluded)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"github.com/cristalhq/aconfig"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"reflect"
+	"strings"
+)
+
+// HelpRow documents a single config field, as flag, environment variable and key in the config file
+type HelpRow struct {
+	Flag    string
+	Env     string
+	Key     string
+	Default string
+	Usage   string
+}
+
+// HelpSection holds the fields of one nested struct of Config, the top level ones are in the general section
+type HelpSection struct {
+	Name string
+	Rows []*HelpRow
+}
+
+// helpSections reflects over Config, so the help lists every field under the names aconfig really uses
+func helpSections() []*HelpSection {
+	general := &HelpSection{Name: msg("help.general")}
+	sections := []*HelpSection{general}
+	byName := make(map[string]*HelpSection)
+
+	walkConfigKeys(func(key string, field aconfig.Field) {
+		if isSection(field) {
+			return // its fields come on their own
+		}
+
+		row := &HelpRow{
+			Env:     "GLS_" + key,
+			Key:     key,
+			Default: field.Tag("default"),
+			Usage:   field.Tag("usage"),
+		}
+		if field.Tag("flag") != "-" {
+			row.Flag = "--" + flagName(field)
+		}
+
+		section := general
+		if parent, nested := field.Name(), strings.Contains(field.Name(), "."); nested {
+			name, _, _ := strings.Cut(parent, ".")
+			section = byName[name]
+			if section == nil {
+				section = &HelpSection{Name: name}
+				byName[name] = section
+				sections = append(sections, section)
+			}
+		}
+		section.Rows = append(section.Rows, row)
+	})
+	return sections
+}
+
+// isSection tells nested structs of Config, which group fields, from the fields themselves
+func isSection(field aconfig.Field) bool {
+	return configFieldType(field).Kind() == reflect.Struct && !isLeafStruct(configFieldType(field))
+}
+
+// isLeafStruct tells structs aconfig parses as a single value, like time.Time, from sections of fields
+func isLeafStruct(fieldType reflect.Type) bool {
+	return fieldType.PkgPath() != "" && fieldType.PkgPath() != reflect.TypeOf(Config{}).PkgPath()
+}
+
+// renderHelp lists the commands and then every config field in aligned columns, grouped by section
+func renderHelp() string {
+	headers := &HelpRow{
+		Flag:    msg("help.flag"),
+		Env:     msg("help.env_var"),
+		Key:     msg("help.file_key"),
+		Default: msg("help.default"),
+		Usage:   msg("help.description"),
+	}
+
+	sections := helpSections()
+	flagLength, envLength, keyLength, defaultLength := columnWidths(headers)
+	for _, section := range sections {
+		for _, row := range section.Rows {
+			f, e, k, d := columnWidths(row)
+			flagLength, envLength, keyLength, defaultLength = max(flagLength, f), max(envLength, e), max(keyLength, k), max(defaultLength, d)
+		}
+	}
+
+	line := func(row *HelpRow) string {
+		return text.Pad(row.Flag, flagLength+2, ' ') + text.Pad(row.Env, envLength+2, ' ') +
+			text.Pad(row.Key, keyLength+2, ' ') + text.Pad(row.Default, defaultLength+2, ' ') + row.Usage
+	}
+
+	var help strings.Builder
+	help.WriteString(msg("help.usage") + "\n\n")
+	help.WriteString(msg("help.env") + "\n\n")
+	help.WriteString(strings.TrimRight(line(headers), " ") + "\n")
+	for _, section := range sections {
+		if len(section.Rows) == 0 {
+			continue
+		}
+		help.WriteString("\n" + section.Name + "\n")
+		for _, row := range section.Rows {
+			help.WriteString(strings.TrimRight(line(row), " ") + "\n")
+		}
+	}
+	return strings.TrimRight(help.String(), "\n")
+}
+
+func columnWidths(row *HelpRow) (int, int, int, int) {
+	return text.StringWidthWithoutEscSequences(row.Flag), text.StringWidthWithoutEscSequences(row.Env),
+		text.StringWidthWithoutEscSequences(row.Key), text.StringWidthWithoutEscSequences(row.Default)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+// golden compares got with the golden file of name in testdata, rewriting it with -update
+func golden(t *testing.T, name string, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		err := os.MkdirAll("testdata", 0755)
+		if err == nil {
+			err = os.WriteFile(path, []byte(got), 0644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(want) {
+		t.Errorf("%s differs, run with -update to accept\ngot:\n%s\nwant:\n%s", path, got, want)
+	}
+}
+
+func TestRenderHelp(t *testing.T) {
+	for _, lang := range []string{"en", "de"} {
+		t.Run(lang, func(t *testing.T) {
+			setLang(lang)
+			t.Cleanup(func() {
+				setLang(defaultLang)
+			})
+
+			help := renderHelp()
+			golden(t, "help-"+lang, help+"\n")
+
+			// Below the header every field has a line, its environment variable starts where the header says
+			column := -1
+			rows := 0
+			for _, line := range strings.Split(help, "\n") {
+				if column < 0 {
+					if strings.HasPrefix(line, msg("help.flag")) {
+						column = strings.Index(line, msg("help.env_var"))
+					}
+					continue
+				}
+				if i := strings.Index(line, "GLS_"); i >= 0 {
+					rows++
+					if i != column {
+						t.Errorf("%q isn't aligned with the header", line)
+					}
+				}
+			}
+			if fields := countHelpRows(); rows != fields {
+				t.Errorf("listed %d fields, want %d", rows, fields)
+			}
+		})
+	}
+}
+
+func countHelpRows() int {
+	count := 0
+	for _, section := range helpSections() {
+		count += len(section.Rows)
+	}
+	return count
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+	"gls/pkg/git"
+	"gls/pkg/gitlab"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ignoreFile sits at the root of the local path and lists projects gls keeps its hands off, like a .gitignore
+const ignoreFile = ".gls-ignore"
+
+// IgnoreList matches slash separated project paths against the patterns of the ignore file
+type IgnoreList struct {
+	matcher gitignore.Matcher
+}
+
+// loadIgnoreList reads the ignore file below localPath, a missing file ignores nothing
+func loadIgnoreList(localPath string) (*IgnoreList, error) {
+	file, err := os.Open(filepath.Join(localPath, ignoreFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return &IgnoreList{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var patterns []gitignore.Pattern
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, gitignore.ParsePattern(line, nil))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return &IgnoreList{matcher: gitignore.NewMatcher(patterns)}, nil
+}
+
+// Match tells whether a project or one of the directories above it is ignored
+func (l *IgnoreList) Match(path string) bool {
+	if l.matcher == nil {
+		return false
+	}
+
+	parts := strings.Split(path, "/")
+	for i := 1; i <= len(parts); i++ {
+		if l.matcher.Match(parts[:i], true) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterIgnored drops ignored projects from both sides and returns how many distinct paths were dropped
+func (l *IgnoreList) filterIgnored(gitlabProjects []*gitlab.Project, localProjects []*git.Project) ([]*gitlab.Project, []*git.Project, int) {
+	ignored := make(map[string]bool)
+
+	var keptGitlab []*gitlab.Project
+	for _, project := range gitlabProjects {
+		if l.Match(project.Path) {
+			ignored[project.Path] = true
+		} else {
+			keptGitlab = append(keptGitlab, project)
+		}
+	}
+
+	var keptLocal []*git.Project
+	for _, project := range localProjects {
+		if l.Match(project.Path) {
+			ignored[project.Path] = true
+		} else {
+			keptLocal = append(keptLocal, project)
+		}
+	}
+
+	return keptGitlab, keptLocal, len(ignored)
+}
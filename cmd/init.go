@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/joho/godotenv"
+	"gls/pkg/gitlab"
+	"gls/pkg/storage"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultLocalPath is where projects go when neither the flags nor the config file tell
+const defaultLocalPath = "~/Projects"
+
+// runInit writes the config for syncing a group found by a clone url: the project is looked up on its Gitlab
+// and the user picks which of the groups above it to sync
+func runInit(configPath string, args []string) {
+	flags := flag.NewFlagSet("gls init", flag.ExitOnError)
+	fromUrl := flags.String("from-url", "", "Clone url of any project in the group to sync, ssh or https")
+	token := flags.String("gitlab-token", "", "Gitlab token, taken from GLS_GITLAB_TOKEN or the config file if not given")
+	tokenType := flags.String("gitlab-token-type", "", "Kind of token: pat, group or job, pat if neither given nor in the config file")
+	localPath := flags.String("local-path", "", "Local path to clone to, "+defaultLocalPath+" if neither given nor in the config file")
+	_ = flags.Parse(args)
+
+	if *fromUrl == "" || flags.NArg() > 0 {
+		log.Fatalf("Usage: gls init --from-url <clone-url> [--gitlab-token <token>] [--local-path <path>]")
+	}
+
+	cloneUrl, err := gitlab.ParseCloneUrl(*fromUrl)
+	if err != nil {
+		log.Fatalf("Error parsing clone url: %v", err)
+	}
+
+	content, err := os.ReadFile(configPath)
+	if err != nil && !os.IsNotExist(err) {
+		log.Fatalf("Error reading config file: %v", err)
+	}
+	existed := err == nil
+
+	ours, err := godotenv.UnmarshalBytes(content)
+	if err != nil {
+		log.Fatalf("Error parsing config file: %v", err)
+	}
+	version, err := configFileVersion(ours)
+	if err != nil {
+		log.Fatalf("Error reading config file: %v", err)
+	}
+	ours, _, _ = migrateConfig(ours)
+
+	// A token from the environment stays there, only one given as flag is written to the file
+	apiToken := firstNonEmpty(*token, os.Getenv("GLS_GITLAB_TOKEN"), ours["GITLAB_TOKEN"])
+	if apiToken == "" {
+		log.Fatalf("Looking up the project needs a Gitlab token, pass --gitlab-token or set GLS_GITLAB_TOKEN")
+	}
+	apiTokenType := firstNonEmpty(*tokenType, ours["GITLAB_TOKEN_TYPE"], gitlab.PersonalToken)
+
+	println(text.FgCyan.Sprint(msg("init.looking_up", cloneUrl.ProjectPath, cloneUrl.BaseUrl)))
+	gl, err := gitlab.New(cloneUrl.BaseUrl, apiToken, apiTokenType, 30*time.Second)
+	if err != nil {
+		log.Fatalf("Error creating gitlab client: %v", err)
+	}
+	namespaces, err := gl.ProjectNamespaces(interruptContext(), cloneUrl.ProjectPath)
+	if err != nil {
+		log.Fatalf("Error looking up %s: %v", cloneUrl.ProjectPath, err)
+	}
+	if len(namespaces) == 0 {
+		log.Fatalf("None of the groups of %s can be read with this token", cloneUrl.ProjectPath)
+	}
+
+	namespace, err := askForNamespace(stdin, os.Stdout, namespaces)
+	if err != nil {
+		log.Fatalf("Error reading input: %v", err)
+	}
+
+	wanted := map[string]string{
+		"GITLAB_URL":   cloneUrl.BaseUrl,
+		"GITLAB_GROUP": namespace.FullPath,
+		"LOCAL_PATH":   firstNonEmpty(*localPath, ours["LOCAL_PATH"], defaultLocalPath),
+	}
+	if *token != "" {
+		wanted["GITLAB_TOKEN"] = *token
+	}
+	if *tokenType != "" {
+		wanted["GITLAB_TOKEN_TYPE"] = *tokenType
+	}
+	if cloneUrl.Https {
+		wanted["GITLAB_HTTPS"] = "true"
+	}
+	if !existed {
+		wanted[configVersionKey] = strconv.Itoa(currentConfigVersion)
+	}
+
+	changes := make(map[string]string)
+	for key, value := range wanted {
+		if ours[key] != value {
+			changes[key] = value
+		}
+	}
+	if len(changes) == 0 && version == currentConfigVersion {
+		println(text.FgCyan.Sprint(msg("init.nothing_changed", configPath)))
+		return
+	}
+
+	var lines []string
+	if existed {
+		lines = strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+	}
+	updated := setConfigLines(migrateConfigLines(lines, version), changes)
+	for _, line := range diffLines(lines, updated) {
+		println(line)
+	}
+
+	if !askForConfirmation(text.FgMagenta.Sprint(msg("config.confirm_write", configPath))) {
+		return
+	}
+
+	if existed {
+		err = storage.WriteFile(configPath+".bak", content, 0600)
+		if err != nil {
+			log.Fatalf("Error writing backup: %v", err)
+		}
+	}
+
+	err = storage.WriteFile(configPath, []byte(strings.Join(updated, "\n")+"\n"), 0600)
+	if err != nil {
+		log.Fatalf("Error writing config file: %v", err)
+	}
+	println(text.FgCyan.Sprint(msg("init.done", configPath, namespace.FullPath)))
+}
+
+// askForNamespace lists the namespaces above a project with their project counts and lets the user pick the one to sync
+func askForNamespace(in *bufio.Reader, out io.Writer, namespaces []*gitlab.Namespace) (*gitlab.Namespace, error) {
+	pathLength := 0
+	for _, namespace := range namespaces {
+		pathLength = max(pathLength, len(namespace.FullPath))
+	}
+	numberLength := len(strconv.Itoa(len(namespaces)))
+
+	fmt.Fprintln(out, text.FgMagenta.Sprint("\n"+msg("init.header")))
+	for i, namespace := range namespaces {
+		projects := msg("init.projects", namespace.Projects)
+		if namespace.Projects < 0 {
+			projects = msg("init.projects_unknown")
+		}
+		fmt.Fprintf(out, "%*d  %s%s\n", numberLength, i+1, text.Pad(namespace.FullPath, pathLength+2, ' '), projects)
+	}
+
+	for {
+		fmt.Fprint(out, text.FgMagenta.Sprint(msg("init.prompt", len(namespaces)))+" ")
+		input, err := in.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+
+		input = strings.TrimSpace(input)
+		number, err := strconv.Atoi(input)
+		if err == nil && number >= 1 && number <= len(namespaces) {
+			return namespaces[number-1], nil
+		}
+		fmt.Fprintln(out, text.FgHiRed.Sprint(msg("review.invalid_selection", input)))
+	}
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"sync"
+)
+
+// Input hands the lines typed by the user to one reader at a time. A single goroutine reads them, so a reader that
+// stops waiting, like the cancel watcher at the end of a cycle, leaves the next line to the next prompt
+type Input struct {
+	source io.Reader
+	start  sync.Once
+	lines  chan string
+	err    error // why lines was closed
+
+	mu   sync.Mutex
+	rest string // handed back by a reader that stopped, or left over by Read
+}
+
+func NewInput(source io.Reader) *Input {
+	return &Input{source: source, lines: make(chan string)}
+}
+
+// read runs from the first read on, it reads one line ahead at most
+func (in *Input) read() {
+	reader := bufio.NewReader(in.source)
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			in.lines <- line
+		}
+		if err != nil {
+			in.err = err
+			close(in.lines)
+			return
+		}
+	}
+}
+
+// ReadLine returns the next line with its newline, or the error of ctx once it is done
+func (in *Input) ReadLine(ctx context.Context) (string, error) {
+	if line := in.takeRest(); line != "" {
+		return line, nil
+	}
+
+	in.start.Do(func() {
+		go in.read()
+	})
+	select {
+	case line, ok := <-in.lines:
+		if !ok {
+			return "", in.err
+		}
+		if ctx.Err() != nil {
+			in.unread(line) // both were ready, the line belongs to whoever reads next
+			return "", ctx.Err()
+		}
+		return line, nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// Read lets prompts wrap the input in a bufio.Reader. It returns a line at most, so nothing is buffered past the
+// line a prompt reads
+func (in *Input) Read(p []byte) (int, error) {
+	line, err := in.ReadLine(context.Background())
+	if err != nil {
+		return 0, err
+	}
+	n := copy(p, line)
+	in.unread(line[n:])
+	return n, nil
+}
+
+func (in *Input) takeRest() string {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+
+	rest := in.rest
+	in.rest = ""
+	return rest
+}
+
+func (in *Input) unread(line string) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+
+	in.rest = line + in.rest
+}
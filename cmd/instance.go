@@ -0,0 +1,79 @@
+package main
+
+import (
+	"github.com/jedib0t/go-pretty/v6/text"
+	"gls/pkg/git"
+	"gls/pkg/gitlab"
+	"net/url"
+	"path/filepath"
+)
+
+// InstanceMove describes a GitLab instance that permanently redirects to a new URL
+type InstanceMove struct {
+	OldHost string
+	NewHost string
+}
+
+// detectInstanceMove checks whether the configured GitLab URL permanently redirects somewhere else
+// and points the config at the new URL, so all API calls go there directly
+func detectInstanceMove(cfg *Config) *InstanceMove {
+	movedTo, err := gitlab.DetectMove(cfg.Gitlab.Url)
+	if err != nil || movedTo == "" {
+		return nil // connection problems surface with the first real API call
+	}
+
+	println(text.FgYellow.Sprint(msg("instance.redirected", movedTo)))
+
+	oldUrl, err := url.Parse(cfg.Gitlab.Url)
+	if err != nil {
+		return nil
+	}
+	newUrl, err := url.Parse(movedTo)
+	if err != nil {
+		return nil
+	}
+
+	cfg.Gitlab.Url = movedTo
+	if oldUrl.Hostname() == newUrl.Hostname() {
+		return nil // only the path changed, clone urls are fine
+	}
+
+	return &InstanceMove{
+		OldHost: oldUrl.Hostname(),
+		NewHost: newUrl.Hostname(),
+	}
+}
+
+// rewriteCloneUrl points a clone url still referring to the old instance at the new one
+func (m *InstanceMove) rewriteCloneUrl(project *gitlab.Project) {
+	project.CloneUrl, _ = git.ReplaceHost(project.CloneUrl, m.OldHost, m.NewHost)
+}
+
+// rewriteOrigins points the origin of local projects at the new instance
+func (m *InstanceMove) rewriteOrigins(localPath string, projects []*git.Project) {
+	rewritten := 0
+	for _, project := range projects {
+		path := filepath.Join(localPath, project.Path)
+
+		origin, err := git.GetOrigin(path)
+		if err != nil {
+			continue
+		}
+
+		moved, ok := git.ReplaceHost(origin, m.OldHost, m.NewHost)
+		if !ok {
+			continue
+		}
+
+		err = git.SetOrigin(path, moved)
+		if err != nil {
+			println(text.FgHiRed.Sprint(msg("instance.origin_failed", project.Path, err)))
+			continue
+		}
+		rewritten++
+	}
+
+	if rewritten > 0 {
+		println(text.FgCyan.Sprint(msg("instance.origins_moved", rewritten, m.OldHost, m.NewHost)))
+	}
+}
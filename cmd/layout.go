@@ -0,0 +1,165 @@
+package main
+
+import (
+	"github.com/jedib0t/go-pretty/v6/text"
+	"golang.org/x/term"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	trackerLength    = 40
+	minTrackerLength = 10
+	minKeyLength     = 20 // leaves room for a shortened group and the name of the project
+	statusLength     = 14 // what the renderer puts after the tracker, e.g. "done [12.345s]"
+)
+
+// ColumnWidths are the widths the columns of the task rows need for their content, Group is 0 when not grouping
+type ColumnWidths struct {
+	Group   int
+	Message int
+	Key     int
+	Branch  int
+	Result  int
+}
+
+// Layout is how the task rows fit into the terminal
+type Layout struct {
+	Key     int  // keys longer than this are shortened in the middle
+	Tracker int  // length of the progress tracker
+	Plain   bool // too narrow for the live table, finished tasks are printed one per line instead
+
+	Widths ColumnWidths // what the layout was made for, to check it again once the terminal is resized
+}
+
+// layoutColumns fits the task rows into a terminal width columns wide. The tracker shrinks first, then the key
+// column, and when even that isn't enough the plain renderer takes over. Without a known width nothing shrinks
+func layoutColumns(width int, widths ColumnWidths) Layout {
+	natural := Layout{Key: widths.Key, Tracker: trackerLength, Widths: widths}
+	if width <= 0 {
+		return natural
+	}
+
+	fixed := widths.Message + 2 + widths.Branch + 2 + widths.Result + 2 + statusLength
+	if widths.Group > 0 {
+		fixed += widths.Group + 2
+	}
+	room := width - 1 - fixed // a row filling the last column wraps on some terminals
+	if widths.Key+2+trackerLength <= room {
+		return natural
+	}
+
+	if tracker := room - widths.Key - 2; tracker >= minTrackerLength {
+		return Layout{Key: widths.Key, Tracker: tracker, Widths: widths}
+	}
+
+	if key := room - 2 - minTrackerLength; key >= min(widths.Key, minKeyLength) {
+		return Layout{Key: key, Tracker: minTrackerLength, Widths: widths}
+	}
+	return Layout{Key: widths.Key, Tracker: trackerLength, Plain: true, Widths: widths}
+}
+
+// shortenKey shortens a project path to length by cutting out its middle, the name of the project stays
+// visible as long as it fits
+func shortenKey(key string, length int) string {
+	runes := []rune(key)
+	if len(runes) <= length {
+		return key
+	}
+	if length <= 1 {
+		return string(runes[:max(length, 0)])
+	}
+
+	tail := len([]rune(key[strings.LastIndex(key, "/")+1:]))
+	if strings.Contains(key, "/") {
+		tail++ // keep the slash, so the name still reads as one
+	}
+	tail = min(tail, length-1)
+	head := length - 1 - tail
+	return string(runes[:head]) + "…" + string(runes[len(runes)-tail:])
+}
+
+// terminalWidth returns the width of the terminal on stdout, 0 if it isn't one
+func terminalWidth() int {
+	width, _, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		return 0
+	}
+	return width
+}
+
+// liveOutput passes the live table on to stdout until it is muted, once the terminal got too narrow for it
+type liveOutput struct {
+	muted atomic.Bool
+}
+
+func (o *liveOutput) Write(p []byte) (int, error) {
+	if o.muted.Load() {
+		return len(p), nil
+	}
+	return os.Stdout.Write(p)
+}
+
+// PlainRenderer prints every task once it finished, one line each. Unlike the live table it never redraws,
+// so it stays readable however narrow the terminal is
+type PlainRenderer struct {
+	tasks   []*Task
+	started atomic.Bool
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+func NewPlainRenderer(tasks []*Task) *PlainRenderer {
+	return &PlainRenderer{tasks: tasks, stop: make(chan struct{}), stopped: make(chan struct{})}
+}
+
+// Start begins printing finished tasks, including those that finished before. Only the first call counts
+func (r *PlainRenderer) Start() {
+	if r.started.Swap(true) {
+		return
+	}
+	go r.render()
+}
+
+// Finish prints the tasks finished since the last look and waits for the renderer to stop
+func (r *PlainRenderer) Finish() {
+	if !r.started.Load() {
+		return
+	}
+	close(r.stop)
+	<-r.stopped
+}
+
+func (r *PlainRenderer) render() {
+	defer close(r.stopped)
+
+	printed := make(map[*Task]bool)
+	printFinished := func() {
+		for _, task := range r.tasks {
+			if printed[task] || !task.Tracker.IsDone() {
+				continue
+			}
+			printed[task] = true
+
+			status := text.FgGreen.Sprint(msg("status.done"))
+			if task.Error.Load() != nil {
+				status = text.FgHiRed.Sprint(msg("status.error"))
+			}
+			println(status + " " + strings.Join(strings.Fields(task.Tracker.Message), " "))
+		}
+	}
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			printFinished()
+		case <-r.stop:
+			printFinished()
+			return
+		}
+	}
+}
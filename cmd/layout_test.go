@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// rowWidth is how wide a task row is with layout
+func rowWidth(layout Layout) int {
+	widths := layout.Widths
+	width := widths.Message + 2 + layout.Key + 2 + widths.Branch + 2 + widths.Result + 2 + layout.Tracker + statusLength
+	if widths.Group > 0 {
+		width += widths.Group + 2
+	}
+	return width
+}
+
+func TestLayoutColumns(t *testing.T) {
+	tests := []struct {
+		name   string
+		width  int
+		widths ColumnWidths
+		want   Layout
+	}{
+		{
+			name:   "unknown width",
+			widths: ColumnWidths{Message: 8, Key: 90, Branch: 6, Result: 10},
+			want:   Layout{Key: 90, Tracker: trackerLength},
+		},
+		{
+			name:   "fits",
+			width:  200,
+			widths: ColumnWidths{Message: 8, Key: 30, Branch: 6, Result: 10},
+			want:   Layout{Key: 30, Tracker: trackerLength},
+		},
+		{
+			name:   "tracker shrinks",
+			width:  110,
+			widths: ColumnWidths{Message: 8, Key: 30, Branch: 6, Result: 10},
+			want:   Layout{Key: 30, Tracker: 33},
+		},
+		{
+			name:   "key shrinks",
+			width:  80,
+			widths: ColumnWidths{Message: 8, Key: 40, Branch: 6, Result: 10},
+			want:   Layout{Key: 23, Tracker: minTrackerLength},
+		},
+		{
+			name:   "group takes room",
+			width:  95,
+			widths: ColumnWidths{Group: 10, Message: 8, Key: 40, Branch: 6, Result: 10},
+			want:   Layout{Key: 26, Tracker: minTrackerLength},
+		},
+		{
+			name:   "too narrow",
+			width:  60,
+			widths: ColumnWidths{Message: 8, Key: 40, Branch: 6, Result: 10},
+			want:   Layout{Key: 40, Tracker: trackerLength, Plain: true},
+		},
+		{
+			name:   "short keys keep their length",
+			width:  67,
+			widths: ColumnWidths{Message: 8, Key: 10, Branch: 6, Result: 10},
+			want:   Layout{Key: 10, Tracker: minTrackerLength},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.want.Widths = test.widths
+			if got := layoutColumns(test.width, test.widths); got != test.want {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+// TestLayoutColumnsWidths checks every width from a narrow split pane to a wide screen
+func TestLayoutColumnsWidths(t *testing.T) {
+	columns := []ColumnWidths{
+		{Message: 8, Key: 12, Branch: 4, Result: 6},
+		{Message: 8, Key: 30, Branch: 6, Result: 10},
+		{Message: 12, Key: 90, Branch: 20, Result: 24},
+		{Group: 16, Message: 8, Key: 60, Branch: 6, Result: 10},
+	}
+
+	for _, widths := range columns {
+		t.Run(fmt.Sprintf("%+v", widths), func(t *testing.T) {
+			var previous Layout
+			for width := 40; width <= 200; width++ {
+				layout := layoutColumns(width, widths)
+				if layout.Widths != widths {
+					t.Fatalf("%d: the layout forgot what it was made for", width)
+				}
+
+				if layout.Plain {
+					if width > 40 && !previous.Plain {
+						t.Errorf("%d: plain again after a table fit at %d", width, width-1)
+					}
+					previous = layout
+					continue
+				}
+				if rowWidth(layout) > width-1 {
+					t.Errorf("%d: rows are %d wide with %+v", width, rowWidth(layout), layout)
+				}
+				if layout.Tracker < minTrackerLength || layout.Tracker > trackerLength {
+					t.Errorf("%d: tracker is %d long", width, layout.Tracker)
+				}
+				if layout.Key > widths.Key || layout.Key < min(widths.Key, minKeyLength) {
+					t.Errorf("%d: key is %d long", width, layout.Key)
+				}
+				if layout.Key < widths.Key && layout.Tracker != minTrackerLength {
+					t.Errorf("%d: the key shrank before the tracker did: %+v", width, layout)
+				}
+				if !previous.Plain && width > 40 && (layout.Key < previous.Key || layout.Tracker < previous.Tracker) {
+					t.Errorf("%d: got narrower than at %d: %+v, was %+v", width, width-1, layout, previous)
+				}
+				previous = layout
+			}
+			if previous.Plain {
+				t.Errorf("200 columns still don't fit: %+v", previous)
+			}
+		})
+	}
+}
+
+func TestShortenKey(t *testing.T) {
+	tests := []struct {
+		key    string
+		length int
+		want   string
+	}{
+		{key: "acme/api", length: 20, want: "acme/api"},
+		{key: "acme/api", length: 8, want: "acme/api"},
+		{key: "acme/backend/services/api", length: 12, want: "acme/ba…/api"},
+		{key: "acme/backend/services/payments", length: 12, want: "ac…/payments"},
+		{key: "acme/backend/very-long-project-name", length: 12, want: "…roject-name"},
+		{key: "grüppe/ünter/prøject", length: 14, want: "grüpp…/prøject"},
+		{key: "acme/api", length: 1, want: "a"},
+		{key: "acme/api", length: 0, want: ""},
+		{key: "noslash-but-long", length: 8, want: "…ut-long"},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%s %d", test.key, test.length), func(t *testing.T) {
+			if got := shortenKey(test.key, test.length); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+// TestShortenKeyLengths shortens keys to every length the layout can come up with
+func TestShortenKeyLengths(t *testing.T) {
+	keys := []string{
+		"acme/api",
+		"acme/platform/backend/services/payments-gateway",
+		"gruppe/ünterguppe/prøjekt-mit-ümlauten",
+		"a-project-without-any-group-at-all",
+	}
+
+	for _, key := range keys {
+		runes := utf8.RuneCountInString(key)
+		name := key[strings.LastIndex(key, "/")+1:]
+		for length := 0; length <= runes+2; length++ {
+			got := shortenKey(key, length)
+			if count := utf8.RuneCountInString(got); count != min(length, runes) {
+				t.Errorf("%q shortened to %d is %q, %d long", key, length, got, count)
+			}
+			if length >= runes {
+				if got != key {
+					t.Errorf("%q shortened to %d is %q", key, length, got)
+				}
+				continue
+			}
+			if length > 1 && !strings.Contains(got, "…") {
+				t.Errorf("%q shortened to %d is %q without a mark", key, length, got)
+			}
+			if length > utf8.RuneCountInString(name)+1 && !strings.HasSuffix(got, name) {
+				t.Errorf("%q shortened to %d is %q, the name is cut", key, length, got)
+			}
+		}
+	}
+}
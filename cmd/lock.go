@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"gls/pkg/gitlab"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// lockAttempts is how often taking the lock is tried when another machine changes the lock file at the same time
+const lockAttempts = 3
+
+// releaseTimeout bounds releasing the lock on the way out, an unreleased lock only blocks others until it expires
+const releaseTimeout = 30 * time.Second
+
+var errLockLost = errors.New("lost the remote lock to another machine")
+
+// holdRemoteLock takes the lock shared by all machines syncing with the same lock project and renews it in the
+// background. The returned context is cancelled once the lock is lost, the returned function releases it.
+// A lock held by someone else ends gls, a lock that can't be reached only warns unless it is required
+func holdRemoteLock(ctx context.Context, cfg Config, gl *gitlab.Gitlab) (context.Context, func()) {
+	if cfg.Lock.Project == "" {
+		log.Fatalf("The remote lock needs a project to keep the lock file in, set lock-project")
+	}
+	if cfg.Lock.Lease <= 0 {
+		log.Fatalf("The lease of the remote lock has to be longer than 0")
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown host"
+	}
+	holder := fmt.Sprintf("%s (pid %d)", hostname, os.Getpid())
+
+	lock, err := gl.NewRemoteLock(ctx, cfg.Lock.Project, cfg.Lock.File, holder, cfg.Lock.Lease)
+	if err == nil {
+		err = acquireRemoteLock(ctx, lock)
+	}
+
+	var held *gitlab.LockHeldError
+	switch {
+	case errors.As(err, &held):
+		log.Fatalf("Gls is already syncing on %s, its lock expires at %s", held.Holder, held.Expires.Local().Format("15:04:05"))
+	case err != nil && cfg.Lock.Required:
+		log.Fatalf("Error taking the remote lock: %v", err)
+	case err != nil:
+		println(text.FgHiRed.Sprint(msg("lock.unreachable", cfg.Lock.Project, err)))
+		return ctx, func() {}
+	}
+
+	lockCtx, cancel := context.WithCancelCause(ctx)
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		renewRemoteLock(lockCtx, lock, cfg.Lock.Lease, stop, cancel)
+	}()
+
+	var once sync.Once
+	return lockCtx, func() {
+		once.Do(func() {
+			close(stop)
+			wg.Wait()
+			defer cancel(nil)
+			if context.Cause(lockCtx) == errLockLost {
+				return // it belongs to someone else now
+			}
+
+			releaseCtx, cancelRelease := context.WithTimeout(context.Background(), releaseTimeout) // ctx may be interrupted already
+			defer cancelRelease()
+			err := lock.Release(releaseCtx)
+			if err != nil {
+				println(text.FgYellow.Sprint(msg("lock.release_failed", err)))
+			}
+		})
+	}
+}
+
+// acquireRemoteLock retries when the lock file changed between reading and writing it, the next attempt sees who won
+func acquireRemoteLock(ctx context.Context, lock *gitlab.RemoteLock) error {
+	var err error
+	for attempt := 0; attempt < lockAttempts; attempt++ {
+		err = lock.Acquire(ctx)
+		if !errors.Is(err, gitlab.ErrLockConflict) {
+			return err
+		}
+	}
+	return err
+}
+
+// renewRemoteLock renews the lease three times per lease, so a failed renewal or two don't lose it yet.
+// Once it is taken over, which only happens after it expired, the sync is cancelled
+func renewRemoteLock(ctx context.Context, lock *gitlab.RemoteLock, lease time.Duration, stop chan struct{}, cancel context.CancelCauseFunc) {
+	ticker := time.NewTicker(lease / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := lock.Renew(ctx)
+		switch {
+		case errors.Is(err, gitlab.ErrLockConflict):
+			println(text.FgHiRed.Sprint(msg("lock.lost")))
+			cancel(errLockLost)
+			return
+		case err != nil && ctx.Err() == nil:
+			println(text.FgYellow.Sprint(msg("lock.renew_failed", err)))
+		}
+	}
+}
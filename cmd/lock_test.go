@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"gls/pkg/gitlab"
+	"gls/pkg/gitlab/fakegitlab"
+	"testing"
+	"time"
+)
+
+// lockConfig takes the remote lock in ops/locks
+func lockConfig() Config {
+	var cfg Config
+	cfg.Lock.Remote = true
+	cfg.Lock.Project = "ops/locks"
+	cfg.Lock.File = "gls.lock"
+	cfg.Lock.Lease = time.Minute
+	return cfg
+}
+
+// remoteLock is a lock of holder on ops/locks of fake
+func remoteLock(t *testing.T, fake *fakegitlab.Gitlab, holder string) *gitlab.RemoteLock {
+	t.Helper()
+	lock, err := gitlab.NewWithAPI(fake).NewRemoteLock(context.Background(), "ops/locks", "gls.lock", holder, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return lock
+}
+
+func TestAcquireRemoteLock(t *testing.T) {
+	tests := []struct {
+		name    string
+		races   int // how many attempts another machine commits in between
+		err     error
+		commits int
+	}{
+		{name: "no race", commits: 1},
+		{name: "lost a race", races: 1, err: &gitlab.LockHeldError{}, commits: 2},
+		{name: "lost every race", races: lockAttempts, err: gitlab.ErrLockConflict, commits: 2 * lockAttempts},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			fake := fakegitlab.New()
+			fake.AddProject("ops/locks")
+			var skew time.Duration
+			fake.Now = func() time.Time {
+				return time.Now().Add(skew)
+			}
+
+			// The other machine takes the lock right before each commit, and lets it expire before the next attempt
+			other := remoteLock(t, fake, "other")
+			races := test.races
+			fake.BeforeCommit = func() {
+				if races == 0 {
+					return
+				}
+				races--
+				before := fake.BeforeCommit
+				fake.BeforeCommit = nil
+				if err := other.Acquire(ctx); err != nil {
+					t.Fatal(err)
+				}
+				fake.BeforeCommit = before
+				if races > 0 {
+					skew += 2 * time.Minute
+				}
+			}
+
+			err := acquireRemoteLock(ctx, remoteLock(t, fake, "gls"))
+			var held *gitlab.LockHeldError
+			switch want := test.err.(type) {
+			case nil:
+				if err != nil {
+					t.Fatal(err)
+				}
+			case *gitlab.LockHeldError:
+				if !errors.As(err, &held) || held.Holder != "other" {
+					t.Fatalf("got %v, want it held by other", err)
+				}
+			default:
+				if !errors.Is(err, want) {
+					t.Fatalf("got %v, want %v", err, want)
+				}
+			}
+			if got := fake.Calls("CreateCommit"); got != test.commits {
+				t.Errorf("committed %d times, want %d", got, test.commits)
+			}
+		})
+	}
+}
+
+func TestRenewRemoteLockLost(t *testing.T) {
+	fake := fakegitlab.New()
+	fake.AddProject("ops/locks")
+	var skew time.Duration
+	fake.Now = func() time.Time {
+		return time.Now().Add(skew)
+	}
+	lock := remoteLock(t, fake, "gls")
+	if err := lock.Acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another machine takes over, as if gls had hung for longer than the lease
+	skew += 2 * time.Minute
+	if err := remoteLock(t, fake, "other").Acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	go renewRemoteLock(ctx, lock, 30*time.Millisecond, make(chan struct{}), cancel)
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("the sync went on after losing the lock")
+	}
+	if cause := context.Cause(ctx); cause != errLockLost {
+		t.Errorf("cancelled with %v", cause)
+	}
+}
+
+func TestRenewRemoteLockUnreachable(t *testing.T) {
+	fake := fakegitlab.New()
+	fake.AddProject("ops/locks")
+	lock := remoteLock(t, fake, "gls")
+	if err := lock.Acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	fake.Fail("ops", errors.New("503 Service Unavailable"))
+
+	// Renewals that don't reach Gitlab only warn, the lease covers a few of them
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		renewRemoteLock(ctx, lock, 30*time.Millisecond, stop, cancel)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for fake.Calls("CreateCommit") < 3 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	close(stop)
+	<-done
+	if ctx.Err() != nil {
+		t.Errorf("the sync was cancelled with %v", context.Cause(ctx))
+	}
+	if got := fake.Calls("CreateCommit"); got < 3 {
+		t.Errorf("renewed %d times", got-1)
+	}
+}
+
+func TestHoldRemoteLock(t *testing.T) {
+	fake := fakegitlab.New()
+	fake.AddProject("ops/locks")
+
+	lockCtx, release := holdRemoteLock(context.Background(), lockConfig(), gitlab.NewWithAPI(fake))
+	if _, ok := fake.File("ops/locks", "gls.lock"); !ok || lockCtx.Err() != nil {
+		t.Fatalf("not holding the lock, file written: %v, %v", ok, lockCtx.Err())
+	}
+	release()
+	release()
+	if _, ok := fake.File("ops/locks", "gls.lock"); ok {
+		t.Error("the lock file is left behind")
+	}
+	if fake.Calls("CreateCommit") != 2 {
+		t.Errorf("committed %d times, want an acquire and a release", fake.Calls("CreateCommit"))
+	}
+}
+
+func TestHoldRemoteLockUnreachable(t *testing.T) {
+	fake := fakegitlab.New()
+	fake.AddProject("ops/locks")
+	fake.Fail("ops", errors.New("503 Service Unavailable"))
+
+	// Without Lock.Required the sync goes on without the lock
+	ctx := context.Background()
+	lockCtx, release := holdRemoteLock(ctx, lockConfig(), gitlab.NewWithAPI(fake))
+	if lockCtx != ctx {
+		t.Error("a lock that was never held guards the sync")
+	}
+	release()
+	if fake.Calls("CreateCommit") != 0 {
+		t.Errorf("committed %d times", fake.Calls("CreateCommit"))
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxTranscript caps the output kept per task, progress updates alone can add up to megabytes
+const maxTranscript = 1024 * 1024
+
+// LogFile collects the full output of all tasks, one section per task
+type LogFile struct {
+	Path string
+	Run  string
+
+	cycle atomic.Int64
+	mu    sync.Mutex
+	file  *os.File
+}
+
+func OpenLogFile(run string, path string) (*LogFile, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &LogFile{
+		Path: path,
+		Run:  run,
+		file: file,
+	}
+	l.write(fmt.Sprintf("%s gls run %s started\n", timestamp(time.Now()), run))
+	return l, nil
+}
+
+// StartCycle marks where the sections of a cycle begin, in watch mode one run has many of them
+func (l *LogFile) StartCycle(cycle int) {
+	l.cycle.Store(int64(cycle))
+	l.Line("=== cycle " + l.CycleId() + " started")
+}
+
+// CycleId tells the run and cycle apart from the others in the file, e.g. 3f9c0a1b2c3d4e5f/2
+func (l *LogFile) CycleId() string {
+	return fmt.Sprintf("%s/%d", l.Run, l.cycle.Load())
+}
+
+// WriteTranscript appends the transcript of a task as a whole, so sections of parallel tasks don't interleave
+func (l *LogFile) WriteTranscript(transcript *Transcript) {
+	l.write(transcript.String())
+}
+
+// Line appends a single line outside of any task section
+func (l *LogFile) Line(line string) {
+	l.write(fmt.Sprintf("%s %s\n", timestamp(time.Now()), line))
+}
+
+func (l *LogFile) write(content string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_, _ = l.file.WriteString(content)
+}
+
+func (l *LogFile) Close() error {
+	return l.file.Close()
+}
+
+// Transcript records everything that happens while a task runs. It is only used by the worker running the task
+type Transcript struct {
+	builder   strings.Builder
+	truncated bool
+}
+
+func NewTranscript(task *Task, cycleId string) *Transcript {
+	t := &Transcript{}
+	t.add(fmt.Sprintf("=== %s %s in cycle %s", task.Action, task.Key, cycleId))
+	return t
+}
+
+func (t *Transcript) Line(line string) {
+	t.add(line)
+}
+
+func (t *Transcript) CommandStarted(args []string) {
+	t.add(fmt.Sprintf("$ %s", strings.Join(args, " ")))
+}
+
+func (t *Transcript) CommandFinished(exitCode int, duration time.Duration) {
+	t.add(fmt.Sprintf("exit code %d after %s", exitCode, duration.Round(time.Millisecond)))
+}
+
+func (t *Transcript) Finish(err error) {
+	if err != nil {
+		t.add(fmt.Sprintf("failed: %v", err))
+	} else {
+		t.add("done")
+	}
+}
+
+func (t *Transcript) add(line string) {
+	if t.truncated {
+		return
+	}
+
+	if t.builder.Len() > maxTranscript {
+		t.truncated = true
+		line = "[output truncated]"
+	}
+
+	t.builder.WriteString(timestamp(time.Now()))
+	t.builder.WriteString(" ")
+	t.builder.WriteString(line)
+	t.builder.WriteString("\n")
+}
+
+func (t *Transcript) String() string {
+	return t.builder.String()
+}
+
+func timestamp(t time.Time) string {
+	return t.Format("2006-01-02T15:04:05.000Z07:00")
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/jedib0t/go-pretty/v6/progress"
+	"gls/pkg/gitlab"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// sections splits a log file into the lines of each task section, keyed by its header
+func sections(content string) map[string][]string {
+	found := make(map[string][]string)
+	header := ""
+	for _, line := range strings.Split(strings.TrimRight(content, "\n"), "\n") {
+		_, line, _ = strings.Cut(line, " ") // the timestamp
+		if strings.HasPrefix(line, "=== ") && !strings.HasPrefix(line, "=== cycle ") {
+			header = line
+		}
+		if header != "" {
+			found[header] = append(found[header], line)
+		}
+		if line == "done" || strings.HasPrefix(line, "failed: ") {
+			header = ""
+		}
+	}
+	return found
+}
+
+func TestLogFile(t *testing.T) {
+	dir := t.TempDir()
+	origin := filepath.Join(dir, "origin")
+	initRepo(t, origin, true)
+
+	path := filepath.Join(dir, "gls.log")
+	logFile, err := OpenLogFile("3f9c0a1b", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logFile.StartCycle(2)
+
+	var cfg Config
+	cfg.Workers = 2
+	cfg.Gitlab.Source = gitlab.GroupSource
+	local := filepath.Join(dir, "local")
+	tasks := []*Task{
+		{Key: "acme/api", Path: filepath.Join(local, "acme", "api"), CloneUrl: origin, Action: Clone, Tracker: &progress.Tracker{}},
+		{Key: "acme/gone", Path: filepath.Join(local, "acme", "gone"), CloneUrl: filepath.Join(dir, "missing"), Action: Clone, Tracker: &progress.Tracker{}},
+	}
+	executeTasks(context.Background(), tasks, cfg, newLogWriter(), NewRunningTasks(), logFile, nil)
+	if err := logFile.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), " gls run 3f9c0a1b started\n") || !strings.Contains(string(content), " === cycle 3f9c0a1b/2 started\n") {
+		t.Errorf("the run and cycle aren't marked in\n%s", content)
+	}
+
+	found := sections(string(content))
+	tests := []struct {
+		header string
+		lines  []string // in this order, with anything in between
+	}{
+		{header: "=== clone acme/api in cycle 3f9c0a1b/2", lines: []string{"$ git clone", "Cloning into", "exit code 0", "done"}},
+		{header: "=== clone acme/gone in cycle 3f9c0a1b/2", lines: []string{"$ git clone", "fatal: ", "exit code 128", "failed: "}},
+	}
+	for _, test := range tests {
+		section, ok := found[test.header]
+		if !ok {
+			t.Errorf("%q is missing in\n%s", test.header, content)
+			continue
+		}
+		next := 0
+		for _, line := range section {
+			if next < len(test.lines) && strings.HasPrefix(line, test.lines[next]) {
+				next++
+			}
+		}
+		if next < len(test.lines) {
+			t.Errorf("%q is missing in the section\n%s", test.lines[next], strings.Join(section, "\n"))
+		}
+	}
+	if len(found) != len(tests) {
+		t.Errorf("found the sections %q", found)
+	}
+}
+
+func TestTranscriptTruncated(t *testing.T) {
+	transcript := NewTranscript(&Task{Key: "acme/api", Action: Pull}, "3f9c0a1b/1")
+	line := strings.Repeat("x", 1000)
+	for range 2 * maxTranscript / len(line) {
+		transcript.Line(line)
+	}
+	transcript.Finish(nil)
+
+	lines := strings.Split(strings.TrimRight(transcript.String(), "\n"), "\n")
+	if !strings.HasSuffix(lines[0], " === pull acme/api in cycle 3f9c0a1b/1") || !strings.HasSuffix(lines[len(lines)-1], " [output truncated]") {
+		t.Errorf("begins with %q and ends with %q", lines[0], lines[len(lines)-1])
+	}
+	if size := len(transcript.String()); size > maxTranscript+2*len(line) {
+		t.Errorf("kept %d bytes", size)
+	}
+}
+
+func TestLogFileCycles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gls.log")
+	tests := []struct {
+		run    string
+		cycles []int
+		tasks  []string // pulled in every cycle
+	}{
+		{run: "a1b2", cycles: []int{1, 2, 3}, tasks: []string{"fleet/core", "fleet/edge"}},
+		{run: "c3d4", cycles: []int{1}, tasks: []string{"fleet/core"}}, // appended by the next run
+	}
+
+	for _, test := range tests {
+		logFile, err := OpenLogFile(test.run, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, cycle := range test.cycles {
+			logFile.StartCycle(cycle)
+			for _, key := range test.tasks {
+				transcript := NewTranscript(&Task{Key: key, Action: Pull}, logFile.CycleId())
+				transcript.Finish(nil)
+				logFile.WriteTranscript(transcript)
+			}
+		}
+		if err := logFile.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want []string
+	for _, test := range tests {
+		want = append(want, "gls run "+test.run+" started")
+		for _, cycle := range test.cycles {
+			id := fmt.Sprintf("%s/%d", test.run, cycle)
+			want = append(want, "=== cycle "+id+" started")
+			for _, key := range test.tasks {
+				want = append(want, "=== pull "+key+" in cycle "+id, "done")
+			}
+		}
+	}
+	var got []string
+	for _, line := range strings.Split(strings.TrimRight(string(content), "\n"), "\n") {
+		_, line, _ = strings.Cut(line, " ") // the timestamp
+		got = append(got, line)
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -1,150 +1,641 @@
 package main
 
 import (
-	"bufio"
+	"context"
+	"errors"
 	"fmt"
-	"github.com/cristalhq/aconfig"
-	"github.com/cristalhq/aconfig/aconfigdotenv"
 	"github.com/jedib0t/go-pretty/v6/progress"
 	"github.com/jedib0t/go-pretty/v6/text"
 	"gls/pkg/git"
 	"gls/pkg/gitlab"
+	"gls/pkg/recording"
+	"gls/pkg/state"
+	"golang.org/x/term"
+	"io"
 	"log"
 	"os"
-	"path/filepath"
-	"regexp"
-	"strconv"
+	"os/signal"
+	"sort"
 	"strings"
-	"sync"
 	"sync/atomic"
+	"syscall"
 	"time"
 )
 
-type Config struct {
-	Workers int `default:"5" usage:"Number of parallel workers"`
-	Gitlab  struct {
-		Url   string `default:"https://gitlab.com" usage:"Gitlab URL"`
-		Token string `required:"true" usage:"Gitlab token for authentication"`
-		Group string `required:"true" usage:"Gitlab group to clone recursively"`
+type Action string
+
+const (
+	Clone  Action = "clone"
+	Pull   Action = "pull"
+	Fetch  Action = "fetch"
+	Delete Action = "delete"
+	Move   Action = "move"
+)
+
+type Task struct {
+	Key      string
+	Path     string
+	From     string // where a moved project was, relative to the local path
+	CloneUrl string
+	Mirror   bool
+	Branch   string // cloned instead of the default branch, empty unless overridden
+	Hook     string
+	Action   Action
+	Tracker  *progress.Tracker
+	Skipped  bool
+	Error    atomic.Pointer[error]
+
+	Columns    string          // the tracker message without the result column
+	PullResult *git.PullResult // only set for pulls that succeeded
+	Repaired   bool            // the pull hit a corrupted repository, which was cloned again
+	Preserved  []string        // untracked files carried over into the repaired clone
+	Pruned     int             // remote-tracking branches removed by a pull or fetch with --prune
+	Branches   int             // remote-tracking branches left after a pull or fetch, only counted for the limit or pruning
+	StartedAt  time.Time       // only set for tasks that ran
+	FinishedAt time.Time
+
+	Track   []string            // local branches kept current next to the checked out one
+	Updates []*git.BranchUpdate // what the pull or fetch did to them
+
+	Restart    bool          // the clone was interrupted and is started over
+	Journal    *CloneJournal // records clones starting and completing, nil in dry runs
+	Transcript *Transcript   // only set when writing a log file
+	Metric     *TaskMetric   // only set for tasks talking to a remote
+}
+
+var errInterrupted = errors.New("interrupted")
+
+func main() {
+	setLang(os.Getenv("GLS_LANG")) // before the config is loaded, so its warnings are translated too
+
+	command, args := "sync", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
 	}
-	Local struct {
-		Path string `required:"true" usage:"Local path to clone to"`
+
+	switch command {
+	case "sync":
+		runSync(args)
+	case "config":
+		runConfig(args)
+	case "init":
+		runInit(configPath(), args)
+	case "dedupe":
+		runDedupe(args)
+	case "status":
+		runStatus(args)
+	case "stats":
+		runStats(args)
+	case "digest":
+		runDigest(args)
+	case "resume":
+		runResume(args)
+	case "explain-filters":
+		runExplainFilters(args)
+	case "shadow-report":
+		runShadowReport(args)
+	case "note":
+		runNote(args)
+	default:
+		log.Fatalf("Unknown command %s, available commands are sync, resume, status, stats, digest, explain-filters, shadow-report, note, init, config and dedupe", command)
 	}
 }
 
-func loadConfig() Config {
-	homedir, err := os.UserHomeDir()
-	if err != nil {
-		log.Fatalf("Error getting homedir: %v", err)
+func runConfig(args []string) {
+	if len(args) == 0 {
+		log.Fatalf("Usage: gls config migrate|export|import")
 	}
 
-	var cfg Config
-	loader := aconfig.LoaderFor(&cfg, aconfig.Config{
-		EnvPrefix:     "GLS",
-		FlagDelimiter: "-",
+	switch args[0] {
+	case "migrate":
+		runConfigMigrate(configPath())
+	case "export":
+		runConfigExport(configPath(), args[1:])
+	case "import":
+		runConfigImport(configPath(), args[1:])
+	default:
+		log.Fatalf("Unknown config command %s, available commands are migrate, export and import", args[0])
+	}
+}
 
-		Files: []string{filepath.Join(homedir, ".gls")},
-		FileDecoders: map[string]aconfig.FileDecoder{
-			".gls": aconfigdotenv.New(),
-		},
-	})
+func runSync(args []string) {
+	cfg := loadConfig(args)
+
+	if cfg.Interactive && !term.IsTerminal(int(os.Stdin.Fd())) {
+		log.Fatalf("Interactive mode needs a terminal, stdin is not one")
+	}
+	if err := checkReplay(cfg); err != nil {
+		log.Fatalf("Can't sync: %v", err)
+	}
 
-	flags := loader.Flags()
-	helpFlag := flags.Bool("help", false, "Display help message")
+	// Taken before anything else, so a second run fails right away instead of after listing Gitlab
+	unlock := func() {}
+	if !cfg.DryRun {
+		unlock = holdLocalLock(cfg)
+		defer unlock()
+	}
 
-	err = flags.Parse(os.Args[1:])
-	if err != nil {
-		log.Fatalf("Error parsing flags: %v", err)
+	ctx := interruptContext()
+
+	// Every output of the run carries its id, and in watch mode the number of the cycle too
+	run := newRunId()
+
+	var logFile *LogFile
+	if cfg.LogFile != "" {
+		var err error
+		logFile, err = OpenLogFile(run, cfg.LogFile)
+		if err != nil {
+			log.Fatalf("Error opening log file: %v", err)
+		}
+		defer logFile.Close()
 	}
 
-	if *helpFlag {
-		println("Usage: gls [flags]")
-		flags.PrintDefaults()
-		println("Flags can also be passed via environment variables with prefix 'GLS_'")
-		println("Or via file at $HOME/.gls in format KEY=value")
-		os.Exit(0)
+	var events *EventWriter
+	if cfg.Events.File != "" {
+		var err error
+		events, err = OpenEventWriter(run, cfg.Events.File, cfg.Events.MaxSize, cfg.Events.Keep)
+		if err != nil {
+			log.Fatalf("Error opening events file: %v", err)
+		}
+		defer events.Close()
 	}
 
-	err = loader.Load()
-	if err != nil {
-		log.Fatalf("Error loading config: %v", err)
+	var move *InstanceMove
+	var gl *gitlab.Gitlab
+	if cfg.Replay == "" {
+		move = detectInstanceMove(&cfg)
+		gl = connectGitlab(ctx, cfg)
+	}
+	ctx = withGitCredentials(ctx, cfg)
+	ctx = withGitBackend(ctx, cfg)
+	if cfg.Prune {
+		ctx = git.WithPrune(ctx)
 	}
 
-	cfg.Local.Path = expandHome(homedir, cfg.Local.Path)
+	release := func() {}
+	if cfg.Lock.Remote && !cfg.DryRun {
+		ctx, release = holdRemoteLock(ctx, cfg, gl)
+		defer release()
+	}
 
-	return cfg
+	if cfg.Watch <= 0 {
+		summary, err := runCycle(ctx, cfg, gl, move, 1, logFile, events)
+		if err != nil {
+			release()
+			unlock()
+			_ = events.Close() // log.Fatalf skips the deferred close
+			log.Fatalf("Sync failed: %v", err)
+		}
+		if code := exitCode(summary); code != 0 {
+			release()
+			unlock()
+			_ = events.Close() // os.Exit skips the deferred close
+			os.Exit(code)
+		}
+		return
+	}
+
+	for cycle := 1; ; cycle++ {
+		_, err := runCycle(ctx, cfg, gl, move, cycle, logFile, events)
+		if err != nil {
+			println(text.FgHiRed.Sprint(msg("watch.cycle_failed", cycle, err)))
+		}
+
+		if !waitForNextCycle(ctx, cfg.Watch) {
+			return
+		}
+	}
 }
 
-func expandHome(homedir string, path string) string {
-	if strings.HasPrefix(path, "~/") {
-		path = filepath.Join(homedir, path[2:])
+// exitCode is what a sync exits with, 1 if any task failed. Dry runs and aborted reviews have no summary
+func exitCode(summary *CycleSummary) int {
+	if summary != nil && summary.Failed > 0 {
+		return 1
 	}
-	return path
+	return 0
 }
 
-type Action string
+// checkReplay rejects replaying a recording where its projects would be worked on, they aren't on disk
+func checkReplay(cfg Config) error {
+	if cfg.Replay != "" && (!cfg.DryRun || cfg.Watch > 0) {
+		return errors.New("replaying a recording only works with --dry-run and without --watch, the recorded projects aren't on disk")
+	}
+	return nil
+}
 
-const (
-	Clone  Action = "clone"
-	Pull   Action = "pull"
-	Delete Action = "delete"
-)
+// holdLocalLock makes sure no other gls run syncs the local path at the same time, the returned function releases
+// the lock. It is released on interrupts too, as they end the run normally. A crashed run leaves its lock behind,
+// which is taken over once its process is gone or removed with --force-unlock
+func holdLocalLock(cfg Config) func() {
+	release, stale, err := state.AcquireLock(cfg.Local.Path, cfg.ForceUnlock)
+	var locked *state.LockedError
+	if errors.As(err, &locked) {
+		log.Fatalf("Gls is already syncing %s as pid %d on %s since %s, remove the lock with --force-unlock if that run crashed",
+			cfg.Local.Path, locked.Holder.PID, locked.Holder.Host, locked.Holder.StartedAt.Local().Format("2006-01-02 15:04:05"))
+	}
+	if err != nil {
+		log.Fatalf("Error taking the local lock: %v", err)
+	}
+	if stale != nil {
+		println(text.FgYellow.Sprint(msg("lock.stale_local", stale.PID, stale.StartedAt.Local().Format("2006-01-02 15:04:05"))))
+	}
 
-type Task struct {
-	Path     string
-	CloneUrl string
-	Action   Action
-	Tracker  *progress.Tracker
-	Skipped  bool
-	Error    atomic.Pointer[error]
+	return func() {
+		err := release()
+		if err != nil {
+			println(text.FgHiRed.Sprint(msg("lock.release_local_failed", err)))
+		}
+		release = func() error { return nil } // released on failure and deferred as well
+	}
 }
 
-func main() {
-	cfg := loadConfig()
-
-	gl, err := gitlab.New(cfg.Gitlab.Url, cfg.Gitlab.Token)
+// connectGitlab creates the client and checks the token with it, failing right away if anything is wrong
+func connectGitlab(ctx context.Context, cfg Config) *gitlab.Gitlab {
+	gl, err := gitlab.New(cfg.Gitlab.Url, cfg.Gitlab.Token, cfg.Gitlab.TokenType, cfg.Gitlab.Timeout)
 	if err != nil {
 		log.Fatalf("Error creating gitlab client: %v", err)
 	}
+	gl.SetListConcurrency(cfg.Gitlab.Concurrency)
 
-	println(text.FgCyan.Sprintf("Fetching active Gitlab projects from %s", cfg.Gitlab.Url))
-	gitlabProjects, errs := gl.GetActiveGitlabProjects(cfg.Gitlab.Group, func(group string) {
-		println(text.FgCyan.Sprintf("Loading group %s", group))
-	})
-	if len(errs) > 0 {
-		log.Fatalf("Errors getting gitlab projects: %v", errs)
+	err = gl.CheckToken(ctx, pathRoot(cfg))
+	var skewErr *gitlab.ClockSkewError
+	if errors.As(err, &skewErr) {
+		skew := skewErr.Skew.Abs().Round(time.Second)
+		if skewErr.Skew > 0 {
+			println(text.FgYellow.Sprint(msg("sync.clock_ahead", skew)))
+		} else {
+			println(text.FgYellow.Sprint(msg("sync.clock_behind", skew)))
+		}
+		err = skewErr.Err
+	}
+	if err != nil {
+		log.Fatalf("Error checking gitlab token: %v", err)
 	}
+	return gl
+}
+
+// withGitCredentials hands the token to the git commands started with ctx when cloning over https
+func withGitCredentials(ctx context.Context, cfg Config) context.Context {
+	if !cfg.Gitlab.Https && cfg.Gitlab.TokenType != gitlab.JobToken {
+		return ctx
+	}
+	// Only the username goes into the clone urls, the token is handed to git by a credential helper
+	return git.WithCredentials(ctx, git.Credentials{Username: gitlab.CloneUsername(cfg.Gitlab.TokenType), Password: cfg.Gitlab.Token})
+}
 
-	println(text.FgCyan.Sprintf("Loading local projects in %s", cfg.Local.Path))
-	localProjects, err := git.GetLocalProjects(cfg.Local.Path)
+// withGitBackend makes clones, pulls and fetches started with ctx use the configured backend
+func withGitBackend(ctx context.Context, cfg Config) context.Context {
+	switch cfg.Git.Backend {
+	case git.CliBackend:
+		return ctx
+	case git.NativeBackend:
+		return git.WithNativeBackend(ctx, git.NativeOptions{SshKeyFile: cfg.Git.SshKey})
+	}
+	log.Fatalf("Unknown git backend %s, available backends are %s and %s", cfg.Git.Backend, git.CliBackend, git.NativeBackend)
+	return nil
+}
+
+// runCycle syncs once. Errors are returned where the whole cycle can't continue, failed tasks are only counted.
+// In watch mode progress is only shown for cycles that changed something, others are reported by a single line
+func runCycle(ctx context.Context, cfg Config, gl *gitlab.Gitlab, move *InstanceMove, cycle int, logFile *LogFile, events *EventWriter) (*CycleSummary, error) {
+	start := time.Now()
+	watching := cfg.Watch > 0
+	warnings := 0
+	warn := func(message string) {
+		println(text.FgYellow.Sprint(message))
+		events.Warning(message)
+		warnings++
+	}
+	info := func(message string) {
+		if !watching {
+			println(text.FgCyan.Sprint(message))
+		}
+	}
+
+	// Trackers, counts and stats are made anew each cycle, only the run's files and connections carry over
+	var stats *CycleStats
+	var inventory *Inventory
+	events.StartCycle(cycle)
+	if logFile != nil {
+		logFile.StartCycle(cycle)
+	}
+	defer func() {
+		events.FinishCycle(stats, inventory)
+	}()
+
+	overrides, err := parseBranchOverrides(cfg.Branch.Overrides)
+	if err != nil {
+		return nil, fmt.Errorf("error in branch overrides: %w", err)
+	}
+	tracks, err := parseBranchOverrides(cfg.Branch.Track)
 	if err != nil {
-		log.Fatalf("Error getting local projects: %v", err)
+		return nil, fmt.Errorf("error in tracked branches: %w", err)
 	}
 
-	println(text.FgCyan.Sprintf("Determining actions"))
+	listCtx := ctx
+	if cfg.Gitlab.ListTimeout > 0 {
+		var cancelList context.CancelFunc
+		listCtx, cancelList = context.WithTimeout(ctx, cfg.Gitlab.ListTimeout)
+		defer cancelList()
+	}
+
+	var replay *recording.Recording
+	if cfg.Replay != "" {
+		replay, err = recording.Load(cfg.Replay)
+		if err != nil {
+			return nil, fmt.Errorf("error loading recording: %w", err)
+		}
+		info(msg("sync.replaying", cfg.Replay, replay.RecordedAt.Local().Format("2006-01-02 15:04")))
+	}
+
+	// Only the listing streams, the planner pairs all projects with the local ones to find moves, orphans and
+	// deletions, so they are collected. The few fields kept of each take about 6MB for 40k projects
+	var gitlabProjects, listedProjects []*gitlab.Project
+	addProject := func(project *gitlab.Project) {
+		if cfg.Record != "" {
+			listed := *project
+			listedProjects = append(listedProjects, &listed)
+		}
+		if cfg.Gitlab.Https || cfg.Gitlab.TokenType == gitlab.JobToken {
+			useHttps(project, gitlab.CloneUsername(cfg.Gitlab.TokenType))
+		}
+		if move != nil && cfg.FollowInstanceMove {
+			move.rewriteCloneUrl(project)
+		}
+		gitlabProjects = append(gitlabProjects, project)
+	}
+
+	var errs []error
+	staleListing := false
+	cached := cachedListing(cfg, warn)
+	if replay != nil {
+		for _, project := range replay.Gitlab {
+			addProject(project)
+		}
+	} else if cached != nil {
+		// Kept as the last sync listed them, clone urls were rewritten already
+		info(msg("sync.listing_cached", time.Since(cached.ListedAt).Round(time.Second)))
+		for _, project := range cached.Projects {
+			listed := *project
+			gitlabProjects = append(gitlabProjects, &listed)
+		}
+	} else {
+		resume := loadListingCheckpoint(cfg, warn)
+		if resume != nil {
+			info(msg("sync.resuming_listing", time.Since(resume.StartedAt).Round(time.Second)))
+		} else {
+			info(msg("sync.fetching_projects", cfg.Gitlab.Url))
+		}
+
+		spinner := []string{"|", "/", "-", "\\"}
+		var checkpoint *gitlab.Checkpoint
+		checkpoint, errs = gl.ResumeSourceProjects(listCtx, listSource(cfg), cfg.Gitlab.Group, cfg.Depth, resume, func(p gitlab.Progress) {
+			if watching {
+				return
+			}
+			frame := spinner[(p.GroupsSeen+p.GroupsListed)%len(spinner)]
+			print(text.FgCyan.Sprint("\r" + msg("sync.scanned_groups", frame, p.GroupsListed, p.GroupsSeen, p.ProjectsFound)))
+		}, addProject)
+		if !watching {
+			println()
+		}
+
+		if cfg.Diagnostics {
+			printDiagnostics(gl.ListDiagnostics(), logFile)
+		}
+
+		err = saveListingCheckpoint(cfg, checkpoint, len(errs) > 0)
+		if err != nil {
+			warn(msg("sync.listing_save_failed", err))
+		}
+
+		// Projects moved while the listing was interrupted may be missing from both parts of it
+		staleListing = checkpoint.Resumed && time.Since(checkpoint.StartedAt) > cfg.Gitlab.ResumeWindow
+		if staleListing {
+			warn(msg("sync.stale_listing", time.Since(checkpoint.StartedAt).Round(time.Second)))
+		}
+	}
 
-	tasks, header := createTasks(gitlabProjects, localProjects, cfg.Local.Path)
+	failedGroups := failedGroups(errs, cfg.Gitlab.Group)
+	for _, err := range errs {
+		println(text.FgHiRed.Sprintf("%v", err))
+		events.Warning(err.Error())
+		warnings++
+	}
+	// Only a group can go on without some of its subgroups, other sources have nothing to tell what is missing
+	if len(errs) > 0 && (!listSource(cfg).Group() || len(failedGroups) < len(errs) || len(gitlabProjects) == 0) {
+		return nil, errors.New("errors getting gitlab projects")
+	}
+
+	// Kept in the state for gls stats and in the events for gls digest, only complete listings tell what there is
+	var listing *state.Listing
+	if replay == nil && cached == nil && len(errs) == 0 && !staleListing {
+		listing = &state.Listing{ListedAt: time.Now(), Source: listingSource(cfg), Projects: gitlabProjects}
+		inventory = takeInventory(gitlabProjects, listing.ListedAt)
+	}
+
+	if cfg.Wikis {
+		gitlabProjects = withWikis(gitlabProjects)
+	}
+
+	notes := loadNotes(cfg, warn)
+	if replay == nil && len(errs) == 0 && !staleListing && !cfg.DryRun {
+		err = reconcileNotes(cfg, notes, gitlabProjects)
+		if err != nil {
+			warn(msg("notes.save_failed", err))
+		}
+	}
+
+	noAccess := loadNoAccess(cfg, warn)
+	if replay == nil && len(errs) == 0 && !staleListing && !cfg.DryRun && recheckNoAccess(noAccess, gitlabProjects, info) {
+		err = noAccess.Save(cfg.Local.Path)
+		if err != nil {
+			warn(msg("no_access.save_failed", err))
+		}
+	}
+
+	ignore, err := loadIgnoreList(cfg.Local.Path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", ignoreFile, err)
+	}
+
+	var known []*git.Project
+	if replay == nil {
+		known = knownProjects(cfg, warn)
+	}
+
+	var localProjects []*git.Project
+	if replay != nil {
+		localProjects = replay.Local
+	} else {
+		info(msg("sync.loading_local", cfg.Local.Path))
+		localProjects, err = git.GetLocalProjects(cfg.Local.Path, known, cfg.Workers)
+		if err != nil {
+			return nil, fmt.Errorf("error getting local projects: %w", err)
+		}
+	}
+
+	// Clones gls started without them completing are started over, unless what's left of them is to stay
+	var journal *CloneJournal
+	if replay == nil {
+		journal = loadCloneJournal(cfg, warn)
+		if cfg.CleanPartial {
+			journal.markInterrupted(localProjects)
+		}
+	}
+
+	if cfg.Record != "" {
+		rec := &recording.Recording{Group: cfg.Gitlab.Group, Depth: cfg.Depth, Gitlab: listedProjects, Local: localProjects}
+		err = rec.Save(cfg.Record)
+		if err != nil {
+			return nil, fmt.Errorf("error saving recording: %w", err)
+		}
+		info(msg("sync.recorded", len(listedProjects), len(localProjects), cfg.Record))
+	}
+
+	// Ignored projects don't exist as far as gls is concerned, so they aren't missing either
+	gitlabProjects, localProjects, ignoredCount := ignore.filterIgnored(gitlabProjects, localProjects)
+	_, known, _ = ignore.filterIgnored(nil, known)
+
+	localProjects, broken := splitBroken(localProjects)
+	for _, project := range broken {
+		warning := msg("sync.broken_project", project.Path)
+		if project.Err != nil {
+			warning = msg("sync.unreadable_project", project.Path, project.Err)
+		}
+		warn(warning)
+	}
+
+	if move != nil && cfg.FollowInstanceMove {
+		move.rewriteOrigins(cfg.Local.Path, localProjects)
+	}
+
+	syncedProjects := syncScope(cfg, localProjects, gitlabProjects)
+
+	var conflicts map[string]*OriginConflict
+	if replay == nil {
+		var fixed []string
+		fixed, conflicts = checkOrigins(gitlabProjects, syncedProjects, cfg)
+		if len(fixed) > 0 {
+			info(msg("sync.origins_fixed", len(fixed)))
+		}
+	}
+
+	for _, path := range unlistedDeletions(failedGroups, gitlabProjects, syncedProjects) {
+		return nil, fmt.Errorf("refusing to continue, %s would be deleted although its group could not be listed", path)
+	}
+	if len(failedGroups) > 0 {
+		warn(msg("sync.continuing_without_groups"))
+	}
+
+	for _, path := range missingProjects(known, localProjects) {
+		warn(msg("sync.deleted_outside", path))
+	}
+
+	info(msg("sync.determining_actions"))
+
+	if cfg.VerifyDefaultBranch && replay == nil {
+		for _, warning := range verifyDefaultBranches(ctx, gitlabProjects, syncedProjects, overrides, cfg) {
+			warn(warning)
+		}
+	}
+
+	var orphans map[string]*gitlab.OrphanEvent
+	if replay == nil && listSource(cfg).Group() {
+		orphans = findOrphans(ctx, gl, cfg, gitlabProjects, syncedProjects)
+	}
+	excluded := excludedCounts(gitlabProjects, cfg)
+
+	var moves map[string]*MoveDecision
+	if cfg.DetectMoves && replay == nil && !staleListing {
+		var prompt func(string, []*MoveCandidate) (*MoveDecision, error)
+		if !cfg.DryRun && term.IsTerminal(int(os.Stdin.Fd())) {
+			prompt = askForMove(stdin, os.Stdout, cfg.Gitlab.Group)
+		}
+		moves, err = resolveMoves(ctx, gitlabProjects, syncedProjects, orphans, cfg, prompt, warn)
+		if err != nil {
+			return nil, fmt.Errorf("error reading input: %w", err)
+		}
+	}
+
+	internalTasks := planTasks(gitlabProjects, syncedProjects, orphans, overrides, conflicts, moves, notes, staleListing, cfg)
+	for _, task := range internalTasks {
+		task.Track = branchesToTrack(tracks, task)
+	}
+	skipNoAccess(internalTasks, noAccess)
+
+	var policySkips []*PolicySkip
+	if cfg.Hooks.PrePlan != "" && !cfg.NoHooks {
+		info(msg("policy.running"))
+		policySkips, err = runPrePlanHook(ctx, cfg, internalTasks, gitlabProjects)
+		if err != nil {
+			return nil, err
+		}
+		for _, skip := range policySkips {
+			events.Emit(&Event{Type: EventPolicySkipped, Project: skip.Project, Action: skip.Action, Skipped: true, Message: skip.Reason})
+			if logFile != nil {
+				logFile.Line(fmt.Sprintf("[gls] pre plan hook skipped %s %s: %s", skip.Action, skip.Project, skip.Reason))
+			}
+		}
+	}
+
+	if cfg.Interactive && !cfg.DryRun {
+		proceed, err := reviewPlan(internalTasks, stdin, os.Stdout)
+		if err != nil {
+			return nil, fmt.Errorf("error reading input: %w", err)
+		}
+		if !proceed {
+			println(text.FgYellow.Sprint(msg("sync.aborted")))
+			return nil, nil
+		}
+		recordReviewDecisions(internalTasks)
+	}
+
+	if replay == nil && !cfg.DryRun {
+		err = updateShadow(ctx, cfg, internalTasks, info)
+		if err != nil {
+			warn(msg("shadow.save_failed", err))
+		}
+	}
+
+	for _, task := range internalTasks {
+		events.Emit(&Event{Type: EventPlanned, Project: task.Key, Action: task.Action, Skipped: task.Skipped, Message: task.Ignored, Orphan: task.Orphan, Note: noteText(task.Note), Decision: task.Decision})
+	}
+
+	if cfg.DryRun {
+		printPlan(os.Stdout, internalTasks, "")
+		return nil, nil
+	}
+
+	tasks, header, layout := createTasks(internalTasks, cfg, cloneHosts(cfg, move), terminalWidth())
+	for _, task := range tasks {
+		task.Journal = journal
+	}
 
 	var messageLength = 0
 	for _, task := range tasks {
-		if len(task.Tracker.Message) > messageLength {
-			messageLength = len(task.Tracker.Message)
+		if text.StringWidthWithoutEscSequences(task.Tracker.Message) > messageLength {
+			messageLength = text.StringWidthWithoutEscSequences(task.Tracker.Message)
 		}
 	}
 
 	pw := progress.NewWriter()
 	pw.SetUpdateFrequency(time.Millisecond * 100)
 	pw.SetNumTrackersExpected(len(tasks))
-	pw.SetSortBy(progress.SortByMessage)
+	if cfg.GroupBySubgroup {
+		pw.SetSortBy(progress.SortByNone) // keep the order of the tasks, they are already grouped
+	} else {
+		pw.SetSortBy(progress.SortByMessage)
+	}
 	pw.SetTrackerPosition(progress.PositionRight)
 	pw.SetMessageLength(messageLength)
-	pw.SetTrackerLength(40)
+	pw.SetTrackerLength(layout.Tracker)
 
 	pw.SetStyle(progress.StyleDefault)
 	pw.Style().Visibility.Value = false
 	pw.Style().Options.Separator = ""
-	pw.Style().Options.DoneString = "done"
-	pw.Style().Options.ErrorString = "error"
+	pw.Style().Options.DoneString = msg("status.done")
+	pw.Style().Options.ErrorString = msg("status.error")
 
 	pw.Style().Colors = progress.StyleColorsExample
 	pw.Style().Colors.Percent = text.Colors{text.FgCyan}
@@ -153,234 +644,415 @@ func main() {
 	pw.Style().Options.TimeInProgressPrecision = time.Millisecond
 	pw.Style().Options.TimeDonePrecision = time.Millisecond
 
-	println(text.FgHiGreen.Sprintf("\n%s", header))
+	plain := NewPlainRenderer(tasks)
+	stopResizing := func() {}
+	switch {
+	case watching:
+		// Whether the table is worth showing is only known afterwards, it is printed from the results then
+		pw.SetOutputWriter(io.Discard)
+	case layout.Plain:
+		pw.SetOutputWriter(io.Discard)
+		println(text.FgCyan.Sprint("\n" + msg("layout.plain")))
+		plain.Start()
+	default:
+		// The live table can't be laid out again once it runs, a terminal made too narrow for it gets plain lines
+		live := &liveOutput{}
+		pw.SetOutputWriter(live)
+		stopResizing = onResize(func(width int) {
+			if layoutColumns(width, layout.Widths).Plain && !live.muted.Swap(true) {
+				println(text.FgCyan.Sprint("\n" + msg("layout.plain")))
+				plain.Start()
+			}
+		})
+		println(text.FgHiGreen.Sprintf("\n%s", header))
+	}
 	go pw.Render()
 
-	executeTasks(tasks, cfg.Workers, pw)
+	executeCycle(ctx, tasks, cfg, pw, logFile, events)
 
 	time.Sleep(time.Millisecond * 100) // wait for one more render cycle
 	pw.Stop()
+	stopResizing()
+	plain.Finish()
 
-	for _, task := range tasks {
-		if task.Error.Load() != nil {
-			println(text.FgHiRed.Sprintf("\nFailed to %s %s: %v", task.Action, task.Path, *task.Error.Load()))
+	summary := summarizeCycle(tasks, warnings, time.Since(start))
+	stats = collectStats(tasks, summary.Duration)
+	if watching {
+		if summary.Quiet() {
+			println(text.FgCyan.Sprint(msg("watch.quiet_cycle", cycle, summary.Checked, summary.Duration.Round(100*time.Millisecond))))
+			saveCycleState(cfg, localProjects, tasks, listing)
+			return summary, nil
 		}
+		println(text.FgHiGreen.Sprintf("\n%s", msg("watch.cycle", cycle)))
+		printTable(header, tasks)
 	}
-}
 
-func executeTasks(tasks []*Task, numWorkers int, pw progress.Writer) {
-	taskQueue := make(chan *Task, len(tasks))
-	var wg sync.WaitGroup
-	for i := 1; i <= numWorkers; i++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			for task := range taskQueue {
-				pw.AppendTracker(task.Tracker)
-				if task.Skipped {
-					task.Tracker.MarkAsDone()
-				} else {
-					task.Tracker.Start()
-					err := executeTask(task)
-					if err != nil {
-						task.Tracker.MarkAsErrored()
-						task.Error.Store(&err)
-					} else {
-						task.Tracker.MarkAsDone()
-					}
+	failed, hookFailed := 0, 0
+	lastGroup := ""
+	for _, task := range tasks {
+		if task.Error.Load() != nil {
+			if cfg.GroupBySubgroup && (failed+hookFailed == 0 || groupLabel(task.Key) != lastGroup) {
+				lastGroup = groupLabel(task.Key)
+				println(text.FgHiGreen.Sprint("\n" + lastGroup))
+			}
+
+			err := *task.Error.Load()
+			var hookErr *git.HookError
+			if errors.As(err, &hookErr) {
+				hookFailed++
+				println(text.FgHiRed.Sprint("\n" + msg("summary.hook_failed", task.Action, task.Path, hookErr.Err)))
+			} else {
+				failed++
+				println(text.FgHiRed.Sprint("\n" + msg("summary.task_failed", task.Action, task.Path, err)))
+				if task.Action == Pull && !cfg.Repair && git.IsCorruption(err) {
+					println(text.FgYellow.Sprint(msg("summary.corruption_hint", task.Key)))
 				}
 			}
-		}()
+		}
 	}
 
-	for _, task := range tasks {
-		taskQueue <- task
+	if len(policySkips) > 0 {
+		println(text.FgYellow.Sprint("\n" + msg("summary.policy_skipped", len(policySkips))))
+		for _, skip := range policySkips {
+			println(fmt.Sprintf("%s %s: %s", skip.Action, skip.Project, skip.Reason))
+		}
 	}
 
-	close(taskQueue)
-	wg.Wait()
-}
-
-func executeTask(task *Task) error {
-	pattern := regexp.MustCompile(`^Receiving objects:.*\((\d+)/(\d+)\)`)
-
-	lineProcessor := func(line string) {
-		matches := pattern.FindStringSubmatch(line)
+	if declined := declinedTasks(internalTasks); len(declined) > 0 {
+		println(text.FgYellow.Sprint("\n" + msg("summary.declined", len(declined))))
+		for _, key := range declined {
+			println(key)
+		}
+	}
 
-		if len(matches) == 3 { // matches[0] is the full match, [1] and [2] are the two numbers
-			current, _ := strconv.Atoi(matches[1])
-			total, _ := strconv.Atoi(matches[2])
-			task.Tracker.UpdateTotal(int64(total))
-			task.Tracker.SetValue(int64(current))
+	if failed > 0 || hookFailed > 0 {
+		println(text.FgHiRed.Sprint("\n" + msg("summary.failures", failed, hookFailed)))
+		if logFile != nil {
+			println(text.FgHiRed.Sprint(msg("summary.log_file", logFile.Path)))
 		}
 	}
 
-	switch task.Action {
-	case Clone:
-		return git.CloneProject(task.CloneUrl, task.Path, lineProcessor)
-	case Pull:
-		return git.PullProject(task.Path, lineProcessor)
-	case Delete:
-		return git.DeleteProject(task.Path)
+	if added := recordNoAccess(tasks, gitlabProjects, noAccess, time.Now()); len(added) > 0 {
+		println(text.FgYellow.Sprint("\n" + msg("summary.no_access", len(added))))
+		for _, known := range added {
+			println(fmt.Sprintf("%s (%s)", known.Path, accessLevelName(known.AccessLevel)))
+		}
+		err = noAccess.Save(cfg.Local.Path)
+		if err != nil {
+			warn(msg("no_access.save_failed", err))
+		}
 	}
-	return nil
-}
 
-type InternalTask struct {
-	Key      string
-	Action   Action
-	CloneUrl string
-	Skipped  bool
-	Message  string
-	Branch   string
-}
+	var changed []string
+	for _, task := range tasks {
+		if task.PullResult != nil && !task.PullResult.UpToDate {
+			changed = append(changed, fmt.Sprintf("%s (%s)", task.Key, describePull(task.PullResult)))
+		}
+	}
+	if len(changed) > 0 {
+		println(text.FgHiGreen.Sprint("\n" + msg("summary.changed", len(changed))))
+		for _, line := range changed {
+			println(line)
+		}
+	}
 
-func createTasks(gitlabProjects []*gitlab.Project, localProjects []*git.Project, localPath string) ([]*Task, string) {
-	var internalTasks []*InternalTask
-	for key, projectPair := range pairProjects(gitlabProjects, localProjects) {
-		// We have a remote and local copy, only need to pull
-		if projectPair.GitlabProject != nil && projectPair.LocalProject != nil {
-			if projectPair.GitlabProject.DefaultBranch == projectPair.LocalProject.Branch {
-				internalTasks = append(internalTasks, &InternalTask{
-					Key:     key,
-					Action:  Pull,
-					Message: "Pulling",
-					Branch:  projectPair.LocalProject.Branch,
-				})
-			} else {
-				internalTasks = append(internalTasks, &InternalTask{
-					Key:     key,
-					Action:  Pull,
-					Skipped: true,
-					Message: "Skipped pulling",
-					Branch:  projectPair.LocalProject.Branch,
-				})
+	var tracked, untracked []string
+	for _, task := range tasks {
+		for _, update := range task.Updates {
+			line := fmt.Sprintf("%s %s (%s)", task.Key, update.Branch, describeBranchUpdate(update))
+			if update.Rejected || update.Missing {
+				untracked = append(untracked, line)
+			} else if update.Created || update.Commits > 0 {
+				tracked = append(tracked, line)
 			}
 		}
+	}
+	if len(tracked) > 0 {
+		println(text.FgHiGreen.Sprint("\n" + msg("summary.tracked_updated", len(tracked))))
+		for _, line := range tracked {
+			println(line)
+		}
+	}
+	if len(untracked) > 0 {
+		println(text.FgYellow.Sprint("\n" + msg("summary.tracked_left_alone", len(untracked))))
+		for _, line := range untracked {
+			println(line)
+		}
+	}
 
-		// We don't have a local copy, so we clone
-		if projectPair.GitlabProject != nil && projectPair.LocalProject == nil {
-			internalTasks = append(internalTasks, &InternalTask{
-				Key:      key,
-				Action:   Clone,
-				Message:  "Cloning",
-				CloneUrl: projectPair.GitlabProject.CloneUrl,
-				Branch:   projectPair.GitlabProject.DefaultBranch,
-			})
+	var crowded []string
+	for _, task := range tasks {
+		if cfg.RemoteBranchLimit > 0 && task.Branches > cfg.RemoteBranchLimit {
+			crowded = append(crowded, fmt.Sprintf("%s (%d)", task.Key, task.Branches))
+		}
+	}
+	if len(crowded) > 0 {
+		println(text.FgYellow.Sprint("\n" + msg("summary.remote_branches", len(crowded), cfg.RemoteBranchLimit)))
+		for _, line := range crowded {
+			println(line)
+		}
+		if !cfg.Prune {
+			println(text.FgYellow.Sprint(msg("summary.prune_hint")))
 		}
+	}
 
-		// We only have a local copy, ask if we should delete it
-		if projectPair.GitlabProject == nil && projectPair.LocalProject != nil {
+	if ignoredCount > 0 {
+		println(text.FgCyan.Sprint("\n" + msg("summary.ignored", ignoredCount, ignoreFile)))
+	}
+	separator := "\n"
+	if ignoredCount > 0 {
+		separator = "" // right below the ignored projects
+	}
+	for _, filter := range planFilters(cfg) {
+		if count := excluded[filter.Name()]; count > 0 {
+			println(text.FgCyan.Sprint(separator + msg("summary.excluded", count, filter.Name())))
+			separator = ""
+		}
+	}
 
-			if askForConfirmation(text.FgMagenta.Sprintf("Do you want to delete %s?", key)) {
-				internalTasks = append(internalTasks, &InternalTask{
-					Key:     key,
-					Action:  Delete,
-					Message: "Deleting",
-					Branch:  projectPair.LocalProject.Branch,
-				})
+	if len(conflicts) > 0 {
+		println(text.FgYellow.Sprint("\n" + msg("summary.origin_conflicts", len(conflicts))))
+		moved := false
+		for _, conflict := range sortedConflicts(conflicts) {
+			println(msg("summary.origin_conflict", conflict.Path, conflict.Origin, conflict.Expected))
+			moved = moved || conflict.Moved
+		}
+		if moved {
+			println(text.FgYellow.Sprint(msg("summary.fix_remotes_hint")))
+		}
+	}
+
+	var repaired []*Task
+	for _, task := range tasks {
+		if task.Repaired {
+			repaired = append(repaired, task)
+		}
+	}
+	if len(repaired) > 0 {
+		println(text.FgHiGreen.Sprint("\n" + msg("summary.repaired", len(repaired), trashPath())))
+		for _, task := range repaired {
+			if len(task.Preserved) > 0 {
+				println(msg("summary.repaired_preserved", task.Key, strings.Join(task.Preserved, ", ")))
 			} else {
-				internalTasks = append(internalTasks, &InternalTask{
-					Key:     key,
-					Action:  Delete,
-					Skipped: true,
-					Message: "Skipped deletion",
-					Branch:  projectPair.LocalProject.Branch,
-				})
+				println(task.Key)
 			}
 		}
 	}
 
-	var messageHeader = "Action"
-	var keyHeader = "Project"
-	var branchHeader = "Branch"
-	var statusHeader = "Status"
+	printStats(stats)
+	reportMetrics(cfg, tasks)
 
-	var messageLength = len(messageHeader)
-	var keyLength = len(keyHeader)
-	var branchLength = len(branchHeader)
-	for _, internalTask := range internalTasks {
-		if len(internalTask.Message) > messageLength {
-			messageLength = len(internalTask.Message)
-		}
-		if len(internalTask.Key) > keyLength {
-			keyLength = len(internalTask.Key)
+	if dropped := events.Dropped(); dropped > 0 {
+		println(text.FgYellow.Sprint("\n" + msg("summary.events_dropped", dropped)))
+	}
+
+	saveCycleState(cfg, localProjects, tasks, listing)
+	return summary, nil
+}
+
+func saveCycleState(cfg Config, localProjects []*git.Project, tasks []*Task, listing *state.Listing) {
+	if !cfg.Local.State {
+		return
+	}
+
+	err := saveState(cfg.Local.Path, localProjects, tasks, listing)
+	if err != nil {
+		println(text.FgHiRed.Sprint("\n" + msg("summary.save_state_failed", err)))
+	}
+}
+
+// interruptContext is cancelled on the first SIGINT or SIGTERM, which kills all running git processes.
+// A second signal terminates gls right away
+func interruptContext() context.Context {
+	ctx, cancel := context.WithCancelCause(context.Background())
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		signal.Stop(signals)
+		cancel(errInterrupted)
+	}()
+
+	return ctx
+}
+
+func missingProjects(known []*git.Project, localProjects []*git.Project) []string {
+	found := make(map[string]bool)
+	for _, project := range localProjects {
+		found[project.Path] = true
+	}
+
+	var missing []string
+	for _, project := range known {
+		if !found[project.Path] {
+			missing = append(missing, project.Path)
 		}
-		if len(internalTask.Branch) > branchLength {
-			branchLength = len(internalTask.Branch)
+	}
+	return missing
+}
+
+// splitBroken separates the remains of failed deletes and unreadable repositories, they are never paired with Gitlab projects
+func splitBroken(projects []*git.Project) ([]*git.Project, []*git.Project) {
+	var intact, broken []*git.Project
+	for _, project := range projects {
+		if project.Broken {
+			broken = append(broken, project)
+		} else {
+			intact = append(intact, project)
 		}
 	}
+	return intact, broken
+}
 
-	var tasks []*Task
-	for _, internalTask := range internalTasks {
-		tasks = append(tasks, &Task{
-			Path:     filepath.Join(localPath, internalTask.Key),
-			CloneUrl: internalTask.CloneUrl,
-			Action:   internalTask.Action,
-			Skipped:  internalTask.Skipped,
-			Error:    atomic.Pointer[error]{},
-			Tracker: &progress.Tracker{
-				Message: text.Pad(internalTask.Message, messageLength+2, ' ') +
-					text.Pad(internalTask.Key, keyLength+2, ' ') +
-					text.Pad(internalTask.Branch, branchLength+2, ' '),
-			},
-		})
+// useHttps switches the clone url of a project to https with the given user
+func useHttps(project *gitlab.Project, username string) {
+	remote, err := git.ParseRemoteUrl(project.HttpUrl)
+	if err != nil {
+		return // keep ssh
 	}
+	remote.User = username
+	project.CloneUrl = remote.String()
+}
 
-	header := text.Pad(messageHeader, messageLength+2, ' ') +
-		text.Pad(keyHeader, keyLength+2, ' ') +
-		text.Pad(branchHeader, branchLength+2, ' ') +
-		statusHeader
+// withinDepth returns the projects at most depth subgroups below the group, a negative depth means unlimited
+func withinDepth(projects []*git.Project, depth int) []*git.Project {
+	if depth < 0 {
+		return projects
+	}
 
-	return tasks, header
+	var within []*git.Project
+	for _, project := range projects {
+		if strings.Count(project.Path, "/") <= depth {
+			within = append(within, project)
+		}
+	}
+	return within
 }
 
-type ProjectPair struct {
-	GitlabProject *gitlab.Project
-	LocalProject  *git.Project
+// loadListingCheckpoint returns the checkpoint of a listing that failed part way within the resume window, if any
+func loadListingCheckpoint(cfg Config, warn func(string)) *gitlab.Checkpoint {
+	if cfg.Gitlab.ResumeWindow <= 0 {
+		return nil
+	}
+
+	checkpoint, err := state.LoadListing(cfg.Local.Path)
+	if err != nil {
+		warn(msg("sync.ignoring_listing", err))
+		return nil
+	}
+	if checkpoint == nil || time.Since(checkpoint.StartedAt) > cfg.Gitlab.ResumeWindow {
+		return nil
+	}
+	return checkpoint
 }
 
-func pairProjects(gitlabProjects []*gitlab.Project, localProjects []*git.Project) map[string]*ProjectPair {
-	projectPairs := make(map[string]*ProjectPair)
-	for _, project := range gitlabProjects {
-		projectPair := projectPairs[project.Path]
-		if projectPair == nil {
-			projectPair = &ProjectPair{}
-		}
+// saveListingCheckpoint keeps the checkpoint of a failed listing for the next run, a complete one needs no resuming
+func saveListingCheckpoint(cfg Config, checkpoint *gitlab.Checkpoint, failed bool) error {
+	if !failed || cfg.Gitlab.ResumeWindow <= 0 {
+		return state.ClearListing(cfg.Local.Path)
+	}
+	if _, err := os.Stat(cfg.Local.Path); os.IsNotExist(err) {
+		return nil // nothing synced yet, the next run has to start over anyway
+	}
+	return state.SaveListing(cfg.Local.Path, checkpoint)
+}
 
-		projectPair.GitlabProject = project
-		projectPairs[project.Path] = projectPair
+// failedGroups returns the paths of the groups whose listing failed, relative to the synced group.
+// The synced group itself is returned as an empty path
+func failedGroups(errs []error, groupPath string) []string {
+	var groups []string
+	for _, err := range errs {
+		var listErr *gitlab.ListError
+		if errors.As(err, &listErr) {
+			if listErr.Group == groupPath {
+				groups = append(groups, "")
+			} else {
+				groups = append(groups, strings.TrimPrefix(listErr.Group, groupPath+"/"))
+			}
+		}
 	}
+	return groups
+}
 
-	for _, project := range localProjects {
-		projectPair := projectPairs[project.Path]
-		if projectPair == nil {
-			projectPair = &ProjectPair{}
+// unlistedDeletions returns the local projects that would be deleted only because their group could not be listed
+func unlistedDeletions(failedGroups []string, gitlabProjects []*gitlab.Project, localProjects []*git.Project) []string {
+	var paths []string
+	for key, pair := range pairProjects(gitlabProjects, localProjects) {
+		if pair.GitlabProject != nil || pair.LocalProject == nil {
+			continue
+		}
+
+		for _, group := range failedGroups {
+			if group == "" || strings.HasPrefix(key, group+"/") {
+				paths = append(paths, key)
+				break
+			}
 		}
+	}
+	sort.Strings(paths)
+	return paths
+}
 
-		projectPair.LocalProject = project
-		projectPairs[project.Path] = projectPair
+// saveState records what is on disk after the run. Projects touched by failed tasks are left out,
+// so the next run has to look at them again. Without a new listing the previous one is kept
+// knownProjects are the local projects the state file remembers, trusted as long as they didn't change. Without
+// them every project is opened, as with --refresh or when the state file can't be read
+func knownProjects(cfg Config, warn func(string)) []*git.Project {
+	if !cfg.Local.State || cfg.Refresh {
+		return nil
+	}
+	st, err := state.Load(cfg.Local.Path)
+	if err != nil {
+		warn(msg("sync.ignoring_state", err))
 	}
-	return projectPairs
+	return st.Projects
 }
 
-func askForConfirmation(promt string) bool {
-	reader := bufio.NewReader(os.Stdin)
+func saveState(localPath string, localProjects []*git.Project, tasks []*Task, listing *state.Listing) error {
+	projects := make(map[string]*git.Project)
+	for _, project := range localProjects {
+		projects[project.Path] = project
+	}
 
-	for {
-		fmt.Printf("%s [y/n]: ", promt)
+	for _, task := range tasks {
+		if task.Skipped {
+			continue
+		}
 
-		response, err := reader.ReadString('\n')
-		if err != nil {
-			log.Fatalf("Error reading input: %v", err)
+		if task.Action == Move {
+			delete(projects, task.From) // gone from there, whether the move worked or not is seen below
+		}
+		if task.Error.Load() != nil || task.Action == Delete {
+			delete(projects, task.Key)
+			continue
 		}
 
-		response = strings.ToLower(strings.TrimSpace(response))
+		project, err := git.GetLocalProject(localPath, task.Key)
+		if err != nil {
+			delete(projects, task.Key)
+			continue
+		}
+		projects[task.Key] = project
+	}
 
-		if response == "y" || response == "yes" {
-			return true
-		} else if response == "n" || response == "no" {
-			return false
+	st := &state.State{Listing: listing}
+	if listing == nil {
+		previous, _ := state.Load(localPath)
+		st.Listing = previous.Listing
+	}
+	for _, task := range tasks {
+		if task.Error.Load() != nil {
+			st.Failed = append(st.Failed, task.Key)
 		}
 	}
+	sort.Strings(st.Failed)
+	for _, project := range projects {
+		st.Projects = append(st.Projects, project)
+	}
+	sort.Slice(st.Projects, func(i, j int) bool {
+		return st.Projects[i].Path < st.Projects[j].Path
+	})
+
+	return st.Save(localPath)
 }
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"gls/pkg/git"
+	"gls/pkg/gitlab"
+	"gls/pkg/state"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestKnownProjects(t *testing.T) {
+	tests := []struct {
+		name    string
+		state   bool
+		refresh bool
+		corrupt string // written over the state file
+		known   []string
+		warned  bool
+	}{
+		{name: "state", state: true, known: []string{"acme/api", "acme/web"}},
+		{name: "refresh", state: true, refresh: true},
+		{name: "no state", state: false},
+		{name: "not json", state: true, corrupt: "{\"projects\": [", warned: true},
+		{name: "cut off", state: true, corrupt: "truncated", warned: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			local := t.TempDir()
+			for _, key := range []string{"acme/api", "acme/web"} {
+				initRepo(t, filepath.Join(local, filepath.FromSlash(key)), true)
+			}
+			saved, err := git.GetLocalProjects(local, nil, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := (&state.State{Projects: saved}).Save(local); err != nil {
+				t.Fatal(err)
+			}
+			switch test.corrupt {
+			case "":
+			case "truncated":
+				path := filepath.Join(local, state.FileName)
+				content, err := os.ReadFile(path)
+				if err == nil {
+					err = os.WriteFile(path, content[:len(content)/2], 0644)
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+			default:
+				if err := os.WriteFile(filepath.Join(local, state.FileName), []byte(test.corrupt), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var cfg Config
+			cfg.Local.Path = local
+			cfg.Local.State = test.state
+			cfg.Refresh = test.refresh
+			var warnings []string
+			known := knownProjects(cfg, func(warning string) {
+				warnings = append(warnings, warning)
+			})
+
+			var paths []string
+			for _, project := range known {
+				paths = append(paths, project.Path)
+			}
+			if !slices.Equal(paths, test.known) {
+				t.Errorf("knew %q, want %q", paths, test.known)
+			}
+			if warned := len(warnings) > 0; warned != test.warned || len(warnings) > 1 {
+				t.Errorf("warned %q", warnings)
+			}
+
+			// Whatever was known, the walk finds every project
+			projects, err := git.GetLocalProjects(local, known, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(projects) != 2 || projects[0].Path != "acme/api" || projects[1].Path != "acme/web" || projects[0].Commit == "" {
+				t.Errorf("found %+v", projects)
+			}
+		})
+	}
+}
+
+func TestUnlistedDeletions(t *testing.T) {
+	timeout := errors.New("context deadline exceeded")
+	listed := []*gitlab.Project{{Path: "api"}, {Path: "team/web"}}
+	local := []*git.Project{{Path: "api"}, {Path: "team/web"}, {Path: "team/old"}, {Path: "teamwork/old"}, {Path: "ops/deep/old"}, {Path: "gone"}}
+
+	tests := []struct {
+		name   string
+		errs   []error
+		failed []string
+		paths  []string
+	}{
+		{name: "everything listed"},
+		{name: "subgroup timed out", errs: []error{&gitlab.ListError{Group: "acme/team", Endpoint: "groups/2/projects", Err: timeout}},
+			failed: []string{"team"}, paths: []string{"team/old"}},
+		{name: "nested subgroup", errs: []error{fmt.Errorf("page 2: %w", &gitlab.ListError{Group: "acme/ops/deep", Err: timeout})},
+			failed: []string{"ops/deep"}, paths: []string{"ops/deep/old"}},
+		{name: "the group itself", errs: []error{&gitlab.ListError{Group: "acme", Err: timeout}},
+			failed: []string{""}, paths: []string{"gone", "ops/deep/old", "team/old", "teamwork/old"}},
+		{name: "not a listing error", errs: []error{timeout}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			failed := failedGroups(test.errs, "acme")
+			if !slices.Equal(failed, test.failed) {
+				t.Errorf("failed groups %q, want %q", failed, test.failed)
+			}
+			if paths := unlistedDeletions(failed, listed, local); !slices.Equal(paths, test.paths) {
+				t.Errorf("refused to delete %q, want %q", paths, test.paths)
+			}
+		})
+	}
+}
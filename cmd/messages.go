@@ -0,0 +1,67 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"log"
+)
+
+// locales holds one catalog per language, en is complete and the fallback for every other one
+//
+//go:embed locales/*.json
+var locales embed.FS
+
+const defaultLang = "en"
+
+var (
+	defaultCatalog = loadCatalog(defaultLang)
+	catalog        = defaultCatalog
+	currentLang    = defaultLang
+)
+
+func loadCatalog(lang string) map[string]string {
+	content, err := locales.ReadFile("locales/" + lang + ".json")
+	if err != nil {
+		return nil
+	}
+
+	var messages map[string]string
+	err = json.Unmarshal(content, &messages)
+	if err != nil {
+		log.Fatalf("Error reading catalog %s: %v", lang, err)
+	}
+	return messages
+}
+
+// setLang switches the output to lang, unknown languages keep the current one
+func setLang(lang string) {
+	if lang == "" || lang == currentLang {
+		return
+	}
+	currentLang = lang
+
+	messages := loadCatalog(lang)
+	if messages == nil {
+		println(msg("lang.unknown", lang))
+		return
+	}
+	catalog = messages
+}
+
+// msg returns the message with the given id in the current language, formatted with args.
+// Messages missing in the current language fall back to english
+func msg(id string, args ...any) string {
+	format, ok := catalog[id]
+	if !ok {
+		format, ok = defaultCatalog[id]
+	}
+	if !ok {
+		format = id
+	}
+
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
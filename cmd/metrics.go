@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/jedib0t/go-pretty/v6/progress"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"gls/pkg/git"
+	"gls/pkg/storage"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// TaskMetric is what was measured while a single task talked to its remote
+type TaskMetric struct {
+	Host     string
+	Protocol string
+	Duration time.Duration
+	Bytes    int64   // received bytes as last reported by git, 0 if unknown
+	Rate     float64 // bytes per second as last reported by git, 0 if unknown
+}
+
+// HostMetrics aggregates the tasks of one host and protocol
+type HostMetrics struct {
+	Host        string        `json:"host"`
+	Protocol    string        `json:"protocol"`
+	Tasks       int           `json:"tasks"`
+	Bytes       int64         `json:"bytes"`
+	Median      time.Duration `json:"median_ns"`
+	P95         time.Duration `json:"p95_ns"`
+	AverageRate float64       `json:"average_rate"` // bytes per second, only counting tasks that reported a rate
+}
+
+func newTaskMetric(cloneUrl string) *TaskMetric {
+	metric := &TaskMetric{Host: "unknown", Protocol: "unknown"}
+
+	remote, err := git.ParseRemoteUrl(cloneUrl)
+	if err == nil {
+		metric.Host = remote.Host
+		metric.Protocol = remote.Scheme
+		if remote.Scheme == "" {
+			metric.Protocol = "ssh" // scp style
+		}
+	}
+	return metric
+}
+
+var transferPattern = regexp.MustCompile(`^Receiving objects:.*, ([\d.]+) (bytes|KiB|MiB|GiB)(?: \| ([\d.]+) (bytes|KiB|MiB|GiB)/s)?`)
+
+// parseTransfer updates the metric from a git progress line, other lines are ignored
+func (m *TaskMetric) parseTransfer(line string) {
+	matches := transferPattern.FindStringSubmatch(line)
+	if matches == nil {
+		return
+	}
+
+	m.Bytes = int64(parseSize(matches[1], matches[2]))
+	if matches[3] != "" {
+		m.Rate = parseSize(matches[3], matches[4])
+	}
+}
+
+func parseSize(value string, unit string) float64 {
+	size, _ := strconv.ParseFloat(value, 64)
+	switch unit {
+	case "KiB":
+		size *= 1 << 10
+	case "MiB":
+		size *= 1 << 20
+	case "GiB":
+		size *= 1 << 30
+	}
+	return size
+}
+
+// aggregateMetrics groups the metrics by host and protocol, sorted by host
+func aggregateMetrics(metrics []*TaskMetric) []*HostMetrics {
+	type key struct{ host, protocol string }
+	grouped := make(map[key][]*TaskMetric)
+	for _, metric := range metrics {
+		k := key{metric.Host, metric.Protocol}
+		grouped[k] = append(grouped[k], metric)
+	}
+
+	var result []*HostMetrics
+	for k, metrics := range grouped {
+		host := &HostMetrics{Host: k.host, Protocol: k.protocol, Tasks: len(metrics)}
+
+		var durations []time.Duration
+		var rateSum float64
+		rates := 0
+		for _, metric := range metrics {
+			durations = append(durations, metric.Duration)
+			host.Bytes += metric.Bytes
+			if metric.Rate > 0 {
+				rateSum += metric.Rate
+				rates++
+			}
+		}
+		sort.Slice(durations, func(i, j int) bool {
+			return durations[i] < durations[j]
+		})
+
+		host.Median = percentile(durations, 50)
+		host.P95 = percentile(durations, 95)
+		if rates > 0 {
+			host.AverageRate = rateSum / float64(rates)
+		}
+		result = append(result, host)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Host != result[j].Host {
+			return result[i].Host < result[j].Host
+		}
+		return result[i].Protocol < result[j].Protocol
+	})
+	return result
+}
+
+// percentile uses the nearest rank method on sorted durations
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[max(rank, 1)-1]
+}
+
+func printMetrics(hosts []*HostMetrics) {
+	rows := [][]string{{
+		msg("metrics.host"), msg("metrics.protocol"), msg("metrics.tasks"), msg("metrics.bytes"),
+		msg("metrics.median"), msg("metrics.p95"), msg("metrics.rate"),
+	}}
+	for _, host := range hosts {
+		bytes, rate := "-", "-"
+		if host.Bytes > 0 {
+			bytes = progress.FormatBytes(host.Bytes)
+		}
+		if host.AverageRate > 0 {
+			rate = progress.FormatBytes(int64(host.AverageRate)) + "/s"
+		}
+
+		rows = append(rows, []string{
+			host.Host,
+			host.Protocol,
+			strconv.Itoa(host.Tasks),
+			bytes,
+			host.Median.Round(time.Millisecond).String(),
+			host.P95.Round(time.Millisecond).String(),
+			rate,
+		})
+	}
+
+	widths := make([]int, len(rows[0]))
+	for _, row := range rows {
+		for i, cell := range row {
+			widths[i] = max(widths[i], text.StringWidthWithoutEscSequences(cell))
+		}
+	}
+
+	println()
+	for i, row := range rows {
+		line := ""
+		for j, cell := range row {
+			line += text.Pad(cell, widths[j]+2, ' ')
+		}
+		if i == 0 {
+			line = text.FgHiGreen.Sprint(line)
+		}
+		println(line)
+	}
+}
+
+func writeMetrics(path string, hosts []*HostMetrics) error {
+	content, err := json.MarshalIndent(hosts, "", "  ")
+	if err != nil {
+		return err
+	}
+	return storage.WriteFile(path, content, 0644)
+}
+
+// collectMetrics returns the metrics of all tasks that ran successfully
+func collectMetrics(tasks []*Task) []*TaskMetric {
+	var metrics []*TaskMetric
+	for _, task := range tasks {
+		if task.Metric != nil && task.Error.Load() == nil {
+			metrics = append(metrics, task.Metric)
+		}
+	}
+	return metrics
+}
+
+func reportMetrics(cfg Config, tasks []*Task) {
+	hosts := aggregateMetrics(collectMetrics(tasks))
+	if cfg.Metrics {
+		printMetrics(hosts)
+	}
+	if cfg.MetricsFile != "" {
+		err := writeMetrics(cfg.MetricsFile, hosts)
+		if err != nil {
+			println(text.FgHiRed.Sprint("\n" + msg("metrics.write_failed", cfg.MetricsFile, err)))
+		}
+	}
+}
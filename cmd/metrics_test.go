@@ -0,0 +1,88 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseTransfer(t *testing.T) {
+	tests := []struct {
+		line  string
+		bytes int64
+		rate  float64
+	}{
+		{line: "Receiving objects:  45% (450/1000), 1.50 MiB | 3.00 MiB/s", bytes: 1572864, rate: 3145728},
+		{line: "Receiving objects: 100% (1000/1000), 2.25 GiB | 512.00 KiB/s, done.", bytes: 2415919104, rate: 524288},
+		{line: "Receiving objects: 100% (3/3), 312 bytes | 312.00 bytes/s, done.", bytes: 312, rate: 312},
+		{line: "Receiving objects: 100% (3/3), 12.00 KiB, done.", bytes: 12288},
+		{line: "Resolving deltas: 100% (10/10), done."},
+		{line: "remote: Counting objects: 1.5 MiB"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.line, func(t *testing.T) {
+			metric := &TaskMetric{}
+			metric.parseTransfer(test.line)
+			if metric.Bytes != test.bytes || metric.Rate != test.rate {
+				t.Errorf("got %d bytes at %.0f/s, want %d at %.0f/s", metric.Bytes, metric.Rate, test.bytes, test.rate)
+			}
+		})
+	}
+}
+
+func TestAggregateMetrics(t *testing.T) {
+	metric := func(cloneUrl string, seconds int, bytes int64, rate float64) *TaskMetric {
+		m := newTaskMetric(cloneUrl)
+		m.Duration, m.Bytes, m.Rate = time.Duration(seconds)*time.Second, bytes, rate
+		return m
+	}
+
+	got := aggregateMetrics([]*TaskMetric{
+		metric("git@gitlab.example.com:acme/a.git", 3, 100, 50),
+		metric("git@gitlab.example.com:acme/b.git", 1, 0, 0), // up to date, git reported nothing
+		metric("ssh://git@gitlab.example.com:2222/acme/c.git", 2, 300, 150),
+		metric("https://gitlab.example.com/acme/d.git", 20, 1000, 10),
+		metric("https://mirror.example.com/acme/d.git", 4, 10, 0),
+		metric("not a url", 1, 0, 0),
+	})
+	want := []*HostMetrics{
+		{Host: "gitlab.example.com", Protocol: "https", Tasks: 1, Bytes: 1000, Median: 20 * time.Second, P95: 20 * time.Second, AverageRate: 10},
+		{Host: "gitlab.example.com", Protocol: "ssh", Tasks: 3, Bytes: 400, Median: 2 * time.Second, P95: 3 * time.Second, AverageRate: 100},
+		{Host: "mirror.example.com", Protocol: "https", Tasks: 1, Bytes: 10, Median: 4 * time.Second, P95: 4 * time.Second},
+		{Host: "unknown", Protocol: "unknown", Tasks: 1, Median: time.Second, P95: time.Second},
+	}
+	if !reflect.DeepEqual(got, want) {
+		for _, host := range got {
+			t.Logf("%+v", *host)
+		}
+		t.Error("aggregated differently")
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	durations := make([]time.Duration, 20)
+	for i := range durations {
+		durations[i] = time.Duration(i+1) * time.Millisecond
+	}
+
+	tests := []struct {
+		sorted []time.Duration
+		p      float64
+		want   time.Duration
+	}{
+		{sorted: nil, p: 50},
+		{sorted: durations[:1], p: 95, want: time.Millisecond},
+		{sorted: durations[:2], p: 50, want: time.Millisecond},
+		{sorted: durations[:3], p: 50, want: 2 * time.Millisecond},
+		{sorted: durations, p: 95, want: 19 * time.Millisecond},
+		{sorted: durations, p: 0, want: time.Millisecond},
+		{sorted: durations, p: 100, want: 20 * time.Millisecond},
+	}
+
+	for _, test := range tests {
+		if got := percentile(test.sorted, test.p); got != test.want {
+			t.Errorf("p%.0f of %d durations is %s, want %s", test.p, len(test.sorted), got, test.want)
+		}
+	}
+}
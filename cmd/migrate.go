@@ -0,0 +1,297 @@
+package main
+
+import (
+	"fmt"
+	"github.com/cristalhq/aconfig"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/joho/godotenv"
+	"gls/pkg/storage"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// currentConfigVersion is the layout of the config file this version of gls writes and expects
+const currentConfigVersion = 2
+
+const configVersionKey = "CONFIG_VERSION"
+
+// configMigration upgrades the config file from one version to the next
+type configMigration struct {
+	From    int
+	Renames map[string]string // old key to new key
+}
+
+var configMigrations = []configMigration{
+	// Version 1 is the original flat file without CONFIG_VERSION, all keys stayed the same
+	{From: 1, Renames: map[string]string{}},
+}
+
+func configFileVersion(values map[string]string) (int, error) {
+	raw, ok := values[configVersionKey]
+	if !ok {
+		return 1, nil
+	}
+
+	version, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q", configVersionKey, raw)
+	}
+	if version > currentConfigVersion {
+		return 0, fmt.Errorf("config file has version %d, this gls only understands up to version %d", version, currentConfigVersion)
+	}
+	return version, nil
+}
+
+// migrateConfig upgrades the values of a config file to the current version.
+// Returns the version the file had before
+func migrateConfig(values map[string]string) (map[string]string, int, error) {
+	version, err := configFileVersion(values)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	migrated := make(map[string]string, len(values))
+	for key, value := range values {
+		migrated[key] = value
+	}
+
+	for _, migration := range configMigrations {
+		if migration.From < version {
+			continue
+		}
+
+		for oldKey, newKey := range migration.Renames {
+			value, ok := migrated[oldKey]
+			if ok {
+				delete(migrated, oldKey)
+				migrated[newKey] = value
+			}
+		}
+	}
+
+	migrated[configVersionKey] = strconv.Itoa(currentConfigVersion)
+	return migrated, version, nil
+}
+
+// migrateConfigLines applies the migrations to the lines of a config file, keeping comments and order intact
+func migrateConfigLines(lines []string, version int) []string {
+	renames := make(map[string]string)
+	for _, migration := range configMigrations {
+		if migration.From < version {
+			continue
+		}
+		for oldKey, newKey := range migration.Renames {
+			renames[oldKey] = newKey
+		}
+	}
+
+	versionLine := fmt.Sprintf("%s=%d", configVersionKey, currentConfigVersion)
+
+	var migrated []string
+	hasVersion := false
+	for _, line := range lines {
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(key), "export "))
+
+		switch {
+		case !ok || strings.HasPrefix(key, "#"):
+			migrated = append(migrated, line)
+		case key == configVersionKey:
+			hasVersion = true
+			migrated = append(migrated, versionLine)
+		case renames[key] != "":
+			migrated = append(migrated, renames[key]+"="+value)
+		default:
+			migrated = append(migrated, line)
+		}
+	}
+
+	if !hasVersion {
+		migrated = append([]string{versionLine}, migrated...)
+	}
+	return migrated
+}
+
+// configKeys returns all keys the config file may contain
+func configKeys() []string {
+	var keys []string
+	walkConfigKeys(func(key string, _ aconfig.Field) {
+		keys = append(keys, key)
+	})
+	return keys
+}
+
+// secretConfigKeys returns the keys of config values tagged as secret, which must never leave the machine
+func secretConfigKeys() []string {
+	var keys []string
+	walkConfigKeys(func(key string, field aconfig.Field) {
+		if field.Tag("secret") == "true" {
+			keys = append(keys, key)
+		}
+	})
+	return keys
+}
+
+func walkConfigKeys(fn func(key string, field aconfig.Field)) {
+	loader := aconfig.LoaderFor(&Config{}, aconfig.Config{
+		SkipDefaults: true,
+		SkipFiles:    true,
+		SkipEnv:      true,
+		SkipFlags:    true,
+	})
+
+	loader.WalkFields(func(field aconfig.Field) bool {
+		key := field.Tag("env")
+		for parent, ok := field.Parent(); ok; parent, ok = parent.Parent() {
+			key = parent.Tag("env") + "_" + key
+		}
+		fn(key, field)
+		return true
+	})
+}
+
+// unknownConfigKeys removes keys gls doesn't know from values and returns a warning for each of them
+func unknownConfigKeys(values map[string]string) []string {
+	valid := configKeys()
+
+	var warnings []string
+	for key := range values {
+		if containsString(valid, key) {
+			continue
+		}
+
+		delete(values, key)
+		warning := msg("config.unknown_key", key)
+		if suggestion := nearestKey(key, valid); suggestion != "" {
+			warning = msg("config.unknown_key_suggestion", key, suggestion)
+		}
+		warnings = append(warnings, warning)
+	}
+	return warnings
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// nearestKey returns the valid key closest to key, as long as it is close enough to be a plausible typo
+func nearestKey(key string, valid []string) string {
+	best, bestDistance := "", len(key)/3+2
+	for _, candidate := range valid {
+		distance := editDistance(key, candidate)
+		if distance < bestDistance {
+			best, bestDistance = candidate, distance
+		}
+	}
+	return best
+}
+
+func editDistance(a string, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+// diffLines renders a line based diff of two files, based on their longest common subsequence
+func diffLines(before []string, after []string) []string {
+	lcs := make([][]int, len(before)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(after)+1)
+	}
+	for i := len(before) - 1; i >= 0; i-- {
+		for j := len(after) - 1; j >= 0; j-- {
+			if before[i] == after[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var diff []string
+	i, j := 0, 0
+	for i < len(before) || j < len(after) {
+		switch {
+		case i < len(before) && j < len(after) && before[i] == after[j]:
+			diff = append(diff, "  "+before[i])
+			i++
+			j++
+		case j < len(after) && (i == len(before) || lcs[i][j+1] >= lcs[i+1][j]):
+			diff = append(diff, text.FgGreen.Sprint("+ "+after[j]))
+			j++
+		default:
+			diff = append(diff, text.FgRed.Sprint("- "+before[i]))
+			i++
+		}
+	}
+	return diff
+}
+
+// runConfigMigrate rewrites the config file in the current format after showing what changes
+func runConfigMigrate(configPath string) {
+	content, err := os.ReadFile(configPath)
+	if err != nil {
+		log.Fatalf("Error reading config file: %v", err)
+	}
+
+	values, err := godotenv.UnmarshalBytes(content)
+	if err != nil {
+		log.Fatalf("Error parsing config file: %v", err)
+	}
+
+	version, err := configFileVersion(values)
+	if err != nil {
+		log.Fatalf("Error reading config file: %v", err)
+	}
+
+	if version == currentConfigVersion {
+		println(text.FgCyan.Sprint(msg("migrate.up_to_date", configPath, currentConfigVersion)))
+		return
+	}
+
+	lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+	migrated := migrateConfigLines(lines, version)
+
+	println(text.FgCyan.Sprint(msg("migrate.migrating", configPath, version, currentConfigVersion)))
+	for _, line := range diffLines(lines, migrated) {
+		println(line)
+	}
+
+	if !askForConfirmation(text.FgMagenta.Sprint(msg("config.confirm_write", configPath))) {
+		return
+	}
+
+	err = storage.WriteFile(configPath+".bak", content, 0600)
+	if err != nil {
+		log.Fatalf("Error writing backup: %v", err)
+	}
+
+	err = storage.WriteFile(configPath, []byte(strings.Join(migrated, "\n")+"\n"), 0600)
+	if err != nil {
+		log.Fatalf("Error writing config file: %v", err)
+	}
+
+	println(text.FgCyan.Sprint(msg("migrate.done", configPath)))
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// withMigrations swaps in migrations for a test, the real ones don't rename anything yet
+func withMigrations(t *testing.T, migrations []configMigration) {
+	t.Helper()
+	previous := configMigrations
+	configMigrations = migrations
+	t.Cleanup(func() {
+		configMigrations = previous
+	})
+}
+
+func TestConfigFileVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  map[string]string
+		version int
+		err     string
+	}{
+		{name: "missing is version 1", values: map[string]string{"LOCAL_PATH": "/tmp"}, version: 1},
+		{name: "current", values: map[string]string{configVersionKey: "2"}, version: 2},
+		{name: "older", values: map[string]string{configVersionKey: "1"}, version: 1},
+		{name: "newer", values: map[string]string{configVersionKey: "3"}, err: "only understands up to version 2"},
+		{name: "not a number", values: map[string]string{configVersionKey: "two"}, err: "invalid CONFIG_VERSION"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			version, err := configFileVersion(test.values)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("got error %v, want one containing %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if version != test.version {
+				t.Errorf("got version %d, want %d", version, test.version)
+			}
+		})
+	}
+}
+
+func TestMigrateConfig(t *testing.T) {
+	withMigrations(t, []configMigration{
+		{From: 1, Renames: map[string]string{"TOKEN": "GITLAB_TOKEN", "PATH": "LOCAL_PATH"}},
+	})
+
+	tests := []struct {
+		name     string
+		values   map[string]string
+		migrated map[string]string
+		from     int
+	}{
+		{
+			name:     "version 1 is renamed",
+			values:   map[string]string{"TOKEN": "secret", "PATH": "/src", "WORKERS": "4"},
+			migrated: map[string]string{"GITLAB_TOKEN": "secret", "LOCAL_PATH": "/src", "WORKERS": "4", configVersionKey: "2"},
+			from:     1,
+		},
+		{
+			name:     "explicit version 1",
+			values:   map[string]string{configVersionKey: "1", "TOKEN": "secret"},
+			migrated: map[string]string{"GITLAB_TOKEN": "secret", configVersionKey: "2"},
+			from:     1,
+		},
+		{
+			name:     "current version stays as it is",
+			values:   map[string]string{configVersionKey: "2", "TOKEN": "kept"},
+			migrated: map[string]string{configVersionKey: "2", "TOKEN": "kept"},
+			from:     2,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			original := make(map[string]string)
+			for key, value := range test.values {
+				original[key] = value
+			}
+
+			migrated, from, err := migrateConfig(test.values)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if from != test.from {
+				t.Errorf("got version %d, want %d", from, test.from)
+			}
+			if !reflect.DeepEqual(migrated, test.migrated) {
+				t.Errorf("got %v, want %v", migrated, test.migrated)
+			}
+			if !reflect.DeepEqual(test.values, original) {
+				t.Errorf("the values passed in changed to %v", test.values)
+			}
+		})
+	}
+}
+
+func TestMigrateConfigLines(t *testing.T) {
+	withMigrations(t, []configMigration{
+		{From: 1, Renames: map[string]string{"TOKEN": "GITLAB_TOKEN"}},
+	})
+
+	tests := []struct {
+		name     string
+		lines    []string
+		version  int
+		migrated []string
+	}{
+		{
+			name:     "adds the version and keeps comments and order",
+			lines:    []string{"# gitlab", "TOKEN=secret", "", "LOCAL_PATH=/src"},
+			version:  1,
+			migrated: []string{"CONFIG_VERSION=2", "# gitlab", "GITLAB_TOKEN=secret", "", "LOCAL_PATH=/src"},
+		},
+		{
+			name:     "replaces the version in place",
+			lines:    []string{"LOCAL_PATH=/src", "CONFIG_VERSION=1", "export TOKEN=secret"},
+			version:  1,
+			migrated: []string{"LOCAL_PATH=/src", "CONFIG_VERSION=2", "GITLAB_TOKEN=secret"},
+		},
+		{
+			name:     "commented keys stay",
+			lines:    []string{"#TOKEN=old"},
+			version:  1,
+			migrated: []string{"CONFIG_VERSION=2", "#TOKEN=old"},
+		},
+		{
+			name:     "renames of older versions don't apply",
+			lines:    []string{"CONFIG_VERSION=2", "TOKEN=secret"},
+			version:  2,
+			migrated: []string{"CONFIG_VERSION=2", "TOKEN=secret"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			migrated := migrateConfigLines(test.lines, test.version)
+			if !reflect.DeepEqual(migrated, test.migrated) {
+				t.Errorf("got %q, want %q", migrated, test.migrated)
+			}
+		})
+	}
+}
+
+func TestUnknownConfigKeys(t *testing.T) {
+	values := map[string]string{"LOCAL_PATH": "/src", "GITLAB_TOKN": "secret", "SOMETHING_ELSE": "x"}
+	warnings := unknownConfigKeys(values)
+
+	if !reflect.DeepEqual(values, map[string]string{"LOCAL_PATH": "/src"}) {
+		t.Errorf("unknown keys weren't removed: %v", values)
+	}
+	if len(warnings) != 2 {
+		t.Fatalf("got %d warnings, want 2: %q", len(warnings), warnings)
+	}
+	joined := strings.Join(warnings, "\n")
+	if !strings.Contains(joined, "GITLAB_TOKEN") {
+		t.Errorf("no suggestion for the typo: %q", warnings)
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"gls/pkg/git"
+	"gls/pkg/gitlab"
+	"io"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MatchRank is how sure gls is that a project new on Gitlab is a local one that moved there, higher is surer
+type MatchRank int
+
+const (
+	MatchName    MatchRank = iota + 1 // same name in another namespace
+	MatchHistory                      // same name and the commits of the local copy
+	MatchAudit                        // the audit events name it as where the local one went
+)
+
+var matchMessages = map[MatchRank]string{
+	MatchName:    "moves.match_name",
+	MatchHistory: "moves.match_history",
+	MatchAudit:   "moves.match_audit",
+}
+
+// MoveCandidate is a project new on Gitlab that a local project gone from Gitlab may have moved to
+type MoveCandidate struct {
+	Project *gitlab.Project
+	Rank    MatchRank
+}
+
+// MoveDecision is what happens to a local project gone from Gitlab that may have moved.
+// Without To and Skip it is deleted or not like any other such project
+type MoveDecision struct {
+	To   *gitlab.Project
+	Skip bool // where it went is unclear, it is left alone
+}
+
+// resolveMoves decides where the local projects gone from Gitlab went, as far as they moved within the group.
+// A single surest candidate is taken right away. Otherwise prompt picks one, without a prompt they are skipped
+// with a warning, which neither moves nor deletes anything
+func resolveMoves(ctx context.Context, gitlabProjects []*gitlab.Project, localProjects []*git.Project, orphans map[string]*gitlab.OrphanEvent, cfg Config, prompt func(string, []*MoveCandidate) (*MoveDecision, error), warn func(string)) (map[string]*MoveDecision, error) {
+	var gone []string
+	var added []*gitlab.Project
+	projectPairs := pairProjects(gitlabProjects, localProjects)
+	for key, pair := range projectPairs {
+		switch {
+		case pair.GitlabProject == nil && !isWikiOf(key, projectPairs):
+			gone = append(gone, key)
+		case pair.LocalProject == nil && !pair.GitlabProject.Wiki && ignoredReason(pair.GitlabProject, cfg) == "":
+			added = append(added, pair.GitlabProject)
+		}
+	}
+	if len(gone) == 0 || len(added) == 0 {
+		return nil, nil
+	}
+	sort.Strings(gone)
+
+	// A project that is the surest candidate of several local ones can't be taken by any of them without asking
+	candidates := make(map[string][]*MoveCandidate)
+	claims := make(map[string]int)
+	for _, key := range gone {
+		localPath := filepath.Join(cfg.Local.Path, key)
+		candidates[key] = rankCandidates(cfg.Gitlab.Group, key, orphans[key], added, func(project *gitlab.Project) bool {
+			shared, err := git.SharesHistory(ctx, localPath, project.CloneUrl)
+			return err == nil && shared
+		})
+		for _, candidate := range bestCandidates(candidates[key]) {
+			claims[candidate.Project.Path]++
+		}
+	}
+
+	moves := make(map[string]*MoveDecision)
+	taken := make(map[string]bool)
+	for _, key := range gone {
+		var open []*MoveCandidate
+		for _, candidate := range candidates[key] {
+			if !taken[candidate.Project.Path] {
+				open = append(open, candidate)
+			}
+		}
+		if len(open) == 0 {
+			continue
+		}
+
+		best := bestCandidates(open)
+		switch {
+		case len(best) == 1 && claims[best[0].Project.Path] == 1:
+			moves[key] = &MoveDecision{To: best[0].Project}
+		case prompt != nil:
+			decision, err := prompt(key, open)
+			if err != nil {
+				return nil, err
+			}
+			moves[key] = decision
+		default:
+			warn(msg("moves.ambiguous", key, len(open)))
+			moves[key] = &MoveDecision{Skip: true}
+		}
+
+		if moves[key].To != nil {
+			taken[moves[key].To.Path] = true
+		}
+	}
+	return moves, nil
+}
+
+// rankCandidates returns the projects a local project gone from Gitlab may have moved to, the surest first.
+// Only those named by its audit event or of the same name qualify, sharesHistory is only asked about the latter
+func rankCandidates(groupPath string, key string, orphan *gitlab.OrphanEvent, added []*gitlab.Project, sharesHistory func(*gitlab.Project) bool) []*MoveCandidate {
+	var candidates []*MoveCandidate
+	for _, project := range added {
+		var rank MatchRank
+		switch {
+		case auditNames(orphan, groupPath, key, project.Path):
+			rank = MatchAudit
+		case path.Base(project.Path) != path.Base(key):
+			continue
+		case sharesHistory(project):
+			rank = MatchHistory
+		default:
+			rank = MatchName
+		}
+		candidates = append(candidates, &MoveCandidate{Project: project, Rank: rank})
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].Rank != candidates[j].Rank {
+			return candidates[i].Rank > candidates[j].Rank
+		}
+		return candidates[i].Project.Path < candidates[j].Project.Path
+	})
+	return candidates
+}
+
+// auditNames tells whether the audit event of a project gone from Gitlab names path as where it went.
+// Transfers name the new namespace, renames the new path or just the new name
+func auditNames(orphan *gitlab.OrphanEvent, groupPath string, key string, candidate string) bool {
+	if orphan == nil || orphan.To == "" {
+		return false
+	}
+
+	fullPath := groupPath + "/" + candidate
+	switch orphan.To {
+	case fullPath, candidate:
+		return true
+	case path.Dir(fullPath):
+		return path.Base(candidate) == path.Base(key)
+	case path.Base(candidate):
+		return path.Dir(candidate) == path.Dir(key)
+	}
+	return false
+}
+
+// bestCandidates returns the candidates of the highest rank, candidates have to be sorted by rankCandidates
+func bestCandidates(candidates []*MoveCandidate) []*MoveCandidate {
+	for i, candidate := range candidates {
+		if candidate.Rank != candidates[0].Rank {
+			return candidates[:i]
+		}
+	}
+	return candidates
+}
+
+// askForMove returns a prompt showing the candidates of a local project gone from Gitlab with their namespace and
+// last activity, the user picks one of them, treats it as deleted or skips it
+func askForMove(in *bufio.Reader, out io.Writer, groupPath string) func(string, []*MoveCandidate) (*MoveDecision, error) {
+	return func(key string, candidates []*MoveCandidate) (*MoveDecision, error) {
+		pathLength := 0
+		for _, candidate := range candidates {
+			pathLength = max(pathLength, len(candidate.Project.Path))
+		}
+		numberLength := len(strconv.Itoa(len(candidates)))
+
+		fmt.Fprintln(out, text.FgMagenta.Sprint("\n"+msg("moves.header", key)))
+		for i, candidate := range candidates {
+			namespace := groupPath
+			if dir := path.Dir(candidate.Project.Path); dir != "." {
+				namespace += "/" + dir
+			}
+			activity := msg("moves.no_activity")
+			if !candidate.Project.LastActivity.IsZero() {
+				activity = candidate.Project.LastActivity.Local().Format("2006-01-02")
+			}
+
+			fmt.Fprintf(out, "%*d  %s%s\n", numberLength, i+1, text.Pad(candidate.Project.Path, pathLength+2, ' '),
+				msg("moves.candidate", namespace, activity, msg(matchMessages[candidate.Rank])))
+		}
+
+		for {
+			fmt.Fprint(out, text.FgMagenta.Sprint(msg("moves.prompt", len(candidates)))+" ")
+			input, err := in.ReadString('\n')
+			if err != nil {
+				return nil, err
+			}
+
+			input = strings.ToLower(strings.TrimSpace(input))
+			switch input {
+			case "d":
+				return &MoveDecision{}, nil
+			case "s", "":
+				return &MoveDecision{Skip: true}, nil
+			}
+
+			number, err := strconv.Atoi(input)
+			if err == nil && number >= 1 && number <= len(candidates) {
+				return &MoveDecision{To: candidates[number-1].Project}, nil
+			}
+			fmt.Fprintln(out, text.FgHiRed.Sprint(msg("review.invalid_selection", input)))
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"gls/pkg/git"
+	"gls/pkg/gitlab"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestResolveMoves(t *testing.T) {
+	tests := []struct {
+		name    string
+		gone    []string
+		added   []string
+		orphans map[string]*gitlab.OrphanEvent
+		input   string // answers to the prompt, none for no prompt
+		want    map[string]string
+		warned  int
+	}{
+		{
+			name:  "same name elsewhere",
+			gone:  []string{"tools/lint"},
+			added: []string{"platform/lint", "platform/format"},
+			want:  map[string]string{"tools/lint": "platform/lint"},
+		},
+		{
+			name:    "named by the audit events",
+			gone:    []string{"api"},
+			added:   []string{"legacy/api", "services/gateway"},
+			orphans: map[string]*gitlab.OrphanEvent{"api": {Type: gitlab.ProjectTransferred, To: "northwind/services/gateway"}},
+			want:    map[string]string{"api": "services/gateway"},
+		},
+		{
+			name:    "renamed in place",
+			gone:    []string{"infra/vault"},
+			added:   []string{"infra/secrets", "other/secrets"},
+			orphans: map[string]*gitlab.OrphanEvent{"infra/vault": {Type: gitlab.ProjectRenamed, To: "secrets"}},
+			want:    map[string]string{"infra/vault": "infra/secrets"},
+		},
+		{
+			name:   "ambiguous without a prompt",
+			gone:   []string{"cli"},
+			added:  []string{"desktop/cli", "mobile/cli"},
+			want:   map[string]string{"cli": "skip"},
+			warned: 1,
+		},
+		{
+			name:  "ambiguous picked",
+			gone:  []string{"cli"},
+			added: []string{"desktop/cli", "mobile/cli"},
+			input: "3\n2\n", // there is no third
+			want:  map[string]string{"cli": "mobile/cli"},
+		},
+		{
+			name:  "ambiguous deleted",
+			gone:  []string{"cli"},
+			added: []string{"desktop/cli", "mobile/cli"},
+			input: "d\n",
+			want:  map[string]string{"cli": "delete"},
+		},
+		{
+			name:   "claimed twice without a prompt",
+			gone:   []string{"a/web", "b/web"},
+			added:  []string{"c/web"},
+			want:   map[string]string{"a/web": "skip", "b/web": "skip"},
+			warned: 2,
+		},
+		{
+			name:  "claimed twice, taken by the first",
+			gone:  []string{"a/web", "b/web"},
+			added: []string{"c/web"},
+			input: "1\n",
+			want:  map[string]string{"a/web": "c/web"}, // nothing is left for b/web, it is asked about as usual
+		},
+		{
+			name:  "nothing new",
+			gone:  []string{"tools/lint"},
+			added: nil,
+			want:  map[string]string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var gitlabProjects []*gitlab.Project
+			for _, path := range test.added {
+				gitlabProjects = append(gitlabProjects, &gitlab.Project{Path: path, DefaultBranch: "main"})
+			}
+			var localProjects []*git.Project
+			for _, path := range test.gone {
+				localProjects = append(localProjects, &git.Project{Path: path, Branch: "main"}) // no history to compare
+			}
+
+			var cfg Config
+			cfg.Gitlab.Group = "northwind"
+			cfg.Local.Path = t.TempDir()
+			var prompt func(string, []*MoveCandidate) (*MoveDecision, error)
+			input := bufio.NewReader(strings.NewReader(test.input))
+			if test.input != "" {
+				prompt = askForMove(input, io.Discard, cfg.Gitlab.Group)
+			}
+			var warnings []string
+			moves, err := resolveMoves(context.Background(), gitlabProjects, localProjects, test.orphans, cfg, prompt, func(warning string) {
+				warnings = append(warnings, warning)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := make(map[string]string)
+			for key, decision := range moves {
+				switch {
+				case decision.To != nil:
+					got[key] = decision.To.Path
+				case decision.Skip:
+					got[key] = "skip"
+				default:
+					got[key] = "delete"
+				}
+			}
+			if !maps.Equal(got, test.want) {
+				t.Errorf("decided %q", got)
+			}
+			if len(warnings) != test.warned {
+				t.Errorf("warned %q", warnings)
+			}
+			if rest, _ := input.ReadString('\n'); rest != "" {
+				t.Errorf("input left unread: %q", rest)
+			}
+		})
+	}
+}
+
+func TestRankCandidates(t *testing.T) {
+	added := []*gitlab.Project{{Path: "tools/ship"}, {Path: "archive/ship"}, {Path: "delivery/ship"}, {Path: "ops/release"}, {Path: "ops/deploy"}}
+	shared := func(project *gitlab.Project) bool { return project.Path == "archive/ship" }
+
+	tests := []struct {
+		name   string
+		orphan *gitlab.OrphanEvent
+		want   []string
+	}{
+		{name: "by name and history", want: []string{"archive/ship history", "delivery/ship name", "tools/ship name"}},
+		{name: "transferred", orphan: &gitlab.OrphanEvent{To: "northwind/delivery"}, want: []string{"delivery/ship audit", "archive/ship history", "tools/ship name"}},
+		{name: "renamed", orphan: &gitlab.OrphanEvent{To: "release"}, want: []string{"ops/release audit", "archive/ship history", "delivery/ship name", "tools/ship name"}},
+		{name: "moved and renamed", orphan: &gitlab.OrphanEvent{To: "northwind/ops/deploy"}, want: []string{"ops/deploy audit", "archive/ship history", "delivery/ship name", "tools/ship name"}},
+		{name: "out of the group", orphan: &gitlab.OrphanEvent{To: "elsewhere/ship"}, want: []string{"archive/ship history", "delivery/ship name", "tools/ship name"}},
+	}
+
+	ranks := map[MatchRank]string{MatchName: "name", MatchHistory: "history", MatchAudit: "audit"}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got []string
+			for _, candidate := range rankCandidates("northwind", "ops/ship", test.orphan, added, shared) {
+				got = append(got, candidate.Project.Path+" "+ranks[candidate.Rank])
+			}
+			if !slices.Equal(got, test.want) {
+				t.Errorf("ranked %q", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"gls/pkg/git"
+	"gls/pkg/gitlab"
+	"gls/pkg/state"
+	"strings"
+	"time"
+)
+
+func loadNoAccess(cfg Config, warn func(string)) *state.NoAccess {
+	noAccess, err := state.LoadNoAccess(cfg.Local.Path)
+	if err != nil {
+		warn(msg("no_access.ignoring", err))
+		return nil
+	}
+	return noAccess
+}
+
+// recheckNoAccess forgets the projects whose access level changed since reading them failed, so they are tried
+// again, and those no longer listed. It needs a complete listing and returns whether anything was forgotten
+func recheckNoAccess(noAccess *state.NoAccess, gitlabProjects []*gitlab.Project, info func(string)) bool {
+	if noAccess == nil {
+		return false
+	}
+
+	listed := make(map[string]*gitlab.Project, len(gitlabProjects))
+	for _, project := range gitlabProjects {
+		listed[project.Path] = project
+	}
+
+	changed := false
+	for _, known := range append([]*state.NoAccessProject(nil), noAccess.Projects...) {
+		project := listed[known.Path]
+		switch {
+		case project == nil:
+			noAccess.Remove(known.Path)
+			changed = true
+		case project.AccessLevel != known.AccessLevel || !project.LacksRepositoryAccess():
+			noAccess.Remove(known.Path)
+			changed = true
+			info(msg("no_access.changed", known.Path))
+		}
+	}
+	return changed
+}
+
+// skipNoAccess skips the clones, pulls and fetches of projects the token is known to lack access to
+func skipNoAccess(internalTasks []*InternalTask, noAccess *state.NoAccess) {
+	for _, task := range internalTasks {
+		if task.Skipped || task.Action == Delete || task.Action == Move {
+			continue
+		}
+		if known := noAccess.Find(task.Key); known != nil {
+			task.Skipped = true
+			task.Ignored = msg("plan.no_access", accessLevelName(known.AccessLevel))
+		}
+	}
+}
+
+// recordNoAccess adds the projects whose task failed because the token lacks access to them, as far as the listing
+// confirms it. Interrupted or failing remotes deny nothing, only the access level counts
+func recordNoAccess(tasks []*Task, gitlabProjects []*gitlab.Project, noAccess *state.NoAccess, now time.Time) []*state.NoAccessProject {
+	if noAccess == nil {
+		return nil
+	}
+
+	listed := make(map[string]*gitlab.Project, len(gitlabProjects))
+	for _, project := range gitlabProjects {
+		listed[project.Path] = project
+	}
+
+	var added []*state.NoAccessProject
+	for _, task := range tasks {
+		if task.Error.Load() == nil || task.Action == Delete || task.Action == Move {
+			continue
+		}
+		err := *task.Error.Load()
+		var hookErr *git.HookError
+		if errors.As(err, &hookErr) || !git.IsAccessDenied(err) {
+			continue
+		}
+		project := listed[task.Key]
+		if project == nil || !project.LacksRepositoryAccess() {
+			continue
+		}
+
+		known := &state.NoAccessProject{Path: task.Key, AccessLevel: project.AccessLevel, Since: now, Error: strings.TrimSpace(err.Error())}
+		noAccess.Add(known)
+		added = append(added, known)
+	}
+	return added
+}
+
+// accessLevelName names the access levels below reporter, the only ones a project lacks access with
+func accessLevelName(level int) string {
+	switch level {
+	case 5:
+		return msg("no_access.minimal")
+	case 10:
+		return msg("no_access.guest")
+	}
+	return msg("no_access.level", level)
+}
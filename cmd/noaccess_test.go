@@ -0,0 +1,163 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"gls/pkg/git"
+	"gls/pkg/gitlab"
+	"gls/pkg/state"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRecheckNoAccess(t *testing.T) {
+	since := time.Date(2026, 3, 2, 8, 0, 0, 0, time.UTC)
+	listed := []*gitlab.Project{
+		{Path: "vault/keys", AccessLevel: 10, Visibility: "private"},
+		{Path: "vault/audit", AccessLevel: 30, Visibility: "private"}, // promoted to developer
+		{Path: "vault/docs", AccessLevel: 10, Visibility: "internal"}, // opened up
+	}
+
+	tests := []struct {
+		name        string
+		known       []string
+		wantKept    []string
+		wantChanged bool
+		wantInfo    []string
+	}{
+		{
+			name:     "unchanged access",
+			known:    []string{"vault/keys"},
+			wantKept: []string{"vault/keys"},
+		},
+		{
+			name:        "access level raised",
+			known:       []string{"vault/audit", "vault/keys"},
+			wantKept:    []string{"vault/keys"},
+			wantChanged: true,
+			wantInfo:    []string{msg("no_access.changed", "vault/audit")},
+		},
+		{
+			name:        "visibility changed",
+			known:       []string{"vault/docs"},
+			wantChanged: true,
+			wantInfo:    []string{msg("no_access.changed", "vault/docs")},
+		},
+		{
+			name:        "no longer listed",
+			known:       []string{"vault/archive", "vault/keys"},
+			wantKept:    []string{"vault/keys"},
+			wantChanged: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			noAccess := &state.NoAccess{}
+			for _, path := range test.known {
+				noAccess.Add(&state.NoAccessProject{Path: path, AccessLevel: 10, Since: since})
+			}
+
+			var infos []string
+			changed := recheckNoAccess(noAccess, listed, func(message string) { infos = append(infos, message) })
+
+			var kept []string
+			for _, known := range noAccess.Projects {
+				kept = append(kept, known.Path)
+			}
+			if changed != test.wantChanged || !slices.Equal(kept, test.wantKept) || !slices.Equal(infos, test.wantInfo) {
+				t.Errorf("changed %t, kept %v, info %q, want %t, %v, %q", changed, kept, infos, test.wantChanged, test.wantKept, test.wantInfo)
+			}
+		})
+	}
+
+	if recheckNoAccess(nil, listed, func(string) {}) {
+		t.Error("nil no access changed")
+	}
+}
+
+func TestSkipNoAccess(t *testing.T) {
+	noAccess := &state.NoAccess{}
+	noAccess.Add(&state.NoAccessProject{Path: "lab/secret", AccessLevel: 5})
+	noAccess.Add(&state.NoAccessProject{Path: "lab/samples", AccessLevel: 10})
+
+	tests := []struct {
+		name        string
+		task        *InternalTask
+		wantSkipped bool
+		wantIgnored string
+	}{
+		{"clone", &InternalTask{Key: "lab/secret", Action: Clone}, true, msg("plan.no_access", msg("no_access.minimal"))},
+		{"pull", &InternalTask{Key: "lab/samples", Action: Pull}, true, msg("plan.no_access", msg("no_access.guest"))},
+		{"delete", &InternalTask{Key: "lab/samples", Action: Delete}, false, ""},
+		{"move", &InternalTask{Key: "lab/secret", From: "old/secret", Action: Move}, false, ""},
+		{"readable", &InternalTask{Key: "lab/results", Action: Pull}, false, ""},
+		{"skipped already", &InternalTask{Key: "lab/secret", Action: Pull, Skipped: true, Ignored: "archived"}, true, "archived"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			skipNoAccess([]*InternalTask{test.task}, noAccess)
+			if test.task.Skipped != test.wantSkipped || test.task.Ignored != test.wantIgnored {
+				t.Errorf("skipped %t because %q, want %t because %q", test.task.Skipped, test.task.Ignored, test.wantSkipped, test.wantIgnored)
+			}
+		})
+	}
+}
+
+func TestRecordNoAccess(t *testing.T) {
+	now := time.Date(2026, 9, 14, 17, 30, 0, 0, time.UTC)
+	listed := []*gitlab.Project{
+		{Path: "infra/vpn", AccessLevel: 10, Visibility: "private"},
+		{Path: "infra/dns", AccessLevel: 40, Visibility: "private"},
+		{Path: "infra/wiki", AccessLevel: 10, Visibility: "public"},
+		{Path: "infra/pki", Visibility: "private"}, // Gitlab didn't tell the access level
+	}
+	denied := errors.New("remote: You are not allowed to download code from this project.\n")
+
+	tests := []struct {
+		name   string
+		key    string
+		action Action
+		err    error
+		want   []string
+	}{
+		{"denied guest", "infra/vpn", Pull, denied, []string{"infra/vpn remote: You are not allowed to download code from this project."}},
+		{"denied reporter", "infra/dns", Pull, denied, nil},
+		{"denied public", "infra/wiki", Clone, denied, nil},
+		{"denied unknown level", "infra/pki", Fetch, denied, nil},
+		{"denied unlisted", "infra/old", Pull, denied, nil},
+		{"network failure", "infra/vpn", Pull, errors.New("could not resolve host: gitlab.example.com"), nil},
+		{"hook failure", "infra/vpn", Clone, &git.HookError{Err: denied}, nil},
+		{"delete", "infra/vpn", Delete, denied, nil},
+		{"succeeded", "infra/vpn", Pull, nil, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			task := &Task{Key: test.key, Action: test.action}
+			if test.err != nil {
+				task.Error.Store(&test.err)
+			}
+			noAccess := &state.NoAccess{}
+
+			added := recordNoAccess([]*Task{task}, listed, noAccess, now)
+
+			var got []string
+			for _, known := range added {
+				if known.AccessLevel != 10 || !known.Since.Equal(now) {
+					t.Errorf("recorded %s with level %d since %s", known.Path, known.AccessLevel, known.Since)
+				}
+				got = append(got, fmt.Sprintf("%s %s", known.Path, known.Error))
+			}
+			if !slices.Equal(got, test.want) || len(noAccess.Projects) != len(test.want) {
+				t.Errorf("recorded %q, kept %d, want %q", got, len(noAccess.Projects), test.want)
+			}
+		})
+	}
+
+	if recordNoAccess(nil, listed, nil, now) != nil {
+		t.Error("nil no access recorded projects")
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"github.com/jedib0t/go-pretty/v6/text"
+	"gls/pkg/gitlab"
+	"gls/pkg/state"
+	"log"
+	"strings"
+	"time"
+)
+
+// runNote sets or removes the note of a project, notes are shown in prompts, the review, status --wide and
+// explain-filters. The path can be given as shown by gls or including the group
+func runNote(args []string) {
+	if len(args) < 2 || (args[0] == "set" && (len(args) < 3 || strings.HasPrefix(args[2], "-"))) {
+		log.Fatalf("Usage: gls note set <project-path> <text> [flags] | gls note rm <project-path> [flags]")
+	}
+
+	command, path, rest := args[0], args[1], args[2:]
+	if command == "set" {
+		rest = args[3:]
+	}
+	cfg := loadConfig(rest)
+	path = projectKey(cfg, path)
+
+	notes, err := state.LoadNotes(cfg.Local.Path)
+	if err != nil {
+		log.Fatalf("Error reading %s: %v", state.NotesFileName, err)
+	}
+
+	switch command {
+	case "set":
+		notes.Set(path, args[2], time.Now())
+	case "rm":
+		if !notes.Remove(path) {
+			println(text.FgYellow.Sprint(msg("notes.none", path)))
+			return
+		}
+	default:
+		log.Fatalf("Unknown note command %s, available commands are set and rm", command)
+	}
+
+	err = notes.Save(cfg.Local.Path)
+	if err != nil {
+		log.Fatalf("Error writing %s: %v", state.NotesFileName, err)
+	}
+	if command == "set" {
+		println(text.FgCyan.Sprint(msg("notes.set", path)))
+	} else {
+		println(text.FgCyan.Sprint(msg("notes.removed", path)))
+	}
+}
+
+// projectKey turns a project path given by the user into the key gls uses, which leaves out the group
+func projectKey(cfg Config, path string) string {
+	path = strings.Trim(path, "/")
+	root := pathRoot(cfg)
+	if root != "" && strings.HasPrefix(strings.ToLower(path), strings.ToLower(root)+"/") {
+		path = path[len(root)+1:]
+	}
+	return path
+}
+
+// loadNotes reads the notes for a sync, which goes on without them when they can't be read
+func loadNotes(cfg Config, warn func(string)) *state.Notes {
+	notes, err := state.LoadNotes(cfg.Local.Path)
+	if err != nil {
+		warn(msg("notes.ignoring", err))
+		return nil
+	}
+	return notes
+}
+
+// reconcileNotes lets the notes follow their projects after a complete listing, and drops those of projects gone
+// for longer than the retention. Projects below the depth aren't listed, so they don't count as gone
+func reconcileNotes(cfg Config, notes *state.Notes, gitlabProjects []*gitlab.Project) error {
+	if notes == nil || len(notes.Notes) == 0 {
+		return nil
+	}
+
+	notes.Reconcile(gitlabProjects, func(path string) bool {
+		return cfg.Depth < 0 || strings.Count(path, "/") <= cfg.Depth
+	}, time.Now(), cfg.Notes.Retention)
+	return notes.Save(cfg.Local.Path)
+}
+
+// describeNote shows a note with the month it was written, e.g. note from 2023-04: contains prod secrets
+func describeNote(note *state.Note) string {
+	return msg("notes.note", note.Written.Local().Format("2006-01"), note.Text)
+}
+
+// noteText is the text of a note for the events file, empty without one
+func noteText(note *state.Note) string {
+	if note == nil {
+		return ""
+	}
+	return note.Text
+}
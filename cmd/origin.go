@@ -0,0 +1,108 @@
+package main
+
+import (
+	"gls/pkg/git"
+	"gls/pkg/gitlab"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// OriginConflict is a local project whose origin doesn't point at the Gitlab project it is paired with
+type OriginConflict struct {
+	Path     string
+	Origin   string
+	Expected string
+	Moved    bool // the same project on another host or over another protocol, only the url is outdated
+}
+
+// checkOrigins compares the origins of the local projects with the clone urls of their Gitlab projects.
+// With fixRemotes origins that only moved are pointed at the clone url and returned as fixed,
+// every other mismatch is returned as a conflict by project path
+func checkOrigins(gitlabProjects []*gitlab.Project, localProjects []*git.Project, cfg Config) ([]string, map[string]*OriginConflict) {
+	var mu sync.Mutex
+	var fixed []string
+	conflicts := make(map[string]*OriginConflict)
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, max(cfg.Workers, 1))
+	for _, pair := range pairProjects(gitlabProjects, localProjects) {
+		if pair.GitlabProject == nil || pair.LocalProject == nil {
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			path := filepath.Join(cfg.Local.Path, pair.LocalProject.Path)
+			origin, err := git.GetOrigin(path)
+			if err != nil {
+				return // no origin to compare, pulling will tell what's wrong
+			}
+			conflict := compareOrigin(pair.LocalProject.Path, origin, pair.GitlabProject.CloneUrl)
+			if conflict == nil {
+				return
+			}
+
+			if conflict.Moved && cfg.FixRemotes && git.SetOrigin(path, conflict.Expected) == nil {
+				mu.Lock()
+				defer mu.Unlock()
+				fixed = append(fixed, conflict.Path)
+				return
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			conflicts[conflict.Path] = conflict
+		}()
+	}
+	wg.Wait()
+
+	sort.Strings(fixed)
+	return fixed, conflicts
+}
+
+// compareOrigin returns nil if origin points at the same project as cloneUrl. Urls that can't be parsed aren't
+// judged, and neither is the user as https and ssh remotes have different ones
+func compareOrigin(path string, origin string, cloneUrl string) *OriginConflict {
+	local, err := git.ParseRemoteUrl(origin)
+	if err != nil {
+		return nil
+	}
+	remote, err := git.ParseRemoteUrl(cloneUrl)
+	if err != nil {
+		return nil
+	}
+
+	if !strings.EqualFold(local.Path, remote.Path) {
+		return &OriginConflict{Path: path, Origin: origin, Expected: cloneUrl}
+	}
+	if protocol(local) != protocol(remote) || !strings.EqualFold(local.Host, remote.Host) || local.Port != remote.Port {
+		return &OriginConflict{Path: path, Origin: origin, Expected: cloneUrl, Moved: true}
+	}
+	return nil
+}
+
+// protocol treats scp style remotes like ssh urls
+func protocol(remote *git.RemoteUrl) string {
+	if remote.Scheme == "" {
+		return "ssh"
+	}
+	return strings.ToLower(remote.Scheme)
+}
+
+// sortedConflicts lists conflicts by path for the summary
+func sortedConflicts(conflicts map[string]*OriginConflict) []*OriginConflict {
+	var sorted []*OriginConflict
+	for _, conflict := range conflicts {
+		sorted = append(sorted, conflict)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Path < sorted[j].Path
+	})
+	return sorted
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"gls/pkg/git"
+	"gls/pkg/gitlab"
+	"time"
+)
+
+// findOrphans asks the audit events what happened to the local projects that are gone from Gitlab.
+// Without audit events, or when they can't be read, the deletes are just asked about as usual
+func findOrphans(ctx context.Context, gl *gitlab.Gitlab, cfg Config, gitlabProjects []*gitlab.Project, localProjects []*git.Project) map[string]*gitlab.OrphanEvent {
+	if cfg.Gitlab.AuditDays <= 0 {
+		return nil
+	}
+
+	var candidates []string
+	projectPairs := pairProjects(gitlabProjects, localProjects)
+	for key, pair := range projectPairs {
+		if pair.GitlabProject == nil && !isWikiOf(key, projectPairs) {
+			candidates = append(candidates, key)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	since := time.Now().AddDate(0, 0, -cfg.Gitlab.AuditDays)
+	orphans, err := gl.FindOrphanEvents(ctx, cfg.Gitlab.Group, candidates, since)
+	if err != nil {
+		return nil
+	}
+	return orphans
+}
+
+func describeOrphan(orphan *gitlab.OrphanEvent) string {
+	date := orphan.Time.Local().Format("2006-01-02 15:04")
+	switch orphan.Type {
+	case gitlab.ProjectTransferred:
+		return msg("orphan.transferred", orphan.To, orphan.Actor, date)
+	case gitlab.ProjectRenamed:
+		return msg("orphan.renamed", orphan.To, orphan.Actor, date)
+	default:
+		return msg("orphan.deleted", orphan.Actor, date)
+	}
+}
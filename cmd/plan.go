@@ -0,0 +1,562 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/jedib0t/go-pretty/v6/progress"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"gls/pkg/git"
+	"gls/pkg/gitlab"
+	"gls/pkg/state"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+type InternalTask struct {
+	Key      string
+	From     string // where a moved project was
+	Action   Action
+	CloneUrl string
+	Mirror   bool
+	Skipped  bool
+	Branch   string
+	Ignored  string // why the project is ignored, it can't be unskipped then
+	Wiki     bool
+	Orphan   *gitlab.OrphanEvent // what happened on Gitlab to a project that is deleted
+	Override bool                // Branch comes from a branch override instead of Gitlab's default branch
+	Note     *state.Note         // what the user noted about the project
+	Track    []string            // local branches kept current next to the checked out one
+	Restart  bool                // the clone was interrupted and is started over, what it left goes to the trash
+	Decision Decision            // what the user answered about deleting the project, empty if they weren't asked
+}
+
+// Decision is what the user answered when asked about a task, so far only deletions are asked about
+type Decision string
+
+const (
+	DecisionYes       Decision = "yes"        // confirmed at the prompt
+	DecisionNo        Decision = "no"         // declined at the prompt
+	DecisionReviewYes Decision = "review_yes" // left checked or checked in the interactive review
+	DecisionReviewNo  Decision = "review_no"  // left unchecked or unchecked in the interactive review
+)
+
+// Declined tells whether the user said no, as opposed to gls skipping the task on its own
+func (d Decision) Declined() bool {
+	return d == DecisionNo || d == DecisionReviewNo
+}
+
+func (t *InternalTask) Message() string {
+	if t.Ignored != "" {
+		return msg("action.ignored", t.Ignored)
+	}
+	if t.Skipped && t.Decision.Declined() {
+		return msg("action.declined_delete")
+	}
+	if t.Skipped {
+		return msg(skippedMessages[t.Action])
+	}
+	if t.Mirror {
+		return msg("action.mirror")
+	}
+	if t.Action == Move {
+		return msg("action.move", t.From)
+	}
+	return msg(messages[t.Action])
+}
+
+// declinedTasks lists the projects the user said no to, apart from the tasks gls skipped on its own, so the user can
+// revisit their own choices
+func declinedTasks(internalTasks []*InternalTask) []string {
+	var declined []string
+	for _, task := range internalTasks {
+		if task.Skipped && task.Decision.Declined() {
+			declined = append(declined, task.Key)
+		}
+	}
+	return declined
+}
+
+var messages = map[Action]string{
+	Clone:  "action.clone",
+	Pull:   "action.pull",
+	Fetch:  "action.fetch",
+	Delete: "action.delete",
+}
+
+var skippedMessages = map[Action]string{
+	Clone:  "action.skipped_clone",
+	Pull:   "action.skipped_pull",
+	Fetch:  "action.skipped_fetch",
+	Delete: "action.skipped_delete",
+	Move:   "action.skipped_move",
+}
+
+func planTasks(gitlabProjects []*gitlab.Project, localProjects []*git.Project, orphans map[string]*gitlab.OrphanEvent, overrides []*BranchOverride, conflicts map[string]*OriginConflict, moves map[string]*MoveDecision, notes *state.Notes, staleListing bool, cfg Config) []*InternalTask {
+	var internalTasks []*InternalTask
+	projectPairs := pairProjects(gitlabProjects, localProjects)
+
+	movedTo := make(map[string]bool)
+	for _, decision := range moves {
+		if decision.To != nil {
+			movedTo[decision.To.Path] = true
+		}
+	}
+
+	for key, projectPair := range projectPairs {
+		var branch string
+		var override bool
+		if projectPair.GitlabProject != nil {
+			branch, override = effectiveBranch(overrides, projectPair.GitlabProject)
+		}
+
+		// Ignored projects are treated as if they didn't exist remotely, but their local copies are kept
+		if projectPair.GitlabProject != nil {
+			reason := ignoredReason(projectPair.GitlabProject, cfg)
+			if reason != "" {
+				if projectPair.LocalProject != nil {
+					internalTasks = append(internalTasks, &InternalTask{
+						Key:     key,
+						Action:  Pull,
+						Skipped: true,
+						Branch:  projectPair.LocalProject.Branch,
+						Ignored: reason,
+					})
+				}
+				continue
+			}
+		}
+
+		// We have a remote and local copy, only need to pull
+		if projectPair.GitlabProject != nil && projectPair.LocalProject != nil {
+			if conflict := conflicts[key]; conflict != nil {
+				// Pulling would fail or, worse, bring in another project
+				reason := msg("plan.origin_conflict", conflict.Origin)
+				if conflict.Moved {
+					reason = msg("plan.origin_moved")
+				}
+				internalTasks = append(internalTasks, &InternalTask{
+					Key:     key,
+					Action:  Pull,
+					Skipped: true,
+					Branch:  projectPair.LocalProject.Branch,
+					Ignored: reason,
+				})
+			} else if cfg.FetchOnly {
+				// Fetching doesn't touch the worktree, so the checked out branch doesn't matter
+				internalTasks = append(internalTasks, &InternalTask{
+					Key:      key,
+					Action:   Fetch,
+					CloneUrl: projectPair.GitlabProject.CloneUrl,
+					Branch:   projectPair.LocalProject.Branch,
+					Wiki:     projectPair.GitlabProject.Wiki,
+				})
+			} else if interruptedClone(projectPair, cfg.Local.Path) {
+				// The clone is started over, PrepareCloneTarget makes sure nothing but the unfinished clone goes away
+				internalTasks = append(internalTasks, &InternalTask{
+					Key:      key,
+					Action:   Clone,
+					CloneUrl: projectPair.GitlabProject.CloneUrl,
+					Branch:   branch,
+					Wiki:     projectPair.GitlabProject.Wiki,
+					Override: override,
+					Restart:  projectPair.LocalProject.Interrupted,
+				})
+			} else if reason := unpullableReason(projectPair); reason != "" {
+				internalTasks = append(internalTasks, &InternalTask{
+					Key:     key,
+					Action:  Pull,
+					Skipped: true,
+					Branch:  projectPair.LocalProject.Branch,
+					Ignored: reason,
+				})
+			} else if projectPair.GitlabProject.Wiki || branch == projectPair.LocalProject.Branch {
+				// Wikis only have a single branch, Gitlab doesn't tell which one
+				internalTasks = append(internalTasks, &InternalTask{
+					Key:      key,
+					Action:   Pull,
+					CloneUrl: projectPair.GitlabProject.CloneUrl,
+					Branch:   projectPair.LocalProject.Branch,
+					Wiki:     projectPair.GitlabProject.Wiki,
+					Override: override,
+				})
+			} else {
+				// The user checked out another branch on purpose, the review can't unskip the pull either
+				internalTasks = append(internalTasks, &InternalTask{
+					Key:     key,
+					Action:  Pull,
+					Skipped: true,
+					Branch:  projectPair.LocalProject.Branch,
+					Ignored: msg("plan.other_branch", projectPair.LocalProject.Branch, branch),
+				})
+			}
+		}
+
+		// We don't have a local copy, so we clone, unless a local project is moved here
+		if projectPair.GitlabProject != nil && projectPair.LocalProject == nil && !movedTo[key] {
+			mirror := cfg.FetchOnly && cfg.Mirror
+			if mirror {
+				// Mirrors have every branch, HEAD stays on the default one
+				branch, override = projectPair.GitlabProject.DefaultBranch, false
+			}
+			internalTasks = append(internalTasks, &InternalTask{
+				Key:      key,
+				Action:   Clone,
+				CloneUrl: projectPair.GitlabProject.CloneUrl,
+				Mirror:   mirror,
+				Branch:   branch,
+				Wiki:     projectPair.GitlabProject.Wiki,
+				Override: override,
+			})
+		}
+
+		// We only have a local copy, ask if we should delete it
+		if projectPair.GitlabProject == nil && projectPair.LocalProject != nil {
+			if isWikiOf(key, projectPairs) {
+				continue // wikis aren't synced, but their project still exists
+			}
+
+			prompt := msg("plan.confirm_delete", key)
+			if orphans[key] != nil {
+				prompt = msg("plan.confirm_delete_orphan", key, describeOrphan(orphans[key]))
+			}
+			if note := notes.Find(key); note != nil {
+				prompt = describeNote(note) + "\n" + prompt
+			}
+
+			if staleListing {
+				// Gitlab may well have the project, under a path the listing missed while it was interrupted
+				internalTasks = append(internalTasks, &InternalTask{
+					Key:     key,
+					Action:  Delete,
+					Skipped: true,
+					Branch:  projectPair.LocalProject.Branch,
+					Ignored: msg("plan.stale_listing"),
+					Orphan:  orphans[key],
+				})
+				continue
+			}
+
+			if decision := moves[key]; decision != nil && decision.Skip {
+				internalTasks = append(internalTasks, &InternalTask{
+					Key:     key,
+					Action:  Delete,
+					Skipped: true,
+					Branch:  projectPair.LocalProject.Branch,
+					Ignored: msg("plan.move_unclear"),
+					Orphan:  orphans[key],
+				})
+				continue
+			} else if decision != nil && decision.To != nil {
+				internalTasks = append(internalTasks, &InternalTask{
+					Key:      decision.To.Path,
+					From:     key,
+					Action:   Move,
+					CloneUrl: decision.To.CloneUrl,
+					Branch:   projectPair.LocalProject.Branch,
+					Orphan:   orphans[key],
+				})
+				continue
+			}
+
+			if cfg.Delete.Shadow {
+				// Only recorded for gls shadow-report, nothing is deleted or asked
+				internalTasks = append(internalTasks, &InternalTask{
+					Key:     key,
+					Action:  Delete,
+					Skipped: true,
+					Branch:  projectPair.LocalProject.Branch,
+					Ignored: msg("plan.shadow_delete"),
+					Orphan:  orphans[key],
+				})
+				continue
+			}
+
+			// The review asks about deletes together with everything else, unchecked until chosen there
+			if cfg.Interactive || cfg.DryRun {
+				internalTasks = append(internalTasks, &InternalTask{
+					Key:     key,
+					Action:  Delete,
+					Skipped: true,
+					Branch:  projectPair.LocalProject.Branch,
+					Orphan:  orphans[key],
+				})
+			} else if askForConfirmation(text.FgMagenta.Sprint(prompt)) {
+				internalTasks = append(internalTasks, &InternalTask{
+					Key:      key,
+					Action:   Delete,
+					Branch:   projectPair.LocalProject.Branch,
+					Orphan:   orphans[key],
+					Decision: DecisionYes,
+				})
+			} else {
+				internalTasks = append(internalTasks, &InternalTask{
+					Key:      key,
+					Action:   Delete,
+					Skipped:  true,
+					Branch:   projectPair.LocalProject.Branch,
+					Orphan:   orphans[key],
+					Decision: DecisionNo,
+				})
+			}
+		}
+	}
+
+	for _, task := range internalTasks {
+		task.Note = notes.Find(task.Key)
+	}
+	sort.Slice(internalTasks, func(i, j int) bool {
+		return internalTasks[i].Key < internalTasks[j].Key
+	})
+
+	return internalTasks
+}
+
+// interruptedClone tells whether a local project is what's left of a clone that didn't finish, as the project does
+// have commits on Gitlab. Either gls recorded starting the clone without it ever completing, or the project has no
+// commit or file at all
+func interruptedClone(projectPair *ProjectPair, localPath string) bool {
+	if projectPair.GitlabProject.DefaultBranch == "" || projectPair.GitlabProject.Wiki {
+		return false
+	}
+	return projectPair.LocalProject.Interrupted ||
+		projectPair.LocalProject.Unborn && git.IsPartialClone(filepath.Join(localPath, projectPair.LocalProject.Path))
+}
+
+// unpullableReason tells why a pull can't work, instead of it failing on every run, or returns an empty string
+func unpullableReason(projectPair *ProjectPair) string {
+	switch {
+	case projectPair.LocalProject.Detached:
+		return msg("plan.detached")
+	case projectPair.LocalProject.Unborn:
+		return msg("plan.unborn")
+	case projectPair.GitlabProject.DefaultBranch == "" && !projectPair.GitlabProject.Wiki:
+		return msg("plan.empty_project")
+	}
+	return ""
+}
+
+// resultLength is the width of the result column, enough for "pulled 1000 commits"
+const resultLength = 20
+
+// subgroup returns the first path segment of a project, projects directly in the group get an empty subgroup
+func subgroup(key string) string {
+	group, _, ok := strings.Cut(key, "/")
+	if !ok {
+		return ""
+	}
+	return group
+}
+
+var actionRanks = map[Action]int{
+	Clone:  0,
+	Move:   0,
+	Pull:   1,
+	Fetch:  1,
+	Delete: 2,
+}
+
+// sortBySubgroup orders tasks by subgroup, then clones before pulls before deletes, then by name
+func sortBySubgroup(internalTasks []*InternalTask) {
+	sort.SliceStable(internalTasks, func(i, j int) bool {
+		a, b := internalTasks[i], internalTasks[j]
+		if subgroup(a.Key) != subgroup(b.Key) {
+			return subgroup(a.Key) < subgroup(b.Key)
+		}
+		if actionRanks[a.Action] != actionRanks[b.Action] {
+			return actionRanks[a.Action] < actionRanks[b.Action]
+		}
+		return a.Key < b.Key
+	})
+}
+
+// createTasks turns the plan into tasks with their rows laid out for a terminal width columns wide, 0 if unknown
+func createTasks(internalTasks []*InternalTask, cfg Config, hosts *CloneHosts, width int) ([]*Task, string, Layout) {
+	var groupHeader = msg("header.subgroup")
+	var messageHeader = msg("header.action")
+	var keyHeader = msg("header.project")
+	var branchHeader = msg("header.branch")
+	var resultHeader = msg("header.result")
+	var statusHeader = msg("header.status")
+
+	if cfg.GroupBySubgroup {
+		sortBySubgroup(internalTasks)
+	}
+
+	var groupLength = 0
+	if cfg.GroupBySubgroup {
+		groupLength = text.StringWidthWithoutEscSequences(groupHeader)
+	}
+	var messageLength = text.StringWidthWithoutEscSequences(messageHeader)
+	var keyLength = text.StringWidthWithoutEscSequences(keyHeader)
+	var branchLength = text.StringWidthWithoutEscSequences(branchHeader)
+	for _, internalTask := range internalTasks {
+		if cfg.GroupBySubgroup && text.StringWidthWithoutEscSequences(groupLabel(internalTask.Key)) > groupLength {
+			groupLength = text.StringWidthWithoutEscSequences(groupLabel(internalTask.Key))
+		}
+		if text.StringWidthWithoutEscSequences(internalTask.Message()) > messageLength {
+			messageLength = text.StringWidthWithoutEscSequences(internalTask.Message())
+		}
+		if len(internalTask.Key) > keyLength {
+			keyLength = len(internalTask.Key)
+		}
+		if len(internalTask.Branch) > branchLength {
+			branchLength = len(internalTask.Branch)
+		}
+	}
+
+	layout := layoutColumns(width, ColumnWidths{
+		Group:   groupLength,
+		Message: messageLength,
+		Key:     keyLength,
+		Branch:  branchLength,
+		Result:  resultLength,
+	})
+	keyLength = layout.Key
+
+	pathLimits := git.GetPathLimits()
+
+	var tasks []*Task
+	for i, internalTask := range internalTasks {
+		columns := ""
+		if cfg.GroupBySubgroup {
+			// Only the first task of a subgroup names it, which makes it a header row for the ones below
+			label := ""
+			if i == 0 || subgroup(internalTasks[i-1].Key) != subgroup(internalTask.Key) {
+				label = groupLabel(internalTask.Key)
+			}
+			columns = text.Pad(label, groupLength+2, ' ')
+		}
+		columns += text.Pad(internalTask.Message(), messageLength+2, ' ') +
+			text.Pad(shortenKey(internalTask.Key, keyLength), keyLength+2, ' ') +
+			text.Pad(internalTask.Branch, branchLength+2, ' ')
+
+		task := &Task{
+			Key:      internalTask.Key,
+			Path:     filepath.Join(cfg.Local.Path, internalTask.Key),
+			From:     internalTask.From,
+			CloneUrl: internalTask.CloneUrl,
+			Mirror:   internalTask.Mirror,
+			Hook:     hookFor(internalTask, cfg),
+			Action:   internalTask.Action,
+			Skipped:  internalTask.Skipped,
+			Track:    internalTask.Track,
+			Restart:  internalTask.Restart,
+			Error:    atomic.Pointer[error]{},
+			Columns:  columns,
+			Tracker: &progress.Tracker{
+				Message: columns + text.Pad("", resultLength+2, ' '),
+			},
+		}
+
+		// Fail clones up front that would otherwise only fail once git gets deep into the repo
+		if task.Action == Clone && !task.Skipped {
+			err := git.CheckPathLength(task.Path, pathLimits)
+			if err != nil {
+				task.Error.Store(&err)
+			}
+		}
+		// and any task whose clone url points at a host nobody allowed, before git talks to it
+		if err := hosts.check(task); err != nil {
+			task.Error.Store(&err)
+		}
+
+		if internalTask.Override {
+			task.Branch = internalTask.Branch
+		}
+
+		tasks = append(tasks, task)
+	}
+
+	header := ""
+	if cfg.GroupBySubgroup {
+		header = text.Pad(groupHeader, groupLength+2, ' ')
+	}
+	header += text.Pad(messageHeader, messageLength+2, ' ') +
+		text.Pad(shortenKey(keyHeader, keyLength), keyLength+2, ' ') +
+		text.Pad(branchHeader, branchLength+2, ' ') +
+		text.Pad(resultHeader, resultLength+2, ' ') +
+		statusHeader
+
+	return tasks, header, layout
+}
+
+func groupLabel(key string) string {
+	group := subgroup(key)
+	if group == "" {
+		return msg("group.root")
+	}
+	return group
+}
+
+func hookFor(internalTask *InternalTask, cfg Config) string {
+	if cfg.NoHooks || internalTask.Skipped || internalTask.Mirror || internalTask.Wiki {
+		return ""
+	}
+
+	switch internalTask.Action {
+	case Clone:
+		return cfg.Hooks.PostClone
+	case Pull:
+		return cfg.Hooks.PostPull
+	}
+	return ""
+}
+
+type ProjectPair struct {
+	GitlabProject *gitlab.Project
+	LocalProject  *git.Project
+}
+
+func pairProjects(gitlabProjects []*gitlab.Project, localProjects []*git.Project) map[string]*ProjectPair {
+	projectPairs := make(map[string]*ProjectPair)
+	for _, project := range gitlabProjects {
+		projectPair := projectPairs[project.Path]
+		if projectPair == nil {
+			projectPair = &ProjectPair{}
+		}
+
+		projectPair.GitlabProject = project
+		projectPairs[project.Path] = projectPair
+	}
+
+	for _, project := range localProjects {
+		projectPair := projectPairs[project.Path]
+		if projectPair == nil {
+			projectPair = &ProjectPair{}
+		}
+
+		projectPair.LocalProject = project
+		projectPairs[project.Path] = projectPair
+	}
+	return projectPairs
+}
+
+// input is shared by all prompts and the cancel watcher, a reader per prompt would swallow buffered input meant for
+// the next one
+var input = NewInput(os.Stdin)
+
+// stdin is what prompts read their answers from
+var stdin = bufio.NewReader(input)
+
+func askForConfirmation(promt string) bool {
+	for {
+		fmt.Printf("%s %s: ", promt, msg("prompt.yes_no"))
+
+		response, err := stdin.ReadString('\n')
+		if err != nil {
+			log.Fatalf("Error reading input: %v", err)
+		}
+
+		response = strings.ToLower(strings.TrimSpace(response))
+
+		if response == "y" || response == "yes" {
+			return true
+		} else if response == "n" || response == "no" {
+			return false
+		}
+	}
+}
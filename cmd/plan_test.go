@@ -0,0 +1,39 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestCreateTasksPathTooLong plans clones next to one whose path can't exist on any platform, only that one fails
+// before it runs
+func TestCreateTasksPathTooLong(t *testing.T) {
+	long := "acme/" + strings.Repeat("a", 256)
+	internalTasks := []*InternalTask{
+		{Key: "acme/api", Action: Clone, CloneUrl: "git@gitlab.example.com:acme/api.git"},
+		{Key: long, Action: Clone, CloneUrl: "git@gitlab.example.com:" + long + ".git"},
+		{Key: long + "-skipped", Action: Clone, Skipped: true},
+		{Key: long + "-pulled", Action: Pull, CloneUrl: "git@gitlab.example.com:" + long + "-pulled.git"},
+	}
+
+	var cfg Config
+	cfg.Local.Path = t.TempDir()
+	cfg.Gitlab.Url = "https://gitlab.example.com"
+	tasks, _, _ := createTasks(internalTasks, cfg, cloneHosts(cfg, nil), 120)
+
+	for _, task := range tasks {
+		err := task.Error.Load()
+		if task.Key != long {
+			if err != nil {
+				t.Errorf("%s %s failed: %v", task.Action, task.Key, *err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains((*err).Error(), "characters long, the limit is 255") {
+			t.Errorf("the clone of the long path got %v", err)
+		}
+	}
+	if len(tasks) != len(internalTasks) {
+		t.Errorf("created %d tasks", len(tasks))
+	}
+}
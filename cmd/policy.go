@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gls/pkg/git"
+	"gls/pkg/gitlab"
+	"io"
+	"os"
+)
+
+// maxPolicyOutput is how much the pre plan hook may write, the plan of many thousand projects stays well below
+const maxPolicyOutput = 16 << 20
+
+// policyPlanVersion changes when the plan handed to the pre plan hook changes in a way scripts have to know about
+const policyPlanVersion = 1
+
+// PolicyPlan is what the pre plan hook gets on stdin
+type PolicyPlan struct {
+	Version int           `json:"version"`
+	DryRun  bool          `json:"dry_run"`
+	Tasks   []*PolicyTask `json:"tasks"`
+}
+
+// PolicyTask is a task as the pre plan hook sees it. The hook answers with the tasks it changed, or all of them,
+// and may only turn a task that would run into a skipped one with a reason
+type PolicyTask struct {
+	Project  string              `json:"project"`
+	Action   Action              `json:"action"`
+	Skipped  bool                `json:"skipped"`
+	Reason   string              `json:"reason,omitempty"`
+	From     string              `json:"from,omitempty"`
+	Branch   string              `json:"branch,omitempty"`
+	CloneUrl string              `json:"clone_url,omitempty"`
+	Wiki     bool                `json:"wiki,omitempty"`
+	Mirror   bool                `json:"mirror,omitempty"`
+	Topics   []string            `json:"topics,omitempty"`
+	Note     string              `json:"note,omitempty"`
+	Orphan   *gitlab.OrphanEvent `json:"orphan,omitempty"`
+}
+
+// PolicyResponse is what the pre plan hook writes to stdout
+type PolicyResponse struct {
+	Tasks []*PolicyTask `json:"tasks"`
+}
+
+// PolicySkip is a task the pre plan hook skipped
+type PolicySkip struct {
+	Project string
+	Action  Action
+	Reason  string
+}
+
+// runPrePlanHook hands the plan to the pre plan hook and skips the tasks it tells to. Anything but a valid answer
+// fails the cycle, a policy that couldn't be applied must not let its tasks run
+func runPrePlanHook(ctx context.Context, cfg Config, internalTasks []*InternalTask, gitlabProjects []*gitlab.Project) ([]*PolicySkip, error) {
+	topics := make(map[string][]string)
+	for _, project := range gitlabProjects {
+		topics[project.Path] = project.Topics
+	}
+
+	plan := &PolicyPlan{Version: policyPlanVersion, DryRun: cfg.DryRun}
+	for _, task := range internalTasks {
+		plan.Tasks = append(plan.Tasks, policyTask(task, topics[task.Key]))
+	}
+	input, err := json.Marshal(plan)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := git.RunFilter(ctx, cfg.Hooks.PrePlan, cfg.Local.Path, git.SandboxEnv(os.Environ(), cfg.Gitlab.Token), input, cfg.Hooks.Timeout, maxPolicyOutput)
+	if err != nil {
+		return nil, fmt.Errorf("the pre plan hook failed: %w", err)
+	}
+
+	response, err := parsePolicyResponse(output)
+	if err != nil {
+		return nil, err
+	}
+	return applyPolicy(internalTasks, plan.Tasks, response)
+}
+
+func policyTask(task *InternalTask, topics []string) *PolicyTask {
+	return &PolicyTask{
+		Project:  task.Key,
+		Action:   task.Action,
+		Skipped:  task.Skipped,
+		Reason:   task.Ignored,
+		From:     task.From,
+		Branch:   task.Branch,
+		CloneUrl: task.CloneUrl,
+		Wiki:     task.Wiki,
+		Mirror:   task.Mirror,
+		Topics:   topics,
+		Note:     noteText(task.Note),
+		Orphan:   task.Orphan,
+	}
+}
+
+// parsePolicyResponse reads the answer of the pre plan hook, which has to be a single JSON object of known fields
+func parsePolicyResponse(output []byte) (*PolicyResponse, error) {
+	decoder := json.NewDecoder(bytes.NewReader(output))
+	decoder.DisallowUnknownFields()
+
+	var response PolicyResponse
+	err := decoder.Decode(&response)
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("the pre plan hook didn't answer, it has to write at least {\"tasks\": []}")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("the answer of the pre plan hook isn't valid: %w", err)
+	}
+	if decoder.Decode(&struct{}{}) != io.EOF {
+		return nil, errors.New("the answer of the pre plan hook isn't valid: more than one JSON value")
+	}
+	return &response, nil
+}
+
+// applyPolicy checks every task of the response against the plan before skipping any, so a response with a single
+// change that isn't allowed changes nothing. Tasks are told apart by project and action, tasks the plan doesn't have
+// are rejected, so a policy can never add a deletion
+func applyPolicy(internalTasks []*InternalTask, planned []*PolicyTask, response *PolicyResponse) ([]*PolicySkip, error) {
+	type taskKey struct {
+		project string
+		action  Action
+	}
+	byKey := make(map[taskKey]int, len(planned))
+	for i, task := range planned {
+		byKey[taskKey{task.Project, task.Action}] = i
+	}
+
+	seen := make(map[taskKey]bool)
+	var skips []*PolicySkip
+	var skipped []int
+	for _, answer := range response.Tasks {
+		if answer == nil {
+			return nil, errors.New("the pre plan hook answered with a null task")
+		}
+		key := taskKey{answer.Project, answer.Action}
+		i, ok := byKey[key]
+		if !ok {
+			return nil, fmt.Errorf("the pre plan hook answered with a task that isn't planned: %s %s", answer.Action, answer.Project)
+		}
+		if seen[key] {
+			return nil, fmt.Errorf("the pre plan hook answered twice for %s %s", answer.Action, answer.Project)
+		}
+		seen[key] = true
+
+		original := planned[i]
+		if !sameTask(original, answer) {
+			return nil, fmt.Errorf("the pre plan hook changed %s %s in a way that isn't allowed, it may only skip tasks", answer.Action, answer.Project)
+		}
+		if original.Skipped {
+			if !answer.Skipped || answer.Reason != original.Reason {
+				return nil, fmt.Errorf("the pre plan hook changed the skipped %s %s, it may only skip tasks", answer.Action, answer.Project)
+			}
+			continue
+		}
+		if !answer.Skipped {
+			if answer.Reason != "" {
+				return nil, fmt.Errorf("the pre plan hook gave a reason for %s %s without skipping it", answer.Action, answer.Project)
+			}
+			continue
+		}
+		if answer.Reason == "" {
+			return nil, fmt.Errorf("the pre plan hook skipped %s %s without a reason", answer.Action, answer.Project)
+		}
+		skipped = append(skipped, i)
+		skips = append(skips, &PolicySkip{Project: answer.Project, Action: answer.Action, Reason: answer.Reason})
+	}
+
+	for n, i := range skipped {
+		internalTasks[i].Skipped = true
+		internalTasks[i].Ignored = msg("plan.policy", skips[n].Reason)
+	}
+	return skips, nil
+}
+
+// sameTask tells whether two tasks as the pre plan hook sees them are the same, apart from whether they are skipped
+// and why. They are compared as JSON, so a hook writing an empty list where gls left one out still answers the same
+func sameTask(a *PolicyTask, b *PolicyTask) bool {
+	x, y := *a, *b
+	x.Skipped, x.Reason, y.Skipped, y.Reason = false, "", false, ""
+	first, err := json.Marshal(&x)
+	if err != nil {
+		return false
+	}
+	second, err := json.Marshal(&y)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(first, second)
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"gls/pkg/gitlab"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// policyTasks is a plan with a clone, a pull and a pull skipped as archived
+func policyTasks() []*InternalTask {
+	return []*InternalTask{
+		{Key: "acme/api", Action: Clone, CloneUrl: "git@gitlab.example.com:acme/api.git"},
+		{Key: "acme/web", Action: Pull, CloneUrl: "git@gitlab.example.com:acme/web.git"},
+		{Key: "acme/old", Action: Pull, CloneUrl: "git@gitlab.example.com:acme/old.git", Skipped: true, Ignored: "archived"},
+	}
+}
+
+// answer is a hook writing response
+func answer(response string) string {
+	return "printf '%s' '" + response + "'"
+}
+
+func TestPrePlanHook(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the hooks are sh scripts")
+	}
+	t.Setenv("GLS_GITLAB_TOKEN", "secret")
+
+	tests := []struct {
+		name    string
+		hook    string
+		timeout time.Duration
+		skipped []string // projects skipped by the policy
+		err     string
+	}{
+		{
+			name: "keeps everything",
+			hook: answer(`{"tasks":[]}`),
+		},
+		{
+			name: "answers with the whole plan",
+			hook: `sed 's/"version":1,"dry_run":false,//'`,
+		},
+		{
+			name:    "skips a pull by topic",
+			hook:    `sed -e 's/"version":1,"dry_run":false,//' -e 's/"skipped":false,\("clone_url":"[^"]*web.git","topics":\["frozen"\]\)/"skipped":true,"reason":"frozen",\1/'`,
+			skipped: []string{"acme/web"},
+		},
+		{
+			name:    "skips with a task of its own",
+			hook:    answer(`{"tasks":[{"project":"acme/api","action":"clone","skipped":true,"reason":"not now","clone_url":"git@gitlab.example.com:acme/api.git"}]}`),
+			skipped: []string{"acme/api"},
+		},
+		{
+			name: "keeps the skipped task skipped",
+			hook: answer(`{"tasks":[{"project":"acme/old","action":"pull","skipped":true,"reason":"archived","clone_url":"git@gitlab.example.com:acme/old.git"}]}`),
+		},
+		{
+			name: "adds a delete",
+			hook: answer(`{"tasks":[{"project":"acme/api","action":"delete"}]}`),
+			err:  "isn't planned: delete acme/api",
+		},
+		{
+			name: "adds a project",
+			hook: answer(`{"tasks":[{"project":"acme/evil","action":"clone","clone_url":"git@evil.example.com:x.git"}]}`),
+			err:  "isn't planned: clone acme/evil",
+		},
+		{
+			name: "changes a clone url",
+			hook: answer(`{"tasks":[{"project":"acme/api","action":"clone","clone_url":"git@evil.example.com:acme/api.git"}]}`),
+			err:  "in a way that isn't allowed",
+		},
+		{
+			name: "unskips",
+			hook: answer(`{"tasks":[{"project":"acme/old","action":"pull","clone_url":"git@gitlab.example.com:acme/old.git"}]}`),
+			err:  "changed the skipped pull acme/old",
+		},
+		{
+			name: "changes why a task is skipped",
+			hook: answer(`{"tasks":[{"project":"acme/old","action":"pull","skipped":true,"reason":"mine","clone_url":"git@gitlab.example.com:acme/old.git"}]}`),
+			err:  "changed the skipped pull acme/old",
+		},
+		{
+			name: "answers twice",
+			hook: answer(`{"tasks":[{"project":"acme/api","action":"clone","clone_url":"git@gitlab.example.com:acme/api.git"},{"project":"acme/api","action":"clone","skipped":true,"reason":"x","clone_url":"git@gitlab.example.com:acme/api.git"}]}`),
+			err:  "answered twice for clone acme/api",
+		},
+		{
+			name: "skips without a reason",
+			hook: answer(`{"tasks":[{"project":"acme/api","action":"clone","skipped":true,"clone_url":"git@gitlab.example.com:acme/api.git"}]}`),
+			err:  "without a reason",
+		},
+		{
+			name: "gives a reason without skipping",
+			hook: answer(`{"tasks":[{"project":"acme/api","action":"clone","reason":"x","clone_url":"git@gitlab.example.com:acme/api.git"}]}`),
+			err:  "gave a reason for clone acme/api without skipping it",
+		},
+		{
+			name: "null task",
+			hook: answer(`{"tasks":[null]}`),
+			err:  "null task",
+		},
+		{
+			name: "trailing JSON",
+			hook: answer(`{"tasks":[]}{"tasks":[{"project":"acme/api","action":"clone","skipped":true,"reason":"x"}]}`),
+			err:  "more than one JSON value",
+		},
+		{
+			name: "unknown field",
+			hook: answer(`{"tasks":[],"delete":["acme/api"]}`),
+			err:  "isn't valid",
+		},
+		{
+			name: "no answer",
+			hook: "true",
+			err:  "didn't answer",
+		},
+		{
+			name: "fails",
+			hook: "echo 'policy server down' >&2; exit 1",
+			err:  "policy server down",
+		},
+		{
+			name: "doesn't see the token",
+			hook: `test -z "$GLS_GITLAB_TOKEN" || exit 3; ` + answer(`{"tasks":[]}`),
+		},
+		{
+			name:    "times out",
+			hook:    "sleep 10",
+			timeout: 100 * time.Millisecond,
+			err:     "timed out",
+		},
+		{
+			name: "exceeds the output limit",
+			hook: "head -c 17000000 /dev/zero",
+			err:  "wrote more than",
+		},
+	}
+
+	gitlabProjects := []*gitlab.Project{{Path: "acme/web", Topics: []string{"frozen"}}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var cfg Config
+			cfg.Local.Path = t.TempDir()
+			cfg.Gitlab.Token = "secret"
+			cfg.Hooks.PrePlan = test.hook
+			cfg.Hooks.Timeout = test.timeout
+			if cfg.Hooks.Timeout == 0 {
+				cfg.Hooks.Timeout = 10 * time.Second
+			}
+
+			tasks := policyTasks()
+			started := time.Now()
+			skips, err := runPrePlanHook(context.Background(), cfg, tasks, gitlabProjects)
+			if test.timeout > 0 && time.Since(started) > 5*time.Second {
+				t.Errorf("the hook wasn't killed in time")
+			}
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("got error %v, want one containing %q", err, test.err)
+				}
+				for i, task := range tasks {
+					if task.Skipped != policyTasks()[i].Skipped {
+						t.Errorf("a failing policy changed %s", task.Key)
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var skipped []string
+			for _, skip := range skips {
+				skipped = append(skipped, skip.Project)
+			}
+			if strings.Join(skipped, ",") != strings.Join(test.skipped, ",") {
+				t.Errorf("skipped %q, want %q", skipped, test.skipped)
+			}
+			for _, task := range tasks {
+				policy := strings.HasPrefix(task.Ignored, "policy: ")
+				if policy != (task.Skipped && task.Key != "acme/old") {
+					t.Errorf("%s was skipped %v for %q", task.Key, task.Skipped, task.Ignored)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// profileKey selects a profile from within the config file, flags and environment override it
+const profileKey = "PROFILE"
+
+// splitProfiles moves the keys of profiles out of values. A profile key is a config key prefixed with the upper case
+// name of the profile, e.g. WORK_GITLAB_URL. The result maps profile names to their keys without the prefix
+func splitProfiles(values map[string]string) map[string]map[string]string {
+	valid := configKeys()
+	profiles := make(map[string]map[string]string)
+
+	for key, value := range values {
+		if containsString(valid, key) {
+			continue
+		}
+
+		// The shortest name wins, profile names may contain underscores themselves
+		for i := strings.Index(key, "_"); i > 0; i = nextUnderscore(key, i) {
+			name, rest := key[:i], key[i+1:]
+			if !containsString(valid, rest) {
+				continue
+			}
+
+			if profiles[name] == nil {
+				profiles[name] = make(map[string]string)
+			}
+			profiles[name][rest] = value
+			delete(values, key)
+			break
+		}
+	}
+	return profiles
+}
+
+func nextUnderscore(key string, i int) int {
+	next := strings.Index(key[i+1:], "_")
+	if next < 0 {
+		return -1
+	}
+	return i + 1 + next
+}
+
+// applyProfile replaces the plain values by those of the profile, unknown profiles are an error listing the known ones
+func applyProfile(values map[string]string, profiles map[string]map[string]string, profile string) error {
+	keys, ok := profiles[strings.ToUpper(profile)]
+	if !ok {
+		if len(profiles) == 0 {
+			return fmt.Errorf("unknown profile %s, the config file defines none", profile)
+		}
+
+		var names []string
+		for name := range profiles {
+			names = append(names, strings.ToLower(name))
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown profile %s, available profiles are %s", profile, strings.Join(names, ", "))
+	}
+
+	for key, value := range keys {
+		values[key] = value
+	}
+	return nil
+}
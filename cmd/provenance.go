@@ -0,0 +1,127 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/cristalhq/aconfig"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// Where a config value came from, the names are message ids
+const (
+	setByDefault = "config.from_default"
+	setInFile    = "config.from_file"
+	setInEnv     = "config.from_env"
+	setByFlag    = "config.from_flag"
+)
+
+// tokenKey is the config key of the Gitlab token, which shouldn't be given as flag
+const tokenKey = "GITLAB_TOKEN"
+
+// ConfigSources tells for every config key where its value came from
+type ConfigSources map[string]string
+
+// configSources works out where every config value came from, in the order aconfig applies them: flags win
+// over the environment, which wins over the config file, which wins over the defaults
+func configSources(flags *flag.FlagSet, fileValues map[string]string) ConfigSources {
+	set := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	sources := make(ConfigSources)
+	walkConfigKeys(func(key string, field aconfig.Field) {
+		if isSection(field) {
+			return
+		}
+		_, inEnv := os.LookupEnv("GLS_" + key)
+		_, inFile := fileValues[key]
+		switch {
+		case field.Tag("flag") != "-" && set[flagName(field)]:
+			sources[key] = setByFlag
+		case inEnv:
+			sources[key] = setInEnv
+		case inFile:
+			sources[key] = setInFile
+		default:
+			sources[key] = setByDefault
+		}
+	})
+	return sources
+}
+
+// protectTokenFlag warns about a token given as flag, it stays in the shell history and anyone on the machine
+// sees it in ps. Where the platform allows, the argument is masked for ps for the rest of the run
+func protectTokenFlag(cfg *Config, sources ConfigSources) {
+	if sources[tokenKey] != setByFlag {
+		return
+	}
+
+	// The token still points into the arguments, it has to be copied before they are masked
+	cfg.Gitlab.Token = strings.Clone(cfg.Gitlab.Token)
+
+	println(text.FgYellow.Sprint(msg("config.token_flag")))
+	if maskFlagValue(os.Args[1:], "gitlab-token") {
+		println(text.FgYellow.Sprint(msg("config.token_masked")))
+	}
+}
+
+// maskFlagValue overwrites the value of the flag in args, given as -name=value, --name=value or -name value.
+// Only ever pass it os.Args, other strings may be read-only. It returns false where the arguments can't be changed for ps
+func maskFlagValue(args []string, name string) bool {
+	masked := false
+	for i, arg := range args {
+		trimmed := strings.TrimPrefix(strings.TrimPrefix(arg, "-"), "-")
+		if trimmed == arg {
+			continue
+		}
+		if value, ok := strings.CutPrefix(trimmed, name+"="); ok {
+			masked = overwriteArg(arg, len(arg)-len(value)) || masked
+		} else if trimmed == name && i+1 < len(args) {
+			masked = overwriteArg(args[i+1], 0) || masked
+		}
+	}
+	return masked
+}
+
+// showConfig prints every config value with where it came from, secrets stay hidden
+func showConfig(cfg Config, sources ConfigSources) string {
+	rows := [][3]string{{msg("help.file_key"), msg("config.value"), msg("config.source")}}
+	walkConfigKeys(func(key string, field aconfig.Field) {
+		if isSection(field) {
+			return
+		}
+		value := configValue(cfg, field)
+		if field.Tag("secret") == "true" && value != "" {
+			value = "****"
+		}
+		rows = append(rows, [3]string{key, value, msg(sources[key])})
+	})
+
+	keyLength, valueLength := 0, 0
+	for _, row := range rows {
+		keyLength = max(keyLength, text.StringWidthWithoutEscSequences(row[0]))
+		valueLength = max(valueLength, text.StringWidthWithoutEscSequences(row[1]))
+	}
+
+	var b strings.Builder
+	for _, row := range rows {
+		b.WriteString(text.Pad(row[0], keyLength+2, ' ') + text.Pad(row[1], valueLength+2, ' ') + row[2] + "\n")
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// configValue formats the value of a field of cfg the way it would be written in the config file
+func configValue(cfg Config, field aconfig.Field) string {
+	value := reflect.ValueOf(cfg)
+	for _, name := range strings.Split(field.Name(), ".") {
+		value = value.FieldByName(name)
+	}
+	if values, ok := value.Interface().([]string); ok {
+		return strings.Join(values, ",")
+	}
+	return fmt.Sprint(value.Interface())
+}
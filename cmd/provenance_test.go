@@ -0,0 +1,94 @@
+package main
+
+import (
+	"github.com/cristalhq/aconfig"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// loadWithSources loads the config from args, the environment and the values of a config file like loadConfig does
+func loadWithSources(t *testing.T, args []string, fileValues map[string]string) (Config, ConfigSources) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), ".gls")
+	if err := os.WriteFile(path, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var cfg Config
+	loader := aconfig.LoaderFor(&cfg, aconfig.Config{
+		EnvPrefix:     "GLS",
+		FlagDelimiter: "-",
+		Args:          args,
+		Files:         []string{path},
+		FileDecoders: map[string]aconfig.FileDecoder{
+			".gls": &configFileDecoder{values: fileValues},
+		},
+	})
+	flags := loader.Flags()
+	boolFlags(loader, flags)
+	if err := flags.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	if err := loader.Load(); err != nil {
+		t.Fatal(err)
+	}
+	return cfg, configSources(flags, fileValues)
+}
+
+func TestConfigSources(t *testing.T) {
+	const secret = "glpat-fl4g-s3cr3t"
+	t.Setenv("GLS_WORKERS", "3")
+	t.Setenv("GLS_DEPTH", "2")
+
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{name: "with equals", args: []string{"--gitlab-token=" + secret, "--depth=1", "--refresh"}},
+		{name: "as next argument", args: []string{"--gitlab-token", secret, "-depth", "1", "-refresh"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg, sources := loadWithSources(t, test.args, map[string]string{"LOCAL_PATH": "/src", "DEPTH": "4", "WORKERS": "5"})
+			if cfg.Gitlab.Token != secret || cfg.Depth != 1 || cfg.Workers != 3 || cfg.Local.Path != "/src" || !cfg.Refresh {
+				t.Fatalf("loaded %+v", cfg)
+			}
+
+			want := map[string]string{
+				"GITLAB_TOKEN": setByFlag,
+				"DEPTH":        setByFlag, // over the environment and the file
+				"REFRESH":      setByFlag,
+				"WORKERS":      setInEnv, // over the file
+				"LOCAL_PATH":   setInFile,
+				"GITLAB_URL":   setByDefault,
+			}
+			for key, source := range want {
+				if sources[key] != source {
+					t.Errorf("%s is %s, want %s", key, sources[key], source)
+				}
+			}
+
+			shown := showConfig(cfg, sources)
+			if strings.Contains(shown, secret) {
+				t.Errorf("the token is shown:\n%s", shown)
+			}
+			for _, line := range strings.Split(shown, "\n") {
+				if strings.HasPrefix(line, "GITLAB_TOKEN ") && strings.Join(strings.Fields(line), " ") != "GITLAB_TOKEN **** "+msg(setByFlag) {
+					t.Errorf("the token is shown as %q", line)
+				}
+			}
+		})
+	}
+}
+
+func TestShowConfigEmptySecret(t *testing.T) {
+	var cfg Config
+	for _, line := range strings.Split(showConfig(cfg, ConfigSources{}), "\n") {
+		if strings.HasPrefix(line, "GITLAB_TOKEN ") && strings.Contains(line, "****") {
+			t.Errorf("a missing token is shown as set: %q", line)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"fmt"
+	"github.com/jedib0t/go-pretty/v6/progress"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"gls/pkg/git"
+	"gls/pkg/gitlab"
+	"gls/pkg/state"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Projects without activity for longer than these are stale
+const (
+	staleAfter     = 30 * 24 * time.Hour
+	veryStaleAfter = 90 * 24 * time.Hour
+)
+
+// defaultStatsMaxAge is how old the listing and local projects of the state may be to be used by gls stats
+const defaultStatsMaxAge = time.Hour
+
+// Sources of the numbers, the names are message ids
+const (
+	fromCache = "stats.cached"
+	fromLive  = "stats.live"
+	fromMixed = "stats.mixed"
+	fromState = "stats.last_sync"
+)
+
+// ProjectNumbers are the numbers gls stats prints
+type ProjectNumbers struct {
+	Total       int
+	Present     int
+	Missing     int
+	Orphaned    int
+	Size        int64 // as far as Gitlab shares the statistics of the projects
+	Sized       int   // projects whose size is known
+	Stale       int
+	VeryStale   int
+	Quarantined int
+	Failed      int
+}
+
+// runStats answers how many projects there are, how big and how stale, in seconds. A recent state of the last sync
+// stands in for listing Gitlab and walking the local path, --live looks again anyway and --max-age=<duration> sets
+// how recent it has to be. Failures are always those of the last sync
+func runStats(args []string) {
+	live, maxAge := false, defaultStatsMaxAge
+	var rest []string
+	for _, arg := range args {
+		switch {
+		case arg == "--live":
+			live = true
+		case strings.HasPrefix(arg, "--max-age="):
+			var err error
+			maxAge, err = time.ParseDuration(strings.TrimPrefix(arg, "--max-age="))
+			if err != nil {
+				log.Fatalf("Error in --max-age: %v", err)
+			}
+		default:
+			rest = append(rest, arg)
+		}
+	}
+
+	cfg := loadConfig(rest)
+	ctx := interruptContext()
+	start := time.Now()
+
+	st := &state.State{}
+	if cfg.Local.State {
+		var err error
+		st, err = state.Load(cfg.Local.Path)
+		if err != nil {
+			println(text.FgYellow.Sprint(msg("sync.ignoring_state", err)))
+		}
+	}
+
+	gitlabProjects, gitlabFrom := []*gitlab.Project(nil), fromLive
+	if !live && listingFresh(st.Listing, listingSource(cfg), time.Now(), maxAge) {
+		gitlabProjects, gitlabFrom = st.Listing.Projects, fromCache
+		println(text.FgCyan.Sprint(msg("stats.listing_cached", time.Since(st.Listing.ListedAt).Round(time.Second))))
+	} else {
+		gl := connectGitlab(ctx, cfg)
+		println(text.FgCyan.Sprint(msg("sync.fetching_projects", cfg.Gitlab.Url)))
+		var errs []error
+		gitlabProjects, errs = gl.GetSourceProjects(ctx, listSource(cfg), cfg.Gitlab.Group, cfg.Depth, func(gitlab.Progress) {})
+		for _, err := range errs {
+			println(text.FgHiRed.Sprintf("%v", err))
+		}
+		if len(errs) > 0 {
+			log.Fatalf("Error getting gitlab projects, the numbers would be incomplete")
+		}
+	}
+	if cfg.Wikis {
+		gitlabProjects = withWikis(gitlabProjects)
+	}
+
+	localProjects, localFrom := st.Projects, fromCache
+	if !live && fresh(st.UpdatedAt, time.Now(), maxAge) {
+		println(text.FgCyan.Sprint(msg("stats.local_cached", time.Since(st.UpdatedAt).Round(time.Second))))
+	} else {
+		localFrom = fromLive
+		println(text.FgCyan.Sprint(msg("sync.loading_local", cfg.Local.Path)))
+		var err error
+		localProjects, err = git.GetLocalProjects(cfg.Local.Path, st.Projects, cfg.Workers)
+		if err != nil {
+			log.Fatalf("Error getting local projects: %v", err)
+		}
+	}
+
+	ignore, err := loadIgnoreList(cfg.Local.Path)
+	if err != nil {
+		log.Fatalf("Error reading %s: %v", ignoreFile, err)
+	}
+	gitlabProjects, localProjects, _ = ignore.filterIgnored(gitlabProjects, localProjects)
+	localProjects, _ = splitBroken(localProjects)
+
+	numbers := countProjects(gitlabProjects, syncScope(cfg, localProjects, gitlabProjects), cfg, time.Now())
+	numbers.Quarantined = countQuarantined(cfg.Local.Path)
+	numbers.Failed = len(st.Failed)
+
+	printNumbers(numbers, gitlabFrom, combinedSource(gitlabFrom, localFrom))
+	println(text.FgCyan.Sprint("\n" + msg("stats.took", time.Since(start).Round(time.Millisecond))))
+}
+
+// fresh tells whether something recorded at the given time may stand in for looking again
+func fresh(at time.Time, now time.Time, maxAge time.Duration) bool {
+	return !at.IsZero() && !at.After(now) && now.Sub(at) <= maxAge
+}
+
+// listingFresh tells whether a listing kept in the state may stand in for listing Gitlab, it has to be recent
+// and of the same source
+func listingFresh(listing *state.Listing, source string, now time.Time, maxAge time.Duration) bool {
+	return listing != nil && listing.Source == source && fresh(listing.ListedAt, now, maxAge)
+}
+
+// combinedSource is where numbers come from that need both the listing and the local projects
+func combinedSource(gitlabFrom string, localFrom string) string {
+	if gitlabFrom != localFrom {
+		return fromMixed
+	}
+	return gitlabFrom
+}
+
+// staleCounts counts the projects without activity for longer than staleAfter and veryStaleAfter, projects
+// whose last activity isn't known are neither
+func staleCounts(projects []*gitlab.Project, now time.Time) (int, int) {
+	stale, veryStale := 0, 0
+	for _, project := range projects {
+		if project.LastActivity.IsZero() {
+			continue
+		}
+		idle := now.Sub(project.LastActivity)
+		if idle > staleAfter {
+			stale++
+		}
+		if idle > veryStaleAfter {
+			veryStale++
+		}
+	}
+	return stale, veryStale
+}
+
+// countProjects compares the listed projects with the local ones like a sync would, projects a sync skips
+// aren't missing
+func countProjects(gitlabProjects []*gitlab.Project, localProjects []*git.Project, cfg Config, now time.Time) *ProjectNumbers {
+	numbers := &ProjectNumbers{Total: len(gitlabProjects)}
+
+	projectPairs := pairProjects(gitlabProjects, localProjects)
+	for key, pair := range projectPairs {
+		switch {
+		case pair.GitlabProject != nil && pair.LocalProject != nil:
+			numbers.Present++
+		case pair.GitlabProject != nil && ignoredReason(pair.GitlabProject, cfg) == "":
+			numbers.Missing++
+		case pair.GitlabProject == nil && !isWikiOf(key, projectPairs):
+			numbers.Orphaned++
+		}
+	}
+
+	for _, project := range gitlabProjects {
+		if project.Size > 0 {
+			numbers.Size += project.Size
+			numbers.Sized++
+		}
+	}
+	numbers.Stale, numbers.VeryStale = staleCounts(gitlabProjects, now)
+	return numbers
+}
+
+// countQuarantined counts the corrupt state files moved out of the way in the local path
+func countQuarantined(localPath string) int {
+	matches, _ := filepath.Glob(filepath.Join(localPath, ".gls-*.corrupt-*"))
+	return len(matches)
+}
+
+func printNumbers(numbers *ProjectNumbers, gitlabFrom string, pairFrom string) {
+	size := msg("stats.size_unknown")
+	if numbers.Sized > 0 {
+		size = msg("stats.size_of", progress.FormatBytes(numbers.Size), numbers.Sized, numbers.Total)
+	}
+
+	rows := [][3]string{
+		{msg("stats.total"), fmt.Sprint(numbers.Total), gitlabFrom},
+		{msg("stats.present"), fmt.Sprint(numbers.Present), pairFrom},
+		{msg("stats.missing"), fmt.Sprint(numbers.Missing), pairFrom},
+		{msg("stats.orphaned"), fmt.Sprint(numbers.Orphaned), pairFrom},
+		{msg("stats.size"), size, gitlabFrom},
+		{msg("stats.stale", int(staleAfter.Hours()/24)), fmt.Sprint(numbers.Stale), gitlabFrom},
+		{msg("stats.stale", int(veryStaleAfter.Hours()/24)), fmt.Sprint(numbers.VeryStale), gitlabFrom},
+		{msg("stats.quarantined"), fmt.Sprint(numbers.Quarantined), fromLive},
+		{msg("stats.failed"), fmt.Sprint(numbers.Failed), fromState},
+	}
+
+	labelLength, valueLength := 0, 0
+	for _, row := range rows {
+		labelLength = max(labelLength, text.StringWidthWithoutEscSequences(row[0]))
+		valueLength = max(valueLength, text.StringWidthWithoutEscSequences(row[1]))
+	}
+
+	println()
+	for _, row := range rows {
+		color := text.FgGreen
+		if row[2] != fromLive {
+			color = text.FgYellow
+		}
+		println(text.Pad(row[0], labelLength+2, ' ') + text.Pad(row[1], valueLength+2, ' ') + color.Sprint("("+msg(row[2])+")"))
+	}
+	if numbers.Sized < numbers.Total {
+		println(text.FgYellow.Sprint("\n" + msg("stats.size_hint")))
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"gls/pkg/git"
+	"gls/pkg/gitlab"
+	"gls/pkg/state"
+	"testing"
+	"time"
+)
+
+func TestListingFresh(t *testing.T) {
+	now := time.Date(2026, 8, 14, 16, 0, 0, 0, time.UTC)
+	source := "https://gitlab.example.com group:harbor depth -1"
+
+	tests := []struct {
+		name    string
+		listing *state.Listing
+		want    bool
+	}{
+		{name: "no listing"},
+		{name: "recent", listing: &state.Listing{ListedAt: now.Add(-20 * time.Minute), Source: source}, want: true},
+		{name: "just old enough", listing: &state.Listing{ListedAt: now.Add(-time.Hour), Source: source}, want: true},
+		{name: "too old", listing: &state.Listing{ListedAt: now.Add(-time.Hour - time.Second), Source: source}},
+		{name: "from the future", listing: &state.Listing{ListedAt: now.Add(time.Minute), Source: source}}, // the clock was changed
+		{name: "never listed", listing: &state.Listing{Source: source}},
+		{name: "another depth", listing: &state.Listing{ListedAt: now, Source: "https://gitlab.example.com group:harbor depth 1"}},
+		{name: "another source", listing: &state.Listing{ListedAt: now, Source: "https://gitlab.example.com starred"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := listingFresh(test.listing, source, now, time.Hour); got != test.want {
+				t.Errorf("got %t", got)
+			}
+		})
+	}
+}
+
+func TestCountProjects(t *testing.T) {
+	now := time.Date(2026, 8, 14, 16, 0, 0, 0, time.UTC)
+	days := func(n int) time.Time { return now.Add(-time.Duration(n) * 24 * time.Hour) }
+	gitlabProjects := []*gitlab.Project{
+		{Path: "cranes", Size: 4096, LastActivity: days(2)},
+		{Path: "docks", Size: 1024, LastActivity: days(45)},
+		{Path: "docks.wiki", Wiki: true},
+		{Path: "tugs", LastActivity: days(120)}, // missing locally, size not shared
+		{Path: "ferries", Archived: true, LastActivity: days(400)},
+		{Path: "buoys"}, // no activity known
+	}
+	localProjects := []*git.Project{
+		{Path: "cranes"},
+		{Path: "docks"},
+		{Path: "docks.wiki"},
+		{Path: "lighthouse"},      // gone from Gitlab
+		{Path: "lighthouse.wiki"}, // goes with it
+		{Path: "cranes.wiki"},     // wikis aren't listed, but its project is
+	}
+
+	var cfg Config
+	cfg.Wikis = true
+	got := countProjects(gitlabProjects, localProjects, cfg, now)
+	want := ProjectNumbers{Total: 6, Present: 3, Missing: 2, Orphaned: 2, Size: 5120, Sized: 2, Stale: 3, VeryStale: 2}
+	if *got != want {
+		t.Errorf("got %+v\nwant %+v", *got, want)
+	}
+}
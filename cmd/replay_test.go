@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"gls/pkg/gitlab"
+	"gls/pkg/gitlab/fakegitlab"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// captureStdout returns what f printed to stdout
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := os.Stdout
+	os.Stdout = writer
+	defer func() {
+		os.Stdout = previous
+	}()
+
+	printed := make(chan string)
+	go func() {
+		output, _ := io.ReadAll(reader)
+		printed <- string(output)
+	}()
+	f()
+	_ = writer.Close()
+	return <-printed
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	fake := fakegitlab.New()
+	fake.AddProject("acme/api")
+	fake.AddProject("acme/web", fakegitlab.DefaultBranch("develop"))
+	fake.AddProject("acme/team/tool")
+
+	local := t.TempDir()
+	initRepo(t, filepath.Join(local, "api"), true)
+	initRepo(t, filepath.Join(local, "web"), true)
+	initRepo(t, filepath.Join(local, "gone"), true)
+
+	var cfg Config
+	cfg.Gitlab.Source = gitlab.GroupSource
+	cfg.Gitlab.Group = "acme"
+	cfg.Depth = -1
+	cfg.Workers = 2
+	cfg.DryRun = true
+	cfg.Local.Path = local
+	cfg.Record = filepath.Join(t.TempDir(), "recording")
+
+	plan := func(cfg Config, gl *gitlab.Gitlab) string {
+		var err error
+		output := captureStdout(t, func() {
+			_, err = runCycle(context.Background(), cfg, gl, nil, 1, nil, nil)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return output
+	}
+	recorded := plan(cfg, gitlab.NewWithAPI(fake))
+	want := "1 [x] Pulling api main 2 [ ] Skipped deletion gone main 3 [x] Cloning team/tool main 4 [ ] Ignored (on branch main, not develop) web main"
+	if got := strings.Join(strings.Fields(recorded), " "); got != want {
+		t.Fatalf("planned\n%s", recorded)
+	}
+
+	// Neither Gitlab nor the local path are looked at again
+	for _, project := range []string{"api", "web", "gone"} {
+		if err := os.RemoveAll(filepath.Join(local, project)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg.Replay, cfg.Record = cfg.Record, ""
+	if err := checkReplay(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if replayed := plan(cfg, nil); replayed != recorded {
+		t.Errorf("replayed the plan\n%s\nrecorded\n%s", replayed, recorded)
+	}
+}
+
+func TestCheckReplay(t *testing.T) {
+	tests := []struct {
+		name   string
+		replay string
+		dryRun bool
+		watch  time.Duration
+		err    bool
+	}{
+		{name: "dry run", replay: "recording", dryRun: true},
+		{name: "without dry run", replay: "recording", err: true},
+		{name: "watching", replay: "recording", dryRun: true, watch: time.Minute, err: true},
+		{name: "not replaying", watch: time.Minute},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var cfg Config
+			cfg.Replay = test.replay
+			cfg.DryRun = test.dryRun
+			cfg.Watch = test.watch
+			if err := checkReplay(cfg); (err != nil) != test.err {
+				t.Errorf("got %v", err)
+			}
+		})
+	}
+}
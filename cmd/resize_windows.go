@@ -0,0 +1,8 @@
+//go:build windows
+
+package main
+
+// onResize does nothing on Windows, which has no signal for it, the width is only looked at when a run starts
+func onResize(func(width int)) func() {
+	return func() {}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"gls/pkg/git"
+	"gls/pkg/state"
+	"sync"
+	"time"
+)
+
+// defaultResumeMaxAge is how old the listing of the last sync may be for gls resume, unless configured otherwise
+const defaultResumeMaxAge = time.Hour
+
+// resuming is set by gls resume, which uses a recent listing of the last sync by default
+var resuming = false
+
+// runResume is a sync that gets back to transferring within seconds, using the listing of the last sync while it is
+// recent instead of listing Gitlab again. Clones the last run didn't complete are started over, like on every sync
+func runResume(args []string) {
+	resuming = true
+	runSync(args)
+}
+
+// cachedListing is the listing of the last sync if --gitlab-listing-max-age allows using it instead of listing
+// Gitlab, nil if it doesn't or the listing is too old or of another source
+func cachedListing(cfg Config, warn func(string)) *state.Listing {
+	maxAge := cfg.Gitlab.ListingMaxAge
+	if maxAge == 0 && resuming {
+		maxAge = defaultResumeMaxAge
+	}
+	if maxAge <= 0 || cfg.Record != "" || cfg.Replay != "" {
+		return nil
+	}
+	if !cfg.Local.State {
+		warn(msg("resume.needs_state"))
+		return nil
+	}
+
+	st, err := state.Load(cfg.Local.Path)
+	if err != nil || !listingFresh(st.Listing, listingSource(cfg), time.Now(), maxAge) {
+		return nil
+	}
+	return st.Listing
+}
+
+// CloneJournal records when clones start and complete, so clones interrupted even by a crash are started over.
+// All methods can be called on a nil CloneJournal, which records nothing
+type CloneJournal struct {
+	localPath string
+	warn      func(string)
+
+	mu     sync.Mutex
+	clones *state.Clones
+	failed bool // saving failed once, which is only warned about once
+}
+
+func loadCloneJournal(cfg Config, warn func(string)) *CloneJournal {
+	clones, err := state.LoadClones(cfg.Local.Path)
+	if err != nil {
+		warn(msg("clones.ignoring", err))
+		clones = &state.Clones{Clones: make(map[string]*state.Clone)}
+	}
+	return &CloneJournal{localPath: cfg.Local.Path, warn: warn, clones: clones}
+}
+
+// markInterrupted flags the local projects gls started cloning without the clone completing. A project whose HEAD
+// resolves got everything anyway, e.g. the run was killed right before recording it
+func (j *CloneJournal) markInterrupted(localProjects []*git.Project) {
+	if j == nil {
+		return
+	}
+	for _, project := range localProjects {
+		project.Interrupted = j.clones.Interrupted(project.Path) && project.Unborn
+	}
+}
+
+// Started records that the clone of the project at key is about to start
+func (j *CloneJournal) Started(key string) {
+	j.update(func(clones *state.Clones) bool {
+		clones.Clones[key] = &state.Clone{StartedAt: time.Now()}
+		return true
+	})
+}
+
+// Finished records the clone at key as complete if git left a repository in localPath, with HEAD resolving or
+// unborn for an empty project
+func (j *CloneJournal) Finished(key string, localPath string) {
+	if j == nil || !git.CloneComplete(localPath) {
+		return
+	}
+	j.update(func(clones *state.Clones) bool {
+		clone := clones.Clones[key]
+		if clone == nil {
+			return false
+		}
+		clone.VerifiedAt = time.Now()
+		return true
+	})
+}
+
+// Moved keeps the record of a clone with the project that was moved from one key to another
+func (j *CloneJournal) Moved(from string, to string) {
+	j.update(func(clones *state.Clones) bool {
+		clone := clones.Clones[from]
+		if clone == nil {
+			return false
+		}
+		delete(clones.Clones, from)
+		clones.Clones[to] = clone
+		return true
+	})
+}
+
+// Forget drops the record of a project that was deleted
+func (j *CloneJournal) Forget(key string) {
+	j.update(func(clones *state.Clones) bool {
+		if clones.Clones[key] == nil {
+			return false
+		}
+		delete(clones.Clones, key)
+		return true
+	})
+}
+
+// update changes the records and saves them right away if they changed, a run killed in between must not lose them
+func (j *CloneJournal) update(change func(clones *state.Clones) bool) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if !change(j.clones) {
+		return
+	}
+	err := j.clones.Save(j.localPath)
+	if err != nil && !j.failed {
+		j.failed = true
+		j.warn(msg("clones.save_failed", err))
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"github.com/jedib0t/go-pretty/v6/progress"
+	"gls/pkg/git"
+	"gls/pkg/gitlab"
+	"gls/pkg/state"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// runGit runs git in dir, failing the test if it fails
+func runGit(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-c", "user.name=gls", "-c", "user.email=gls@example.com", "-c", "init.defaultBranch=main"}, args...)...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, output)
+	}
+}
+
+// initRepo creates a repository at path, with a commit unless it is empty like the clone of an empty project
+func initRepo(t *testing.T, path string, commit bool) {
+	t.Helper()
+	err := os.MkdirAll(path, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, path, "init", "--quiet")
+	if !commit {
+		return
+	}
+	err = os.WriteFile(filepath.Join(path, "README.md"), []byte("hello\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, path, "add", ".")
+	runGit(t, path, "commit", "--quiet", "-m", "initial")
+}
+
+// reloadJournal reads the journal from disk like the next run does, failing the test on warnings
+func reloadJournal(t *testing.T, localPath string) *CloneJournal {
+	t.Helper()
+	var cfg Config
+	cfg.Local.Path = localPath
+	return loadCloneJournal(cfg, func(warning string) {
+		t.Errorf("warned: %s", warning)
+	})
+}
+
+func TestCloneJournalFinished(t *testing.T) {
+	tests := []struct {
+		name     string
+		clone    func(t *testing.T, path string)
+		complete bool
+	}{
+		{
+			name:     "cloned",
+			clone:    func(t *testing.T, path string) { initRepo(t, path, true) },
+			complete: true,
+		},
+		{
+			name:     "empty project",
+			clone:    func(t *testing.T, path string) { initRepo(t, path, false) },
+			complete: true,
+		},
+		{
+			name:  "no repository",
+			clone: func(t *testing.T, path string) {},
+		},
+		{
+			name: "not a repository",
+			clone: func(t *testing.T, path string) {
+				err := os.MkdirAll(path, 0755)
+				if err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			localPath := t.TempDir()
+			path := filepath.Join(localPath, "acme", "api")
+
+			journal := reloadJournal(t, localPath)
+			journal.Started("acme/api")
+			test.clone(t, path)
+			journal.Finished("acme/api", path)
+
+			clones := reloadJournal(t, localPath).clones
+			if clones.Clones["acme/api"] == nil {
+				t.Fatal("the clone wasn't recorded")
+			}
+			if interrupted := clones.Interrupted("acme/api"); interrupted == test.complete {
+				t.Errorf("got interrupted %v, want complete %v", interrupted, test.complete)
+			}
+		})
+	}
+}
+
+func TestCloneJournalMovedAndForgotten(t *testing.T) {
+	localPath := t.TempDir()
+	journal := reloadJournal(t, localPath)
+	journal.Started("old/api")
+	journal.Started("gone")
+	journal.Moved("old/api", "new/api")
+	journal.Forget("gone")
+
+	clones := reloadJournal(t, localPath).clones
+	if len(clones.Clones) != 1 || !clones.Interrupted("new/api") {
+		t.Errorf("got %v, want only the interrupted clone of new/api", clones.Clones)
+	}
+
+	var nilJournal *CloneJournal
+	nilJournal.Started("api") // dry runs record nothing
+	nilJournal.Finished("api", localPath)
+	nilJournal.markInterrupted([]*git.Project{{Path: "api"}})
+}
+
+// TestMarkInterrupted simulates runs killed at every point of a clone and checks what the next run starts over
+func TestMarkInterrupted(t *testing.T) {
+	tests := []struct {
+		name        string
+		started     bool // the run recorded starting the clone
+		finished    bool // and it completing
+		commit      bool // the clone got everything
+		file        bool // something else is in the clone too
+		interrupted bool
+		restart     bool
+	}{
+		{name: "killed while receiving", started: true, interrupted: true, restart: true},
+		{name: "killed while receiving with a file left", started: true, file: true, interrupted: true, restart: true},
+		{name: "killed before recording completion", started: true, commit: true},
+		{name: "completed", started: true, finished: true, commit: true},
+		{name: "killed by an older version", restart: true},
+		{name: "unborn and not cloned by gls", file: true},
+	}
+
+	localPath := t.TempDir()
+	journal := reloadJournal(t, localPath)
+	for _, test := range tests {
+		path := filepath.Join(localPath, test.name)
+		if test.started {
+			journal.Started(test.name)
+		}
+		initRepo(t, path, test.commit)
+		if test.file {
+			err := os.WriteFile(filepath.Join(path, "notes.txt"), []byte("mine\n"), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if test.finished {
+			journal.Finished(test.name, path)
+		}
+	}
+
+	localProjects, err := git.GetLocalProjects(localPath, nil, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloadJournal(t, localPath).markInterrupted(localProjects)
+	byPath := make(map[string]*git.Project)
+	for _, project := range localProjects {
+		byPath[project.Path] = project
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			project := byPath[test.name]
+			if project == nil {
+				t.Fatal("not found locally")
+			}
+			if project.Interrupted != test.interrupted {
+				t.Errorf("got interrupted %v, want %v", project.Interrupted, test.interrupted)
+			}
+			pair := &ProjectPair{GitlabProject: &gitlab.Project{Path: test.name, DefaultBranch: "main"}, LocalProject: project}
+			if restart := interruptedClone(pair, localPath); restart != test.restart {
+				t.Errorf("got restart %v, want %v", restart, test.restart)
+			}
+		})
+	}
+}
+
+func TestRestartInterruptedClone(t *testing.T) {
+	t.Setenv("HOME", t.TempDir()) // the trash
+	source := filepath.Join(t.TempDir(), "source")
+	initRepo(t, source, true)
+	cloneUrl := "file://" + filepath.ToSlash(source)
+
+	localPath := t.TempDir()
+	path := filepath.Join(localPath, "api")
+	journal := reloadJournal(t, localPath)
+	var cfg Config
+	cfg.Local.Path = localPath
+	cfg.Gitlab.Source = gitlab.GroupSource
+
+	// The first run is killed before git received anything
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	task := &Task{Key: "api", Path: path, CloneUrl: cloneUrl, Action: Clone, Tracker: &progress.Tracker{}, Journal: journal}
+	err := executeTask(ctx, task, cfg)
+	if err == nil {
+		t.Fatal("a killed clone succeeded")
+	}
+	initRepo(t, path, false) // what the killed git left behind
+
+	localProjects, err := git.GetLocalProjects(localPath, nil, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	journal = reloadJournal(t, localPath)
+	journal.markInterrupted(localProjects)
+	if len(localProjects) != 1 || !localProjects[0].Interrupted {
+		t.Fatalf("the killed clone wasn't found interrupted: %+v", localProjects)
+	}
+
+	// The next run starts it over
+	task = &Task{Key: "api", Path: path, CloneUrl: cloneUrl, Action: Clone, Tracker: &progress.Tracker{}, Journal: journal, Restart: true}
+	err = executeTask(context.Background(), task, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(path, "README.md")); err != nil {
+		t.Errorf("the clone didn't complete: %v", err)
+	}
+	if reloadJournal(t, localPath).clones.Interrupted("api") {
+		t.Error("the completed clone is still recorded as interrupted")
+	}
+	trashed, err := os.ReadDir(trashPath())
+	if err != nil || len(trashed) != 1 {
+		t.Errorf("the interrupted clone wasn't moved to the trash: %v %v", trashed, err)
+	}
+}
+
+func TestLoadClonesCorrupted(t *testing.T) {
+	localPath := t.TempDir()
+	err := os.WriteFile(filepath.Join(localPath, state.ClonesFileName), []byte("{not json"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var warnings []string
+	var cfg Config
+	cfg.Local.Path = localPath
+	journal := loadCloneJournal(cfg, func(warning string) {
+		warnings = append(warnings, warning)
+	})
+	if len(warnings) != 1 {
+		t.Errorf("got warnings %q", warnings)
+	}
+	journal.Started("api")
+	if !reloadJournal(t, localPath).clones.Interrupted("api") {
+		t.Error("the journal wasn't written anew")
+	}
+}
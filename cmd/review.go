@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// filterTasks returns the tasks matching every word of the query.
+// A word matches when it names the action of a task, or when its characters appear in order in the project path,
+// so both "api" and "tapi" find "team/api-gateway"
+func filterTasks(tasks []*InternalTask, query string) []*InternalTask {
+	words := strings.Fields(strings.ToLower(query))
+
+	var filtered []*InternalTask
+	for _, task := range tasks {
+		matches := true
+		for _, word := range words {
+			if word != string(task.Action) && !fuzzyMatch(strings.ToLower(task.Key), word) {
+				matches = false
+				break
+			}
+		}
+
+		if matches {
+			filtered = append(filtered, task)
+		}
+	}
+	return filtered
+}
+
+func fuzzyMatch(s string, query string) bool {
+	for _, r := range query {
+		i := strings.IndexRune(s, r)
+		if i < 0 {
+			return false
+		}
+		s = s[i+utf8.RuneLen(r):]
+	}
+	return true
+}
+
+// reviewPlan lets the user narrow down the plan with a query and skip or unskip tasks in bulk before anything runs.
+// Returns false if the user aborted
+func reviewPlan(tasks []*InternalTask, in *bufio.Reader, out io.Writer) (bool, error) {
+	query := ""
+	for {
+		visible := filterTasks(tasks, query)
+		printPlan(out, visible, query)
+
+		fmt.Fprint(out, msg("review.prompt")+" ")
+		input, err := in.ReadString('\n')
+		if err != nil {
+			return false, err
+		}
+
+		input = strings.TrimSpace(input)
+		switch strings.ToLower(input) {
+		case "y", "yes":
+			return true, nil
+		case "n", "no":
+			return false, nil
+		case "skip":
+			for _, task := range visible {
+				task.Skipped = true
+			}
+		case "unskip":
+			for _, task := range visible {
+				task.Skipped = task.Ignored != ""
+			}
+		case "invert":
+			for _, task := range visible {
+				task.Skipped = !task.Skipped || task.Ignored != ""
+			}
+		default:
+			if strings.HasPrefix(input, "/") {
+				query = strings.TrimPrefix(input, "/")
+				continue
+			}
+
+			err = toggleTasks(visible, input)
+			if err != nil {
+				fmt.Fprintln(out, text.FgHiRed.Sprint(err))
+			}
+		}
+	}
+}
+
+// recordReviewDecisions keeps what the user chose for the deletions in the review, those skipped for other reasons
+// weren't theirs to choose
+func recordReviewDecisions(tasks []*InternalTask) {
+	for _, task := range tasks {
+		if task.Action != Delete || task.Ignored != "" {
+			continue
+		}
+		task.Decision = DecisionReviewYes
+		if task.Skipped {
+			task.Decision = DecisionReviewNo
+		}
+	}
+}
+
+// toggleTasks flips the tasks selected by a comma separated list of 1-based numbers
+func toggleTasks(tasks []*InternalTask, selection string) error {
+	var selected []*InternalTask
+	for _, field := range strings.Split(selection, ",") {
+		number, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || number < 1 || number > len(tasks) {
+			return errors.New(msg("review.invalid_selection", field))
+		}
+		selected = append(selected, tasks[number-1])
+	}
+
+	for _, task := range selected {
+		task.Skipped = !task.Skipped || task.Ignored != ""
+	}
+	return nil
+}
+
+func printPlan(out io.Writer, tasks []*InternalTask, query string) {
+	var messageLength, keyLength int
+	for _, task := range tasks {
+		messageLength = max(messageLength, text.StringWidthWithoutEscSequences(task.Message()))
+		keyLength = max(keyLength, len(task.Key))
+	}
+	numberLength := len(strconv.Itoa(len(tasks)))
+
+	fmt.Fprintln(out)
+	for i, task := range tasks {
+		mark := "[x]"
+		if task.Skipped {
+			mark = "[ ]"
+		}
+
+		orphan := ""
+		if task.Orphan != nil {
+			orphan = "  " + text.FgMagenta.Sprint(describeOrphan(task.Orphan))
+		}
+		if task.Note != nil {
+			orphan += "  " + text.FgYellow.Sprint(describeNote(task.Note))
+		}
+
+		fmt.Fprintf(out, "%s %s %s%s%s%s\n",
+			text.AlignRight.Apply(strconv.Itoa(i+1), numberLength),
+			mark,
+			text.Pad(task.Message(), messageLength+2, ' '),
+			text.Pad(task.Key, keyLength+2, ' '),
+			task.Branch,
+			orphan)
+	}
+
+	if query != "" {
+		fmt.Fprintln(out, text.FgCyan.Sprint(msg("review.filtered", len(tasks), query)))
+	}
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"gls/pkg/git"
+	"gls/pkg/gitlab"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// reviewTasks is a plan with every action, the archived pull can't be unskipped
+func reviewTasks() []*InternalTask {
+	return []*InternalTask{
+		{Key: "team/api-gateway", Action: Clone},
+		{Key: "team/web", Action: Pull},
+		{Key: "tools/api-docs", Action: Fetch},
+		{Key: "old/archived", Action: Pull, Skipped: true, Ignored: "archived"},
+		{Key: "old/gone", Action: Delete, Skipped: true},
+		{Key: "gruppe/übersicht", Action: Pull},
+	}
+}
+
+// skippedKeys lists the skipped tasks
+func skippedKeys(tasks []*InternalTask) []string {
+	var keys []string
+	for _, task := range tasks {
+		if task.Skipped {
+			keys = append(keys, task.Key)
+		}
+	}
+	return keys
+}
+
+func TestFuzzyMatch(t *testing.T) {
+	tests := []struct {
+		s     string
+		query string
+		want  bool
+	}{
+		{s: "team/api-gateway", query: "", want: true},
+		{s: "team/api-gateway", query: "api", want: true},
+		{s: "team/api-gateway", query: "tapi", want: true},
+		{s: "team/api-gateway", query: "team/api-gateway", want: true},
+		{s: "team/api-gateway", query: "gwy", want: true},
+		{s: "team/api-gateway", query: "ipa", want: false},
+		{s: "team/api-gateway", query: "aa", want: true},
+		{s: "team/api-gateway", query: "aaaaa", want: false},
+		{s: "team/api-gateway", query: "team/api-gateway!", want: false},
+		{s: "gruppe/übersicht", query: "üb", want: true},
+		{s: "gruppe/übersicht", query: "üü", want: false},
+		{s: "gruppe/übersicht", query: "ueb", want: true},
+		{s: "", query: "a", want: false},
+	}
+
+	for _, test := range tests {
+		if got := fuzzyMatch(test.s, test.query); got != test.want {
+			t.Errorf("%q in %q: got %v, want %v", test.query, test.s, got, test.want)
+		}
+	}
+}
+
+func TestFilterTasks(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{query: "", want: []string{"team/api-gateway", "team/web", "tools/api-docs", "old/archived", "old/gone", "gruppe/übersicht"}},
+		{query: "   ", want: []string{"team/api-gateway", "team/web", "tools/api-docs", "old/archived", "old/gone", "gruppe/übersicht"}},
+		{query: "api", want: []string{"team/api-gateway", "tools/api-docs"}},
+		{query: "tapi", want: []string{"team/api-gateway", "tools/api-docs"}},
+		{query: "API", want: []string{"team/api-gateway", "tools/api-docs"}},
+		{query: "api docs", want: []string{"tools/api-docs"}},
+		{query: "pull", want: []string{"team/web", "old/archived", "gruppe/übersicht"}},
+		{query: "pull old", want: []string{"old/archived"}},
+		{query: "delete", want: []string{"old/gone"}},
+		{query: "clone fetch", want: nil}, // every word has to match
+		{query: "ÜBER", want: []string{"gruppe/übersicht"}},
+		{query: "old", want: []string{"tools/api-docs", "old/archived", "old/gone"}},
+		{query: "nothing", want: nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			var got []string
+			for _, task := range filterTasks(reviewTasks(), test.query) {
+				got = append(got, task.Key)
+			}
+			if !slices.Equal(got, test.want) {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestToggleTasks(t *testing.T) {
+	tests := []struct {
+		selection string
+		skipped   []string
+		err       bool
+	}{
+		{selection: "1", skipped: []string{"team/api-gateway", "old/archived", "old/gone"}},
+		{selection: "1,2", skipped: []string{"team/api-gateway", "team/web", "old/archived", "old/gone"}},
+		{selection: " 1 , 5 ", skipped: []string{"team/api-gateway", "old/archived"}},
+		{selection: "1,1", skipped: []string{"old/archived", "old/gone"}}, // flipped twice
+		{selection: "4", skipped: []string{"old/archived", "old/gone"}},   // ignored, stays skipped
+		{selection: "6", skipped: []string{"old/archived", "old/gone", "gruppe/übersicht"}},
+		{selection: "0", err: true},
+		{selection: "7", err: true},
+		{selection: "-1", err: true},
+		{selection: "one", err: true},
+		{selection: "", err: true},
+		{selection: "1,", err: true},
+		{selection: "1-3", err: true},
+		{selection: "1,x", err: true}, // nothing is toggled when a part is invalid
+	}
+
+	for _, test := range tests {
+		t.Run(test.selection, func(t *testing.T) {
+			tasks := reviewTasks()
+			err := toggleTasks(tasks, test.selection)
+			if (err != nil) != test.err {
+				t.Fatalf("got %v", err)
+			}
+			if test.err {
+				test.skipped = skippedKeys(reviewTasks())
+			}
+			if got := skippedKeys(tasks); !slices.Equal(got, test.skipped) {
+				t.Errorf("skipped %q, want %q", got, test.skipped)
+			}
+		})
+	}
+}
+
+func TestReviewPlan(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		ok      bool
+		err     error
+		skipped []string
+		output  string // shown at some point
+	}{
+		{
+			name:    "accepted",
+			input:   "y\n",
+			ok:      true,
+			skipped: []string{"old/archived", "old/gone"},
+		},
+		{
+			name:    "aborted",
+			input:   "NO\n",
+			skipped: []string{"old/archived", "old/gone"},
+		},
+		{
+			name:    "toggled",
+			input:   "2,5\nyes\n",
+			ok:      true,
+			skipped: []string{"team/web", "old/archived"},
+		},
+		{
+			name:    "filtered and skipped",
+			input:   "/api\nskip\n/\ny\n",
+			ok:      true,
+			skipped: []string{"team/api-gateway", "tools/api-docs", "old/archived", "old/gone"},
+			output:  msg("review.filtered", 2, "api"),
+		},
+		{
+			name:    "numbers count within the filter",
+			input:   "/old/\n2\ny\n",
+			ok:      true,
+			skipped: []string{"old/archived"},
+		},
+		{
+			name:    "unskipped, the ignored task stays",
+			input:   "unskip\ny\n",
+			ok:      true,
+			skipped: []string{"old/archived"},
+		},
+		{
+			name:    "inverted",
+			input:   "/team\ninvert\ny\n",
+			ok:      true,
+			skipped: []string{"team/api-gateway", "team/web", "old/archived", "old/gone"},
+		},
+		{
+			name:    "invalid selection asks again",
+			input:   "9\n\ny\n",
+			ok:      true,
+			skipped: []string{"old/archived", "old/gone"},
+			output:  msg("review.invalid_selection", "9"),
+		},
+		{
+			name:    "input ends",
+			input:   "1\n",
+			err:     io.EOF,
+			skipped: []string{"team/api-gateway", "old/archived", "old/gone"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tasks := reviewTasks()
+			var out strings.Builder
+			ok, err := reviewPlan(tasks, bufio.NewReader(strings.NewReader(test.input)), &out)
+			if ok != test.ok || err != test.err {
+				t.Errorf("got %v, %v, want %v, %v", ok, err, test.ok, test.err)
+			}
+			if got := skippedKeys(tasks); !slices.Equal(got, test.skipped) {
+				t.Errorf("skipped %q, want %q", got, test.skipped)
+			}
+			if !strings.Contains(out.String(), test.output) {
+				t.Errorf("%q wasn't shown in\n%s", test.output, out.String())
+			}
+
+			// Every line answers a prompt, running out of input leaves one unanswered
+			want := strings.Count(test.input, "\n")
+			if test.err != nil {
+				want++
+			}
+			if prompts := strings.Count(out.String(), msg("review.prompt")); prompts != want {
+				t.Errorf("prompted %d times, want %d", prompts, want)
+			}
+		})
+	}
+}
+
+// TestReviewOtherBranch plans a project checked out on another branch than Gitlab's default, no bulk command or
+// toggle in the review turns it into a pull
+func TestReviewOtherBranch(t *testing.T) {
+	local := []*git.Project{{Path: "team/web", Branch: "feature"}, {Path: "team/api", Branch: "main"}}
+	listed := []*gitlab.Project{
+		{Path: "team/web", DefaultBranch: "main", CloneUrl: "git@gitlab.example.com:team/web.git"},
+		{Path: "team/api", DefaultBranch: "main", CloneUrl: "git@gitlab.example.com:team/api.git"},
+	}
+
+	for _, input := range []string{"unskip\ny\n", "invert\ny\n", "invert\ninvert\ny\n", "1\ny\n", "1,2\ny\n"} {
+		t.Run(strings.ReplaceAll(input, "\n", " "), func(t *testing.T) {
+			tasks := planTasks(listed, local, nil, nil, nil, nil, nil, false, Config{})
+			slices.SortFunc(tasks, func(a, b *InternalTask) int {
+				return strings.Compare(b.Key, a.Key) // the project on the other branch first
+			})
+			web := tasks[0]
+			if web.Key != "team/web" || !web.Skipped || web.Message() != msg("action.ignored", msg("plan.other_branch", "feature", "main")) {
+				t.Fatalf("planned %s: %s", web.Key, web.Message())
+			}
+
+			var out strings.Builder
+			ok, err := reviewPlan(tasks, bufio.NewReader(strings.NewReader(input)), &out)
+			if !ok || err != nil {
+				t.Fatalf("got %v, %v", ok, err)
+			}
+			if !web.Skipped {
+				t.Error("the pull on the other branch was unskipped")
+			}
+		})
+	}
+}
+
+// TestReviewDeletions reviews two projects gone from Gitlab, only the one checked in the review is deleted and nothing
+// asks about it again
+func TestReviewDeletions(t *testing.T) {
+	local := t.TempDir()
+	for _, key := range []string{"old/gone", "old/kept"} {
+		initRepo(t, filepath.Join(local, filepath.FromSlash(key)), true)
+	}
+	localProjects := []*git.Project{{Path: "old/gone", Branch: "main"}, {Path: "old/kept", Branch: "main"}}
+
+	previous := stdin
+	stdin = bufio.NewReader(strings.NewReader("1\ny\n")) // the only answers there are
+	t.Cleanup(func() {
+		stdin = previous
+	})
+
+	var cfg Config
+	cfg.Interactive = true
+	cfg.Workers = 1
+	cfg.Local.Path = local
+	cfg.Gitlab.Source = gitlab.GroupSource
+
+	output := captureStdout(t, func() {
+		internalTasks := planTasks(nil, localProjects, nil, nil, nil, nil, nil, false, cfg)
+		proceed, err := reviewPlan(internalTasks, stdin, os.Stdout)
+		if err != nil || !proceed {
+			t.Fatalf("the review ended with %v, %v", proceed, err)
+		}
+		recordReviewDecisions(internalTasks)
+		decisions := []Decision{internalTasks[0].Decision, internalTasks[1].Decision}
+		if !slices.Equal(decisions, []Decision{DecisionReviewYes, DecisionReviewNo}) {
+			t.Errorf("decided %q", decisions)
+		}
+
+		tasks, _, _ := createTasks(internalTasks, cfg, cloneHosts(cfg, nil), 120)
+		executeTasks(context.Background(), tasks, cfg, newLogWriter(), NewRunningTasks(), nil, nil)
+		for _, task := range tasks {
+			if err := task.Error.Load(); err != nil {
+				t.Errorf("%s %s failed: %v", task.Action, task.Key, *err)
+			}
+		}
+	})
+
+	if _, err := os.Stat(filepath.Join(local, "old", "gone")); !os.IsNotExist(err) {
+		t.Errorf("the checked deletion didn't run: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(local, "old", "kept", ".git")); err != nil {
+		t.Errorf("the unchecked project is gone: %v", err)
+	}
+	if prompts := strings.Count(output, msg("prompt.yes_no")); prompts != 0 {
+		t.Errorf("asked %d times more after the review:\n%s", prompts, output)
+	}
+	if rest, err := stdin.ReadString('\n'); rest != "" || err != io.EOF {
+		t.Errorf("input left unread: %q", rest)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"gls/pkg/git"
+	"gls/pkg/state"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// updateShadow records the deletes of a plan made in shadow mode, with why they would have happened and what work
+// would have been lost. Once shadow mode is off the records are cleared, as deletes are real again
+func updateShadow(ctx context.Context, cfg Config, tasks []*InternalTask, info func(string)) error {
+	if !cfg.Delete.Shadow {
+		cleared, err := state.ClearShadow(cfg.Local.Path)
+		if cleared {
+			info(msg("shadow.cleared"))
+		}
+		return err
+	}
+
+	shadow, err := state.LoadShadow(cfg.Local.Path)
+	if err != nil {
+		return err
+	}
+	shadow.StartRun(time.Now())
+
+	recorded := 0
+	for _, task := range tasks {
+		if task.Action != Delete {
+			continue
+		}
+
+		deletion := &state.ShadowDeletion{Path: task.Key, Reason: msg("shadow.not_on_gitlab")}
+		if task.Orphan != nil {
+			deletion.Reason = describeOrphan(task.Orphan)
+		}
+		deletion.Unpushed, err = git.UnpushedWork(ctx, filepath.Join(cfg.Local.Path, task.Key))
+		deletion.Unknown = err != nil
+		shadow.Record(deletion)
+		recorded++
+	}
+
+	if recorded > 0 {
+		info(msg("shadow.recorded", recorded))
+	}
+	return shadow.Save(cfg.Local.Path)
+}
+
+// runShadowReport summarizes what shadow mode would have deleted over all its runs
+func runShadowReport(args []string) {
+	cfg := loadConfig(args)
+
+	shadow, err := state.LoadShadow(cfg.Local.Path)
+	if err != nil {
+		log.Fatalf("Error reading %s: %v", state.ShadowFileName, err)
+	}
+	if shadow.Runs == 0 {
+		println(text.FgCyan.Sprint(msg("shadow.no_runs")))
+		return
+	}
+
+	println(text.FgCyan.Sprint(msg("shadow.runs", shadow.Runs, shadow.LastRun.Local().Format("2006-01-02 15:04"))))
+
+	current, atRisk := 0, 0
+	for _, deletion := range shadow.Deletions {
+		color := text.FgHiRed
+		status := msg("shadow.still_planned")
+		if shadow.Current(deletion) {
+			current++
+		} else {
+			color = text.FgHiBlack
+			status = msg("shadow.no_longer_planned")
+		}
+
+		println(color.Sprint(fmt.Sprintf("\n%s  %s", deletion.Path, status)))
+		println(msg("shadow.seen", deletion.FirstSeen.Local().Format("2006-01-02"), deletion.LastSeen.Local().Format("2006-01-02"), deletion.Runs))
+		println(msg("shadow.reason", deletion.Reason))
+		switch {
+		case deletion.Unknown:
+			println(text.FgYellow.Sprint(msg("shadow.unpushed_unknown")))
+		case len(deletion.Unpushed) > 0:
+			atRisk++
+			println(text.FgYellow.Sprint(msg("shadow.unpushed", strings.Join(deletion.Unpushed, ", "))))
+		}
+	}
+
+	println(text.FgCyan.Sprint("\n" + msg("shadow.summary", len(shadow.Deletions), current, atRisk)))
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"gls/pkg/gitlab"
+	"gls/pkg/state"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUpdateShadow(t *testing.T) {
+	var cfg Config
+	cfg.Local.Path = t.TempDir()
+	initRepo(t, filepath.Join(cfg.Local.Path, "legacy", "billing"), true) // its commit is on no remote
+	initRepo(t, filepath.Join(cfg.Local.Path, "legacy", "cron"), false)
+	retired := &gitlab.OrphanEvent{Type: gitlab.ProjectDeleted, Actor: "Robin", Time: time.Date(2026, 6, 1, 9, 0, 0, 0, time.UTC)}
+
+	tests := []struct {
+		name   string
+		shadow bool
+		tasks  []*InternalTask
+		want   map[string]string // runs, whether the last run would still delete it and the work at risk
+	}{
+		{
+			name:   "first run",
+			shadow: true,
+			tasks: []*InternalTask{
+				{Key: "legacy/billing", Action: Delete, Skipped: true},
+				{Key: "legacy/cron", Action: Delete, Skipped: true, Orphan: retired},
+				{Key: "legacy/ledger", Action: Pull},
+			},
+			want: map[string]string{
+				"legacy/billing": "1 current unpushed",
+				"legacy/cron":    "1 current",
+			},
+		},
+		{
+			name:   "second run",
+			shadow: true,
+			tasks: []*InternalTask{
+				{Key: "legacy/billing", Action: Delete, Skipped: true},
+				{Key: "legacy/fax", Action: Delete, Skipped: true}, // gone in the meantime
+			},
+			want: map[string]string{
+				"legacy/billing": "2 current unpushed",
+				"legacy/cron":    "1",
+				"legacy/fax":     "1 current unknown",
+			},
+		},
+		{
+			name:  "shadow mode off",
+			tasks: []*InternalTask{{Key: "legacy/billing", Action: Delete}},
+		},
+	}
+
+	var firstRun time.Time
+	for i, test := range tests {
+		cfg.Delete.Shadow = test.shadow
+		var infos []string
+		if err := updateShadow(context.Background(), cfg, test.tasks, func(s string) { infos = append(infos, s) }); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		shadow, err := state.LoadShadow(cfg.Local.Path)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if i == 0 {
+			firstRun = shadow.LastRun
+		}
+		if !test.shadow {
+			if _, err := os.Stat(filepath.Join(cfg.Local.Path, state.ShadowFileName)); !os.IsNotExist(err) || shadow.Runs != 0 {
+				t.Errorf("%s: the records are kept: %v", test.name, err)
+			}
+			if !slices.Equal(infos, []string{msg("shadow.cleared")}) {
+				t.Errorf("%s: told %q", test.name, infos)
+			}
+			continue
+		}
+
+		got := make(map[string]string)
+		for _, deletion := range shadow.Deletions {
+			description := fmt.Sprint(deletion.Runs)
+			if shadow.Current(deletion) {
+				description += " current"
+			}
+			if len(deletion.Unpushed) == 1 && strings.HasPrefix(deletion.Unpushed[0], "unpushed commit ") && strings.HasSuffix(deletion.Unpushed[0], " initial") {
+				description += " unpushed"
+			}
+			if deletion.Unknown {
+				description += " unknown"
+			}
+			got[deletion.Path] = description
+
+			if !deletion.FirstSeen.Equal(firstRun) && deletion.Path != "legacy/fax" {
+				t.Errorf("%s: %s first seen at %s, not in the first run", test.name, deletion.Path, deletion.FirstSeen)
+			}
+			if deletion.Path == "legacy/cron" && deletion.Reason != describeOrphan(retired) {
+				t.Errorf("%s: %s would be deleted because %q", test.name, deletion.Path, deletion.Reason)
+			}
+		}
+		if !maps.Equal(got, test.want) || shadow.Runs != i+1 {
+			t.Errorf("%s: recorded %q after %d runs", test.name, got, shadow.Runs)
+		}
+		if !slices.IsSortedFunc(shadow.Deletions, func(a, b *state.ShadowDeletion) int { return strings.Compare(a.Path, b.Path) }) {
+			t.Errorf("%s: the records aren't sorted by path", test.name)
+		}
+	}
+}
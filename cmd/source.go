@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"gls/pkg/git"
+	"gls/pkg/gitlab"
+	"path/filepath"
+)
+
+// listSource is where the projects to sync come from, loadConfig made sure it parses
+func listSource(cfg Config) *gitlab.Source {
+	source, _ := gitlab.ParseSource(cfg.Gitlab.Source)
+	return source
+}
+
+// pathRoot is the group the paths of the listed projects are relative to, empty for sources whose projects keep
+// their full path
+func pathRoot(cfg Config) string {
+	if !listSource(cfg).Group() {
+		return ""
+	}
+	return cfg.Gitlab.Group
+}
+
+// listingSource tells apart listings of different projects, of another instance, source, group or depth
+func listingSource(cfg Config) string {
+	source := listSource(cfg)
+	if !source.Group() {
+		return fmt.Sprintf("%s %s", cfg.Gitlab.Url, source)
+	}
+	return fmt.Sprintf("%s %s:%s depth %d", cfg.Gitlab.Url, source, cfg.Gitlab.Group, cfg.Depth)
+}
+
+// syncScope returns the local projects a sync is responsible for. Below a group those are the ones within the depth,
+// deeper ones may have been synced by a deeper run. Other sources pick projects from anywhere on the instance,
+// so only listed projects and those marked by an earlier sync of such a source count, never anything else in the
+// local path. Only they can be deleted
+func syncScope(cfg Config, localProjects []*git.Project, gitlabProjects []*gitlab.Project) []*git.Project {
+	if listSource(cfg).Group() {
+		return withinDepth(localProjects, cfg.Depth)
+	}
+
+	listed := make(map[string]bool)
+	for _, project := range gitlabProjects {
+		listed[project.Path] = true
+	}
+
+	var projects []*git.Project
+	for _, project := range localProjects {
+		if listed[project.Path] || marked(cfg, project) {
+			projects = append(projects, project)
+		}
+	}
+	return projects
+}
+
+// marked tells whether gls synced a local project from a source other than a group, unreadable ones never count
+func marked(cfg Config, project *git.Project) bool {
+	if project.Broken {
+		return false
+	}
+	source, err := git.SourceMark(filepath.Join(cfg.Local.Path, project.Path))
+	return err == nil && source != ""
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"gls/pkg/git"
+	"gls/pkg/gitlab"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestSyncScope(t *testing.T) {
+	local := t.TempDir()
+	for _, path := range []string{"observatory/radar", "observatory/lab/optics", "partners/mirror", "personal/dotfiles"} {
+		initRepo(t, filepath.Join(local, path), true)
+	}
+	if err := git.MarkSource(filepath.Join(local, "partners/mirror"), gitlab.StarredSource); err != nil {
+		t.Fatal(err)
+	}
+	localProjects := []*git.Project{
+		{Path: "observatory/radar"},
+		{Path: "observatory/lab/optics"},
+		{Path: "partners/mirror"},   // starred by an earlier sync, unstarred since
+		{Path: "personal/dotfiles"}, // never synced by gls
+		{Path: "partners/broken", Broken: true},
+	}
+	listed := []*gitlab.Project{{Path: "observatory/radar"}}
+
+	tests := []struct {
+		source string
+		depth  int
+		want   []string
+	}{
+		{source: gitlab.GroupSource, depth: -1, want: []string{"observatory/radar", "observatory/lab/optics", "partners/mirror", "personal/dotfiles", "partners/broken"}},
+		{source: gitlab.GroupSource, depth: 1, want: []string{"observatory/radar", "partners/mirror", "personal/dotfiles", "partners/broken"}},
+		{source: gitlab.StarredSource, depth: -1, want: []string{"observatory/radar", "partners/mirror"}},
+		{source: "ids:1", depth: 0, want: []string{"observatory/radar", "partners/mirror"}}, // the depth is for groups only
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%s depth %d", test.source, test.depth), func(t *testing.T) {
+			var cfg Config
+			cfg.Gitlab.Source = test.source
+			cfg.Local.Path = local
+			cfg.Depth = test.depth
+
+			var got []string
+			for _, project := range syncScope(cfg, localProjects, listed) {
+				got = append(got, project.Path)
+			}
+			if !slices.Equal(got, test.want) {
+				t.Errorf("synced %q", got)
+			}
+		})
+	}
+}
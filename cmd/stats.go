@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"github.com/jedib0t/go-pretty/v6/progress"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"sort"
+	"time"
+)
+
+// slowestTasks is how many of the slowest tasks the summary lists
+const slowestTasks = 5
+
+// CycleStats tells where the time of a cycle went and how much git received
+type CycleStats struct {
+	WallTime time.Duration `json:"wall_time_ns"`
+	TaskTime time.Duration `json:"task_time_ns"` // summed over all tasks, workers run them in parallel
+	Bytes    int64         `json:"bytes"`        // as reported by git, tasks that didn't report any count as 0
+	Slowest  []*TaskTime   `json:"slowest"`
+}
+
+type TaskTime struct {
+	Project  string        `json:"project"`
+	Action   Action        `json:"action"`
+	Duration time.Duration `json:"duration_ns"`
+}
+
+func collectStats(tasks []*Task, wallTime time.Duration) *CycleStats {
+	stats := &CycleStats{WallTime: wallTime}
+
+	var times []*TaskTime
+	for _, task := range tasks {
+		if task.StartedAt.IsZero() {
+			continue // skipped or failed during planning
+		}
+
+		duration := task.FinishedAt.Sub(task.StartedAt)
+		stats.TaskTime += duration
+		if task.Metric != nil {
+			stats.Bytes += task.Metric.Bytes
+		}
+		times = append(times, &TaskTime{Project: task.Key, Action: task.Action, Duration: duration})
+	}
+
+	sort.SliceStable(times, func(i, j int) bool {
+		return times[i].Duration > times[j].Duration
+	})
+	stats.Slowest = times[:min(len(times), slowestTasks)]
+	return stats
+}
+
+func printStats(stats *CycleStats) {
+	if len(stats.Slowest) == 0 {
+		return // nothing ran
+	}
+
+	println(text.FgCyan.Sprint("\n" + msg("summary.stats",
+		stats.WallTime.Round(time.Millisecond), stats.TaskTime.Round(time.Millisecond), progress.FormatBytes(stats.Bytes))))
+	println(msg("summary.slowest"))
+	for _, task := range stats.Slowest {
+		println(fmt.Sprintf("%10s  %s %s", task.Duration.Round(time.Millisecond), task.Action, task.Project))
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"gls/pkg/git"
+	"gls/pkg/gitlab"
+	"gls/pkg/state"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ProjectState is how a project compares with Gitlab, the names are message ids
+type ProjectState string
+
+const (
+	StateInSync      ProjectState = "state.in_sync"
+	StateBehind      ProjectState = "state.behind"
+	StateAhead       ProjectState = "state.ahead"
+	StateDiverged    ProjectState = "state.diverged"
+	StateDirty       ProjectState = "state.dirty"
+	StateWrongBranch ProjectState = "state.wrong_branch"
+	StateMissing     ProjectState = "state.missing"
+	StateOrphaned    ProjectState = "state.orphaned"
+	StateIgnored     ProjectState = "state.ignored"
+	StateUnknown     ProjectState = "state.unknown"
+)
+
+// states is the order the counts are listed in
+var states = []ProjectState{
+	StateInSync, StateIgnored, StateBehind, StateAhead, StateDiverged, StateDirty, StateWrongBranch, StateMissing, StateOrphaned, StateUnknown,
+}
+
+var divergenceStates = map[git.Divergence]ProjectState{
+	git.InSync:   StateInSync,
+	git.Behind:   StateBehind,
+	git.Ahead:    StateAhead,
+	git.Diverged: StateDiverged,
+}
+
+type ProjectStatus struct {
+	Key    string
+	Branch string
+	State  ProjectState
+	Err    error       // why the state is unknown
+	Note   *state.Note // only shown with --wide
+}
+
+// runStatus pairs the projects like a sync but only reports how they compare, nothing is cloned, pulled or deleted.
+// With --wide the notes of the projects are listed too. It exits with 1 unless everything is in sync
+func runStatus(args []string) {
+	var wide bool
+	var rest []string
+	for _, arg := range args {
+		if arg == "--wide" {
+			wide = true
+		} else {
+			rest = append(rest, arg)
+		}
+	}
+
+	cfg := loadConfig(rest)
+	ctx := interruptContext()
+
+	overrides, err := parseBranchOverrides(cfg.Branch.Overrides)
+	if err != nil {
+		log.Fatalf("Error in branch overrides: %v", err)
+	}
+
+	gl := connectGitlab(ctx, cfg)
+	ctx = withGitCredentials(ctx, cfg)
+
+	println(text.FgCyan.Sprint(msg("sync.fetching_projects", cfg.Gitlab.Url)))
+	gitlabProjects, errs := gl.GetSourceProjects(ctx, listSource(cfg), cfg.Gitlab.Group, cfg.Depth, func(gitlab.Progress) {})
+	for _, err := range errs {
+		println(text.FgHiRed.Sprintf("%v", err))
+	}
+	if len(errs) > 0 {
+		log.Fatalf("Error getting gitlab projects, the status would be incomplete")
+	}
+	if cfg.Wikis {
+		gitlabProjects = withWikis(gitlabProjects)
+	}
+
+	ignore, err := loadIgnoreList(cfg.Local.Path)
+	if err != nil {
+		log.Fatalf("Error reading %s: %v", ignoreFile, err)
+	}
+
+	println(text.FgCyan.Sprint(msg("sync.loading_local", cfg.Local.Path)))
+	localProjects, err := git.GetLocalProjects(cfg.Local.Path, nil, cfg.Workers)
+	if err != nil {
+		log.Fatalf("Error getting local projects: %v", err)
+	}
+
+	gitlabProjects, localProjects, _ = ignore.filterIgnored(gitlabProjects, localProjects)
+	localProjects, broken := splitBroken(localProjects)
+	for _, project := range broken {
+		warning := msg("sync.broken_project", project.Path)
+		if project.Err != nil {
+			warning = msg("sync.unreadable_project", project.Path, project.Err)
+		}
+		println(text.FgYellow.Sprint(warning))
+	}
+
+	statuses := projectStatuses(ctx, gitlabProjects, syncScope(cfg, localProjects, gitlabProjects), overrides, cfg)
+	if errors.Is(ctx.Err(), context.Canceled) {
+		log.Fatalf("Interrupted")
+	}
+
+	if wide {
+		notes := loadNotes(cfg, func(warning string) {
+			println(text.FgYellow.Sprint(warning))
+		})
+		for _, status := range statuses {
+			status.Note = notes.Find(status.Key)
+		}
+	}
+	printStatuses(statuses, wide)
+
+	for _, status := range statuses {
+		if status.State != StateInSync && status.State != StateIgnored {
+			os.Exit(1)
+		}
+	}
+}
+
+// projectStatuses compares every project, asking origin about up to cfg.Workers projects at once
+func projectStatuses(ctx context.Context, gitlabProjects []*gitlab.Project, localProjects []*git.Project, overrides []*BranchOverride, cfg Config) []*ProjectStatus {
+	var statuses []*ProjectStatus
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, max(cfg.Workers, 1))
+
+	projectPairs := pairProjects(gitlabProjects, localProjects)
+	for key, pair := range projectPairs {
+		if pair.LocalProject == nil && ignoredReason(pair.GitlabProject, cfg) != "" {
+			continue // not synced, so not missing either
+		}
+
+		status := &ProjectStatus{Key: key}
+		statuses = append(statuses, status)
+
+		switch {
+		case pair.LocalProject == nil:
+			status.State = StateMissing
+			status.Branch, _ = effectiveBranch(overrides, pair.GitlabProject)
+			continue
+		case pair.GitlabProject == nil && isWikiOf(key, projectPairs):
+			status.State = StateIgnored // wikis aren't synced, but their project still exists
+		case pair.GitlabProject == nil:
+			status.State = StateOrphaned
+		case ignoredReason(pair.GitlabProject, cfg) != "":
+			status.State = StateIgnored
+		}
+		status.Branch = pair.LocalProject.Branch
+		if status.State != "" {
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			status.State, status.Err = compareProject(ctx, pair, overrides, cfg)
+		}()
+	}
+	wg.Wait()
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Key < statuses[j].Key
+	})
+	return statuses
+}
+
+func compareProject(ctx context.Context, pair *ProjectPair, overrides []*BranchOverride, cfg Config) (ProjectState, error) {
+	if pair.LocalProject.Unborn {
+		if pair.GitlabProject.DefaultBranch == "" {
+			return StateInSync, nil // empty on both sides
+		}
+		return StateBehind, nil
+	}
+
+	branch, _ := effectiveBranch(overrides, pair.GitlabProject)
+	if !pair.GitlabProject.Wiki && branch != pair.LocalProject.Branch {
+		return StateWrongBranch, nil
+	}
+
+	path := filepath.Join(cfg.Local.Path, pair.LocalProject.Path)
+	dirty, err := git.IsDirty(ctx, path)
+	if err != nil {
+		return StateUnknown, err
+	}
+	if dirty {
+		return StateDirty, nil
+	}
+
+	divergence, err := git.CompareWithRemote(ctx, path, pair.LocalProject.Branch)
+	if err != nil {
+		return StateUnknown, err
+	}
+	return divergenceStates[divergence], nil
+}
+
+func printStatuses(statuses []*ProjectStatus, wide bool) {
+	stateHeader, keyHeader, branchHeader := msg("header.status"), msg("header.project"), msg("header.branch")
+
+	stateLength := text.StringWidthWithoutEscSequences(stateHeader)
+	keyLength := text.StringWidthWithoutEscSequences(keyHeader)
+	branchLength := text.StringWidthWithoutEscSequences(branchHeader)
+	for _, status := range statuses {
+		stateLength = max(stateLength, text.StringWidthWithoutEscSequences(msg(string(status.State))))
+		keyLength = max(keyLength, len(status.Key))
+		branchLength = max(branchLength, len(status.Branch))
+	}
+
+	header := text.Pad(stateHeader, stateLength+2, ' ') + text.Pad(keyHeader, keyLength+2, ' ') + branchHeader
+	if wide {
+		header = text.Pad(header, stateLength+keyLength+branchLength+6, ' ') + msg("header.note")
+	}
+	println(text.FgHiGreen.Sprint("\n" + header))
+
+	counts := make(map[ProjectState]int)
+	for _, status := range statuses {
+		counts[status.State]++
+
+		color := text.FgYellow
+		switch status.State {
+		case StateInSync, StateIgnored:
+			color = text.FgGreen
+		case StateUnknown:
+			color = text.FgHiRed
+		}
+		line := color.Sprint(text.Pad(msg(string(status.State)), stateLength+2, ' ')) + text.Pad(status.Key, keyLength+2, ' ') + status.Branch
+		if wide && status.Note != nil {
+			line += strings.Repeat(" ", branchLength+2-len(status.Branch)) + describeNote(status.Note)
+		}
+		println(line)
+	}
+
+	for _, status := range statuses {
+		if status.Err != nil {
+			println(text.FgHiRed.Sprint("\n" + msg("state.failed", status.Key, status.Err)))
+		}
+	}
+
+	var summary []string
+	for _, state := range states {
+		if counts[state] > 0 {
+			summary = append(summary, fmt.Sprintf("%d %s", counts[state], msg(string(state))))
+		}
+	}
+	println(text.FgCyan.Sprint("\n" + strings.Join(summary, ", ")))
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"time"
+)
+
+// CycleSummary counts what a cycle did, a quiet cycle did nothing worth more than a single line
+type CycleSummary struct {
+	Checked  int // tasks that ran
+	Cloned   int
+	Deleted  int
+	Moved    int
+	Updated  int // pulls that brought in commits and repairs
+	Failed   int
+	Warnings int
+	Duration time.Duration
+}
+
+func summarizeCycle(tasks []*Task, warnings int, duration time.Duration) *CycleSummary {
+	summary := &CycleSummary{Warnings: warnings, Duration: duration}
+	for _, task := range tasks {
+		if task.Error.Load() != nil {
+			summary.Failed++
+			continue // includes tasks failing during planning, which never ran
+		}
+		if task.Skipped {
+			continue
+		}
+
+		summary.Checked++
+		switch {
+		case task.Action == Clone:
+			summary.Cloned++
+		case task.Action == Delete:
+			summary.Deleted++
+		case task.Action == Move:
+			summary.Moved++
+		case task.Repaired, task.PullResult != nil && !task.PullResult.UpToDate:
+			summary.Updated++
+		}
+	}
+	return summary
+}
+
+func (s *CycleSummary) Quiet() bool {
+	return s.Cloned == 0 && s.Deleted == 0 && s.Moved == 0 && s.Updated == 0 && s.Failed == 0 && s.Warnings == 0
+}
+
+// printTable prints the final state of the progress table, for cycles whose live progress wasn't shown
+func printTable(header string, tasks []*Task) {
+	println(text.FgHiGreen.Sprint(header))
+	for _, task := range tasks {
+		status := text.FgGreen.Sprint(msg("status.done"))
+		if task.Error.Load() != nil {
+			status = text.FgHiRed.Sprint(msg("status.error"))
+		}
+		println(task.Tracker.Message + status)
+	}
+}
+
+// waitForNextCycle returns false if ctx is done before the interval passed
+func waitForNextCycle(ctx context.Context, interval time.Duration) bool {
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
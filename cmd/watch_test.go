@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"gls/pkg/git"
+	"gls/pkg/gitlab"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestInteractiveWatchCycles reviews and runs two cycles the way --interactive --watch does, typing each answer once
+// the prompt waits for it. The cancel watcher of the first cycle must not take the review answers of the second
+func TestInteractiveWatchCycles(t *testing.T) {
+	reader, writer := io.Pipe()
+	defer writer.Close()
+	previousInput, previousStdin := input, stdin
+	input = NewInput(reader)
+	stdin = bufio.NewReader(input)
+	t.Cleanup(func() {
+		input, stdin = previousInput, previousStdin
+	})
+	typed := func(line string) {
+		go func() {
+			_, _ = io.WriteString(writer, line+"\n")
+		}()
+	}
+
+	var cfg Config
+	cfg.Interactive = true
+	cfg.Workers = 1
+	cfg.Gitlab.Source = gitlab.GroupSource
+	dir := t.TempDir()
+
+	for cycle := 1; cycle <= 2; cycle++ {
+		var out strings.Builder
+		typed("y")
+		reviewed := make(chan error, 1)
+		go func() {
+			proceed, err := reviewPlan([]*InternalTask{{Key: "acme/api", Action: Clone}}, stdin, &out)
+			if err == nil && !proceed {
+				err = errors.New("aborted")
+			}
+			reviewed <- err
+		}()
+		select {
+		case err := <-reviewed:
+			if err != nil {
+				t.Fatalf("cycle %d: the review got %v", cycle, err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("cycle %d: the review never got its answer", cycle)
+		}
+
+		// The clone hangs until it is cancelled, x is typed until it shows up in the list
+		task := hangingClone(t, dir)
+		pw := newLogWriter()
+		done := make(chan struct{})
+		go func() {
+			executeCycle(context.Background(), []*Task{task}, cfg, pw, nil, nil)
+			close(done)
+		}()
+		for listed := false; !listed; {
+			typed("x")
+			waitUntilLogged(pw, len(pw.Logs())+1)
+			listed = slices.Contains(pw.Logs(), msg("cancel.enter_number"))
+		}
+		typed("1")
+
+		select {
+		case <-done:
+		case <-time.After(10 * time.Second):
+			t.Fatalf("cycle %d: the clone wasn't cancelled, logged %q", cycle, pw.Logs())
+		}
+		if err := task.Error.Load(); err == nil || *err != errCancelledByUser {
+			t.Errorf("cycle %d: the clone ended with %v", cycle, err)
+		}
+	}
+
+	// Nothing is reading the input between cycles
+	typed("n")
+	answered := make(chan string, 1)
+	go func() {
+		line, _ := stdin.ReadString('\n')
+		answered <- line
+	}()
+	select {
+	case line := <-answered:
+		if line != "n\n" {
+			t.Errorf("the prompt after the cycles got %q", line)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("the prompt after the cycles never got its answer")
+	}
+}
+
+func TestSummarizeCycle(t *testing.T) {
+	failed := func(task *Task) *Task {
+		err := errors.New("exit status 128")
+		task.Error.Store(&err)
+		return task
+	}
+
+	tests := []struct {
+		name     string
+		tasks    []*Task
+		warnings int
+		want     CycleSummary
+		quiet    bool
+	}{
+		{name: "nothing planned", quiet: true},
+		{name: "nothing changed", tasks: []*Task{
+			{Key: "acme/api", Action: Pull, PullResult: &git.PullResult{UpToDate: true}},
+			{Key: "acme/web", Action: Fetch},
+			{Key: "acme/old", Action: Delete, Skipped: true},
+			{Key: "acme/new", Action: Clone, Skipped: true},
+		}, want: CycleSummary{Checked: 2}, quiet: true},
+		{name: "changes", tasks: []*Task{
+			{Key: "acme/api", Action: Pull, PullResult: &git.PullResult{CommitsFetched: 3}},
+			{Key: "acme/web", Action: Pull, Repaired: true},
+			{Key: "acme/new", Action: Clone},
+			{Key: "acme/old", Action: Delete},
+			{Key: "acme/moved", Action: Move},
+			{Key: "acme/docs", Action: Pull, PullResult: &git.PullResult{UpToDate: true}},
+		}, want: CycleSummary{Checked: 6, Cloned: 1, Deleted: 1, Moved: 1, Updated: 2}},
+		{name: "failed", tasks: []*Task{
+			failed(&Task{Key: "acme/api", Action: Pull}),
+			failed(&Task{Key: "acme/new", Action: Clone, Skipped: true}), // failed while planning
+		}, want: CycleSummary{Failed: 2}},
+		{name: "warned", warnings: 1, want: CycleSummary{Warnings: 1}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			summary := summarizeCycle(test.tasks, test.warnings, time.Second)
+			test.want.Duration = time.Second
+			if *summary != test.want || summary.Quiet() != test.quiet {
+				t.Errorf("got %+v, quiet %t, want %+v, quiet %t", *summary, summary.Quiet(), test.want, test.quiet)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"gls/pkg/git"
+	"gls/pkg/gitlab"
+	"strings"
+)
+
+// wikiSuffix is appended to the path of a project for its wiki, both locally and in the clone url
+const wikiSuffix = ".wiki"
+
+// withWikis adds the wikis of projects that have them enabled as projects of their own
+func withWikis(gitlabProjects []*gitlab.Project) []*gitlab.Project {
+	projects := gitlabProjects
+	for _, project := range gitlabProjects {
+		if !project.WikiEnabled {
+			continue
+		}
+
+		cloneUrl, err := git.WikiUrl(project.CloneUrl)
+		if err != nil {
+			continue
+		}
+
+		projects = append(projects, &gitlab.Project{
+			Path:     project.Path + wikiSuffix,
+			CloneUrl: cloneUrl,
+			Topics:   project.Topics, // ignored together with their project
+			Wiki:     true,
+			Archived: project.Archived,
+			Shared:   project.Shared,
+		})
+	}
+	return projects
+}
+
+// isWikiOf tells whether a local project is the wiki of one of the Gitlab projects. Those are left alone
+// when wikis aren't synced, they only go away together with their project
+func isWikiOf(key string, projectPairs map[string]*ProjectPair) bool {
+	project, ok := strings.CutSuffix(key, wikiSuffix)
+	if !ok {
+		return false
+	}
+
+	pair := projectPairs[project]
+	return pair != nil && pair.GitlabProject != nil
+}
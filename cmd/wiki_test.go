@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"gls/pkg/git"
+	"gls/pkg/gitlab"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestWithWikis(t *testing.T) {
+	handbook := &gitlab.Project{Path: "docs/handbook", CloneUrl: "https://gitlab.example.com/docs/handbook.git", Topics: []string{"frozen"}, WikiEnabled: true, Archived: true}
+	rfcs := &gitlab.Project{Path: "docs/rfcs", CloneUrl: "ssh://git@gitlab.example.com:2222/docs/rfcs.git", WikiEnabled: true, Shared: true}
+	assets := &gitlab.Project{Path: "docs/assets", CloneUrl: "git@gitlab.example.com:docs/assets.git"}
+	broken := &gitlab.Project{Path: "docs/broken", CloneUrl: "gitlab.example.com/docs/broken", WikiEnabled: true}
+
+	got := withWikis([]*gitlab.Project{handbook, rfcs, assets, broken})
+	want := []*gitlab.Project{handbook, rfcs, assets, broken,
+		{Path: "docs/handbook.wiki", CloneUrl: "https://gitlab.example.com/docs/handbook.wiki.git", Topics: []string{"frozen"}, Wiki: true, Archived: true},
+		{Path: "docs/rfcs.wiki", CloneUrl: "ssh://git@gitlab.example.com:2222/docs/rfcs.wiki.git", Wiki: true, Shared: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		for _, project := range got {
+			t.Logf("%+v", *project)
+		}
+		t.Error("added other wikis")
+	}
+}
+
+func TestPlanWikis(t *testing.T) {
+	listed := []*gitlab.Project{
+		{Path: "handbook", DefaultBranch: "main", CloneUrl: "git@gitlab.example.com:docs/handbook.git", WikiEnabled: true},
+		{Path: "rfcs", DefaultBranch: "main", CloneUrl: "git@gitlab.example.com:docs/rfcs.git", WikiEnabled: true},
+	}
+	local := []*git.Project{
+		{Path: "handbook", Branch: "main"},
+		{Path: "handbook.wiki", Branch: "master"}, // not the default branch of its project
+		{Path: "retired.wiki", Branch: "master"},  // its project is gone
+	}
+
+	tests := []struct {
+		name  string
+		wikis bool
+		input string
+		want  map[string]string
+	}{
+		{
+			name:  "synced",
+			wikis: true,
+			input: "n\n",
+			want: map[string]string{
+				"handbook":      "pull main hook",
+				"handbook.wiki": "pull master",
+				"rfcs":          "clone main hook",
+				"rfcs.wiki":     "clone ",
+				"retired.wiki":  "delete master skipped",
+			},
+		},
+		{
+			name:  "not synced",
+			input: "y\n",
+			want: map[string]string{
+				"handbook":     "pull main hook",
+				"rfcs":         "clone main hook",
+				"retired.wiki": "delete master",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			input := stdin
+			stdin = bufio.NewReader(strings.NewReader(test.input))
+			t.Cleanup(func() {
+				stdin = input
+			})
+
+			var cfg Config
+			cfg.Wikis = test.wikis
+			cfg.Hooks.PostClone = "make setup"
+			cfg.Hooks.PostPull = "make setup"
+			gitlabProjects := listed
+			if cfg.Wikis {
+				gitlabProjects = withWikis(gitlabProjects)
+			}
+
+			got := make(map[string]string)
+			for _, task := range planTasks(gitlabProjects, local, nil, nil, nil, nil, nil, false, cfg) {
+				description := fmt.Sprintf("%s %s", task.Action, task.Branch)
+				if task.Skipped {
+					description += " skipped"
+				}
+				if hookFor(task, cfg) != "" {
+					description += " hook"
+				}
+				got[task.Key] = description
+			}
+			if !maps.Equal(got, test.want) {
+				for _, key := range slices.Sorted(maps.Keys(got)) {
+					t.Logf("%s: %s", key, got[key])
+				}
+				t.Error("planned differently")
+			}
+		})
+	}
+}
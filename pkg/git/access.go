@@ -0,0 +1,32 @@
+package git
+
+import (
+	"strings"
+)
+
+// accessDeniedPatterns are messages Gitlab and git print when the remote refuses a repository to the token, as opposed
+// to failing to authenticate it at all, which affects every project alike
+var accessDeniedPatterns = []string{
+	"you are not allowed to download code",
+	"could not be found or you don't have permission",
+	"the requested url returned error: 403",
+	"the requested url returned error: 404",
+	"authorization failed", // the native backend
+	"repository not found",
+}
+
+// IsAccessDenied tells whether a failed clone, pull or fetch failed because the remote doesn't let the token
+// read the repository
+func IsAccessDenied(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	message := strings.ToLower(err.Error())
+	for _, pattern := range accessDeniedPatterns {
+		if strings.Contains(message, pattern) {
+			return true
+		}
+	}
+	return false
+}
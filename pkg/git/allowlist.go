@@ -0,0 +1,175 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"net/url"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// AllowedHost is a host clone urls may point at. Without a port any port is fine
+type AllowedHost struct {
+	Host string
+	Port string
+}
+
+func (h AllowedHost) String() string {
+	if h.Port == "" {
+		return h.Host
+	}
+	return net.JoinHostPort(h.Host, h.Port)
+}
+
+// ParseAllowedHost reads a host written as host, host:port or as url, of which only host and port count
+func ParseAllowedHost(value string) (AllowedHost, error) {
+	value = strings.TrimSpace(value)
+	if strings.Contains(value, "://") {
+		parsed, err := url.Parse(value)
+		if err != nil {
+			return AllowedHost{}, err
+		}
+		value = parsed.Host
+	}
+
+	host, port, err := net.SplitHostPort(value)
+	if err != nil {
+		host, port = strings.Trim(value, "[]"), "" // no port
+	}
+	if host == "" || strings.ContainsAny(host, "/@ ") {
+		return AllowedHost{}, fmt.Errorf("%q is no host", value)
+	}
+	return AllowedHost{Host: strings.ToLower(host), Port: port}, nil
+}
+
+// HostAllowlist decides which hosts clone urls may point at, so a wrong url or rewrite never makes gls talk to
+// some other server. Hosts of ssh urls that aren't listed are looked up with ssh -G, as they may be aliases from
+// the ssh config. Without ssh aliases have to be listed themselves
+type HostAllowlist struct {
+	hosts []AllowedHost
+
+	mu      sync.Mutex
+	aliases map[string]*AllowedHost // resolved ssh aliases, nil if they can't be resolved
+	resolve func(alias string) (*AllowedHost, error)
+}
+
+func NewHostAllowlist(hosts []AllowedHost) *HostAllowlist {
+	return &HostAllowlist{
+		hosts:   hosts,
+		aliases: make(map[string]*AllowedHost),
+		resolve: resolveSshAlias,
+	}
+}
+
+// Check returns an error when the clone url points at a host that isn't allowed. Local paths and file urls
+// don't leave the machine and are always fine
+func (a *HostAllowlist) Check(cloneUrl string) error {
+	if isLocalPath(cloneUrl) {
+		return nil
+	}
+	remote, err := ParseRemoteUrl(cloneUrl)
+	if err != nil {
+		return err
+	}
+	if remote.Host == "" {
+		return nil
+	}
+
+	target := AllowedHost{Host: strings.ToLower(remote.Host), Port: remote.Port}
+	if a.allows(target) {
+		return nil
+	}
+
+	// ssh applies its config to the host, which may name another host or the port to use
+	if remote.Scheme == "" || remote.Scheme == "ssh" {
+		resolved := a.resolveAlias(target.Host)
+		if resolved != nil {
+			if remote.Port != "" {
+				resolved.Port = remote.Port // given in the url, it wins over the ssh config
+			}
+			if a.allows(*resolved) {
+				return nil
+			}
+			if resolved.Host != target.Host {
+				return fmt.Errorf("clone url host %s is an ssh alias for %s, which isn't allowed", target, resolved)
+			}
+		}
+	}
+	return fmt.Errorf("clone url host %s isn't allowed", target)
+}
+
+// isLocalPath tells local paths apart from scp-like ssh urls the way git does. Paths have no colon, a slash before
+// the first one, or start with a drive letter on Windows
+func isLocalPath(cloneUrl string) bool {
+	if strings.Contains(cloneUrl, "://") {
+		return false
+	}
+	colon := strings.Index(cloneUrl, ":")
+	slash := strings.Index(cloneUrl, "/")
+	return colon < 0 || slash >= 0 && slash < colon || filepath.VolumeName(cloneUrl) != ""
+}
+
+func (a *HostAllowlist) allows(target AllowedHost) bool {
+	for _, host := range a.hosts {
+		if host.Host == target.Host && (host.Port == "" || host.Port == target.Port) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveAlias looks up what an ssh host really connects to, nil if ssh isn't there to ask
+func (a *HostAllowlist) resolveAlias(alias string) *AllowedHost {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	resolved, ok := a.aliases[alias]
+	if !ok {
+		resolved, _ = a.resolve(alias)
+		a.aliases[alias] = resolved
+	}
+	if resolved == nil {
+		return nil
+	}
+	copied := *resolved
+	return &copied
+}
+
+// resolveSshAlias asks ssh for the hostname and port it would connect to for the host, with the ssh config applied
+func resolveSshAlias(alias string) (*AllowedHost, error) {
+	if strings.HasPrefix(alias, "-") {
+		return nil, fmt.Errorf("invalid ssh host %q", alias)
+	}
+	path, err := exec.LookPath("ssh")
+	if err != nil {
+		return nil, err
+	}
+	output, err := exec.Command(path, "-G", alias).Output()
+	if err != nil {
+		return nil, err
+	}
+	return parseSshConfig(output)
+}
+
+// parseSshConfig reads hostname and port from the output of ssh -G
+func parseSshConfig(output []byte) (*AllowedHost, error) {
+	resolved := &AllowedHost{}
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		key, value, _ := strings.Cut(strings.TrimSpace(scanner.Text()), " ")
+		switch strings.ToLower(key) {
+		case "hostname":
+			resolved.Host = strings.ToLower(value)
+		case "port":
+			resolved.Port = value
+		}
+	}
+	if resolved.Host == "" {
+		return nil, fmt.Errorf("ssh -G printed no hostname")
+	}
+	return resolved, nil
+}
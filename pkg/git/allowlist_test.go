@@ -0,0 +1,167 @@
+package git
+
+import (
+	"errors"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestParseAllowedHost(t *testing.T) {
+	tests := []struct {
+		value string
+		want  AllowedHost
+		err   bool
+	}{
+		{value: "gitlab.example.com", want: AllowedHost{Host: "gitlab.example.com"}},
+		{value: " GitLab.Example.com ", want: AllowedHost{Host: "gitlab.example.com"}},
+		{value: "gitlab.example.com:2222", want: AllowedHost{Host: "gitlab.example.com", Port: "2222"}},
+		{value: "https://gitlab.example.com:8443/acme", want: AllowedHost{Host: "gitlab.example.com", Port: "8443"}},
+		{value: "https://gitlab.example.com", want: AllowedHost{Host: "gitlab.example.com"}},
+		{value: "[::1]:22", want: AllowedHost{Host: "::1", Port: "22"}},
+		{value: "[::1]", want: AllowedHost{Host: "::1"}},
+		{value: "", err: true},
+		{value: "git@gitlab.example.com", err: true},
+		{value: "gitlab.example.com/acme", err: true},
+		{value: "https://gitlab.example.com:port", err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			got, err := ParseAllowedHost(test.value)
+			if (err != nil) != test.err || got != test.want {
+				t.Errorf("got %+v, %v, want %+v", got, err, test.want)
+			}
+		})
+	}
+}
+
+func TestHostAllowlistCheck(t *testing.T) {
+	// What ssh -G would say about the hosts, those missing aren't in the ssh config
+	sshConfig := map[string]*AllowedHost{
+		"gl":        {Host: "gitlab.example.com", Port: "22"},
+		"gl-mirror": {Host: "mirror.example.com", Port: "22"},
+		"evil":      {Host: "evil.example.com", Port: "22"},
+	}
+
+	tests := []struct {
+		url string
+		err string
+	}{
+		{url: "git@gitlab.example.com:acme/api.git"},
+		{url: "gitlab.example.com:acme/api.git"},
+		{url: "git@GitLab.Example.com:acme/api.git"},
+		{url: "https://gitlab.example.com/acme/api.git"},
+		{url: "ssh://git@gitlab.example.com:2222/acme/api.git"},
+		{url: "https://oauth2@mirror.example.com:8443/acme/api.git"},
+		{url: "https://mirror.example.com/acme/api.git", err: "clone url host mirror.example.com isn't allowed"},
+		{url: "https://mirror.example.com:9000/acme/api.git", err: "clone url host mirror.example.com:9000 isn't allowed"},
+		{url: "git@gl:acme/api.git"},
+		{url: "ssh://git@gl/acme/api.git"},
+		{url: "ssh://git@gl-mirror:8443/acme/api.git"}, // the port in the url wins over the ssh config
+		{url: "git@gl-mirror:acme/api.git", err: "clone url host gl-mirror is an ssh alias for mirror.example.com:22, which isn't allowed"},
+		{url: "git@evil:acme/api.git", err: "clone url host evil is an ssh alias for evil.example.com:22, which isn't allowed"},
+		{url: "https://gl/acme/api.git", err: "clone url host gl isn't allowed"}, // only ssh reads the ssh config
+		{url: "git@unknown.example.com:acme/api.git", err: "clone url host unknown.example.com isn't allowed"},
+		{url: "git@-oProxyCommand=evil:acme/api.git", err: "isn't allowed"},
+		{url: "https://gitlab.example.com:port/acme/api.git", err: `invalid port ":port"`},
+		{url: "gitlab.example.com:", err: "invalid remote url"},
+		{url: "/src/acme/api"},
+		{url: "./acme/api"},
+		{url: "../mirrors/acme:api"},
+		{url: "file:///src/acme/api"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.url, func(t *testing.T) {
+			allowlist := NewHostAllowlist([]AllowedHost{{Host: "gitlab.example.com"}, {Host: "mirror.example.com", Port: "8443"}})
+			allowlist.resolve = func(alias string) (*AllowedHost, error) {
+				if resolved := sshConfig[alias]; resolved != nil {
+					copied := *resolved
+					return &copied, nil
+				}
+				return nil, errors.New("not in the ssh config")
+			}
+
+			err := allowlist.Check(test.url)
+			switch {
+			case test.err == "" && err != nil:
+				t.Errorf("got %v", err)
+			case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+				t.Errorf("got %v, want %s", err, test.err)
+			}
+		})
+	}
+}
+
+func TestHostAllowlistDriveLetter(t *testing.T) {
+	allowlist := NewHostAllowlist([]AllowedHost{{Host: "gitlab.example.com"}})
+	allowlist.resolve = func(string) (*AllowedHost, error) {
+		return nil, errors.New("no ssh")
+	}
+
+	// Like git, only Windows reads a drive letter as a path, elsewhere it is the host of an scp-like url
+	for _, url := range []string{`C:\src\acme\api`, "C:/src/acme/api"} {
+		err := allowlist.Check(url)
+		if runtime.GOOS == "windows" && err != nil {
+			t.Errorf("%s: got %v", url, err)
+		}
+		if runtime.GOOS != "windows" && (err == nil || !strings.Contains(err.Error(), "clone url host c isn't allowed")) {
+			t.Errorf("%s: got %v", url, err)
+		}
+	}
+}
+
+func TestHostAllowlistResolvesOnce(t *testing.T) {
+	allowlist := NewHostAllowlist(nil)
+	calls := 0
+	allowlist.resolve = func(alias string) (*AllowedHost, error) {
+		calls++
+		return &AllowedHost{Host: "gitlab.example.com", Port: "22"}, nil
+	}
+
+	for range 3 {
+		_ = allowlist.Check("git@gl:acme/api.git")
+		_ = allowlist.Check("ssh://git@gl:2222/acme/web.git") // mustn't change the cached port
+	}
+	if calls != 1 {
+		t.Errorf("asked ssh %d times", calls)
+	}
+	if err := allowlist.Check("git@gl:acme/api.git"); !strings.Contains(err.Error(), "alias for gitlab.example.com:22,") {
+		t.Errorf("the cached alias changed: %v", err)
+	}
+}
+
+func TestResolveSshAliasOption(t *testing.T) {
+	// Never handed to ssh, it would read it as an option
+	if resolved, err := resolveSshAlias("-oProxyCommand=touch pwned"); err == nil || resolved != nil {
+		t.Errorf("got %+v, %v", resolved, err)
+	}
+}
+
+func TestParseSshConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   *AllowedHost
+	}{
+		{name: "hostname and port", output: "user git\nhostname GitLab.Example.com\nport 2222\nidentityfile ~/.ssh/id_ed25519\n",
+			want: &AllowedHost{Host: "gitlab.example.com", Port: "2222"}},
+		{name: "keys in any case", output: "HostName gitlab.example.com\nPort 22\n", want: &AllowedHost{Host: "gitlab.example.com", Port: "22"}},
+		{name: "indented", output: "  hostname gitlab.example.com\n", want: &AllowedHost{Host: "gitlab.example.com"}},
+		{name: "no hostname", output: "user git\nport 22\n"},
+		{name: "empty", output: ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseSshConfig([]byte(test.output))
+			switch {
+			case test.want == nil && err == nil:
+				t.Errorf("got %+v", got)
+			case test.want != nil && (err != nil || *got != *test.want):
+				t.Errorf("got %+v, %v, want %+v", got, err, test.want)
+			}
+		})
+	}
+}
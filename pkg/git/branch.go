@@ -0,0 +1,40 @@
+package git
+
+import (
+	"fmt"
+	"strings"
+)
+
+// BranchNotFoundError tells that the branch to clone or pull doesn't exist on the remote
+type BranchNotFoundError struct {
+	Branch string
+	Err    error
+}
+
+func (e *BranchNotFoundError) Error() string {
+	return fmt.Sprintf("branch %s doesn't exist on the remote", e.Branch)
+}
+
+func (e *BranchNotFoundError) Unwrap() error {
+	return e.Err
+}
+
+// missingBranchPatterns are printed by clone and pull when the branch they are after is missing on the remote
+var missingBranchPatterns = []string{
+	"not found in upstream origin",
+	"no such ref was fetched",
+}
+
+// branchError turns the failure of a clone or pull of branch into a BranchNotFoundError where the branch was missing
+func branchError(err error, branch string) error {
+	if err == nil || branch == "" {
+		return err
+	}
+
+	for _, pattern := range missingBranchPatterns {
+		if strings.Contains(err.Error(), pattern) {
+			return &BranchNotFoundError{Branch: branch, Err: err}
+		}
+	}
+	return err
+}
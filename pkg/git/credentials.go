@@ -0,0 +1,43 @@
+package git
+
+import (
+	"context"
+	"os"
+	"os/exec"
+)
+
+// Credentials are handed to git for https remotes, without ever writing them into the remote url or a config file
+type Credentials struct {
+	Username string
+	Password string
+}
+
+type credentialsKey struct{}
+
+// WithCredentials makes the clones, pulls and fetches started with ctx authenticate with creds
+func WithCredentials(ctx context.Context, creds Credentials) context.Context {
+	return context.WithValue(ctx, credentialsKey{}, creds)
+}
+
+// credentialHelper answers git's credential requests from the environment of the git process
+const credentialHelper = `!f() { test "$1" = get && echo "username=$GLS_GIT_USERNAME" && echo "password=$GLS_GIT_PASSWORD"; }; f`
+
+// gitCommand prepares a git command that talks to a remote. With credentials in ctx, other credential helpers
+// are reset and replaced by one that only lives in the environment of this process
+func gitCommand(ctx context.Context, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "git", args...)
+
+	creds, ok := ctx.Value(credentialsKey{}).(Credentials)
+	if ok {
+		cmd.Env = append(os.Environ(),
+			"GIT_CONFIG_COUNT=2",
+			"GIT_CONFIG_KEY_0=credential.helper",
+			"GIT_CONFIG_VALUE_0=",
+			"GIT_CONFIG_KEY_1=credential.helper",
+			"GIT_CONFIG_VALUE_1="+credentialHelper,
+			"GLS_GIT_USERNAME="+creds.Username,
+			"GLS_GIT_PASSWORD="+creds.Password,
+		)
+	}
+	return cmd
+}
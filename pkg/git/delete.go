@@ -0,0 +1,150 @@
+package git
+
+import (
+	"fmt"
+	"github.com/go-git/go-git/v5"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// BrokenSuffix marks a project whose deletion failed halfway, it needs manual cleanup
+const BrokenSuffix = ".gls-broken"
+
+// maxLeftovers limits how many paths a DeleteError lists
+const maxLeftovers = 10
+
+// removeAll removes a tree, tests replace it to leave parts behind whatever user they run as
+var removeAll = os.RemoveAll
+
+// Leftover is a path that could not be removed
+type Leftover struct {
+	Path  string
+	Mode  fs.FileMode
+	Owner string // empty where ownership isn't known
+}
+
+func (l Leftover) String() string {
+	if l.Owner == "" {
+		return fmt.Sprintf("%s (%s)", l.Path, l.Mode)
+	}
+	return fmt.Sprintf("%s (%s, owner %s)", l.Path, l.Mode, l.Owner)
+}
+
+// DeleteError tells which paths were left behind when a project could only be removed partially
+type DeleteError struct {
+	Path      string // where the remains were moved to
+	Leftovers []Leftover
+	Total     int // number of leftovers, Leftovers may only hold the first few
+	Err       error
+}
+
+func (e *DeleteError) Error() string {
+	var paths []string
+	for _, leftover := range e.Leftovers {
+		paths = append(paths, leftover.String())
+	}
+	if e.Total > len(e.Leftovers) {
+		paths = append(paths, fmt.Sprintf("and %d more", e.Total-len(e.Leftovers)))
+	}
+	return fmt.Sprintf("could not remove %d paths, the remains in %s need manual cleanup: %s",
+		e.Total, e.Path, strings.Join(paths, ", "))
+}
+
+func (e *DeleteError) Unwrap() error {
+	return e.Err
+}
+
+// DeleteProject removes a repository completely or not at all. The repository is first renamed, so a removal
+// that fails halfway leaves a directory ending in BrokenSuffix instead of something that looks like the project.
+// Read-only files, e.g. git's pack files on Windows, are made writable and the removal is retried
+func DeleteProject(localPath string) error {
+	_, err := git.PlainOpen(localPath)
+	if err != nil {
+		return err // folder not a git repo
+	}
+
+	brokenPath := filepath.Clean(localPath) + BrokenSuffix
+	_, err = os.Lstat(brokenPath)
+	if err == nil {
+		return fmt.Errorf("%s is left over from an earlier delete and needs manual cleanup", brokenPath)
+	}
+
+	err = os.Rename(localPath, brokenPath)
+	if err != nil {
+		return err // nothing removed yet
+	}
+
+	err = removeAll(brokenPath)
+	if err == nil {
+		return nil
+	}
+
+	makeWritable(brokenPath)
+	err = removeAll(brokenPath)
+	if err == nil {
+		return nil
+	}
+
+	leftovers, total := findLeftovers(brokenPath)
+	return &DeleteError{Path: brokenPath, Leftovers: leftovers, Total: total, Err: err}
+}
+
+// makeWritable clears read-only attributes below path, as far as we are allowed to
+func makeWritable(path string) {
+	_ = filepath.WalkDir(path, func(path string, e fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // keep going, the retry reports what's left
+		}
+
+		info, err := e.Info()
+		if err != nil || info.Mode()&fs.ModeSymlink != 0 {
+			return nil // chmod would follow the link
+		}
+
+		mode := info.Mode().Perm() | 0200
+		if e.IsDir() {
+			mode |= 0700 // entries can only be removed from a directory we can write and enter
+		}
+		_ = os.Chmod(path, mode)
+		return nil
+	})
+}
+
+// findLeftovers lists the files and empty directories that survived the removal, as those are the ones in the way
+func findLeftovers(path string) ([]Leftover, int) {
+	var leftovers []Leftover
+	total := 0
+
+	_ = filepath.WalkDir(path, func(path string, e fs.DirEntry, err error) error {
+		if err != nil && e == nil {
+			return nil
+		}
+
+		if e.IsDir() && err == nil {
+			entries, readErr := os.ReadDir(path)
+			if readErr == nil && len(entries) > 0 {
+				return nil // its content is listed instead
+			}
+		}
+
+		total++
+		if len(leftovers) < maxLeftovers {
+			leftover := Leftover{Path: path}
+			info, err := e.Info()
+			if err == nil {
+				leftover.Mode = info.Mode()
+				leftover.Owner = fileOwner(info)
+			}
+			leftovers = append(leftovers, leftover)
+		}
+
+		if e.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+
+	return leftovers, total
+}
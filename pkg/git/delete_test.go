@@ -0,0 +1,247 @@
+package git
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// tree creates files and, for paths ending in /, directories below root
+func tree(t *testing.T, root string, paths ...string) {
+	t.Helper()
+	for _, path := range paths {
+		path = filepath.Join(root, filepath.FromSlash(path))
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err == nil && strings.HasSuffix(path, string(filepath.Separator)) {
+			err = os.MkdirAll(path, 0755)
+		} else if err == nil {
+			err = os.WriteFile(path, []byte("content\n"), 0644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDeleteProject(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(t *testing.T, path string)
+		err     string
+		removed bool
+	}{
+		{name: "repository", setup: commit, removed: true},
+		{name: "read-only files and directories", setup: func(t *testing.T, path string) {
+			commit(t, path)
+			run(t, path, "gc", "--quiet") // leaves read-only pack files
+			tree(t, path, "docs/readme.md", "docs/locked/notes.txt")
+			for _, locked := range []string{"docs/readme.md", "docs/locked/notes.txt", "docs/locked"} {
+				if err := os.Chmod(filepath.Join(path, locked), 0555); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}, removed: true},
+		{name: "symlink out of the project", setup: func(t *testing.T, path string) {
+			commit(t, path)
+			outside := filepath.Join(filepath.Dir(path), "outside.txt")
+			tree(t, filepath.Dir(path), "outside.txt")
+			if err := os.Chmod(outside, 0444); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Symlink(outside, filepath.Join(path, "link")); err != nil {
+				t.Skip("symlinks aren't allowed:", err)
+			}
+		}, removed: true},
+		{name: "not a repository", setup: func(t *testing.T, path string) {
+			tree(t, path, "file.txt")
+		}, err: "repository does not exist"},
+		{name: "left over from an earlier delete", setup: func(t *testing.T, path string) {
+			commit(t, path)
+			tree(t, filepath.Dir(path), "project"+BrokenSuffix+"/")
+		}, err: "is left over from an earlier delete and needs manual cleanup"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "project")
+			test.setup(t, path)
+
+			err := DeleteProject(path)
+			switch {
+			case test.err == "" && err != nil:
+				t.Fatal(err)
+			case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+				t.Fatalf("got %v, want %s", err, test.err)
+			}
+
+			_, statErr := os.Lstat(path)
+			if removed := os.IsNotExist(statErr); removed != test.removed {
+				t.Errorf("removed: %v, want %v", removed, test.removed)
+			}
+			if test.removed {
+				if _, err := os.Lstat(path + BrokenSuffix); !os.IsNotExist(err) {
+					t.Errorf("%s is left behind: %v", path+BrokenSuffix, err)
+				}
+			}
+			if info, err := os.Stat(filepath.Join(filepath.Dir(path), "outside.txt")); err == nil && info.Mode().Perm() != 0444 {
+				t.Errorf("the target of a link was made writable: %s", info.Mode())
+			}
+		})
+	}
+}
+
+// TestDeleteProjectPartially leaves the files called stuck behind, as if they belonged to another user
+func TestDeleteProjectPartially(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("files in use can't be renamed on Windows")
+	}
+	errStuck := errors.New("permission denied")
+
+	tests := []struct {
+		name  string
+		stuck []string
+		total int
+		more  string // how the error mentions the leftovers it doesn't list
+	}{
+		{name: "a file", stuck: []string{"src/stuck"}, total: 1},
+		{name: "an empty directory", stuck: []string{"cache/stuck/"}, total: 1},
+		{name: "next to removed files", stuck: []string{"a/stuck", "a/b/stuck", "c/stuck"}, total: 3},
+		{name: "more than are listed", stuck: []string{
+			"0/stuck", "1/stuck", "2/stuck", "3/stuck", "4/stuck", "5/stuck", "6/stuck", "7/stuck", "8/stuck", "9/stuck", "10/stuck", "11/stuck",
+		}, total: 12, more: "and 2 more"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "project")
+			commit(t, path)
+			tree(t, path, test.stuck...)
+
+			calls := 0
+			removeAll = func(root string) error {
+				calls++
+				var dirs []string
+				stuck := false
+				_ = filepath.WalkDir(root, func(path string, e fs.DirEntry, err error) error {
+					switch {
+					case err != nil:
+					case e.Name() == "stuck":
+						stuck = true
+						if e.IsDir() {
+							return filepath.SkipDir
+						}
+					case e.IsDir():
+						dirs = append(dirs, path)
+					default:
+						_ = os.Remove(path)
+					}
+					return nil
+				})
+				for _, dir := range slices.Backward(dirs) {
+					_ = os.Remove(dir) // fails for those holding what's stuck
+				}
+				if stuck {
+					return errStuck
+				}
+				return nil
+			}
+			t.Cleanup(func() {
+				removeAll = os.RemoveAll
+			})
+
+			err := DeleteProject(path)
+			var deleteErr *DeleteError
+			if !errors.As(err, &deleteErr) || !errors.Is(err, errStuck) {
+				t.Fatalf("got %v", err)
+			}
+			if calls != 2 {
+				t.Errorf("removed %d times, want a retry after making it writable", calls)
+			}
+			if deleteErr.Path != path+BrokenSuffix || deleteErr.Total != test.total || len(deleteErr.Leftovers) != min(test.total, maxLeftovers) {
+				t.Errorf("got %s with %d of %d leftovers", deleteErr.Path, len(deleteErr.Leftovers), deleteErr.Total)
+			}
+			for _, leftover := range deleteErr.Leftovers {
+				if filepath.Base(leftover.Path) != "stuck" || !strings.HasPrefix(leftover.Path, deleteErr.Path) {
+					t.Errorf("%s isn't left over", leftover)
+				}
+			}
+			if test.more != "" && !strings.HasSuffix(err.Error(), test.more) {
+				t.Errorf("%q doesn't end in %q", err, test.more)
+			}
+
+			// Nothing that looks like the project is left, and the remains are kept apart from the next clone
+			if _, err := os.Lstat(path); !os.IsNotExist(err) {
+				t.Errorf("the project is still there: %v", err)
+			}
+			commit(t, path)
+			if err := DeleteProject(path); err == nil || !strings.Contains(err.Error(), "needs manual cleanup") {
+				t.Errorf("deleting again got %v", err)
+			}
+		})
+	}
+}
+
+func TestFindLeftovers(t *testing.T) {
+	tests := []struct {
+		name  string
+		tree  []string
+		want  []string
+		total int
+	}{
+		{name: "nothing", want: []string{"."}, total: 1},
+		{name: "files", tree: []string{"a", "b/c"}, want: []string{"a", "b/c"}, total: 2},
+		{name: "empty directories", tree: []string{"a/", "b/c/", "b/d"}, want: []string{"a", "b/c", "b/d"}, total: 3},
+		{name: "deep", tree: []string{"a/b/c/d/e"}, want: []string{"a/b/c/d/e"}, total: 1},
+		{name: "more than are listed", tree: []string{
+			"01", "02", "03", "04", "05", "06", "07", "08", "09", "10", "11", "12/",
+		}, want: []string{"01", "02", "03", "04", "05", "06", "07", "08", "09", "10"}, total: 12},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			root := t.TempDir()
+			tree(t, root, test.tree...)
+
+			leftovers, total := findLeftovers(root)
+			var got []string
+			for _, leftover := range leftovers {
+				relative, err := filepath.Rel(root, leftover.Path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, filepath.ToSlash(relative))
+				if leftover.Mode == 0 && leftover.Path != root {
+					t.Errorf("%s has no mode", leftover.Path)
+				}
+			}
+			if !slices.Equal(got, test.want) || total != test.total {
+				t.Errorf("got %q of %d, want %q of %d", got, total, test.want, test.total)
+			}
+		})
+	}
+
+	if leftovers, total := findLeftovers(filepath.Join(t.TempDir(), "missing")); len(leftovers) != 0 || total != 0 {
+		t.Errorf("a missing path left %v", leftovers)
+	}
+}
+
+func TestDeleteErrorMessage(t *testing.T) {
+	err := &DeleteError{
+		Path: "/projects/acme/api" + BrokenSuffix,
+		Leftovers: []Leftover{
+			{Path: "/projects/acme/api.gls-broken/a", Mode: 0444},
+			{Path: "/projects/acme/api.gls-broken/b", Mode: fs.ModeDir | 0555, Owner: "root"},
+		},
+		Total: 5,
+	}
+	want := "could not remove 5 paths, the remains in /projects/acme/api.gls-broken need manual cleanup: " +
+		"/projects/acme/api.gls-broken/a (-r--r--r--), /projects/acme/api.gls-broken/b (dr-xr-xr-x, owner root), and 3 more"
+	if err.Error() != want {
+		t.Errorf("got %q", err)
+	}
+}
@@ -0,0 +1,86 @@
+package git
+
+import (
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Fingerprint identifies the content of a repository without walking any objects.
+// Origin names the project it was cloned from, Tips are the commits its refs point at
+type Fingerprint struct {
+	Origin string // host/path of origin, lower case, empty if there is no origin
+	Tips   []string
+}
+
+func GetFingerprint(repoPath string) (*Fingerprint, error) {
+	repo, err := git.PlainOpen(repoPath)
+	if err != nil {
+		return nil, err
+	}
+
+	fingerprint := &Fingerprint{}
+
+	remote, err := repo.Remote("origin")
+	if err == nil && len(remote.Config().URLs) > 0 {
+		parsed, err := ParseRemoteUrl(remote.Config().URLs[0])
+		if err == nil {
+			fingerprint.Origin = strings.ToLower(parsed.Host + "/" + parsed.Path)
+		}
+	}
+
+	refs, err := repo.References()
+	if err != nil {
+		return nil, err
+	}
+
+	tips := make(map[string]bool)
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() == plumbing.HashReference {
+			tips[ref.Hash().String()] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for tip := range tips {
+		fingerprint.Tips = append(fingerprint.Tips, tip)
+	}
+	sort.Strings(fingerprint.Tips)
+	return fingerprint, nil
+}
+
+// SharesTip reports whether both repositories have a ref pointing at the same commit, which means they share history
+func (f *Fingerprint) SharesTip(other *Fingerprint) bool {
+	for _, tip := range f.Tips {
+		i := sort.SearchStrings(other.Tips, tip)
+		if i < len(other.Tips) && other.Tips[i] == tip {
+			return true
+		}
+	}
+	return false
+}
+
+// Size returns the number of bytes used by all files below path
+func Size(path string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(path, func(_ string, e fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if e.Type().IsRegular() {
+			info, err := e.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
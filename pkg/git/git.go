@@ -2,92 +2,461 @@ package git
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 type Project struct {
-	Path   string
-	Branch string
+	Path   string `json:"path"` // relative to the local path and slash separated like Gitlab paths, on every OS
+	Branch string `json:"branch"`
+	Commit string `json:"commit"`
+	Broken bool   `json:"broken,omitempty"` // left over from a failed delete, see DeleteProject, or unreadable
+	Err    error  `json:"-"`                // why a broken repository couldn't be read
+
+	Detached bool `json:"detached,omitempty"` // HEAD points at a commit, Branch is DetachedBranch
+	Unborn   bool `json:"unborn,omitempty"`   // nothing committed yet, e.g. cloned from an empty project
+
+	Interrupted bool `json:"-"` // cloned by gls without the clone ever completing, set by the caller
 }
 
-func GetLocalProjects(localPath string) ([]*Project, error) {
+// DetachedBranch stands in for the branch of projects with a detached HEAD
+const DetachedBranch = "(detached)"
+
+// GetLocalProjects finds all git repositories below localPath.
+// Projects in known are trusted without opening them as long as their HEAD still points at the same branch and
+// that branch at the same commit, everything else is discovered by walking the tree with up to workers directories opened at once.
+// Remains of failed deletes and repositories that can't be read are returned as Broken, the projects are
+// sorted by path
+func GetLocalProjects(localPath string, known []*Project, workers int) ([]*Project, error) {
+	localPath = filepath.Clean(localPath) // walked paths use native separators only, the root has to as well
+
 	var projects []*Project
 
-	err := filepath.WalkDir(localPath, func(path string, e os.DirEntry, err error) error {
-		if err != nil {
-			return err
+	verified := make(map[string]bool)
+	for _, project := range known {
+		path := filepath.Join(localPath, project.Path)
+		branch, err := readHeadBranch(path)
+		if err != nil || branch != project.Branch {
+			continue // gone or changed, the walk will pick it up again if it still exists
 		}
+		commit, err := readBranchCommit(path, branch)
+		if err != nil || commit != project.Commit {
+			continue // pulled or committed to outside of gls
+		}
+
+		verified[path] = true
+		projects = append(projects, project)
+	}
+
+	walker := &projectWalker{
+		root:     localPath,
+		verified: verified,
+		sem:      make(chan struct{}, max(workers, 1)),
+		projects: projects,
+	}
+	walker.visit(localPath)
+	walker.wg.Wait()
+
+	sort.Slice(walker.projects, func(i, j int) bool {
+		return walker.projects[i].Path < walker.projects[j].Path
+	})
+	return walker.projects, walker.err
+}
+
+// projectWalker opens directories concurrently, descending only into those that aren't repositories
+type projectWalker struct {
+	root     string
+	verified map[string]bool
+	sem      chan struct{}
+	wg       sync.WaitGroup
+
+	mu       sync.Mutex
+	projects []*Project
+	err      error // the first directory that couldn't be read
+}
+
+func (w *projectWalker) visit(path string) {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+
+		w.sem <- struct{}{}
+		subdirs := w.open(path)
+		<-w.sem
 
-		if !e.IsDir() {
-			return nil // it's a file
+		for _, subdir := range subdirs {
+			w.visit(subdir)
 		}
+	}()
+}
+
+// open adds path if it is a repository, otherwise it returns the directories below it
+func (w *projectWalker) open(path string) []string {
+	if w.verified[path] {
+		return nil // known repo, already added
+	}
 
-		repo, err := git.PlainOpen(path)
+	relPath, err := filepath.Rel(w.root, path)
+	if err != nil {
+		w.fail(err)
+		return nil
+	}
+
+	if strings.HasSuffix(path, BrokenSuffix) {
+		// Whatever is left may not even be a repository anymore, so it must not be opened or walked
+		w.add(&Project{Path: filepath.ToSlash(relPath), Broken: true})
+		return nil
+	}
+
+	repo, err := git.PlainOpen(path)
+	if err == nil {
+		project, err := readProject(repo, filepath.ToSlash(relPath))
 		if err != nil {
-			return nil // folder not a git repo
+			// One unreadable repository shouldn't hide all the others
+			project = &Project{Path: filepath.ToSlash(relPath), Broken: true, Err: err}
 		}
 
-		headRef, err := repo.Head()
-		if err != nil {
-			return err
+		w.add(project)
+		return nil // found a repo, don't need to check subtree
+	}
+
+	// Not a git repo, look further down
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		w.fail(err)
+		return nil
+	}
+
+	var subdirs []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			subdirs = append(subdirs, filepath.Join(path, entry.Name()))
 		}
+	}
+	return subdirs
+}
+
+func (w *projectWalker) add(project *Project) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.projects = append(w.projects, project)
+}
 
-		projects = append(projects, &Project{
-			Path:   strings.TrimPrefix(path, localPath+"/"),
-			Branch: headRef.Name().Short(),
-		})
+func (w *projectWalker) fail(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err == nil {
+		w.err = err
+	}
+}
 
-		return filepath.SkipDir // found a repo, don't need to check subtree
-	})
+// GetLocalProject opens a single repository below localPath
+func GetLocalProject(localPath string, path string) (*Project, error) {
+	repo, err := git.PlainOpen(filepath.Join(localPath, path))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	project, err := readProject(repo, path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return project, nil
+}
+
+// readProject resolves HEAD of a repository. A detached or unborn HEAD is no error, the project is flagged instead
+func readProject(repo *git.Repository, path string) (*Project, error) {
+	head, err := repo.Reference(plumbing.HEAD, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if head.Type() == plumbing.HashReference {
+		return &Project{Path: path, Branch: DetachedBranch, Commit: head.Hash().String(), Detached: true}, nil
+	}
+
+	resolved, err := repo.Reference(head.Target(), true)
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return &Project{Path: path, Unborn: true}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Project{
+		Path:   path,
+		Branch: head.Target().Short(),
+		Commit: resolved.Hash().String(),
+	}, nil
+}
+
+// HeadCommit returns the hash of the commit HEAD points at
+func HeadCommit(localPath string) (string, error) {
+	repo, err := git.PlainOpen(localPath)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", localPath, err)
+	}
+
+	headRef, err := repo.Head()
+	if err != nil {
+		return "", fmt.Errorf("HEAD of %s: %w", localPath, err)
+	}
+	return headRef.Hash().String(), nil
+}
+
+// gitDir is where the repository at repoPath keeps HEAD and its refs, the repository itself for a bare mirror
+func gitDir(repoPath string) string {
+	dir := filepath.Join(repoPath, ".git")
+	if _, err := os.Stat(filepath.Join(dir, "HEAD")); os.IsNotExist(err) {
+		return repoPath
+	}
+	return dir
+}
+
+// readHeadBranch reads .git/HEAD directly, which is a lot cheaper than opening the repository
+func readHeadBranch(repoPath string) (string, error) {
+	content, err := os.ReadFile(filepath.Join(gitDir(repoPath), "HEAD"))
+	if err != nil {
+		return "", err
+	}
+
+	branch, ok := strings.CutPrefix(strings.TrimSpace(string(content)), "ref: refs/heads/")
+	if !ok {
+		return "", fmt.Errorf("HEAD of %s is not a branch", repoPath)
+	}
+
+	return branch, nil
+}
+
+// readBranchCommit reads the commit of branch from its loose ref, or from packed-refs where git moves refs that
+// didn't change in a while
+func readBranchCommit(repoPath string, branch string) (string, error) {
+	dir := gitDir(repoPath)
+	ref := "refs/heads/" + branch
+
+	content, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(ref)))
+	if err == nil {
+		return strings.TrimSpace(string(content)), nil
+	}
+	if !os.IsNotExist(err) {
+		return "", err
+	}
+
+	file, err := os.Open(filepath.Join(dir, "packed-refs"))
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
 
-	return projects, err
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		commit, name, ok := strings.Cut(scanner.Text(), " ")
+		if ok && name == ref {
+			return commit, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("branch %s of %s has no commit", branch, repoPath)
 }
 
-func DeleteProject(localPath string) error {
-	_, err := git.PlainOpen(localPath)
+// Clones, pulls and fetches run the git binary, which brings its own ssh and credential setup. With WithNativeBackend
+// they use go-git instead, see native.go. go-git pull overwrites local changes, so the native pull refuses those
+
+// CloneProject clones branch, or the default branch if it is empty
+func CloneProject(ctx context.Context, cloneUrl string, localPath string, branch string, lineProcessor func(string)) error {
+	if options, ok := nativeOptions(ctx); ok {
+		return nativeClone(ctx, options, cloneUrl, localPath, branch, false, lineProcessor)
+	}
+
+	args := []string{"clone", "--progress"}
+	if branch != "" {
+		args = append(args, "--branch", branch)
+	}
+	cmd := gitCommand(ctx, append(args, cloneUrl, localPath)...)
+	return branchError(execCommand(ctx, cmd, lineProcessor), branch)
+}
+
+func MirrorProject(ctx context.Context, cloneUrl string, localPath string, lineProcessor func(string)) error {
+	if options, ok := nativeOptions(ctx); ok {
+		return nativeClone(ctx, options, cloneUrl, localPath, "", true, lineProcessor)
+	}
+
+	cmd := gitCommand(ctx, "clone", "--mirror", "--progress", cloneUrl, localPath)
+	return execCommand(ctx, cmd, lineProcessor)
+}
+
+// PullResult tells whether a pull changed anything
+type PullResult struct {
+	UpToDate       bool
+	CommitsFetched int  // commits HEAD moved forward by
+	LocalChanges   bool // not pulled by the native backend, which would overwrite the changes
+}
+
+// PullProject pulls the checked out branch and compares HEAD before and after to find out what changed
+func PullProject(ctx context.Context, localPath string, lineProcessor func(string)) (*PullResult, error) {
+	if options, ok := nativeOptions(ctx); ok {
+		result, err := nativePull(ctx, options, localPath, lineProcessor)
+		if errors.Is(err, ErrLocalChanges) {
+			return &PullResult{UpToDate: true, LocalChanges: true}, nil
+		}
+		return result, err
+	}
+
+	before, err := HeadCommit(localPath)
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{"pull", "--progress"}
+	if pruning(ctx) {
+		args = append(args, "--prune")
+	}
+	cmd := gitCommand(ctx, args...)
+	cmd.Dir = localPath
+	err = execCommand(ctx, cmd, lineProcessor)
+	if err != nil {
+		branch, _ := readHeadBranch(localPath)
+		return nil, branchError(err, branch)
+	}
+
+	after, err := HeadCommit(localPath)
 	if err != nil {
-		return err // folder not a git repo
+		return nil, err
+	}
+	if after == before {
+		return &PullResult{UpToDate: true}, nil
 	}
 
-	return os.RemoveAll(localPath)
+	count := exec.CommandContext(ctx, "git", "rev-list", "--count", before+".."+after)
+	count.Dir = localPath
+	out, err := count.Output()
+	if err != nil {
+		return nil, err
+	}
+
+	commits, err := strconv.Atoi(strings.TrimSpace(string(out)))
+	if err != nil {
+		return nil, err
+	}
+	return &PullResult{CommitsFetched: commits}, nil
 }
 
-// It would be nice to use go-git for clone and pull too, but go-git pull overwrites existing changes in the repo
-// It also requires configuring an SSH key. While just running git in the right place already does all this for you
+// FetchProject updates all remote refs without touching the worktree, so it is safe on any branch and with local changes
+func FetchProject(ctx context.Context, localPath string, lineProcessor func(string)) error {
+	if options, ok := nativeOptions(ctx); ok {
+		return nativeFetch(ctx, options, localPath, lineProcessor)
+	}
 
-func CloneProject(cloneUrl string, localPath string, lineProcessor func(string)) error {
-	cmd := exec.Command("git", "clone", "--progress", cloneUrl, localPath)
-	return execCommand(cmd, lineProcessor)
+	args := []string{"fetch", "--all", "--prune", "--progress"}
+	if pruning(ctx) {
+		args = append(args, "--prune-tags")
+	}
+	cmd := gitCommand(ctx, args...)
+	cmd.Dir = localPath
+	return execCommand(ctx, cmd, lineProcessor)
 }
 
-func PullProject(localPath string, lineProcessor func(string)) error {
-	cmd := exec.Command("git", "pull", "--progress")
+// UnpushedWork lists what would be lost by removing the repository: uncommitted changes and commits on
+// local branches that are on no remote. Bare repositories have no worktree, so only their commits are checked
+func UnpushedWork(ctx context.Context, localPath string) ([]string, error) {
+	if _, ok := nativeOptions(ctx); ok {
+		return nativeUnpushedWork(localPath)
+	}
+
+	var work []string
+
+	if _, err := os.Stat(filepath.Join(localPath, ".git")); err == nil {
+		cmd := exec.CommandContext(ctx, "git", "status", "--porcelain")
+		cmd.Dir = localPath
+		out, err := cmd.Output()
+		if err != nil {
+			return nil, err
+		}
+		if len(strings.TrimSpace(string(out))) > 0 {
+			work = append(work, "uncommitted changes")
+		}
+	}
+
+	cmd := exec.CommandContext(ctx, "git", "log", "--branches", "--not", "--remotes", "--format=%h %s")
 	cmd.Dir = localPath
-	return execCommand(cmd, lineProcessor)
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if line != "" {
+			work = append(work, "unpushed commit "+line)
+		}
+	}
+
+	return work, nil
+}
+
+// maxOutput caps how much output is kept for error messages, progress updates alone can add up to megabytes
+const maxOutput = 64 * 1024
+
+// CommandListener is told about every command run with a context carrying it, e.g. to write a log
+type CommandListener interface {
+	CommandStarted(args []string)
+	CommandFinished(exitCode int, duration time.Duration)
 }
 
-func execCommand(cmd *exec.Cmd, lineProcessor func(string)) error {
-	stderr, err := cmd.StderrPipe() // git reports progress on stderr
+type commandListenerKey struct{}
+
+func WithCommandListener(ctx context.Context, listener CommandListener) context.Context {
+	return context.WithValue(ctx, commandListenerKey{}, listener)
+}
+
+func execCommand(ctx context.Context, cmd *exec.Cmd, lineProcessor func(string)) error {
+	killProcessGroup(cmd) // git spawns ssh and helpers, which have to die with it
+
+	listener, _ := ctx.Value(commandListenerKey{}).(CommandListener)
+	if listener != nil {
+		start := time.Now()
+		listener.CommandStarted(cmd.Args)
+		defer func() {
+			listener.CommandFinished(cmd.ProcessState.ExitCode(), time.Since(start))
+		}()
+	}
+
+	// git reports progress on stderr, hooks write to both, so everything goes through the same pipe
+	reader, writer, err := os.Pipe()
 	if err != nil {
 		return err
 	}
+	defer reader.Close()
+
+	cmd.Stdout = writer
+	cmd.Stderr = writer
 
 	err = cmd.Start()
+	_ = writer.Close() // the child has its own copy, reading ends once it exits
 	if err != nil {
 		return err
 	}
 
 	var out string
-	scanner := bufio.NewScanner(stderr)
+	scanner := bufio.NewScanner(reader)
 	scanner.Split(scanLines)
 	for scanner.Scan() {
 		line := scanner.Text()
 		out += fmt.Sprintln(line)
+		if len(out) > maxOutput {
+			out = out[len(out)-maxOutput:]
+		}
 		lineProcessor(line)
 	}
 
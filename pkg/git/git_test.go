@@ -0,0 +1,164 @@
+package git
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// run runs git in dir and returns its trimmed output, failing the test if it fails
+func run(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-c", "user.name=gls", "-c", "user.email=gls@example.com", "-c", "init.defaultBranch=main"}, args...)...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, output)
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// commit commits a change to the repository at path, creating it first if needed
+func commit(t *testing.T, path string) {
+	t.Helper()
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		err = os.MkdirAll(path, 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		run(t, path, "init", "--quiet")
+	}
+	file, err := os.OpenFile(filepath.Join(path, "changes.txt"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = file.WriteString("change\n")
+	if err == nil {
+		err = file.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	run(t, path, "add", ".")
+	run(t, path, "commit", "--quiet", "-m", "change")
+}
+
+func TestGetLocalProjectsTrustsUnchanged(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(t *testing.T, path string) // before the state was saved
+		change  func(t *testing.T, path string) // what happened since
+		trusted bool
+	}{
+		{name: "unchanged", change: func(*testing.T, string) {}, trusted: true},
+		{name: "refs packed", change: func(t *testing.T, path string) { run(t, path, "pack-refs", "--all") }, trusted: true},
+		{name: "committed to", change: commit},
+		{name: "committed to after packing", change: func(t *testing.T, path string) {
+			run(t, path, "pack-refs", "--all")
+			commit(t, path)
+		}},
+		{name: "reset to an older commit", change: func(t *testing.T, path string) {
+			run(t, path, "pack-refs", "--all")
+			run(t, path, "reset", "--quiet", "--hard", "HEAD~1")
+		}},
+		{name: "branch switched", change: func(t *testing.T, path string) { run(t, path, "checkout", "--quiet", "-b", "other") }},
+		{name: "detached", change: func(t *testing.T, path string) { run(t, path, "checkout", "--quiet", "--detach") }},
+		{name: "mirror unchanged", change: func(*testing.T, string) {}, setup: func(t *testing.T, path string) {
+			mirror := path + ".git"
+			run(t, filepath.Dir(path), "clone", "--quiet", "--mirror", path, mirror)
+			err := os.RemoveAll(path)
+			if err == nil {
+				err = os.Rename(mirror, path)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		}, trusted: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			localPath := t.TempDir()
+			path := filepath.Join(localPath, "acme", "api")
+			commit(t, path)
+			commit(t, path)
+			if test.setup != nil {
+				test.setup(t, path)
+			}
+
+			known, err := GetLocalProjects(localPath, nil, 1)
+			if err != nil || len(known) != 1 {
+				t.Fatalf("got %+v, %v", known, err)
+			}
+			test.change(t, path)
+
+			projects, err := GetLocalProjects(localPath, known, 1)
+			if err != nil || len(projects) != 1 {
+				t.Fatalf("got %+v, %v", projects, err)
+			}
+			if trusted := projects[0] == known[0]; trusted != test.trusted {
+				t.Errorf("got trusted %v, want %v", trusted, test.trusted)
+			}
+
+			want, err := GetLocalProject(localPath, "acme/api")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := projects[0]; got.Branch != want.Branch || got.Commit != want.Commit || got.Detached != want.Detached {
+				t.Errorf("got %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestGetLocalProjectsTrustsNothingGone(t *testing.T) {
+	localPath := t.TempDir()
+	commit(t, filepath.Join(localPath, "api"))
+	known := []*Project{{Path: "gone", Branch: "main", Commit: strings.Repeat("0", 40)}}
+
+	projects, err := GetLocalProjects(localPath, known, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(projects) != 1 || projects[0].Path != "api" {
+		t.Errorf("got %+v", projects)
+	}
+}
+
+func TestGetLocalProjectsPaths(t *testing.T) {
+	root := t.TempDir()
+	for _, path := range []string{"api", "team/web", "team/platform/tools"} {
+		commit(t, filepath.Join(root, filepath.FromSlash(path)))
+	}
+	sep := string(filepath.Separator)
+
+	tests := []struct {
+		name      string
+		localPath string
+	}{
+		{name: "clean", localPath: root},
+		{name: "trailing separator", localPath: root + sep},
+		{name: "doubled separators", localPath: strings.Replace(root, sep, sep+sep, 1) + sep + sep},
+		{name: "dot segments", localPath: root + sep + "team" + sep + ".." + sep + "."},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			projects, err := GetLocalProjects(test.localPath, nil, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var paths []string
+			for _, project := range projects {
+				paths = append(paths, project.Path)
+			}
+			// Slash separated on every OS, so they match the paths of Gitlab
+			if want := []string{"api", "team/platform/tools", "team/web"}; !slices.Equal(paths, want) {
+				t.Errorf("found %q, want %q", paths, want)
+			}
+		})
+	}
+}
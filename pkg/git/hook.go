@@ -0,0 +1,131 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// HookError marks failures of user supplied hooks, as opposed to failures of git itself
+type HookError struct {
+	Err error
+}
+
+func (e *HookError) Error() string {
+	return fmt.Sprintf("hook failed: %v", e.Err)
+}
+
+func (e *HookError) Unwrap() error {
+	return e.Err
+}
+
+// RunHook runs a shell command inside the repository at localPath.
+// The hook only sees the given environment and is killed together with its children once the timeout is reached
+func RunHook(ctx context.Context, command string, localPath string, env []string, timeout time.Duration, lineProcessor func(string)) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, timeout, fmt.Errorf("timed out after %s", timeout))
+		defer cancel()
+	}
+
+	cmd := shellCommand(ctx, command)
+	cmd.Dir = localPath
+	cmd.Env = append(env, "PWD="+localPath)
+
+	err := execCommand(ctx, cmd, lineProcessor)
+	if err != nil {
+		if ctx.Err() != nil {
+			err = context.Cause(ctx)
+		}
+		return &HookError{Err: err}
+	}
+	return nil
+}
+
+// RunFilter runs a shell command in dir with input on stdin and returns what it wrote to stdout. What it writes to
+// stderr ends up in the error if it fails. Like hooks it only sees the given environment and is killed together with
+// its children once the timeout is reached, and it may not write more than maxOutput bytes to either
+func RunFilter(ctx context.Context, command string, dir string, env []string, input []byte, timeout time.Duration, maxOutput int) ([]byte, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, timeout, fmt.Errorf("timed out after %s", timeout))
+		defer cancel()
+	}
+
+	cmd := shellCommand(ctx, command)
+	cmd.Dir = dir
+	cmd.Env = append(env, "PWD="+dir)
+	killProcessGroup(cmd)
+	cmd.WaitDelay = time.Second // children left behind holding stdout open don't keep gls waiting
+
+	stdout := &limitedBuffer{limit: maxOutput}
+	stderr := &limitedBuffer{limit: maxOutput}
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	err := cmd.Run()
+	if ctx.Err() != nil {
+		err = context.Cause(ctx)
+	}
+	if err == nil && (stdout.exceeded || stderr.exceeded) {
+		err = fmt.Errorf("wrote more than %d bytes", maxOutput)
+	}
+	if err != nil {
+		if output := strings.TrimSpace(stderr.String()); output != "" {
+			err = fmt.Errorf("%v\n%s", err, output)
+		}
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
+
+// limitedBuffer keeps the first limit bytes written to it and remembers whether there were more. The buffer isn't
+// embedded, io.Copy would use its ReadFrom and get past the limit
+type limitedBuffer struct {
+	buffer   bytes.Buffer
+	limit    int
+	exceeded bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.buffer.Len(); len(p) > room {
+		b.exceeded = true
+		b.buffer.Write(p[:max(room, 0)])
+		return len(p), nil
+	}
+	return b.buffer.Write(p)
+}
+
+func (b *limitedBuffer) Bytes() []byte {
+	return b.buffer.Bytes()
+}
+
+func (b *limitedBuffer) String() string {
+	return b.buffer.String()
+}
+
+// SandboxEnv returns environ without GLS_ variables and without anything containing one of the secrets,
+// so hooks can't get hold of the Gitlab token
+func SandboxEnv(environ []string, secrets ...string) []string {
+	var env []string
+	for _, entry := range environ {
+		key, value, _ := strings.Cut(entry, "=")
+		if strings.HasPrefix(strings.ToUpper(key), "GLS_") || containsSecret(value, secrets) {
+			continue
+		}
+		env = append(env, entry)
+	}
+	return env
+}
+
+func containsSecret(value string, secrets []string) bool {
+	for _, secret := range secrets {
+		if secret != "" && strings.Contains(value, secret) {
+			return true
+		}
+	}
+	return false
+}
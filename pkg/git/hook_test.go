@@ -0,0 +1,178 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+const token = "glpat-s3cr3t"
+
+func TestSandboxEnv(t *testing.T) {
+	environ := []string{
+		"PATH=/usr/bin:/bin",
+		"HOME=/home/dev",
+		"GLS_GITLAB_TOKEN=" + token,
+		"GLS_LOCAL_PATH=/src",
+		"gls_lowercase=1",
+		"GITLAB_TOKEN=" + token,
+		"CI_JOB_TOKEN=" + token,
+		"GIT_CONFIG_VALUE_0=https://oauth2:" + token + "@gitlab.example.com",
+		"GITLAB_HOST=gitlab.example.com",
+		"EMPTY=",
+		"NOT_GLS_VAR=kept",
+	}
+	want := []string{
+		"PATH=/usr/bin:/bin",
+		"HOME=/home/dev",
+		"GITLAB_HOST=gitlab.example.com",
+		"EMPTY=",
+		"NOT_GLS_VAR=kept",
+	}
+
+	tests := []struct {
+		name    string
+		secrets []string
+		want    []string
+	}{
+		{name: "token", secrets: []string{token}, want: want},
+		{name: "token and an empty one", secrets: []string{"", token}, want: want},
+		{name: "only GLS_ variables without secrets", want: []string{
+			"PATH=/usr/bin:/bin",
+			"HOME=/home/dev",
+			"GITLAB_TOKEN=" + token,
+			"CI_JOB_TOKEN=" + token,
+			"GIT_CONFIG_VALUE_0=https://oauth2:" + token + "@gitlab.example.com",
+			"GITLAB_HOST=gitlab.example.com",
+			"EMPTY=",
+			"NOT_GLS_VAR=kept",
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := SandboxEnv(environ, test.secrets...); !slices.Equal(got, test.want) {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+// runHook runs a hook in a new directory and returns its output and the directory
+func runHook(t *testing.T, command string, env []string, timeout time.Duration) ([]string, string, error) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the hooks are written for sh")
+	}
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var lines []string
+	err = RunHook(context.Background(), command, dir, env, timeout, func(line string) {
+		lines = append(lines, line)
+	})
+	return lines, dir, err
+}
+
+func TestRunHookEnvironment(t *testing.T) {
+	t.Setenv("GITLAB_TOKEN", token)
+	t.Setenv("GLS_GITLAB_TOKEN", token)
+	env := append(SandboxEnv(os.Environ(), token), "GLS_PROJECT_PATH=acme/api", "GLS_ACTION=clone")
+
+	lines, dir, err := runHook(t, "env; pwd; echo done > hook.txt", env, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := strings.Join(lines, "\n")
+	if strings.Contains(output, token) {
+		t.Errorf("the token reached the hook:\n%s", output)
+	}
+	for _, line := range []string{"GLS_PROJECT_PATH=acme/api", "GLS_ACTION=clone", "PWD=" + dir, dir} {
+		if !slices.Contains(lines, line) {
+			t.Errorf("%s is missing in\n%s", line, output)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "hook.txt")); err != nil {
+		t.Errorf("the hook didn't run in the project: %v", err)
+	}
+}
+
+func TestRunHookFailures(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		timeout time.Duration
+		err     string
+		output  []string
+	}{
+		{name: "exit code", command: "echo broken >&2; exit 3", err: "exit status 3", output: []string{"broken"}},
+		{name: "timeout", command: "echo started; sleep 30", timeout: 200 * time.Millisecond, err: "timed out after 200ms", output: []string{"started"}},
+		{name: "timeout with children", command: "(sleep 30; echo late) & sleep 30", timeout: 200 * time.Millisecond, err: "timed out after 200ms"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			start := time.Now()
+			lines, _, err := runHook(t, test.command, nil, test.timeout)
+			var hookErr *HookError
+			if !errors.As(err, &hookErr) || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("got %v, want a hook error with %s", err, test.err)
+			}
+			if took := time.Since(start); took > 10*time.Second {
+				t.Errorf("took %s, the hook or its children weren't killed", took)
+			}
+			if !slices.Equal(lines, test.output) {
+				t.Errorf("got %q, want %q", lines, test.output)
+			}
+		})
+	}
+}
+
+func TestRunFilter(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the filters are written for sh")
+	}
+
+	tests := []struct {
+		name    string
+		command string
+		want    string
+		err     string
+	}{
+		{name: "reads stdin", command: "tr a-z A-Z", want: "PLAN\n"},
+		{name: "runs in dir", command: "cat input.txt", want: "from dir\n"},
+		{name: "stderr in the error", command: "echo denied >&2; exit 1", err: "exit status 1\ndenied"},
+		{name: "too much output", command: "yes | head -c 100", err: "wrote more than 64 bytes"},
+		{name: "timeout", command: "sleep 30", err: "timed out after 200ms"},
+		{name: "no token", command: "env | grep -c " + token + " || true", want: "0\n"},
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "input.txt"), []byte("from dir\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	env := SandboxEnv(append(os.Environ(), "GITLAB_TOKEN="+token), token)
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			output, err := RunFilter(context.Background(), test.command, dir, env, []byte("plan\n"), 200*time.Millisecond, 64)
+			switch {
+			case test.err == "" && err != nil:
+				t.Fatal(err)
+			case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+				t.Fatalf("got %v, want %s", err, test.err)
+			}
+			if string(output) != test.want {
+				t.Errorf("got %q, want %q", output, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package git
+
+import (
+	"github.com/go-git/go-git/v5"
+)
+
+// The source a repository was synced from is kept in its config as gls.source
+const (
+	markSection = "gls"
+	markOption  = "source"
+)
+
+// MarkSource records in the config of a repository which kind of source gls synced it from, e.g. starred.
+// An unchanged mark isn't written again
+func MarkSource(localPath string, source string) error {
+	repo, err := git.PlainOpen(localPath)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := repo.Config()
+	if err != nil {
+		return err
+	}
+	section := cfg.Raw.Section(markSection)
+	if section.Option(markOption) == source {
+		return nil
+	}
+
+	section.SetOption(markOption, source)
+	return repo.SetConfig(cfg)
+}
+
+// SourceMark returns the kind of source gls synced a repository from, empty if it was never marked
+func SourceMark(localPath string) (string, error) {
+	repo, err := git.PlainOpen(localPath)
+	if err != nil {
+		return "", err
+	}
+
+	cfg, err := repo.Config()
+	if err != nil {
+		return "", err
+	}
+	return cfg.Raw.Section(markSection).Option(markOption), nil
+}
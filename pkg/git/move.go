@@ -0,0 +1,288 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// rename is os.Rename, replaceable to simulate a move across filesystems
+var rename = os.Rename
+
+// MoveProject moves the repository at source to target, e.g. after the project was moved on Gitlab, and points
+// its origin at cloneUrl. The directories above target are created, an existing target is never replaced
+func MoveProject(source string, target string, cloneUrl string) error {
+	_, err := git.PlainOpen(source)
+	if err != nil {
+		return err // folder not a git repo
+	}
+
+	if _, err := os.Lstat(target); err == nil {
+		return fmt.Errorf("%s already exists", target)
+	}
+	err = os.MkdirAll(filepath.Dir(target), 0755)
+	if err != nil {
+		return err
+	}
+
+	err = moveRepository(source, target)
+	if err != nil {
+		return err
+	}
+	return SetOrigin(target, cloneUrl)
+}
+
+// moveRepository moves a repository to target, which must not exist yet. When both are on different filesystems
+// the repository is copied with its modes, symlinks, hardlinks and mtimes, and the source is only removed once the
+// copy has the same refs, files and sizes
+func moveRepository(source string, target string) error {
+	err := rename(source, target)
+	if err == nil || !isCrossDevice(err) {
+		return err
+	}
+
+	// Only a target created here is removed again when the copy fails
+	err = os.Mkdir(target, 0700)
+	if err != nil {
+		return err
+	}
+	err = copyTree(source, target)
+	if err == nil {
+		err = verifyCopy(source, target)
+	}
+	if err != nil {
+		_ = os.RemoveAll(target)
+		return fmt.Errorf("copying %s to another filesystem: %w", source, err)
+	}
+	return os.RemoveAll(source)
+}
+
+// copyTree copies a directory tree into the existing directory target, symlinks stay links. Files hardlinked to each
+// other in source are linked in target too, as git does for objects of local clones
+func copyTree(source string, target string) error {
+	linked := make(map[fileID]string)
+	var dirs []string
+
+	err := filepath.WalkDir(source, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(source, path)
+		if err != nil {
+			return err
+		}
+		dest := filepath.Join(target, rel)
+
+		info, err := os.Lstat(path)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case info.IsDir():
+			if rel != "." {
+				err = os.Mkdir(dest, 0700) // the real mode is set last, it may not allow writing into it
+				if err != nil {
+					return err
+				}
+			}
+			dirs = append(dirs, rel)
+			return nil
+		case info.Mode()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			err = os.Symlink(link, dest)
+			if err != nil {
+				return err
+			}
+			preserveOwner(dest, info)
+			return preserveLinkTime(dest, info.ModTime())
+		case !info.Mode().IsRegular():
+			return nil // sockets and the like have no place in a repository
+		}
+
+		if id, ok := hardlinkID(info); ok {
+			if first, seen := linked[id]; seen {
+				return os.Link(first, dest)
+			}
+			linked[id] = dest
+		}
+
+		err = copyFileContent(path, dest, info.Mode().Perm())
+		if err != nil {
+			return err
+		}
+		preserveOwner(dest, info)
+		return os.Chtimes(dest, info.ModTime(), info.ModTime())
+	})
+	if err != nil {
+		return err
+	}
+
+	// Deepest first, so setting the times of a directory isn't undone by creating entries in it
+	for i := len(dirs) - 1; i >= 0; i-- {
+		info, err := os.Lstat(filepath.Join(source, dirs[i]))
+		if err != nil {
+			return err
+		}
+		dest := filepath.Join(target, dirs[i])
+		preserveOwner(dest, info)
+		err = os.Chmod(dest, info.Mode().Perm())
+		if err != nil {
+			return err
+		}
+		err = os.Chtimes(dest, info.ModTime(), info.ModTime())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func copyFileContent(source string, target string, perm fs.FileMode) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	closeErr := out.Close()
+	if err != nil {
+		return err
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+	return os.Chmod(target, perm) // the umask applied when creating it
+}
+
+// verifyCopy checks that both trees have the same entries with the same sizes and, as far as the source could be
+// read as a repository, the same refs and a readable HEAD commit
+func verifyCopy(source string, target string) error {
+	sourceEntries, err := treeSizes(source)
+	if err != nil {
+		return err
+	}
+	targetEntries, err := treeSizes(target)
+	if err != nil {
+		return err
+	}
+	if len(sourceEntries) != len(targetEntries) {
+		return fmt.Errorf("the copy has %d entries instead of %d", len(targetEntries), len(sourceEntries))
+	}
+	for path, size := range sourceEntries {
+		copied, ok := targetEntries[path]
+		if !ok || copied != size {
+			return fmt.Errorf("%s differs in the copy", path)
+		}
+	}
+
+	sourceRefs, err := repositoryRefs(source)
+	if err != nil {
+		return nil // a broken repository, e.g. one being repaired, is copied as it is
+	}
+	targetRefs, err := repositoryRefs(target)
+	if err != nil {
+		return fmt.Errorf("the copy can't be read as a repository: %w", err)
+	}
+	for name, ref := range sourceRefs {
+		if targetRefs[name] != ref {
+			return fmt.Errorf("ref %s differs in the copy", name)
+		}
+	}
+
+	repo, err := git.PlainOpen(source)
+	if err != nil {
+		return nil
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return nil // unborn
+	}
+	if _, err := repo.CommitObject(head.Hash()); err != nil {
+		return nil // not readable in the source either
+	}
+
+	copied, err := git.PlainOpen(target)
+	if err != nil {
+		return err
+	}
+	_, err = copied.CommitObject(head.Hash())
+	if err != nil {
+		return fmt.Errorf("HEAD commit %s can't be read from the copy: %w", head.Hash(), err)
+	}
+	return nil
+}
+
+// treeSizes maps every entry below root to its size, -1 for directories and the link target's length for symlinks
+func treeSizes(root string) (map[string]int64, error) {
+	sizes := make(map[string]int64)
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case info.IsDir():
+			sizes[rel] = -1
+		case info.Mode()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			sizes[rel] = int64(len(link))
+		case info.Mode().IsRegular():
+			sizes[rel] = info.Size()
+		}
+		return nil
+	})
+	return sizes, err
+}
+
+func repositoryRefs(path string) (map[plumbing.ReferenceName]string, error) {
+	repo, err := git.PlainOpen(path)
+	if err != nil {
+		return nil, err
+	}
+	refs, err := repo.References()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[plumbing.ReferenceName]string)
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		result[ref.Name()] = ref.String()
+		return nil
+	})
+	return result, err
+}
+
+// preserveLinkTime sets the mtime of a symlink itself, where the platform allows it
+func preserveLinkTime(path string, mtime time.Time) error {
+	err := setLinkTime(path, mtime)
+	if errors.Is(err, errors.ErrUnsupported) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,45 @@
+//go:build !windows
+
+package git
+
+import (
+	"errors"
+	"golang.org/x/sys/unix"
+	"io/fs"
+	"os"
+	"syscall"
+	"time"
+)
+
+// fileID identifies a file across its hardlinks
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+func isCrossDevice(err error) bool {
+	return errors.Is(err, syscall.EXDEV)
+}
+
+// hardlinkID returns the identity of a file with more than one link
+func hardlinkID(info fs.FileInfo) (fileID, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || stat.Nlink < 2 {
+		return fileID{}, false
+	}
+	return fileID{dev: uint64(stat.Dev), ino: uint64(stat.Ino)}, true
+}
+
+// preserveOwner hands a copied file to the owner of the original, which only works as root and is skipped otherwise
+func preserveOwner(path string, info fs.FileInfo) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || (int(stat.Uid) == os.Getuid() && int(stat.Gid) == os.Getgid()) {
+		return
+	}
+	_ = os.Lchown(path, int(stat.Uid), int(stat.Gid))
+}
+
+func setLinkTime(path string, mtime time.Time) error {
+	tv := unix.NsecToTimeval(mtime.UnixNano())
+	return unix.Lutimes(path, []unix.Timeval{tv, tv})
+}
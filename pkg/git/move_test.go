@@ -0,0 +1,196 @@
+//go:build !windows
+
+package git
+
+import (
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// acrossFilesystems makes every rename fail the way it does between filesystems, for as long as the test runs
+func acrossFilesystems(t *testing.T) *int {
+	t.Helper()
+	renames := 0
+	previous := rename
+	rename = func(source string, target string) error {
+		renames++
+		return &os.LinkError{Op: "rename", Old: source, New: target, Err: syscall.EXDEV}
+	}
+	t.Cleanup(func() {
+		rename = previous
+	})
+	return &renames
+}
+
+// snapshot describes every entry below root by its mode, mtime and content or link target
+func snapshot(t *testing.T, root string) map[string]string {
+	t.Helper()
+	entries := make(map[string]string)
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		info, err := os.Lstat(path)
+		if err != nil {
+			return err
+		}
+
+		description := fmt.Sprintf("%s %d", info.Mode(), info.ModTime().UnixNano())
+		switch {
+		case info.Mode()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			description += " -> " + link
+		case info.Mode().IsRegular():
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			description += " " + string(content)
+		}
+		entries[rel] = description
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+func TestMoveProjectAcrossFilesystems(t *testing.T) {
+	renames := acrossFilesystems(t)
+	dir := t.TempDir()
+	source := filepath.Join(dir, "acme", "api")
+	commit(t, source)
+	run(t, source, "remote", "add", "origin", "git@gitlab.example.com:acme/api.git")
+	run(t, source, "gc", "--quiet") // read-only pack files
+	tree(t, source, "bin/build.sh", "docs/locked/notes.txt")
+	if err := os.Symlink("bin/build.sh", filepath.Join(source, "build")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("missing.txt", filepath.Join(source, "dangling")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(filepath.Join(source, "docs/locked/notes.txt"), filepath.Join(source, "notes.txt")); err != nil {
+		t.Fatal(err)
+	}
+	for path, mode := range map[string]fs.FileMode{"bin/build.sh": 0750, "docs/locked/notes.txt": 0444, "docs/locked": 0555} {
+		if err := os.Chmod(filepath.Join(source, path), mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, path := range []string{"bin/build.sh", "bin", "docs"} {
+		if err := os.Chtimes(filepath.Join(source, path), old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, link := range []string{"build", "dangling"} {
+		if err := setLinkTime(filepath.Join(source, link), old); err != nil { // in microseconds, as precise as the copy
+			t.Fatal(err)
+		}
+	}
+	head := run(t, source, "rev-parse", "HEAD")
+	want := snapshot(t, source)
+
+	target := filepath.Join(dir, "platform", "api")
+	if err := MoveProject(source, target, "git@gitlab.example.com:platform/api.git"); err != nil {
+		t.Fatal(err)
+	}
+
+	if *renames != 1 {
+		t.Errorf("renamed %d times", *renames)
+	}
+	if _, err := os.Lstat(source); !os.IsNotExist(err) {
+		t.Errorf("the source is left behind: %v", err)
+	}
+	got := snapshot(t, target)
+	delete(got, ".git/config") // the new origin
+	delete(want, ".git/config")
+	for _, path := range slices.Sorted(maps.Keys(want)) {
+		if got[path] != want[path] {
+			t.Errorf("%s is %q in the copy, want %q", path, got[path], want[path])
+		}
+	}
+	for _, path := range slices.Sorted(maps.Keys(got)) {
+		if _, ok := want[path]; !ok {
+			t.Errorf("%s is new in the copy", path)
+		}
+	}
+
+	first, err := os.Stat(filepath.Join(target, "notes.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := os.Stat(filepath.Join(target, "docs/locked/notes.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(first, second) {
+		t.Error("hardlinked files were copied twice")
+	}
+	if copied := run(t, target, "rev-parse", "HEAD"); copied != head {
+		t.Errorf("HEAD is %s in the copy, want %s", copied, head)
+	}
+	if url := run(t, target, "remote", "get-url", "origin"); url != "git@gitlab.example.com:platform/api.git" {
+		t.Errorf("origin is %s", url)
+	}
+}
+
+func TestMoveRepositoryCopyFails(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("relies on the 4096 characters linux allows in a path")
+	}
+	acrossFilesystems(t)
+
+	// Nothing stops root from writing, a path too long in the copy fails it halfway instead
+	dir := t.TempDir()
+	source := filepath.Join(dir, "api")
+	tree(t, source, "a.txt", "b/"+strings.Repeat("b", 200)+".txt", "c.txt")
+	want := snapshot(t, source)
+	target := filepath.Join(dir, "deep")
+	for len(target) < 4096-100 {
+		target = filepath.Join(target, strings.Repeat("d", min(200, 4096-100-len(target))))
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	err := moveRepository(source, target)
+	if err == nil || !strings.Contains(err.Error(), "copying "+source+" to another filesystem") {
+		t.Fatalf("got %v", err)
+	}
+	if _, err := os.Lstat(target); !os.IsNotExist(err) {
+		t.Errorf("the partial copy is left behind: %v", err)
+	}
+	if got := snapshot(t, source); !maps.Equal(got, want) {
+		t.Errorf("the source changed to %q", got)
+	}
+
+	// A target that showed up in the meantime isn't this copy's to remove
+	if err := os.Mkdir(target, 0755); err != nil {
+		t.Fatal(err)
+	}
+	tree(t, target, "theirs.txt")
+	if err := moveRepository(source, target); !os.IsExist(err) {
+		t.Errorf("got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(target, "theirs.txt")); err != nil {
+		t.Errorf("an existing target was removed: %v", err)
+	}
+}
@@ -0,0 +1,27 @@
+//go:build windows
+
+package git
+
+import (
+	"errors"
+	"golang.org/x/sys/windows"
+	"io/fs"
+	"time"
+)
+
+// fileID identifies a file across its hardlinks, which aren't detected on windows
+type fileID struct{}
+
+func isCrossDevice(err error) bool {
+	return errors.Is(err, windows.ERROR_NOT_SAME_DEVICE)
+}
+
+func hardlinkID(fs.FileInfo) (fileID, bool) {
+	return fileID{}, false
+}
+
+func preserveOwner(string, fs.FileInfo) {}
+
+func setLinkTime(string, time.Time) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,388 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"strings"
+	"time"
+)
+
+// Backends that clone, pull and fetch, and ask origin for its default branch and what a repository has that is on no
+// remote. Repairs, status, moves and hooks run the git binary either way
+const (
+	CliBackend    = "cli"
+	NativeBackend = "native"
+)
+
+// ErrLocalChanges means the native backend refused to pull, go-git would overwrite the changes
+var ErrLocalChanges = errors.New("the worktree has local changes")
+
+// NativeOptions configure the native backend
+type NativeOptions struct {
+	SshKeyFile string // private key for ssh urls, the SSH agent is asked without one
+}
+
+type nativeKey struct{}
+
+// WithNativeBackend makes what the native backend does with ctx use go-git instead of the git binary
+func WithNativeBackend(ctx context.Context, options NativeOptions) context.Context {
+	return context.WithValue(ctx, nativeKey{}, options)
+}
+
+func nativeOptions(ctx context.Context) (NativeOptions, bool) {
+	options, ok := ctx.Value(nativeKey{}).(NativeOptions)
+	return options, ok
+}
+
+// lineWriter hands what go-git reports to a line processor, lines end at \n or \r like in execCommand
+type lineWriter struct {
+	lineProcessor func(string)
+	pending       []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.pending = append(w.pending, p...)
+	for {
+		advance, line, _ := scanLines(w.pending, false)
+		if advance == 0 {
+			return len(p), nil
+		}
+		w.lineProcessor(string(line))
+		w.pending = w.pending[advance:]
+	}
+}
+
+// Flush hands over what's left without a line ending
+func (w *lineWriter) Flush() {
+	if len(w.pending) > 0 {
+		w.lineProcessor(string(w.pending))
+		w.pending = nil
+	}
+}
+
+// nativeAuth authenticates ssh urls with the key file or the SSH agent, and https urls with the credentials of ctx
+func nativeAuth(ctx context.Context, cloneUrl string, options NativeOptions) (transport.AuthMethod, error) {
+	endpoint, err := transport.NewEndpoint(cloneUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	switch endpoint.Protocol {
+	case "ssh":
+		user := endpoint.User
+		if user == "" {
+			user = "git"
+		}
+		if options.SshKeyFile != "" {
+			return ssh.NewPublicKeysFromFile(user, options.SshKeyFile, "")
+		}
+		return ssh.NewSSHAgentAuth(user)
+	case "http", "https":
+		if creds, ok := ctx.Value(credentialsKey{}).(Credentials); ok {
+			return &http.BasicAuth{Username: creds.Username, Password: creds.Password}, nil
+		}
+	}
+	return nil, nil
+}
+
+// nativeCommand tells the command listener of ctx about a go-git operation, as if it were a command
+func nativeCommand(ctx context.Context, args ...string) func(error) {
+	listener, _ := ctx.Value(commandListenerKey{}).(CommandListener)
+	if listener == nil {
+		return func(error) {}
+	}
+
+	start := time.Now()
+	listener.CommandStarted(append([]string{"go-git"}, args...))
+	return func(err error) {
+		exitCode := 0
+		if err != nil {
+			exitCode = 1
+		}
+		listener.CommandFinished(exitCode, time.Since(start))
+	}
+}
+
+func nativeClone(ctx context.Context, options NativeOptions, cloneUrl string, localPath string, branch string, mirror bool, lineProcessor func(string)) (err error) {
+	finished := nativeCommand(ctx, "clone", cloneUrl, localPath)
+	defer func() { finished(err) }()
+
+	auth, err := nativeAuth(ctx, cloneUrl, options)
+	if err != nil {
+		return err
+	}
+
+	progress := &lineWriter{lineProcessor: lineProcessor}
+	defer progress.Flush()
+
+	cloneOptions := &git.CloneOptions{URL: cloneUrl, Auth: auth, Progress: progress, Mirror: mirror}
+	if branch != "" {
+		cloneOptions.ReferenceName = plumbing.NewBranchReferenceName(branch)
+	}
+	_, err = git.PlainCloneContext(ctx, localPath, mirror, cloneOptions)
+	switch {
+	case errors.Is(err, transport.ErrEmptyRemoteRepository):
+		return initEmptyClone(cloneUrl, localPath, mirror) // the git binary clones empty projects too
+	case errors.Is(err, plumbing.ErrReferenceNotFound) && branch != "":
+		return &BranchNotFoundError{Branch: branch, Err: err}
+	}
+	return err
+}
+
+// initEmptyClone creates what cloning an empty repository with the git binary leaves behind
+func initEmptyClone(cloneUrl string, localPath string, mirror bool) error {
+	repo, err := git.PlainInit(localPath, mirror)
+	if err != nil {
+		return err
+	}
+
+	remote := &config.RemoteConfig{Name: git.DefaultRemoteName, URLs: []string{cloneUrl}}
+	if mirror {
+		remote.Fetch = []config.RefSpec{"+refs/*:refs/*"}
+		remote.Mirror = true
+	}
+	_, err = repo.CreateRemote(remote)
+	return err
+}
+
+// nativePull fast-forwards the checked out branch. go-git overwrites local changes when it updates the worktree,
+// so a worktree with any changes, untracked files included, isn't pulled but reported as ErrLocalChanges
+func nativePull(ctx context.Context, options NativeOptions, localPath string, lineProcessor func(string)) (result *PullResult, err error) {
+	finished := nativeCommand(ctx, "pull", localPath)
+	defer func() { finished(err) }()
+
+	repo, err := git.PlainOpen(localPath)
+	if err != nil {
+		return nil, err
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return nil, err
+	}
+	status, err := worktree.Status()
+	if err != nil {
+		return nil, err
+	}
+	if !status.IsClean() {
+		return nil, ErrLocalChanges
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return nil, err
+	}
+	remote, err := repo.Remote(git.DefaultRemoteName)
+	if err != nil {
+		return nil, err
+	}
+	auth, err := nativeAuth(ctx, remote.Config().URLs[0], options)
+	if err != nil {
+		return nil, err
+	}
+
+	progress := &lineWriter{lineProcessor: lineProcessor}
+	defer progress.Flush()
+
+	// go-git pulls can't prune, a pruning fetch of origin goes first then
+	if pruning(ctx) {
+		err = remote.FetchContext(ctx, &git.FetchOptions{Auth: auth, Progress: progress, Prune: true})
+		if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+			return nil, err
+		}
+	}
+
+	err = worktree.PullContext(ctx, &git.PullOptions{ReferenceName: head.Name(), Auth: auth, Progress: progress})
+	switch {
+	case errors.Is(err, git.NoErrAlreadyUpToDate):
+		return &PullResult{UpToDate: true}, nil
+	case errors.Is(err, git.ErrNonFastForwardUpdate):
+		return nil, fmt.Errorf("%s diverged from origin, the native backend only fast-forwards: %w", head.Name().Short(), err)
+	case errors.Is(err, plumbing.ErrReferenceNotFound):
+		return nil, &BranchNotFoundError{Branch: head.Name().Short(), Err: err}
+	case err != nil:
+		return nil, err
+	}
+
+	after, err := repo.Head()
+	if err != nil {
+		return nil, err
+	}
+	commits, err := countCommits(repo, head.Hash(), after.Hash())
+	if err != nil {
+		return nil, err
+	}
+	return &PullResult{CommitsFetched: commits}, nil
+}
+
+// countCommits counts the commits from before up to after, which is a fast-forward of before
+func countCommits(repo *git.Repository, before plumbing.Hash, after plumbing.Hash) (int, error) {
+	commits, err := repo.Log(&git.LogOptions{From: after})
+	if err != nil {
+		return 0, err
+	}
+	defer commits.Close()
+
+	count := 0
+	for {
+		commit, err := commits.Next()
+		if err != nil {
+			return 0, err
+		}
+		if commit.Hash == before {
+			return count, nil
+		}
+		count++
+	}
+}
+
+// nativeFetch fetches every remote and prunes refs gone from them, like fetch --all --prune. go-git can't prune tags
+func nativeFetch(ctx context.Context, options NativeOptions, localPath string, lineProcessor func(string)) (err error) {
+	finished := nativeCommand(ctx, "fetch", localPath)
+	defer func() { finished(err) }()
+
+	repo, err := git.PlainOpen(localPath)
+	if err != nil {
+		return err
+	}
+	remotes, err := repo.Remotes()
+	if err != nil {
+		return err
+	}
+
+	progress := &lineWriter{lineProcessor: lineProcessor}
+	defer progress.Flush()
+
+	for _, remote := range remotes {
+		auth, err := nativeAuth(ctx, remote.Config().URLs[0], options)
+		if err != nil {
+			return err
+		}
+
+		err = remote.FetchContext(ctx, &git.FetchOptions{RemoteName: remote.Config().Name, Auth: auth, Progress: progress, Prune: true})
+		if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+			return fmt.Errorf("fetching %s: %w", remote.Config().Name, err)
+		}
+	}
+	return nil
+}
+
+// nativeRemoteHead asks origin for its refs with go-git, HEAD is among them as a symbolic ref. Unlike the git binary
+// go-git guesses a branch for a detached HEAD from the commit it is at, Gitlab's HEAD is never detached though
+func nativeRemoteHead(ctx context.Context, options NativeOptions, localPath string) (branch string, err error) {
+	finished := nativeCommand(ctx, "ls-remote", localPath)
+	defer func() { finished(err) }()
+
+	repo, err := git.PlainOpen(localPath)
+	if err != nil {
+		return "", err
+	}
+	remote, err := repo.Remote(git.DefaultRemoteName)
+	if err != nil {
+		return "", err
+	}
+	auth, err := nativeAuth(ctx, remote.Config().URLs[0], options)
+	if err != nil {
+		return "", err
+	}
+
+	refs, err := remote.ListContext(ctx, &git.ListOptions{Auth: auth})
+	if err != nil {
+		return "", fmt.Errorf("ls-remote in %s: %w", localPath, err)
+	}
+	for _, ref := range refs {
+		if ref.Name() != plumbing.HEAD || ref.Type() != plumbing.SymbolicReference {
+			continue
+		}
+		if !ref.Target().IsBranch() {
+			return "", fmt.Errorf("remote HEAD points at %s, which is not a branch", ref.Target())
+		}
+		return ref.Target().Short(), nil
+	}
+	return "", fmt.Errorf("remote HEAD is not a branch")
+}
+
+// nativeUnpushedWork is UnpushedWork with go-git. Everything reachable from a remote branch is walked first, commits
+// of local branches beyond that are unpushed, which is what log --branches --not --remotes lists
+func nativeUnpushedWork(localPath string) ([]string, error) {
+	repo, err := git.PlainOpen(localPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var work []string
+	worktree, err := repo.Worktree()
+	switch {
+	case errors.Is(err, git.ErrIsBareRepository):
+	case err != nil:
+		return nil, err
+	default:
+		status, err := worktree.Status()
+		if err != nil {
+			return nil, err
+		}
+		if !status.IsClean() {
+			work = append(work, "uncommitted changes")
+		}
+	}
+
+	refs, err := repo.References()
+	if err != nil {
+		return nil, err
+	}
+	var branches, remotes []*plumbing.Reference
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		switch {
+		case ref.Type() != plumbing.HashReference:
+		case ref.Name().IsBranch():
+			branches = append(branches, ref)
+		case ref.Name().IsRemote():
+			remotes = append(remotes, ref)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	pushed := make(map[plumbing.Hash]bool)
+	for _, ref := range remotes {
+		err = walkCommits(repo, ref.Hash(), pushed, func(*object.Commit) {})
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, ref := range branches {
+		err = walkCommits(repo, ref.Hash(), pushed, func(commit *object.Commit) {
+			subject, _, _ := strings.Cut(commit.Message, "\n")
+			work = append(work, fmt.Sprintf("unpushed commit %s %s", commit.Hash.String()[:7], subject))
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return work, nil
+}
+
+// walkCommits calls found for every commit reachable from tip that isn't in seen yet, and adds it to seen
+func walkCommits(repo *git.Repository, tip plumbing.Hash, seen map[plumbing.Hash]bool, found func(*object.Commit)) error {
+	if seen[tip] {
+		return nil
+	}
+	commit, err := repo.CommitObject(tip)
+	if err != nil {
+		return err
+	}
+	return object.NewCommitPreorderIter(commit, seen, nil).ForEach(func(commit *object.Commit) error {
+		seen[commit.Hash] = true
+		found(commit)
+		return nil
+	})
+}
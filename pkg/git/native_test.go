@@ -0,0 +1,140 @@
+package git
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// backends are contexts using the git binary and go-git
+var backends = map[string]context.Context{
+	CliBackend:    context.Background(),
+	NativeBackend: WithNativeBackend(context.Background(), NativeOptions{}),
+}
+
+// cloneOrigin commits twice to an origin in dir and clones it
+func cloneOrigin(t *testing.T, dir string) (string, string) {
+	t.Helper()
+	origin, clone := filepath.Join(dir, "origin"), filepath.Join(dir, "clone")
+	commit(t, origin)
+	commit(t, origin)
+	run(t, dir, "clone", "--quiet", origin, clone)
+	return origin, clone
+}
+
+func TestRemoteHead(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(t *testing.T, origin string)
+		want   string
+		err    string
+		native string // what go-git says instead, it guesses a branch at the commit of a detached HEAD
+	}{
+		{name: "default branch", change: func(*testing.T, string) {}, want: "main"},
+		{name: "default branch changed", change: func(t *testing.T, origin string) {
+			run(t, origin, "branch", "develop")
+			run(t, origin, "symbolic-ref", "HEAD", "refs/heads/develop")
+		}, want: "develop"},
+		{name: "detached", change: func(t *testing.T, origin string) {
+			run(t, origin, "checkout", "--quiet", "--detach")
+		}, err: "remote HEAD is not a branch", native: "main"},
+	}
+
+	for _, test := range tests {
+		for backend, ctx := range backends {
+			t.Run(test.name+" "+backend, func(t *testing.T) {
+				origin, clone := cloneOrigin(t, t.TempDir())
+				test.change(t, origin)
+				want, wantErr := test.want, test.err // test is shared by both backends
+				if backend == NativeBackend && test.native != "" {
+					want, wantErr = test.native, ""
+				}
+
+				head, err := RemoteHead(ctx, clone)
+				switch {
+				case wantErr != "" && (err == nil || err.Error() != wantErr):
+					t.Errorf("got %q, %v, want %s", head, err, wantErr)
+				case wantErr == "" && (err != nil || head != want):
+					t.Errorf("got %q, %v, want %s", head, err, want)
+				}
+			})
+		}
+	}
+}
+
+// TestUnpushedWork checks that go-git finds the same work as the git binary
+func TestUnpushedWork(t *testing.T) {
+	write := func(t *testing.T, path string) {
+		if err := os.WriteFile(path, []byte("mine\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		change func(t *testing.T, clone string) string // returns the repository to check
+		want   int                                     // entries of work
+	}{
+		{name: "clean", change: func(t *testing.T, clone string) string { return clone }},
+		{name: "changed", change: func(t *testing.T, clone string) string {
+			write(t, filepath.Join(clone, "changes.txt"))
+			return clone
+		}, want: 1},
+		{name: "untracked", change: func(t *testing.T, clone string) string {
+			write(t, filepath.Join(clone, "mine.txt"))
+			return clone
+		}, want: 1},
+		{name: "committed", change: func(t *testing.T, clone string) string {
+			commit(t, clone)
+			commit(t, clone)
+			return clone
+		}, want: 2},
+		{name: "branch from an older commit", change: func(t *testing.T, clone string) string {
+			run(t, clone, "checkout", "--quiet", "-b", "topic", "HEAD~1")
+			run(t, clone, "commit", "--quiet", "--allow-empty", "-m", "topic")
+			return clone
+		}, want: 1},
+		{name: "pushed branch", change: func(t *testing.T, clone string) string {
+			run(t, clone, "checkout", "--quiet", "-b", "topic")
+			commit(t, clone)
+			run(t, clone, "push", "--quiet", "origin", "topic")
+			return clone
+		}},
+		{name: "committed and changed", change: func(t *testing.T, clone string) string {
+			commit(t, clone)
+			write(t, filepath.Join(clone, "mine.txt"))
+			return clone
+		}, want: 2},
+		{name: "mirror", change: func(t *testing.T, clone string) string {
+			commit(t, clone)
+			mirror := clone + ".git"
+			run(t, filepath.Dir(clone), "clone", "--quiet", "--mirror", clone, mirror)
+			return mirror
+		}, want: 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, clone := cloneOrigin(t, t.TempDir())
+			path := test.change(t, clone)
+
+			var found [][]string
+			for _, backend := range []string{CliBackend, NativeBackend} {
+				work, err := UnpushedWork(backends[backend], path)
+				if err != nil {
+					t.Fatalf("%s: %v", backend, err)
+				}
+				if len(work) != test.want {
+					t.Errorf("%s found %q", backend, work)
+				}
+				slices.Sort(work)
+				found = append(found, work)
+			}
+			if !slices.Equal(found[0], found[1]) {
+				t.Errorf("the backends disagree, the git binary found %q, go-git %q", found[0], found[1])
+			}
+		})
+	}
+}
@@ -0,0 +1,25 @@
+//go:build !windows
+
+package git
+
+import (
+	"io/fs"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// fileOwner names the user owning a file, e.g. root for files created by a hook running with sudo
+func fileOwner(info fs.FileInfo) string {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return ""
+	}
+
+	uid := strconv.FormatUint(uint64(stat.Uid), 10)
+	owner, err := user.LookupId(uid)
+	if err != nil {
+		return uid
+	}
+	return owner.Username
+}
@@ -0,0 +1,12 @@
+//go:build windows
+
+package git
+
+import (
+	"io/fs"
+)
+
+// fileOwner is unknown on Windows, the read-only attribute in the mode is what usually gets in the way there
+func fileOwner(info fs.FileInfo) string {
+	return ""
+}
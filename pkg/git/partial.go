@@ -0,0 +1,62 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"os"
+)
+
+// TargetExistsError tells that a clone can't go where it should, as something other than a repository is there
+type TargetExistsError struct {
+	Path    string
+	Partial bool // only what's left of an interrupted clone is there
+}
+
+func (e *TargetExistsError) Error() string {
+	if e.Partial {
+		return fmt.Sprintf("target %s holds an interrupted clone, remove it or allow cleaning up partial clones", e.Path)
+	}
+	return fmt.Sprintf("target %s exists and is not a repository", e.Path)
+}
+
+// IsPartialClone tells whether localPath holds nothing but a .git directory, which is what an interrupted clone leaves
+func IsPartialClone(localPath string) bool {
+	entries, err := os.ReadDir(localPath)
+	return err == nil && len(entries) == 1 && entries[0].Name() == ".git" && entries[0].IsDir()
+}
+
+// PrepareCloneTarget makes sure a clone into localPath can start. An empty directory or a partial clone is removed
+// if cleanPartial is set, anything else is never touched
+func PrepareCloneTarget(localPath string, cleanPartial bool) error {
+	entries, err := os.ReadDir(localPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	partial := IsPartialClone(localPath)
+	switch {
+	case len(entries) > 0 && !partial:
+		return &TargetExistsError{Path: localPath}
+	case cleanPartial:
+		return os.RemoveAll(localPath)
+	case partial:
+		return &TargetExistsError{Path: localPath, Partial: true}
+	}
+	return nil // git clones into empty directories just fine
+}
+
+// CloneComplete tells whether git left a repository in localPath whose HEAD points at a commit, or at a branch
+// without any for a clone of an empty project
+func CloneComplete(localPath string) bool {
+	repo, err := git.PlainOpen(localPath)
+	if err != nil {
+		return false
+	}
+	_, err = repo.Head()
+	return err == nil || errors.Is(err, plumbing.ErrReferenceNotFound)
+}
@@ -0,0 +1,89 @@
+package git
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPrepareCloneTarget(t *testing.T) {
+	tests := []struct {
+		name    string
+		paths   []string // below the target, nil for no target at all
+		clean   bool
+		removed bool
+		partial bool
+		err     bool
+	}{
+		{name: "no target"},
+		{name: "empty directory", paths: []string{}},
+		{name: "empty directory cleaned", paths: []string{}, clean: true, removed: true},
+		{name: "interrupted clone", paths: []string{".git/HEAD", ".git/objects/pack/"}, partial: true, err: true},
+		{name: "interrupted clone cleaned", paths: []string{".git/HEAD", ".git/objects/pack/"}, clean: true, removed: true},
+		{name: "other content", paths: []string{".git/HEAD", "notes.txt"}, clean: true, err: true},
+		{name: "only a hidden directory", paths: []string{".idea/"}, clean: true, err: true},
+		{name: "git file", paths: []string{".git"}, clean: true, err: true}, // a worktree or submodule points elsewhere
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			target := filepath.Join(t.TempDir(), "infra", "terraform")
+			if test.paths != nil {
+				if err := os.MkdirAll(target, 0755); err != nil {
+					t.Fatal(err)
+				}
+				tree(t, target, test.paths...)
+			}
+
+			err := PrepareCloneTarget(target, test.clean)
+			var exists *TargetExistsError
+			if errors.As(err, &exists) != test.err || (err != nil) != test.err {
+				t.Fatalf("got %v", err)
+			}
+			if exists != nil && (exists.Partial != test.partial || exists.Path != target) {
+				t.Errorf("got %+v", exists)
+			}
+
+			_, statErr := os.Stat(target)
+			if removed := test.paths != nil && os.IsNotExist(statErr); removed != test.removed {
+				t.Errorf("removed: %t, want %t", removed, test.removed)
+			}
+			for _, path := range test.paths {
+				if _, err := os.Lstat(filepath.Join(target, path)); !test.removed && err != nil {
+					t.Errorf("%s is gone: %v", path, err)
+				}
+			}
+		})
+	}
+}
+
+func TestCloneComplete(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, path string)
+		want  bool
+	}{
+		{name: "cloned", setup: commit, want: true},
+		{name: "empty project", setup: func(t *testing.T, path string) {
+			if err := os.MkdirAll(path, 0755); err != nil {
+				t.Fatal(err)
+			}
+			run(t, path, "init", "--quiet")
+		}, want: true},
+		{name: "git directory without HEAD", setup: func(t *testing.T, path string) {
+			tree(t, path, ".git/objects/pack/", ".git/refs/")
+		}},
+		{name: "missing", setup: func(*testing.T, string) {}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "infra", "ansible")
+			test.setup(t, path)
+			if got := CloneComplete(path); got != test.want {
+				t.Errorf("got %t", got)
+			}
+		})
+	}
+}
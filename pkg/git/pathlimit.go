@@ -0,0 +1,35 @@
+package git
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// gitInternalPath is roughly the longest path git creates inside a fresh clone.
+// The destination itself may fit the limit while the pack files inside it don't
+var gitInternalPath = filepath.Join(".git", "objects", "pack", "pack-"+strings.Repeat("0", 40)+".keep")
+
+type PathLimits struct {
+	MaxPath      int
+	MaxComponent int
+	Hint         string
+}
+
+// CheckPathLength verifies that a repository can be created at localPath on this platform
+func CheckPathLength(localPath string, limits PathLimits) error {
+	components := strings.Split(filepath.Clean(localPath), string(filepath.Separator))
+	for _, component := range components {
+		if len(component) > limits.MaxComponent {
+			return fmt.Errorf("path component %q is %d characters long, the limit is %d", component, len(component), limits.MaxComponent)
+		}
+	}
+
+	length := len(filepath.Join(localPath, gitInternalPath))
+	if length > limits.MaxPath {
+		return fmt.Errorf("path would reach %d characters at a depth of %d, the limit is %d. %s",
+			length, len(components), limits.MaxPath, limits.Hint)
+	}
+
+	return nil
+}
@@ -0,0 +1,11 @@
+//go:build !windows
+
+package git
+
+func GetPathLimits() PathLimits {
+	return PathLimits{
+		MaxPath:      4096,
+		MaxComponent: 255,
+		Hint:         "Use a shorter local path or sync a more specific group",
+	}
+}
@@ -0,0 +1,56 @@
+package git
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckPathLength(t *testing.T) {
+	base := filepath.FromSlash("/src/acme") // nothing is created, only the length counts
+	// The longest path git creates in a clone of base/api
+	cloned := len(filepath.Join(base, "api", gitInternalPath))
+
+	tests := []struct {
+		name   string
+		path   string
+		limits PathLimits
+		err    string
+	}{
+		{name: "component below the limit", path: filepath.Join(base, strings.Repeat("a", 9)), limits: PathLimits{MaxPath: 4096, MaxComponent: 10}},
+		{name: "component at the limit", path: filepath.Join(base, strings.Repeat("a", 10)), limits: PathLimits{MaxPath: 4096, MaxComponent: 10}},
+		{name: "component above the limit", path: filepath.Join(base, strings.Repeat("a", 11)), limits: PathLimits{MaxPath: 4096, MaxComponent: 10},
+			err: `path component "aaaaaaaaaaa" is 11 characters long, the limit is 10`},
+		{name: "component above the limit in the middle", path: filepath.Join(base, strings.Repeat("a", 11), "api"), limits: PathLimits{MaxPath: 4096, MaxComponent: 10},
+			err: "is 11 characters long"},
+		{name: "path below the limit", path: filepath.Join(base, "api"), limits: PathLimits{MaxPath: cloned + 1, MaxComponent: 255}},
+		{name: "path at the limit", path: filepath.Join(base, "api"), limits: PathLimits{MaxPath: cloned, MaxComponent: 255}},
+		{name: "path above the limit", path: filepath.Join(base, "api"), limits: PathLimits{MaxPath: cloned - 1, MaxComponent: 255, Hint: "Use a shorter path"},
+			err: "Use a shorter path"},
+		{name: "path fits, what git creates in it doesn't", path: filepath.Join(base, "api"), limits: PathLimits{MaxPath: len(filepath.Join(base, "api")) + 1, MaxComponent: 255},
+			err: "characters at a depth of"},
+		{name: "unclean path", path: base + string(filepath.Separator) + "." + string(filepath.Separator) + "api" + string(filepath.Separator), limits: PathLimits{MaxPath: cloned, MaxComponent: 255}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := CheckPathLength(test.path, test.limits)
+			switch {
+			case test.err == "" && err != nil:
+				t.Errorf("got %v", err)
+			case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+				t.Errorf("got %v, want %s", err, test.err)
+			}
+		})
+	}
+}
+
+func TestGetPathLimits(t *testing.T) {
+	limits := GetPathLimits()
+	if limits.MaxComponent != 255 || limits.MaxPath < 259 || limits.Hint == "" {
+		t.Errorf("got %+v", limits)
+	}
+	if err := CheckPathLength(filepath.Join(t.TempDir(), "acme", "api"), limits); err != nil {
+		t.Errorf("a short path fails: %v", err)
+	}
+}
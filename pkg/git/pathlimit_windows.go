@@ -0,0 +1,35 @@
+//go:build windows
+
+package git
+
+import (
+	"golang.org/x/sys/windows/registry"
+)
+
+// Without the LongPathsEnabled policy most Windows APIs (and git for windows) stop at MAX_PATH
+func GetPathLimits() PathLimits {
+	if longPathsEnabled() {
+		return PathLimits{
+			MaxPath:      32767,
+			MaxComponent: 255,
+			Hint:         "Use a shorter local path or sync a more specific group",
+		}
+	}
+
+	return PathLimits{
+		MaxPath:      259, // MAX_PATH includes the terminating null character
+		MaxComponent: 255,
+		Hint:         "Use a shorter local path, or enable LongPathsEnabled in the registry and run 'git config --global core.longpaths true'",
+	}
+}
+
+func longPathsEnabled() bool {
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, `SYSTEM\CurrentControlSet\Control\FileSystem`, registry.QUERY_VALUE)
+	if err != nil {
+		return false
+	}
+	defer key.Close()
+
+	value, _, err := key.GetIntegerValue("LongPathsEnabled")
+	return err == nil && value == 1
+}
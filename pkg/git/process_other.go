@@ -0,0 +1,21 @@
+//go:build !windows
+
+package git
+
+import (
+	"context"
+	"os/exec"
+	"syscall"
+)
+
+// killProcessGroup starts the command in its own process group and kills the whole group when its context is done
+func killProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
+
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
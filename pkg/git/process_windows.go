@@ -0,0 +1,20 @@
+//go:build windows
+
+package git
+
+import (
+	"context"
+	"os/exec"
+	"strconv"
+)
+
+// killProcessGroup kills the whole process tree when the command's context is done
+func killProcessGroup(cmd *exec.Cmd) {
+	cmd.Cancel = func() error {
+		return exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid)).Run()
+	}
+}
+
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	return exec.CommandContext(ctx, "cmd", "/C", command)
+}
@@ -0,0 +1,100 @@
+package git
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+)
+
+// ProgressScale is the total of every progress. Progress is kept in basis points instead of raw object counts,
+// so no repository is big enough to overflow a tracker or render negative percentages
+const ProgressScale = 10000
+
+// progressPattern matches the phases of git's progress that count something, those of the server start with remote
+var progressPattern = regexp.MustCompile(`^(?:remote: *)?(Counting objects|Compressing objects|Receiving objects|Unpacking objects|Resolving deltas|Updating files):.*\((\d+)/(\d+)\)`)
+
+// progressPhase is a segment of the progress, starting and as wide as percent of the whole
+type progressPhase struct {
+	start int64
+	width int64
+}
+
+// progressPhases follow each other in this order. Receiving usually takes longest, resolving deltas and checking out
+// files can still take minutes for big repositories, which is why they have segments of their own
+var progressPhases = map[string]progressPhase{
+	"Counting objects":    {start: 0, width: 5},
+	"Compressing objects": {start: 5, width: 5},
+	"Receiving objects":   {start: 10, width: 60},
+	"Unpacking objects":   {start: 10, width: 60}, // instead of receiving for small fetches
+	"Resolving deltas":    {start: 70, width: 20},
+	"Updating files":      {start: 90, width: 10},
+}
+
+// ProgressParser follows git's progress lines for a single command, mapping its phases onto a single progress.
+// Its value stays within 0 and ProgressScale and never goes backwards, out of range lines are clamped and
+// reported to Debug
+type ProgressParser struct {
+	Debug func(string)
+	value int64
+
+	phase       string // the phase of the last line and how far it got
+	phasePoints int64
+}
+
+// Parse returns the progress in basis points if the line reports any
+func (p *ProgressParser) Parse(line string) (int64, bool) {
+	matches := progressPattern.FindStringSubmatch(line)
+	if len(matches) != 4 { // matches[0] is the full match, [1] the phase, [2] and [3] the two numbers
+		return 0, false
+	}
+
+	points, ok := basisPoints(matches[2], matches[3])
+	if !ok {
+		p.report(fmt.Sprintf("ignoring progress %s %s/%s", matches[1], matches[2], matches[3]))
+		return p.value, true
+	}
+	if points > ProgressScale {
+		p.report(fmt.Sprintf("clamping progress %s %s/%s", matches[1], matches[2], matches[3]))
+		points = ProgressScale
+	}
+
+	if matches[1] == p.phase && points < p.phasePoints {
+		// Earlier phases come again when fetching from several remotes, only going back within one is odd
+		p.report(fmt.Sprintf("progress %s %s/%s went backwards", matches[1], matches[2], matches[3]))
+	}
+	p.phase, p.phasePoints = matches[1], points
+
+	phase := progressPhases[matches[1]]
+	p.value = max(p.value, (phase.start*ProgressScale+phase.width*points)/100)
+	return p.value, true
+}
+
+// Phase is the phase of the last progress line, e.g. Receiving objects
+func (p *ProgressParser) Phase() string {
+	return p.phase
+}
+
+func (p *ProgressParser) report(message string) {
+	if p.Debug != nil {
+		p.Debug(message)
+	}
+}
+
+// basisPoints calculates current/total in basis points, with arbitrary precision as the counts can be anything
+func basisPoints(current string, total string) (int64, bool) {
+	c, ok := new(big.Int).SetString(current, 10)
+	if !ok {
+		return 0, false
+	}
+	t, ok := new(big.Int).SetString(total, 10)
+	if !ok || t.Sign() <= 0 {
+		return 0, false
+	}
+
+	points := new(big.Int).Mul(c, big.NewInt(ProgressScale))
+	points.Quo(points, t)
+	if !points.IsInt64() {
+		return ProgressScale + 1, true // way out of range, clamped by the caller
+	}
+	return points.Int64(), true
+}
@@ -0,0 +1,60 @@
+package git
+
+import (
+	"strings"
+	"testing"
+)
+
+// FuzzProgressParser feeds the parser lines separated by newlines, whatever they hold its progress has to stay
+// within 0 and ProgressScale and never go backwards
+func FuzzProgressParser(f *testing.F) {
+	f.Add("Receiving objects:  50% (5/10)\nResolving deltas: 100% (4/4), done.")
+	f.Add("remote: Counting objects: 100% (1200/1200), done.\nReceiving objects:   0% (1/1200)")
+	f.Add("Receiving objects:  50% (5/10)\nReceiving objects:  30% (3/10)")
+	f.Add("Receiving objects: 100% (0/0)")
+	f.Add("Receiving objects: 100% (-5/10)\nReceiving objects: 100% (5/-10)")
+	f.Add("Receiving objects: 100% (99999999999999999999999999/1)")
+	f.Add("Updating files: 100% (3/3), done.\nCounting objects:   1% (1/100)")
+	f.Add("Unpacking objects:  33% (1/3)\nremote: Compressing objects: 100% (3/3), done.")
+
+	f.Fuzz(func(t *testing.T, transcript string) {
+		parser := &ProgressParser{Debug: func(string) {}}
+		var last int64
+		for _, line := range strings.Split(transcript, "\n") {
+			points, ok := parser.Parse(line)
+			if !ok {
+				continue
+			}
+			if points < 0 || points > ProgressScale {
+				t.Fatalf("%q got %d basis points", line, points)
+			}
+			if points < last {
+				t.Fatalf("%q went back from %d to %d", line, last, points)
+			}
+			last = points
+		}
+	})
+}
+
+func TestProgressParser(t *testing.T) {
+	tests := []struct {
+		line   string
+		points int64
+		ok     bool
+	}{
+		{line: "Cloning into 'api'..."},
+		{line: "remote: Counting objects: 100% (10/10), done.", points: 500, ok: true},
+		{line: "Receiving objects:  50% (5/10)", points: 4000, ok: true},
+		{line: "Receiving objects: 100% (5/0)", points: 4000, ok: true}, // ignored, the progress stays
+		{line: "Resolving deltas: 100% (7/7), done.", points: 9000, ok: true},
+		{line: "Updating files: 100% (1/1), done.", points: ProgressScale, ok: true},
+	}
+
+	parser := &ProgressParser{}
+	for _, test := range tests {
+		points, ok := parser.Parse(test.line)
+		if points != test.points || ok != test.ok {
+			t.Errorf("%q got %d, %v, want %d, %v", test.line, points, ok, test.points, test.ok)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PruneEmptyDirs removes the parents of a deleted project that are left empty, walking up towards root.
+// Hidden files like .DS_Store don't keep a directory alive. It stops at the first directory with real content
+// and never removes root itself
+func PruneEmptyDirs(root string, path string) error {
+	root = filepath.Clean(root)
+
+	for dir := filepath.Dir(filepath.Clean(path)); dir != root; dir = filepath.Dir(dir) {
+		rel, err := filepath.Rel(root, dir)
+		if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+			return nil // not below root, nothing we may touch
+		}
+
+		entries, err := os.ReadDir(dir)
+		if os.IsNotExist(err) {
+			continue // already pruned by a parallel delete
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			if !isClutter(entry) {
+				return nil
+			}
+		}
+
+		for _, entry := range entries {
+			err = os.Remove(filepath.Join(dir, entry.Name()))
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+
+		err = os.Remove(dir)
+		if err != nil && !os.IsNotExist(err) {
+			return nil // something appeared in the meantime, e.g. a parallel clone
+		}
+	}
+	return nil
+}
+
+// isClutter reports whether an entry is a hidden file an otherwise empty directory can be removed with
+func isClutter(entry os.DirEntry) bool {
+	return strings.HasPrefix(entry.Name(), ".") && entry.Type().IsRegular()
+}
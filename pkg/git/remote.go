@@ -0,0 +1,215 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-git/go-git/v5"
+	"net/url"
+	"os/exec"
+	"strings"
+)
+
+// RemoteUrl is a clone URL split into its parts. Both URL style remotes (ssh://, https://)
+// and scp style remotes (git@host:group/project.git) are supported
+type RemoteUrl struct {
+	Scheme string // empty for scp style remotes
+	User   string
+	Host   string
+	Port   string
+	Path   string // without leading slash and .git suffix
+}
+
+func ParseRemoteUrl(remote string) (*RemoteUrl, error) {
+	if strings.Contains(remote, "://") {
+		parsed, err := url.Parse(remote)
+		if err != nil {
+			return nil, err
+		}
+
+		return &RemoteUrl{
+			Scheme: parsed.Scheme,
+			User:   parsed.User.Username(),
+			Host:   parsed.Hostname(),
+			Port:   parsed.Port(),
+			Path:   trimPath(parsed.Path),
+		}, nil
+	}
+
+	hostPart, path, ok := strings.Cut(remote, ":")
+	if !ok || path == "" {
+		return nil, fmt.Errorf("invalid remote url %q", remote)
+	}
+
+	user, host, ok := strings.Cut(hostPart, "@")
+	if !ok {
+		host, user = user, ""
+	}
+
+	return &RemoteUrl{
+		User: user,
+		Host: host,
+		Path: trimPath(path),
+	}, nil
+}
+
+func trimPath(path string) string {
+	return strings.TrimSuffix(strings.Trim(path, "/"), ".git")
+}
+
+func (r *RemoteUrl) String() string {
+	if r.Scheme == "" {
+		host := r.Host
+		if r.User != "" {
+			host = r.User + "@" + host
+		}
+		return host + ":" + r.Path + ".git"
+	}
+
+	u := url.URL{
+		Scheme: r.Scheme,
+		Host:   r.Host,
+		Path:   "/" + r.Path + ".git",
+	}
+	if r.Port != "" {
+		u.Host += ":" + r.Port
+	}
+	if r.User != "" {
+		u.User = url.User(r.User)
+	}
+	return u.String()
+}
+
+// ReplaceHost moves a remote from oldHost to newHost, keeping everything else.
+// Remotes on other hosts are returned unchanged
+func ReplaceHost(remote string, oldHost string, newHost string) (string, bool) {
+	parsed, err := ParseRemoteUrl(remote)
+	if err != nil || !strings.EqualFold(parsed.Host, oldHost) {
+		return remote, false
+	}
+
+	parsed.Host = newHost
+	return parsed.String(), true
+}
+
+// WikiUrl derives the url of a project's wiki repository from its clone url, it sits next to it as <project>.wiki.git
+func WikiUrl(cloneUrl string) (string, error) {
+	parsed, err := ParseRemoteUrl(cloneUrl)
+	if err != nil {
+		return "", err
+	}
+
+	parsed.Path += ".wiki"
+	return parsed.String(), nil
+}
+
+func GetOrigin(localPath string) (string, error) {
+	repo, err := git.PlainOpen(localPath)
+	if err != nil {
+		return "", err
+	}
+
+	remote, err := repo.Remote("origin")
+	if err != nil {
+		return "", err
+	}
+
+	urls := remote.Config().URLs
+	if len(urls) == 0 {
+		return "", fmt.Errorf("origin of %s has no url", localPath)
+	}
+	return urls[0], nil
+}
+
+func SetOrigin(localPath string, originUrl string) error {
+	repo, err := git.PlainOpen(localPath)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := repo.Config()
+	if err != nil {
+		return err
+	}
+
+	origin, ok := cfg.Remotes["origin"]
+	if !ok {
+		return fmt.Errorf("%s has no origin", localPath)
+	}
+
+	origin.URLs = []string{originUrl}
+	return repo.SetConfig(cfg)
+}
+
+// RemoteHead asks origin which branch its HEAD points at, which is the default branch of the project
+func RemoteHead(ctx context.Context, localPath string) (string, error) {
+	if options, ok := nativeOptions(ctx); ok {
+		return nativeRemoteHead(ctx, options, localPath)
+	}
+
+	cmd := gitCommand(ctx, "ls-remote", "--symref", "origin", "HEAD")
+	cmd.Dir = localPath
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("ls-remote in %s: %w", localPath, err)
+	}
+	return parseSymref(string(out))
+}
+
+// SharesHistory asks the repository at cloneUrl for its refs and tells whether the repository at localPath has any
+// of the commits they point at, which makes it a copy of that repository. Nothing is fetched
+func SharesHistory(ctx context.Context, localPath string, cloneUrl string) (bool, error) {
+	cmd := gitCommand(ctx, "ls-remote", cloneUrl)
+	cmd.Dir = localPath
+	out, err := cmd.Output()
+	if err != nil {
+		return false, fmt.Errorf("ls-remote %s: %w", cloneUrl, err)
+	}
+
+	var objects strings.Builder
+	for _, line := range strings.Split(string(out), "\n") {
+		if commit, _, ok := strings.Cut(line, "\t"); ok {
+			objects.WriteString(commit + "^{commit}\n")
+		}
+	}
+	if objects.Len() == 0 {
+		return false, nil // an empty repository has no history to share
+	}
+
+	// A single cat-file answers for every ref, unknown commits are reported as missing
+	cmd = exec.CommandContext(ctx, "git", "cat-file", "--batch-check")
+	cmd.Dir = localPath
+	cmd.Stdin = strings.NewReader(objects.String())
+	out, err = cmd.Output()
+	if err != nil {
+		return false, fmt.Errorf("cat-file in %s: %w", localPath, err)
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if strings.HasSuffix(line, " missing") || line == "" {
+			continue
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// parseSymref reads the branch from the output of ls-remote --symref, e.g. "ref: refs/heads/main\tHEAD"
+func parseSymref(out string) (string, error) {
+	for _, line := range strings.Split(out, "\n") {
+		target, name, ok := strings.Cut(strings.TrimSpace(line), "\t")
+		if !ok || name != "HEAD" {
+			continue
+		}
+
+		ref, ok := strings.CutPrefix(target, "ref: ")
+		if !ok {
+			continue // the line with the commit HEAD points at
+		}
+
+		branch, ok := strings.CutPrefix(strings.TrimSpace(ref), "refs/heads/")
+		if !ok {
+			return "", fmt.Errorf("remote HEAD points at %s, which is not a branch", ref)
+		}
+		return branch, nil
+	}
+	return "", fmt.Errorf("remote HEAD is not a branch")
+}
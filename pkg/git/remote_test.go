@@ -0,0 +1,28 @@
+package git
+
+import "testing"
+
+func TestReplaceHost(t *testing.T) {
+	tests := []struct {
+		remote string
+		want   string
+		moved  bool
+	}{
+		{remote: "git@old.example.com:acme/api.git", want: "git@new.example.com:acme/api.git", moved: true},
+		{remote: "git@Old.Example.com:acme/api", want: "git@new.example.com:acme/api.git", moved: true},
+		{remote: "ssh://git@old.example.com:2222/acme/api.git", want: "ssh://git@new.example.com:2222/acme/api.git", moved: true},
+		{remote: "https://oauth2@old.example.com/acme/team/api.git", want: "https://oauth2@new.example.com/acme/team/api.git", moved: true},
+		{remote: "git@other.example.com:acme/api.git", want: "git@other.example.com:acme/api.git"},
+		{remote: "git@old.example.com.evil:acme/api.git", want: "git@old.example.com.evil:acme/api.git"},
+		{remote: "old.example.com", want: "old.example.com"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.remote, func(t *testing.T) {
+			got, moved := ReplaceHost(test.remote, "old.example.com", "new.example.com")
+			if got != test.want || moved != test.moved {
+				t.Errorf("got %s, %t, want %s, %t", got, moved, test.want, test.moved)
+			}
+		})
+	}
+}
@@ -0,0 +1,243 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// corruptionPatterns are messages git prints when the repository itself is broken, as opposed to the network,
+// the remote or local changes getting in the way
+var corruptionPatterns = []string{
+	"bad object",
+	"is corrupt",
+	"loose object",
+	"object file",
+	"broken link from",
+	"missing blob",
+	"missing tree",
+	"bad tree object",
+	"invalid sha1 pointer",
+	"index file corrupt",
+	"bad index file",
+	"unable to read sha1 file",
+	"unable to read tree",
+	"did not send all necessary objects",
+	"your current branch appears to be broken",
+	"unable to resolve reference",
+}
+
+// IsCorruption tells whether a failed git command failed because the local repository is corrupted
+func IsCorruption(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	message := strings.ToLower(err.Error())
+	for _, pattern := range corruptionPatterns {
+		if strings.Contains(message, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// RepairRefusedError lists what a repair would have lost
+type RepairRefusedError struct {
+	Path string
+	Lost []string
+}
+
+func (e *RepairRefusedError) Error() string {
+	return fmt.Sprintf("not repairing %s, it would lose %s", e.Path, strings.Join(e.Lost, ", "))
+}
+
+// RepairProject replaces a corrupted repository by a fresh clone. The broken copy is moved into trashDir and
+// its untracked files are copied into the new clone, they are returned relative to localPath. The clone is on branch,
+// or the default branch if it is empty. Repositories with local commits or changes that exist nowhere else are never touched.
+// What a broken repository holds is asked from the git binary, also with the native backend, go-git gives up on it
+func RepairProject(ctx context.Context, trashDir string, cloneUrl string, localPath string, branch string, lineProcessor func(string)) ([]string, error) {
+	lost, err := localOnlyWork(ctx, localPath)
+	if err != nil {
+		return nil, fmt.Errorf("not repairing %s, can't tell what would be lost: %w", localPath, err)
+	}
+	if len(lost) > 0 {
+		return nil, &RepairRefusedError{Path: localPath, Lost: lost}
+	}
+
+	untracked, err := untrackedFiles(ctx, localPath)
+	if err != nil {
+		return nil, fmt.Errorf("not repairing %s, can't list its untracked files: %w", localPath, err)
+	}
+
+	trashed, err := TrashProject(trashDir, localPath)
+	if err != nil {
+		return nil, err
+	}
+
+	err = CloneProject(ctx, cloneUrl, localPath, branch, lineProcessor)
+	if err != nil {
+		// Put the broken copy back, it is still better than nothing
+		_ = os.RemoveAll(localPath)
+		restoreErr := moveRepository(trashed, localPath)
+		if restoreErr != nil {
+			return nil, fmt.Errorf("%w, the broken copy stays in %s: %v", err, trashed, restoreErr)
+		}
+		return nil, err
+	}
+
+	var preserved []string
+	for _, file := range untracked {
+		target := filepath.Join(localPath, file)
+		if _, err := os.Lstat(target); err == nil {
+			continue // the fresh clone has a file there now, it wins
+		}
+
+		err = copyFile(filepath.Join(trashed, file), target)
+		if err != nil {
+			return preserved, fmt.Errorf("restoring %s, the broken copy is in %s: %w", file, trashed, err)
+		}
+		preserved = append(preserved, filepath.ToSlash(file))
+	}
+
+	return preserved, nil
+}
+
+// localOnlyWork lists the local branches with commits that are on no remote and the files with uncommitted changes.
+// Only refs are read where possible, as objects may be the broken part. Branches that can't be checked count as lost
+func localOnlyWork(ctx context.Context, localPath string) ([]string, error) {
+	repo, err := git.PlainOpen(localPath)
+	if err != nil {
+		return nil, err
+	}
+
+	refs, err := repo.References()
+	if err != nil {
+		return nil, err
+	}
+
+	var branches []*plumbing.Reference
+	remoteTips := make(map[plumbing.Hash]bool)
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		switch {
+		case ref.Type() != plumbing.HashReference:
+		case ref.Name().IsBranch():
+			branches = append(branches, ref)
+		case ref.Name().IsRemote():
+			remoteTips[ref.Hash()] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var lost []string
+	for _, branch := range branches {
+		if remoteTips[branch.Hash()] {
+			continue // cheap and works without reading any object
+		}
+
+		cmd := exec.CommandContext(ctx, "git", "rev-list", "--count", branch.Name().String(), "--not", "--remotes")
+		cmd.Dir = localPath
+		out, err := cmd.Output()
+		if err != nil || strings.TrimSpace(string(out)) != "0" {
+			lost = append(lost, fmt.Sprintf("%s (%s)", branch.Name(), branch.Hash().String()[:7]))
+		}
+	}
+
+	// Unstaged changes are found by comparing the worktree with the index, which reads no objects.
+	// Staged changes need the tree of HEAD, which may well be what's broken, the trash still has them then
+	changed, err := changedFiles(ctx, localPath, "diff-files", "--name-only")
+	if err != nil {
+		return nil, err
+	}
+	staged, err := changedFiles(ctx, localPath, "diff-index", "--cached", "--name-only", "HEAD", "--")
+	if err == nil {
+		changed = append(changed, staged...)
+	}
+	for _, file := range changed {
+		lost = append(lost, "changes to "+file)
+	}
+
+	return lost, nil
+}
+
+func changedFiles(ctx context.Context, localPath string, args ...string) ([]string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = localPath
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, file := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
+// untrackedFiles lists the files git doesn't know about, leaving out ignored ones
+func untrackedFiles(ctx context.Context, localPath string) ([]string, error) {
+	cmd := exec.CommandContext(ctx, "git", "ls-files", "--others", "--exclude-standard", "-z")
+	cmd.Dir = localPath
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, file := range strings.Split(string(out), "\x00") {
+		if file != "" {
+			files = append(files, filepath.FromSlash(file))
+		}
+	}
+	return files, nil
+}
+
+func copyFile(source string, target string) error {
+	info, err := os.Lstat(source)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(target), 0755)
+	if err != nil {
+		return err
+	}
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		link, err := os.Readlink(source)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(link, target)
+	}
+
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, in)
+	closeErr := out.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
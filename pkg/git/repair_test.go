@@ -0,0 +1,171 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestIsCorruption(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{err: errors.New("error: object file .git/objects/4b/825dc6 is empty\nfatal: loose object 4b825dc6 (stored in .git/objects/4b/825dc6) is corrupt"), want: true},
+		{err: errors.New("fatal: bad object HEAD"), want: true},
+		{err: errors.New("error: Could not read 4b825dc6\nfatal: Missing tree 4b825dc6"), want: true},
+		{err: errors.New("fatal: Your current branch appears to be broken"), want: true},
+		{err: errors.New("fatal: could not read Username for 'https://gitlab.example.com': terminal prompts disabled")},
+		{err: errors.New("error: Your local changes to the following files would be overwritten by merge")},
+		{err: errors.New("fatal: Not possible to fast-forward, aborting.")},
+		{err: nil},
+	}
+
+	for _, test := range tests {
+		if got := IsCorruption(test.err); got != test.want {
+			t.Errorf("%v: got %t", test.err, got)
+		}
+	}
+}
+
+func TestRepairProject(t *testing.T) {
+	tests := []struct {
+		name      string
+		change    func(t *testing.T, path string) // before the repository is corrupted
+		missing   bool                            // Gitlab can't be reached for the new clone
+		preserved []string
+		lost      []string
+		err       string
+	}{
+		{
+			name: "untracked files carried over",
+			change: func(t *testing.T, path string) {
+				tree(t, path, "notes/todo.txt", "build/app.bin", "README.md")
+				if err := os.WriteFile(filepath.Join(path, ".git", "info", "exclude"), []byte("build/\n"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			},
+			preserved: []string{"notes/todo.txt"}, // README.md is in the fresh clone
+		},
+		{name: "local commit", change: commit, lost: []string{"refs/heads/main ("}},
+		{
+			name: "local branch",
+			change: func(t *testing.T, path string) {
+				run(t, path, "checkout", "--quiet", "-b", "spike")
+				commit(t, path)
+				run(t, path, "checkout", "--quiet", "main")
+			},
+			lost: []string{"refs/heads/spike ("},
+		},
+		{
+			name: "unstaged change",
+			change: func(t *testing.T, path string) {
+				if err := os.WriteFile(filepath.Join(path, "changes.txt"), []byte("uncommitted work\n"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			},
+			lost: []string{"changes to changes.txt"},
+		},
+		{
+			name: "clone fails",
+			change: func(t *testing.T, path string) {
+				tree(t, path, "notes/todo.txt")
+			},
+			missing: true,
+			err:     "does not exist",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			origin := filepath.Join(dir, "origin")
+			commit(t, origin)
+			tree(t, origin, "README.md")
+			run(t, origin, "add", "README.md")
+			run(t, origin, "commit", "--quiet", "-m", "readme")
+			local := filepath.Join(dir, "local", "api")
+			run(t, dir, "clone", "--quiet", "--no-hardlinks", origin, local)
+			test.change(t, local)
+
+			tree(t, origin, "CHANGELOG.md")
+			run(t, origin, "add", "CHANGELOG.md")
+			run(t, origin, "commit", "--quiet", "-m", "changelog")
+
+			// The tree of the cloned commit is cut off, git refuses to read it
+			head := run(t, local, "rev-parse", "origin/main^{tree}")
+			object := filepath.Join(local, ".git", "objects", head[:2], head[2:])
+			if err := os.Chmod(object, 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Truncate(object, 0); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := PullProject(context.Background(), local, func(string) {}); !IsCorruption(err) {
+				t.Fatalf("the corrupted repository pulled with %v", err)
+			}
+
+			cloneUrl := origin
+			if test.missing {
+				cloneUrl = filepath.Join(dir, "gone")
+			}
+			trash := filepath.Join(dir, "trash")
+			preserved, err := RepairProject(context.Background(), trash, cloneUrl, local, "", func(string) {})
+
+			var refused *RepairRefusedError
+			switch {
+			case test.lost != nil:
+				if !errors.As(err, &refused) || len(refused.Lost) != len(test.lost) {
+					t.Fatalf("got %v, want %q lost", err, test.lost)
+				}
+				for i, lost := range test.lost {
+					if !strings.HasPrefix(refused.Lost[i], lost) {
+						t.Errorf("lost %q, want %q", refused.Lost[i], lost)
+					}
+				}
+			case test.err != "":
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("got %v", err)
+				}
+			case err != nil:
+				t.Fatal(err)
+			}
+
+			if err != nil {
+				// The broken copy is back in place, nothing of it was lost
+				if info, statErr := os.Stat(object); statErr != nil || info.Size() != 0 {
+					t.Errorf("the repository was replaced: %v", statErr)
+				}
+				if test.missing {
+					if _, err := os.Stat(filepath.Join(local, "notes", "todo.txt")); err != nil {
+						t.Errorf("the untracked file is gone: %v", err)
+					}
+				}
+				return
+			}
+
+			if !slices.Equal(preserved, test.preserved) {
+				t.Errorf("preserved %q, want %q", preserved, test.preserved)
+			}
+			if _, err := PullProject(context.Background(), local, func(string) {}); err != nil {
+				t.Errorf("the repaired clone doesn't pull: %v", err)
+			}
+			for _, file := range test.preserved {
+				if _, err := os.Stat(filepath.Join(local, file)); err != nil {
+					t.Error(err)
+				}
+			}
+			if _, err := os.Stat(filepath.Join(local, "build")); !os.IsNotExist(err) {
+				t.Errorf("ignored files were carried over: %v", err)
+			}
+			trashed, err := os.ReadDir(trash)
+			if err != nil || len(trashed) != 1 {
+				t.Errorf("trashed %v, %v", trashed, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Divergence tells how HEAD relates to a branch on origin
+type Divergence string
+
+const (
+	InSync   Divergence = "in sync"
+	Behind   Divergence = "behind"
+	Ahead    Divergence = "ahead"
+	Diverged Divergence = "diverged"
+)
+
+// CompareWithRemote compares HEAD with branch on origin without fetching anything, only the tip of the branch is
+// asked for with ls-remote. A tip that isn't known locally has commits that were never fetched, so HEAD is behind
+func CompareWithRemote(ctx context.Context, localPath string, branch string) (Divergence, error) {
+	cmd := gitCommand(ctx, "ls-remote", "origin", "refs/heads/"+branch)
+	cmd.Dir = localPath
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("ls-remote in %s: %w", localPath, err)
+	}
+
+	remote, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\t")
+	if remote == "" {
+		return "", &BranchNotFoundError{Branch: branch}
+	}
+
+	head, err := HeadCommit(localPath)
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case remote == head:
+		return InSync, nil
+	case !gitSucceeds(ctx, localPath, "cat-file", "-e", remote+"^{commit}"):
+		return Behind, nil
+	case gitSucceeds(ctx, localPath, "merge-base", "--is-ancestor", head, remote):
+		return Behind, nil
+	case gitSucceeds(ctx, localPath, "merge-base", "--is-ancestor", remote, head):
+		return Ahead, nil
+	}
+	return Diverged, nil
+}
+
+// IsDirty tells whether the worktree has changes or untracked files, bare mirrors have no worktree to be dirty
+func IsDirty(ctx context.Context, localPath string) (bool, error) {
+	if _, err := os.Stat(filepath.Join(localPath, ".git")); err != nil {
+		return false, nil
+	}
+
+	cmd := exec.CommandContext(ctx, "git", "status", "--porcelain")
+	cmd.Dir = localPath
+	out, err := cmd.Output()
+	if err != nil {
+		return false, fmt.Errorf("status of %s: %w", localPath, err)
+	}
+	return len(strings.TrimSpace(string(out))) > 0, nil
+}
+
+func gitSucceeds(ctx context.Context, localPath string, args ...string) bool {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = localPath
+	return cmd.Run() == nil
+}
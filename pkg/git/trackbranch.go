@@ -0,0 +1,152 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"strings"
+)
+
+// BranchUpdate tells what keeping a local branch current with origin did to it
+type BranchUpdate struct {
+	Branch   string
+	Created  bool // the branch didn't exist locally and now tracks origin
+	Commits  int  // commits the branch moved forward by
+	Rejected bool // the branch has commits origin doesn't have, it is left alone instead of being forced
+	Missing  bool // origin has no such branch
+}
+
+// rejectedPatterns are printed by fetch when a refspec without + would lose commits of the local branch
+var rejectedPatterns = []string{
+	"(non-fast-forward)",
+	"! [rejected]",
+}
+
+// missingRefPatterns are printed by fetch when a refspec names a branch the remote doesn't have
+var missingRefPatterns = []string{
+	"couldn't find remote ref",
+}
+
+// UpdateBranches fast-forwards local branches to origin without checking them out, by fetching origin's branch
+// straight into the local one. Branches missing locally are created tracking origin. The checked out branch is
+// skipped, it is the pull's business. Only failures to talk to origin are returned as error, what happened to the
+// single branches is in the updates. The native backend fetches with go-git, nothing else runs the git binary
+func UpdateBranches(ctx context.Context, localPath string, branches []string, lineProcessor func(string)) ([]*BranchUpdate, error) {
+	head, err := readHeadBranch(localPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var updates []*BranchUpdate
+	for _, branch := range branches {
+		if branch == head {
+			continue
+		}
+
+		update, err := updateBranch(ctx, localPath, branch, lineProcessor)
+		if err != nil {
+			return updates, fmt.Errorf("updating %s: %w", branch, err)
+		}
+		updates = append(updates, update)
+	}
+	return updates, nil
+}
+
+func updateBranch(ctx context.Context, localPath string, branch string, lineProcessor func(string)) (*BranchUpdate, error) {
+	update := &BranchUpdate{Branch: branch}
+
+	repo, err := git.PlainOpen(localPath)
+	if err != nil {
+		return nil, err
+	}
+	name := plumbing.NewBranchReferenceName(branch)
+	before, err := repo.Reference(name, true)
+	if err != nil && !errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return nil, err
+	}
+
+	// Without a + the refspec only takes fast-forwards, whatever would drop local commits is rejected
+	refSpec := name.String() + ":" + name.String()
+	if options, ok := nativeOptions(ctx); ok {
+		err = nativeFetchRefSpec(ctx, options, repo, refSpec, lineProcessor)
+	} else {
+		cmd := gitCommand(ctx, "fetch", "--progress", git.DefaultRemoteName, refSpec)
+		cmd.Dir = localPath
+		err = execCommand(ctx, cmd, lineProcessor)
+	}
+	switch {
+	case errors.Is(err, git.ErrForceNeeded) || matchesAny(err, rejectedPatterns):
+		update.Rejected = true
+		return update, nil
+	case errors.Is(err, git.NoMatchingRefSpecError{}) || matchesAny(err, missingRefPatterns):
+		update.Missing = true
+		return update, nil
+	case err != nil:
+		return nil, err
+	}
+
+	after, err := repo.Reference(name, true)
+	if err != nil {
+		return nil, err
+	}
+	if before == nil {
+		update.Created = true
+		return update, trackOrigin(repo, branch)
+	}
+	if after.Hash() != before.Hash() {
+		update.Commits, err = countCommits(repo, before.Hash(), after.Hash())
+	}
+	return update, err
+}
+
+// trackOrigin makes a new branch track the branch of the same name on origin, unless something is configured already
+func trackOrigin(repo *git.Repository, branch string) error {
+	err := repo.CreateBranch(&config.Branch{
+		Name:   branch,
+		Remote: git.DefaultRemoteName,
+		Merge:  plumbing.NewBranchReferenceName(branch),
+	})
+	if errors.Is(err, git.ErrBranchExists) {
+		return nil
+	}
+	return err
+}
+
+// nativeFetchRefSpec fetches a single refspec from origin with go-git, which refuses non-fast-forwards with ErrForceNeeded
+func nativeFetchRefSpec(ctx context.Context, options NativeOptions, repo *git.Repository, refSpec string, lineProcessor func(string)) (err error) {
+	finished := nativeCommand(ctx, "fetch", git.DefaultRemoteName, refSpec)
+	defer func() { finished(err) }()
+
+	remote, err := repo.Remote(git.DefaultRemoteName)
+	if err != nil {
+		return err
+	}
+	auth, err := nativeAuth(ctx, remote.Config().URLs[0], options)
+	if err != nil {
+		return err
+	}
+
+	progress := &lineWriter{lineProcessor: lineProcessor}
+	defer progress.Flush()
+
+	err = remote.FetchContext(ctx, &git.FetchOptions{RefSpecs: []config.RefSpec{config.RefSpec(refSpec)}, Auth: auth, Progress: progress})
+	if errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return nil
+	}
+	return err
+}
+
+func matchesAny(err error, patterns []string) bool {
+	if err == nil {
+		return false
+	}
+	for _, pattern := range patterns {
+		if strings.Contains(err.Error(), pattern) {
+			return true
+		}
+	}
+	return false
+}
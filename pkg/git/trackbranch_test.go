@@ -0,0 +1,115 @@
+package git
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestUpdateBranches(t *testing.T) {
+	tests := []struct {
+		branch string
+		origin func(t *testing.T, origin string) // after cloning
+		local  func(t *testing.T, clone string)
+		want   BranchUpdate
+		moved  bool // the local branch is where origin's is afterwards
+	}{
+		{
+			branch: "release",
+			origin: func(t *testing.T, origin string) {
+				run(t, origin, "checkout", "--quiet", "release")
+				commit(t, origin)
+				commit(t, origin)
+				run(t, origin, "checkout", "--quiet", "main")
+			},
+			local: func(t *testing.T, clone string) { run(t, clone, "branch", "release", "origin/release") },
+			want:  BranchUpdate{Branch: "release", Commits: 2},
+			moved: true,
+		},
+		{
+			branch: "hotfix",
+			origin: func(t *testing.T, origin string) { run(t, origin, "branch", "hotfix") },
+			local:  func(*testing.T, string) {},
+			want:   BranchUpdate{Branch: "hotfix", Created: true},
+			moved:  true,
+		},
+		{
+			branch: "spike",
+			origin: func(t *testing.T, origin string) {
+				run(t, origin, "checkout", "--quiet", "spike")
+				commit(t, origin)
+				run(t, origin, "checkout", "--quiet", "main")
+			},
+			local: func(t *testing.T, clone string) {
+				run(t, clone, "checkout", "--quiet", "-b", "spike", "origin/spike")
+				tree(t, clone, "spike.txt") // not the commit origin got
+				run(t, clone, "add", "spike.txt")
+				run(t, clone, "commit", "--quiet", "-m", "spike")
+				run(t, clone, "checkout", "--quiet", "main")
+			},
+			want: BranchUpdate{Branch: "spike", Rejected: true},
+		},
+		{
+			branch: "docs",
+			origin: func(*testing.T, string) {},
+			local:  func(t *testing.T, clone string) { run(t, clone, "branch", "docs", "origin/docs") },
+			want:   BranchUpdate{Branch: "docs"},
+			moved:  true,
+		},
+		{
+			branch: "removed",
+			origin: func(*testing.T, string) {},
+			local:  func(*testing.T, string) {},
+			want:   BranchUpdate{Branch: "removed", Missing: true},
+		},
+	}
+
+	for backend, ctx := range backends {
+		t.Run(backend, func(t *testing.T) {
+			dir := t.TempDir()
+			origin, clone := cloneOrigin(t, dir)
+			for _, branch := range []string{"release", "spike", "docs"} {
+				run(t, origin, "branch", branch)
+			}
+			run(t, clone, "fetch", "--quiet")
+			for _, test := range tests {
+				test.origin(t, origin)
+				test.local(t, clone)
+			}
+
+			branches := []string{"main"} // checked out, left to the pull
+			for _, test := range tests {
+				branches = append(branches, test.branch)
+			}
+			updates, err := UpdateBranches(ctx, clone, branches, func(string) {})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var updated []string
+			for _, update := range updates {
+				updated = append(updated, update.Branch)
+			}
+			if !slices.Equal(updated, branches[1:]) {
+				t.Fatalf("updated %q", updated)
+			}
+			for i, test := range tests {
+				if !reflect.DeepEqual(*updates[i], test.want) {
+					t.Errorf("got %+v, want %+v", *updates[i], test.want)
+				}
+				if !test.moved {
+					continue
+				}
+				if local, remote := run(t, clone, "rev-parse", test.branch), run(t, origin, "rev-parse", test.branch); local != remote {
+					t.Errorf("%s is at %s, origin at %s", test.branch, local, remote)
+				}
+			}
+			if remote, merge := run(t, clone, "config", "branch.hotfix.remote"), run(t, clone, "config", "branch.hotfix.merge"); remote != "origin" || merge != "refs/heads/hotfix" {
+				t.Errorf("hotfix tracks %s of %s", merge, remote)
+			}
+			if subject := run(t, clone, "log", "-1", "--format=%s", "spike"); subject != "spike" {
+				t.Errorf("spike lost its local commit, it is at %q", subject)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package git
+
+import (
+	"context"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+type pruneKey struct{}
+
+// WithPrune makes pulls started with ctx prune remote-tracking branches deleted on the remote, and fetches prune tags too.
+// Fetches always prune branches
+func WithPrune(ctx context.Context) context.Context {
+	return context.WithValue(ctx, pruneKey{}, true)
+}
+
+func pruning(ctx context.Context) bool {
+	prune, _ := ctx.Value(pruneKey{}).(bool)
+	return prune
+}
+
+// RemoteBranches returns the remote-tracking branches of a repository, e.g. origin/main, without the symbolic
+// origin/HEAD. Mirrors keep the branches of the remote as their own and have none
+func RemoteBranches(localPath string) (map[string]bool, error) {
+	repo, err := git.PlainOpen(localPath)
+	if err != nil {
+		return nil, err
+	}
+	refs, err := repo.References()
+	if err != nil {
+		return nil, err
+	}
+	defer refs.Close()
+
+	branches := make(map[string]bool)
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Name().IsRemote() && ref.Type() == plumbing.HashReference {
+			branches[ref.Name().Short()] = true
+		}
+		return nil
+	})
+	return branches, err
+}
@@ -0,0 +1,36 @@
+package git
+
+import (
+	"fmt"
+	"github.com/go-git/go-git/v5"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// TrashProject moves the repository at localPath into trashDir instead of deleting it, so it can still be recovered.
+// Each call gets its own timestamped folder, returns where the repository ended up. The trash may be on another
+// filesystem than localPath, the repository is copied faithfully then
+func TrashProject(trashDir string, localPath string) (string, error) {
+	_, err := git.PlainOpen(localPath)
+	if err != nil {
+		return "", err // folder not a git repo
+	}
+
+	err = os.MkdirAll(trashDir, 0755)
+	if err != nil {
+		return "", err
+	}
+
+	dir, err := os.MkdirTemp(trashDir, time.Now().Format("20060102-150405-"))
+	if err != nil {
+		return "", err
+	}
+
+	target := filepath.Join(dir, filepath.Base(localPath))
+	err = moveRepository(localPath, target)
+	if err != nil {
+		return "", fmt.Errorf("moving %s to the trash: %w", localPath, err)
+	}
+	return target, nil
+}
@@ -0,0 +1,124 @@
+package gitlab
+
+import (
+	"context"
+	"fmt"
+	"github.com/hashicorp/go-retryablehttp"
+	"gitlab.com/gitlab-org/api/client-go"
+	"net/http"
+	"time"
+)
+
+// API is the part of the Gitlab API the listing and the remote lock need. Paged calls take the page to fetch,
+// starting at 1, and return the next one, 0 after the last page
+type API interface {
+	SearchGroup(ctx context.Context, query string) ([]*gitlab.Group, error)
+	ListUsers(ctx context.Context, username string) ([]*gitlab.User, error)
+	ListGroupProjects(ctx context.Context, groupID int, page int) ([]*gitlab.Project, int, error)
+	ListSubGroups(ctx context.Context, groupID int, page int) ([]*gitlab.Group, int, error)
+	ListUserProjects(ctx context.Context, userID int, page int) ([]*gitlab.Project, int, error)
+	ListStarredProjects(ctx context.Context, page int) ([]*gitlab.Project, int, error)
+	GetProject(ctx context.Context, projectID int) (*gitlab.Project, error) // nil for projects that don't exist or can't be read
+
+	GetProjectByPath(ctx context.Context, path string) (*gitlab.Project, error)
+	// GetFile returns a file at ref, nil if it doesn't exist, and the time of the Gitlab server when it answered
+	GetFile(ctx context.Context, project string, path string, ref string) (*gitlab.File, time.Time, error)
+	// CreateCommit returns ErrLockConflict when Gitlab rejects the commit, e.g. because a file changed since the
+	// last commit of its action
+	CreateCommit(ctx context.Context, project string, opt *gitlab.CreateCommitOptions) (*gitlab.Commit, error)
+}
+
+// clientAPI is the API of a real Gitlab instance
+type clientAPI struct {
+	client *gitlab.Client
+}
+
+func (a *clientAPI) SearchGroup(ctx context.Context, query string) ([]*gitlab.Group, error) {
+	groups, _, err := a.client.Groups.SearchGroup(query, gitlab.WithContext(ctx))
+	return groups, err
+}
+
+func (a *clientAPI) ListUsers(ctx context.Context, username string) ([]*gitlab.User, error) {
+	users, _, err := a.client.Users.ListUsers(&gitlab.ListUsersOptions{Username: &username}, gitlab.WithContext(ctx))
+	return users, err
+}
+
+func (a *clientAPI) ListGroupProjects(ctx context.Context, groupID int, page int) ([]*gitlab.Project, int, error) {
+	opt := &gitlab.ListGroupProjectsOptions{ListOptions: gitlab.ListOptions{PerPage: listPageSize, Page: page}}
+	projects, resp, err := a.client.Groups.ListGroupProjects(groupID, opt, gitlab.WithContext(ctx), withStatistics())
+	if err != nil {
+		return nil, 0, err
+	}
+	return projects, resp.NextPage, nil
+}
+
+func (a *clientAPI) ListSubGroups(ctx context.Context, groupID int, page int) ([]*gitlab.Group, int, error) {
+	opt := &gitlab.ListSubGroupsOptions{ListOptions: gitlab.ListOptions{PerPage: listPageSize, Page: page}}
+	groups, resp, err := a.client.Groups.ListSubGroups(groupID, opt, gitlab.WithContext(ctx))
+	if err != nil {
+		return nil, 0, err
+	}
+	return groups, resp.NextPage, nil
+}
+
+func (a *clientAPI) ListUserProjects(ctx context.Context, userID int, page int) ([]*gitlab.Project, int, error) {
+	opt := &gitlab.ListProjectsOptions{Statistics: gitlab.Ptr(true), ListOptions: gitlab.ListOptions{PerPage: listPageSize, Page: page}}
+	projects, resp, err := a.client.Projects.ListUserProjects(userID, opt, gitlab.WithContext(ctx))
+	if err != nil {
+		return nil, 0, err
+	}
+	return projects, resp.NextPage, nil
+}
+
+func (a *clientAPI) ListStarredProjects(ctx context.Context, page int) ([]*gitlab.Project, int, error) {
+	opt := &gitlab.ListProjectsOptions{Starred: gitlab.Ptr(true), Statistics: gitlab.Ptr(true), ListOptions: gitlab.ListOptions{PerPage: listPageSize, Page: page}}
+	projects, resp, err := a.client.Projects.ListProjects(opt, gitlab.WithContext(ctx))
+	if err != nil {
+		return nil, 0, err
+	}
+	return projects, resp.NextPage, nil
+}
+
+func (a *clientAPI) GetProject(ctx context.Context, projectID int) (*gitlab.Project, error) {
+	project, resp, err := a.client.Projects.GetProject(projectID, &gitlab.GetProjectOptions{Statistics: gitlab.Ptr(true)}, gitlab.WithContext(ctx))
+	if resp != nil && (resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusForbidden) {
+		return nil, nil
+	}
+	return project, err
+}
+
+func (a *clientAPI) GetProjectByPath(ctx context.Context, path string) (*gitlab.Project, error) {
+	project, _, err := a.client.Projects.GetProject(path, nil, gitlab.WithContext(ctx))
+	return project, err
+}
+
+func (a *clientAPI) GetFile(ctx context.Context, project string, path string, ref string) (*gitlab.File, time.Time, error) {
+	file, resp, err := a.client.RepositoryFiles.GetFile(project, path, &gitlab.GetFileOptions{Ref: gitlab.Ptr(ref)}, gitlab.WithContext(ctx))
+	now := time.Now()
+	if resp != nil {
+		now = serverTime(resp)
+	}
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return nil, now, nil
+	}
+	return file, now, err
+}
+
+func (a *clientAPI) CreateCommit(ctx context.Context, project string, opt *gitlab.CreateCommitOptions) (*gitlab.Commit, error) {
+	commit, resp, err := a.client.Commits.CreateCommit(project, opt, gitlab.WithContext(ctx))
+	if resp != nil && resp.StatusCode == http.StatusBadRequest {
+		return nil, fmt.Errorf("%w: %v", ErrLockConflict, err)
+	}
+	return commit, err
+}
+
+// withStatistics asks for the statistics of the listed projects, which the options of every listing but the one
+// of group projects can ask for themselves
+func withStatistics() gitlab.RequestOptionFunc {
+	return func(req *retryablehttp.Request) error {
+		q := req.URL.Query()
+		q.Set("statistics", "true")
+		req.URL.RawQuery = q.Encode()
+		return nil
+	}
+}
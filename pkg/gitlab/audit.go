@@ -0,0 +1,101 @@
+package gitlab
+
+import (
+	"context"
+	"gitlab.com/gitlab-org/api/client-go"
+	"strings"
+	"time"
+)
+
+// What happened to a project according to the audit events
+const (
+	ProjectDeleted     = "deleted"
+	ProjectTransferred = "transferred"
+	ProjectRenamed     = "renamed"
+)
+
+// OrphanEvent tells who made a project disappear from the group and how
+type OrphanEvent struct {
+	Type  string    `json:"type"`
+	Actor string    `json:"actor"`
+	Time  time.Time `json:"time"`
+	To    string    `json:"to,omitempty"` // new path of transferred or renamed projects
+}
+
+// maxAuditPages limits how far back audit events are paged through, busy groups have a lot of them
+const maxAuditPages = 10
+
+// FindOrphanEvents looks through the audit events of the group since the given time for the deletion, transfer
+// or rename of the given projects, paths are relative to the group. Audit events need Gitlab Premium and the
+// Owner role in the group, so errors are common and just mean there is nothing to tell
+func (gl *Gitlab) FindOrphanEvents(ctx context.Context, groupPath string, paths []string, since time.Time) (map[string]*OrphanEvent, error) {
+	wanted := make(map[string]string)
+	for _, path := range paths {
+		wanted[groupPath+"/"+path] = path
+	}
+
+	found := make(map[string]*OrphanEvent)
+	opt := &gitlab.ListAuditEventsOptions{
+		ListOptions:  gitlab.ListOptions{PerPage: 100, Page: 1},
+		CreatedAfter: &since,
+	}
+	for page := 0; page < maxAuditPages; page++ {
+		events, resp, err := gl.client.AuditEvents.ListGroupAuditEvents(groupPath, opt, gitlab.WithContext(ctx))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, event := range events {
+			path, orphan := matchOrphanEvent(event, wanted)
+			if orphan == nil {
+				continue
+			}
+			if previous := found[path]; previous == nil || previous.Time.Before(orphan.Time) {
+				found[path] = orphan
+			}
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+
+	return found, nil
+}
+
+// matchOrphanEvent returns the wanted project an audit event is about and what happened to it
+func matchOrphanEvent(event *gitlab.AuditEvent, wanted map[string]string) (string, *OrphanEvent) {
+	details := event.Details
+
+	var path string
+	for _, candidate := range []string{details.EntityPath, details.TargetDetails, details.From} {
+		if p, ok := wanted[candidate]; ok {
+			path = p
+			break
+		}
+	}
+	if path == "" {
+		return "", nil
+	}
+
+	orphan := &OrphanEvent{Actor: details.AuthorName}
+	if event.CreatedAt != nil {
+		orphan.Time = *event.CreatedAt
+	}
+
+	name := strings.ToLower(event.EventName + " " + details.EventName)
+	switch {
+	case details.Remove == "project" || strings.Contains(name, "destroy") || strings.Contains(name, "delet"):
+		orphan.Type = ProjectDeleted
+	case details.Change == "namespace" || strings.Contains(name, "transfer"):
+		orphan.Type = ProjectTransferred
+		orphan.To = details.To
+	case details.Change == "path" || strings.Contains(name, "path_updated") || strings.Contains(name, "rename"):
+		orphan.Type = ProjectRenamed
+		orphan.To = details.To
+	default:
+		return "", nil // something else happened to it
+	}
+	return path, orphan
+}
@@ -0,0 +1,88 @@
+package gitlab_test
+
+import (
+	"context"
+	gls "gls/pkg/gitlab"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFindOrphanEvents(t *testing.T) {
+	// Newest first, like Gitlab lists them, over two pages
+	pages := map[string]string{
+		"1": `[
+			{"event_name": "project_path_updated", "created_at": "2026-05-04T10:00:00Z",
+			 "details": {"change": "path", "from": "infra/dns", "to": "infra/dns-legacy", "author_name": "Dana", "entity_path": "infra/dns"}},
+			{"event_name": "project_destroyed", "created_at": "2026-05-03T09:00:00Z",
+			 "details": {"remove": "project", "author_name": "Robin", "target_details": "infra/vpn", "entity_path": "infra/vpn"}},
+			{"event_name": "member_added", "created_at": "2026-05-02T08:00:00Z",
+			 "details": {"add": "user_access", "author_name": "Robin", "entity_path": "infra/mail"}},
+			{"event_name": "project_destroyed", "created_at": "2026-05-02T07:00:00Z",
+			 "details": {"remove": "project", "author_name": "Sam", "entity_path": "other/vpn"}}
+		]`,
+		"2": `[
+			{"event_name": "project_namespace_updated", "created_at": "2026-04-30T12:00:00Z",
+			 "details": {"change": "namespace", "from": "infra/ldap", "to": "identity/ldap", "author_name": "Kai", "entity_path": "identity/ldap"}},
+			{"event_name": "project_path_updated", "created_at": "2026-04-01T12:00:00Z",
+			 "details": {"change": "path", "from": "infra/dns", "to": "infra/dns-old", "author_name": "Kai", "entity_path": "infra/dns"}}
+		]`,
+	}
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v4/groups/infra/audit_events" {
+			http.Error(w, `{"message": "403 Forbidden"}`, http.StatusForbidden)
+			return
+		}
+		page := r.URL.Query().Get("page")
+		requests = append(requests, page+" after "+r.URL.Query().Get("created_after"))
+		if page == "1" {
+			w.Header().Set("X-Next-Page", "2")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(pages[page]))
+	}))
+	defer server.Close()
+
+	gl, err := gls.New(server.URL, "token", gls.PersonalToken, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	since := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		path string
+		want *gls.OrphanEvent
+	}{
+		{path: "dns", want: &gls.OrphanEvent{Type: gls.ProjectRenamed, Actor: "Dana", Time: time.Date(2026, 5, 4, 10, 0, 0, 0, time.UTC), To: "infra/dns-legacy"}}, // the latest rename
+		{path: "vpn", want: &gls.OrphanEvent{Type: gls.ProjectDeleted, Actor: "Robin", Time: time.Date(2026, 5, 3, 9, 0, 0, 0, time.UTC)}},
+		{path: "ldap", want: &gls.OrphanEvent{Type: gls.ProjectTransferred, Actor: "Kai", Time: time.Date(2026, 4, 30, 12, 0, 0, 0, time.UTC), To: "identity/ldap"}},
+		{path: "mail"}, // only its members changed
+		{path: "ntp"},  // nothing happened to it in the window
+	}
+
+	var paths []string
+	for _, test := range tests {
+		paths = append(paths, test.path)
+	}
+	orphans, err := gl.FindOrphanEvents(context.Background(), "infra", paths, since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range tests {
+		if got := orphans[test.path]; !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %+v, want %+v", test.path, got, test.want)
+		}
+	}
+	if want := []string{"1 after 2026-03-01T00:00:00Z", "2 after 2026-03-01T00:00:00Z"}; !reflect.DeepEqual(requests, want) {
+		t.Errorf("requested %q", requests)
+	}
+
+	// Without Premium or the Owner role
+	orphans, err = gl.FindOrphanEvents(context.Background(), "free", paths, since)
+	if err == nil || orphans != nil {
+		t.Errorf("got %v, %v", orphans, err)
+	}
+}
@@ -0,0 +1,56 @@
+package gitlab
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// CloneUrl is what a clone url tells about the Gitlab instance and the project
+type CloneUrl struct {
+	BaseUrl     string // web url of the instance, ssh ports are dropped as the API is served over https
+	ProjectPath string // full path of the project, including all of its groups
+	Https       bool   // cloned over http(s) rather than ssh
+}
+
+// scpLike matches the short ssh form user@host:path, the user is optional
+var scpLike = regexp.MustCompile(`^(?:[^@/]+@)?([^:/]+):(.+)$`)
+
+// ParseCloneUrl understands ssh clone urls like git@gitlab.example.com:group/sub/project.git or
+// ssh://git@gitlab.example.com:2222/group/project.git and http(s) ones like https://gitlab.example.com:8443/group/project
+func ParseCloneUrl(raw string) (*CloneUrl, error) {
+	raw = strings.TrimSpace(raw)
+
+	var cloneUrl *CloneUrl
+	if strings.Contains(raw, "://") {
+		parsed, err := url.Parse(raw)
+		if err != nil {
+			return nil, err
+		}
+		if parsed.Hostname() == "" {
+			return nil, fmt.Errorf("%s has no host", raw)
+		}
+
+		switch parsed.Scheme {
+		case "ssh", "git+ssh":
+			cloneUrl = &CloneUrl{BaseUrl: "https://" + parsed.Hostname(), ProjectPath: parsed.Path}
+		case "http", "https":
+			cloneUrl = &CloneUrl{BaseUrl: parsed.Scheme + "://" + parsed.Host, ProjectPath: parsed.Path, Https: true}
+		default:
+			return nil, fmt.Errorf("unsupported scheme %s in %s, use ssh or https", parsed.Scheme, raw)
+		}
+	} else {
+		match := scpLike.FindStringSubmatch(raw)
+		if match == nil {
+			return nil, fmt.Errorf("%s is no clone url", raw)
+		}
+		cloneUrl = &CloneUrl{BaseUrl: "https://" + match[1], ProjectPath: match[2]}
+	}
+
+	cloneUrl.ProjectPath = strings.TrimSuffix(strings.Trim(cloneUrl.ProjectPath, "/"), ".git")
+	if !strings.Contains(cloneUrl.ProjectPath, "/") {
+		return nil, fmt.Errorf("%s doesn't name a project within a group or user", raw)
+	}
+	return cloneUrl, nil
+}
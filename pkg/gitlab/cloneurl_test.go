@@ -0,0 +1,42 @@
+package gitlab_test
+
+import (
+	gls "gls/pkg/gitlab"
+	"strings"
+	"testing"
+)
+
+func TestParseCloneUrl(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want gls.CloneUrl
+		err  string
+	}{
+		{raw: "git@code.example.org:robotics/firmware/motor.git", want: gls.CloneUrl{BaseUrl: "https://code.example.org", ProjectPath: "robotics/firmware/motor"}},
+		{raw: "code.example.org:robotics/motor", want: gls.CloneUrl{BaseUrl: "https://code.example.org", ProjectPath: "robotics/motor"}},
+		{raw: "ssh://git@code.example.org:2222/robotics/motor.git", want: gls.CloneUrl{BaseUrl: "https://code.example.org", ProjectPath: "robotics/motor"}},
+		{raw: "git+ssh://code.example.org/robotics/motor", want: gls.CloneUrl{BaseUrl: "https://code.example.org", ProjectPath: "robotics/motor"}},
+		{raw: "https://code.example.org:8443/robotics/firmware/motor.git", want: gls.CloneUrl{BaseUrl: "https://code.example.org:8443", ProjectPath: "robotics/firmware/motor", Https: true}},
+		{raw: "  http://code.example.org/robotics/motor/  \n", want: gls.CloneUrl{BaseUrl: "http://code.example.org", ProjectPath: "robotics/motor", Https: true}},
+		{raw: "https://code.example.org/motor.git", err: "doesn't name a project within a group or user"},
+		{raw: "git@code.example.org:motor", err: "doesn't name a project within a group or user"},
+		{raw: "ftp://code.example.org/robotics/motor", err: "unsupported scheme ftp"},
+		{raw: "https:///robotics/motor", err: "has no host"},
+		{raw: "/srv/git/robotics/motor.git", err: "is no clone url"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.raw, func(t *testing.T) {
+			got, err := gls.ParseCloneUrl(test.raw)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("got %+v, %v, want %s", got, err, test.err)
+				}
+				return
+			}
+			if err != nil || *got != test.want {
+				t.Errorf("got %+v, %v, want %+v", got, err, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package gitlab
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// latencyBuckets are the upper bounds of the histogram buckets, one more bucket takes everything above the last
+var latencyBuckets = [...]time.Duration{
+	10 * time.Millisecond, 50 * time.Millisecond, 100 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond,
+	time.Second, 2500 * time.Millisecond, 5 * time.Second, 10 * time.Second,
+}
+
+// Histogram counts durations into latencyBuckets, it is safe for concurrent use without locking
+type Histogram struct {
+	counts [len(latencyBuckets) + 1]atomic.Int64
+	max    atomic.Int64
+}
+
+func (h *Histogram) Observe(d time.Duration) {
+	bucket := len(latencyBuckets)
+	for i, bound := range latencyBuckets {
+		if d <= bound {
+			bucket = i
+			break
+		}
+	}
+	h.counts[bucket].Add(1)
+
+	for {
+		current := h.max.Load()
+		if int64(d) <= current || h.max.CompareAndSwap(current, int64(d)) {
+			return
+		}
+	}
+}
+
+func (h *Histogram) Count() int64 {
+	var count int64
+	for i := range h.counts {
+		count += h.counts[i].Load()
+	}
+	return count
+}
+
+func (h *Histogram) Max() time.Duration {
+	return time.Duration(h.max.Load())
+}
+
+// Quantile returns the upper bound of the bucket holding the q quantile, e.g. 0.95. Beyond the last bucket it
+// returns the maximum, without observations 0
+func (h *Histogram) Quantile(q float64) time.Duration {
+	count := h.Count()
+	if count == 0 {
+		return 0
+	}
+
+	rank := int64(q * float64(count))
+	var seen int64
+	for i, bound := range latencyBuckets {
+		seen += h.counts[i].Load()
+		if seen > rank {
+			return bound
+		}
+	}
+	return h.Max()
+}
+
+// ListDiagnostics tells how a listing went, to check that it stays within its request limit.
+// Counters are updated while the listing runs, read them once it returned
+type ListDiagnostics struct {
+	Limit        int // most requests at once, 0 is unlimited
+	Requests     atomic.Int64
+	InFlight     atomic.Int64
+	PeakInFlight atomic.Int64
+	Goroutines   atomic.Int64 // started for the listing in total, most of them wait for a request slot
+	QueueWait    Histogram    // how long requests waited for a slot
+	GroupLatency Histogram    // from discovering a group until its projects and subgroups were listed
+
+	mu           sync.Mutex
+	slowestGroup string
+}
+
+func (d *ListDiagnostics) requestStarted() {
+	d.Requests.Add(1)
+	inFlight := d.InFlight.Add(1)
+	for {
+		peak := d.PeakInFlight.Load()
+		if inFlight <= peak || d.PeakInFlight.CompareAndSwap(peak, inFlight) {
+			return
+		}
+	}
+}
+
+func (d *ListDiagnostics) requestFinished() {
+	d.InFlight.Add(-1)
+}
+
+func (d *ListDiagnostics) groupListed(group string, latency time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if latency > d.GroupLatency.Max() {
+		d.slowestGroup = group
+	}
+	d.GroupLatency.Observe(latency)
+}
+
+// SlowestGroup is the group that took longest to list
+func (d *ListDiagnostics) SlowestGroup() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.slowestGroup
+}
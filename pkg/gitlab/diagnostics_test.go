@@ -0,0 +1,52 @@
+package gitlab_test
+
+import (
+	"context"
+	"fmt"
+	gls "gls/pkg/gitlab"
+	"gls/pkg/gitlab/fakegitlab"
+	"testing"
+	"time"
+)
+
+func TestListingStaysWithinConcurrency(t *testing.T) {
+	fake := fakegitlab.New()
+	fake.Latency = time.Millisecond // so requests overlap like against a real instance
+	for i := range 500 {
+		fake.AddProject(fmt.Sprintf("acme/sub-%03d/project", i))
+	}
+
+	for _, limit := range []int{1, 4, 20} {
+		t.Run(fmt.Sprint(limit), func(t *testing.T) {
+			gl := gls.NewWithAPI(fake)
+			gl.SetListConcurrency(limit)
+
+			projects, errs := gl.GetActiveGitlabProjects(context.Background(), "acme", -1, func(gls.Progress) {})
+			if len(errs) > 0 {
+				t.Fatal(errs)
+			}
+			if len(projects) != 500 {
+				t.Fatalf("listed %d projects, want 500", len(projects))
+			}
+
+			diagnostics := gl.ListDiagnostics()
+			if peak := diagnostics.PeakInFlight.Load(); peak > int64(limit) {
+				t.Errorf("%d requests ran at once, the limit is %d", peak, limit)
+			}
+			if diagnostics.InFlight.Load() != 0 {
+				t.Errorf("%d requests are still counted as running", diagnostics.InFlight.Load())
+			}
+			// Over a thousand requests with latency fill every slot, otherwise the limit wasn't put to the test
+			if limit > 1 && diagnostics.PeakInFlight.Load() < 2 {
+				t.Errorf("requests never overlapped")
+			}
+			if diagnostics.Limit != limit {
+				t.Errorf("got limit %d, want %d", diagnostics.Limit, limit)
+			}
+		})
+	}
+
+	if peak := fake.PeakCalls(); peak > 20 {
+		t.Errorf("the fake saw %d calls at once, more than the highest limit", peak)
+	}
+}
@@ -0,0 +1,507 @@
+// Package fakegitlab is an in-memory Gitlab to test the listing against, seeded with a tree of groups and projects
+package fakegitlab
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"gitlab.com/gitlab-org/api/client-go"
+	gls "gls/pkg/gitlab"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var _ gls.API = (*Gitlab)(nil)
+
+// Gitlab answers the calls of the listing from what it was seeded with. Pages hold PageSize entries,
+// listings of a group or user registered with Fail return that error instead, pages registered with FailPage once.
+// Listing calls take Latency, so they overlap like requests to a real instance.
+// Files of projects only exist as far as commits created them, which is what the remote lock needs
+type Gitlab struct {
+	PageSize int
+	Latency  time.Duration
+
+	Now          func() time.Time // the clock of the server, time.Now if nil
+	BeforeCommit func()           // called before a commit is applied, e.g. to let another machine commit first
+
+	inFlight atomic.Int64
+	peak     atomic.Int64
+
+	mu       sync.Mutex
+	nextID   int
+	groups   map[string]*gitlab.Group // by full path
+	users    map[string]*gitlab.User  // by username
+	projects map[int][]*gitlab.Project
+	userProj map[int][]*gitlab.Project
+	starred  []*gitlab.Project
+	failures map[string]error
+	pageFail map[string]error // by group or user and page
+	calls    map[string]int
+	files    map[string]*file // by project and file path
+	commits  int
+}
+
+// file is the content of a file and the last commit that changed it
+type file struct {
+	content string
+	commit  string
+}
+
+// New creates an empty instance with pages of 2, so paging is exercised without seeding much
+func New() *Gitlab {
+	return &Gitlab{
+		PageSize: 2,
+		groups:   make(map[string]*gitlab.Group),
+		users:    make(map[string]*gitlab.User),
+		projects: make(map[int][]*gitlab.Project),
+		userProj: make(map[int][]*gitlab.Project),
+		failures: make(map[string]error),
+		pageFail: make(map[string]error),
+		calls:    make(map[string]int),
+		files:    make(map[string]*file),
+	}
+}
+
+// ProjectOption changes a seeded project, e.g. to archive it
+type ProjectOption func(*gitlab.Project)
+
+// Archived marks a project as archived
+func Archived() ProjectOption {
+	return func(project *gitlab.Project) {
+		project.Archived = true
+	}
+}
+
+// SharedWith shares a project with another group
+func SharedWith(groupPath string) ProjectOption {
+	return func(project *gitlab.Project) {
+		project.SharedWithGroups = append(project.SharedWithGroups, struct {
+			GroupID          int    `json:"group_id"`
+			GroupName        string `json:"group_name"`
+			GroupFullPath    string `json:"group_full_path"`
+			GroupAccessLevel int    `json:"group_access_level"`
+		}{GroupFullPath: groupPath})
+	}
+}
+
+// DefaultBranch sets the default branch, seeded projects are on main otherwise
+func DefaultBranch(branch string) ProjectOption {
+	return func(project *gitlab.Project) {
+		project.DefaultBranch = branch
+	}
+}
+
+// Topics sets the topics of a project
+func Topics(topics ...string) ProjectOption {
+	return func(project *gitlab.Project) {
+		project.Topics = topics
+	}
+}
+
+// AddGroup creates a group and the groups above it that don't exist yet
+func (f *Gitlab) AddGroup(fullPath string) *gitlab.Group {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.addGroup(fullPath)
+}
+
+func (f *Gitlab) addGroup(fullPath string) *gitlab.Group {
+	if group, ok := f.groups[fullPath]; ok {
+		return group
+	}
+
+	group := &gitlab.Group{ID: f.id(), Path: path.Base(fullPath), Name: path.Base(fullPath), FullPath: fullPath}
+	if parent := path.Dir(fullPath); parent != "." {
+		group.ParentID = f.addGroup(parent).ID
+	}
+	f.groups[fullPath] = group
+	return group
+}
+
+// AddProject creates a project at fullPath, the groups above it are created as needed
+func (f *Gitlab) AddProject(fullPath string, options ...ProjectOption) *gitlab.Project {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	group := f.addGroup(path.Dir(fullPath))
+	project := f.newProject(fullPath, options)
+	f.projects[group.ID] = append(f.projects[group.ID], project)
+	return project
+}
+
+// AddUserProject creates a project in the personal namespace of username, creating the user as needed
+func (f *Gitlab) AddUserProject(username string, name string, options ...ProjectOption) *gitlab.Project {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	user, ok := f.users[username]
+	if !ok {
+		user = &gitlab.User{ID: f.id(), Username: username}
+		f.users[username] = user
+	}
+
+	project := f.newProject(username+"/"+name, options)
+	f.userProj[user.ID] = append(f.userProj[user.ID], project)
+	return project
+}
+
+func (f *Gitlab) newProject(fullPath string, options []ProjectOption) *gitlab.Project {
+	project := &gitlab.Project{
+		ID:                f.id(),
+		Path:              path.Base(fullPath),
+		PathWithNamespace: fullPath,
+		DefaultBranch:     "main",
+		SSHURLToRepo:      fmt.Sprintf("git@gitlab.example.com:%s.git", fullPath),
+		HTTPURLToRepo:     fmt.Sprintf("https://gitlab.example.com/%s.git", fullPath),
+	}
+	for _, option := range options {
+		option(project)
+	}
+	return project
+}
+
+// Star adds a seeded project to the starred projects of the token's user
+func (f *Gitlab) Star(project *gitlab.Project) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.starred = append(f.starred, project)
+}
+
+// Fail makes listing the projects and subgroups of a group, or the projects of a user, return err
+func (f *Gitlab) Fail(groupOrUser string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failures[groupOrUser] = err
+}
+
+// FailPage makes the next request of a page of the projects or subgroups of a group, or the projects of a user,
+// return err. Later requests of the page succeed again, like after a network blip
+func (f *Gitlab) FailPage(groupOrUser string, page int, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pageFail[pageKey(groupOrUser, page)] = err
+}
+
+// File returns the content of a file in a project, false if it doesn't exist
+func (f *Gitlab) File(project string, filePath string) (string, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	file, ok := f.files[project+"/"+filePath]
+	if !ok {
+		return "", false
+	}
+	return file.content, true
+}
+
+// Calls tells how often a method was called, e.g. to check that a depth limit saved requests
+func (f *Gitlab) Calls(method string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[method]
+}
+
+// PeakCalls tells the most listing calls that ran at once
+func (f *Gitlab) PeakCalls() int {
+	return int(f.peak.Load())
+}
+
+// wait counts a listing call as running and lets it take Latency, without holding the lock
+func (f *Gitlab) wait(ctx context.Context) {
+	inFlight := f.inFlight.Add(1)
+	for {
+		peak := f.peak.Load()
+		if inFlight <= peak || f.peak.CompareAndSwap(peak, inFlight) {
+			break
+		}
+	}
+
+	if f.Latency > 0 {
+		select {
+		case <-time.After(f.Latency):
+		case <-ctx.Done():
+		}
+	}
+}
+
+func (f *Gitlab) id() int {
+	f.nextID++
+	return f.nextID
+}
+
+func (f *Gitlab) SearchGroup(ctx context.Context, query string) ([]*gitlab.Group, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls["SearchGroup"]++
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var groups []*gitlab.Group
+	for fullPath, group := range f.groups {
+		if strings.Contains(strings.ToLower(fullPath), strings.ToLower(query)) {
+			groups = append(groups, group)
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].ID < groups[j].ID
+	})
+	return groups, nil
+}
+
+func (f *Gitlab) ListUsers(ctx context.Context, username string) ([]*gitlab.User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls["ListUsers"]++
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if user, ok := f.users[username]; ok {
+		return []*gitlab.User{user}, nil
+	}
+	return nil, nil
+}
+
+func (f *Gitlab) ListGroupProjects(ctx context.Context, groupID int, page int) ([]*gitlab.Project, int, error) {
+	f.wait(ctx)
+	defer f.inFlight.Add(-1)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls["ListGroupProjects"]++
+
+	if err := f.failure(ctx, f.groupPath(groupID), page); err != nil {
+		return nil, 0, err
+	}
+	projects, next := paginate(f.projects[groupID], page, f.PageSize)
+	return projects, next, nil
+}
+
+func (f *Gitlab) ListSubGroups(ctx context.Context, groupID int, page int) ([]*gitlab.Group, int, error) {
+	f.wait(ctx)
+	defer f.inFlight.Add(-1)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls["ListSubGroups"]++
+
+	if err := f.failure(ctx, f.groupPath(groupID), page); err != nil {
+		return nil, 0, err
+	}
+
+	var subgroups []*gitlab.Group
+	for _, group := range f.groups {
+		if group.ParentID == groupID {
+			subgroups = append(subgroups, group)
+		}
+	}
+	sort.Slice(subgroups, func(i, j int) bool {
+		return subgroups[i].ID < subgroups[j].ID
+	})
+	groups, next := paginate(subgroups, page, f.PageSize)
+	return groups, next, nil
+}
+
+func (f *Gitlab) ListUserProjects(ctx context.Context, userID int, page int) ([]*gitlab.Project, int, error) {
+	f.wait(ctx)
+	defer f.inFlight.Add(-1)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls["ListUserProjects"]++
+
+	for username, user := range f.users {
+		if user.ID == userID {
+			if err := f.failure(ctx, username, page); err != nil {
+				return nil, 0, err
+			}
+		}
+	}
+	projects, next := paginate(f.userProj[userID], page, f.PageSize)
+	return projects, next, nil
+}
+
+// ListStarredProjects fails like a user called starred would
+func (f *Gitlab) ListStarredProjects(ctx context.Context, page int) ([]*gitlab.Project, int, error) {
+	f.wait(ctx)
+	defer f.inFlight.Add(-1)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls["ListStarredProjects"]++
+
+	if err := f.failure(ctx, gls.StarredSource, page); err != nil {
+		return nil, 0, err
+	}
+	projects, next := paginate(f.starred, page, f.PageSize)
+	return projects, next, nil
+}
+
+// GetProject fails like the group or user the project is in
+func (f *Gitlab) GetProject(ctx context.Context, projectID int) (*gitlab.Project, error) {
+	f.wait(ctx)
+	defer f.inFlight.Add(-1)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls["GetProject"]++
+
+	for _, project := range f.allProjects() {
+		if project.ID == projectID {
+			return project, f.failure(ctx, path.Dir(project.PathWithNamespace), 1)
+		}
+	}
+	return nil, ctx.Err()
+}
+
+// GetProjectByPath fails like the group or user the project is in, and like Gitlab for projects that don't exist
+func (f *Gitlab) GetProjectByPath(ctx context.Context, fullPath string) (*gitlab.Project, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls["GetProjectByPath"]++
+
+	if err := f.failure(ctx, path.Dir(fullPath), 1); err != nil {
+		return nil, err
+	}
+	project := f.project(fullPath)
+	if project == nil {
+		return nil, fmt.Errorf("404 Project Not Found")
+	}
+	return project, nil
+}
+
+// GetFile fails like the group or user the project is in. Every project has a single branch, ref isn't looked at
+func (f *Gitlab) GetFile(ctx context.Context, project string, filePath string, ref string) (*gitlab.File, time.Time, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls["GetFile"]++
+
+	now := f.now()
+	if err := f.failure(ctx, path.Dir(project), 1); err != nil {
+		return nil, now, err
+	}
+	if f.project(project) == nil {
+		return nil, now, fmt.Errorf("404 Project Not Found")
+	}
+	file, ok := f.files[project+"/"+filePath]
+	if !ok {
+		return nil, now, nil
+	}
+	return &gitlab.File{
+		FilePath:     filePath,
+		Ref:          ref,
+		Content:      base64.StdEncoding.EncodeToString([]byte(file.content)),
+		Encoding:     "base64",
+		LastCommitID: file.commit,
+	}, now, nil
+}
+
+// CreateCommit applies all actions or none, like Gitlab. Creating a file that exists, changing one that doesn't or
+// changing one whose last commit isn't the expected one is gls.ErrLockConflict
+func (f *Gitlab) CreateCommit(ctx context.Context, project string, opt *gitlab.CreateCommitOptions) (*gitlab.Commit, error) {
+	if f.BeforeCommit != nil {
+		f.BeforeCommit()
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls["CreateCommit"]++
+
+	if err := f.failure(ctx, path.Dir(project), 1); err != nil {
+		return nil, err
+	}
+	if f.project(project) == nil {
+		return nil, fmt.Errorf("404 Project Not Found")
+	}
+
+	for _, action := range opt.Actions {
+		existing, ok := f.files[project+"/"+*action.FilePath]
+		switch {
+		case *action.Action == gitlab.FileCreate && ok:
+			return nil, fmt.Errorf("%w: a file with this name already exists", gls.ErrLockConflict)
+		case *action.Action != gitlab.FileCreate && !ok:
+			return nil, fmt.Errorf("%w: a file with this name doesn't exist", gls.ErrLockConflict)
+		case action.LastCommitID != nil && ok && *action.LastCommitID != existing.commit:
+			return nil, fmt.Errorf("%w: %s has been modified since", gls.ErrLockConflict, *action.FilePath)
+		}
+	}
+
+	f.commits++
+	commit := &gitlab.Commit{ID: fmt.Sprintf("%040x", f.commits), Message: *opt.CommitMessage}
+	for _, action := range opt.Actions {
+		key := project + "/" + *action.FilePath
+		if *action.Action == gitlab.FileDelete {
+			delete(f.files, key)
+			continue
+		}
+		f.files[key] = &file{content: *action.Content, commit: commit.ID}
+	}
+	return commit, nil
+}
+
+func (f *Gitlab) now() time.Time {
+	if f.Now != nil {
+		return f.Now()
+	}
+	return time.Now()
+}
+
+func (f *Gitlab) allProjects() []*gitlab.Project {
+	var all []*gitlab.Project
+	for _, projects := range f.projects {
+		all = append(all, projects...)
+	}
+	for _, projects := range f.userProj {
+		all = append(all, projects...)
+	}
+	return all
+}
+
+func (f *Gitlab) project(fullPath string) *gitlab.Project {
+	for _, project := range f.allProjects() {
+		if project.PathWithNamespace == fullPath {
+			return project
+		}
+	}
+	return nil
+}
+
+func (f *Gitlab) groupPath(groupID int) string {
+	for fullPath, group := range f.groups {
+		if group.ID == groupID {
+			return fullPath
+		}
+	}
+	return ""
+}
+
+func (f *Gitlab) failure(ctx context.Context, groupOrUser string, page int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err, ok := f.pageFail[pageKey(groupOrUser, page)]; ok {
+		delete(f.pageFail, pageKey(groupOrUser, page))
+		return err
+	}
+	return f.failures[groupOrUser]
+}
+
+func pageKey(groupOrUser string, page int) string {
+	return fmt.Sprintf("%s?page=%d", groupOrUser, page)
+}
+
+// paginate returns a page of items, starting at 1, and the number of the next page or 0 after the last one
+func paginate[T any](items []T, page int, pageSize int) ([]T, int) {
+	pageSize = max(pageSize, 1)
+	start := min((page-1)*pageSize, len(items))
+	end := min(start+pageSize, len(items))
+	if end >= len(items) {
+		return items[start:end], 0
+	}
+	return items[start:end], page + 1
+}
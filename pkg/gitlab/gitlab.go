@@ -1,53 +1,289 @@
 package gitlab
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"gitlab.com/gitlab-org/api/client-go"
+	"net/http"
 	"strings"
 	"sync"
+	"time"
 )
 
 type Gitlab struct {
 	client *gitlab.Client
+	api    API // what the listing goes through
+
+	listConcurrency int
+	diagnostics     *ListDiagnostics // of the last listing
+}
+
+// SetListConcurrency limits how many requests a listing runs at once, 0 is unlimited
+func (gl *Gitlab) SetListConcurrency(limit int) {
+	gl.listConcurrency = limit
+}
+
+// ListDiagnostics returns how the last listing went, nil before the first one
+func (gl *Gitlab) ListDiagnostics() *ListDiagnostics {
+	return gl.diagnostics
+}
+
+// ListError tells which group and endpoint a listing request failed on, e.g. because it timed out
+type ListError struct {
+	Group    string
+	Endpoint string
+	Err      error
+}
+
+func (e *ListError) Error() string {
+	return fmt.Sprintf("listing group %s failed at %s: %v", e.Group, e.Endpoint, e.Err)
+}
+
+func (e *ListError) Unwrap() error {
+	return e.Err
 }
 
 type Project struct {
-	Path          string
-	DefaultBranch string
-	CloneUrl      string
+	ID            int      `json:"id,omitempty"`
+	Path          string   `json:"path"`
+	DefaultBranch string   `json:"defaultBranch"`
+	CloneUrl      string   `json:"cloneUrl"`
+	HttpUrl       string   `json:"httpUrl"`
+	Topics        []string `json:"topics,omitempty"`
+	WikiEnabled   bool     `json:"wikiEnabled,omitempty"`
+	Wiki          bool     `json:"wiki,omitempty"`     // the wiki repository of the project, planned next to it
+	Archived      bool     `json:"archived,omitempty"` // only synced with IncludeArchived
+	Shared        bool     `json:"shared,omitempty"`   // shared with other groups, only synced with IncludeShared
+
+	LastActivity time.Time `json:"lastActivity,omitzero"`
+	Size         int64     `json:"size,omitempty"` // of the repository in bytes, 0 when Gitlab doesn't share its statistics
+
+	AccessLevel int    `json:"accessLevel,omitempty"` // of the token on the project, 0 when Gitlab doesn't tell
+	Visibility  string `json:"visibility,omitempty"`
+}
+
+// LacksRepositoryAccess tells whether the token can list the project but not read its repository, which private
+// projects only allow reporters and up. Without a known access level it can't be told
+func (p *Project) LacksRepositoryAccess() bool {
+	return p.AccessLevel > 0 && p.AccessLevel < int(gitlab.ReporterPermissions) && p.Visibility == string(gitlab.PrivateVisibility)
 }
 
-func New(url string, token string) (*Gitlab, error) {
-	client, err := gitlab.NewClient(token, gitlab.WithBaseURL(url))
+// Token types, group access tokens authenticate like personal ones but CI_JOB_TOKEN needs its own header
+const (
+	PersonalToken = "pat"
+	GroupToken    = "group"
+	JobToken      = "job"
+)
+
+var (
+	ErrUnauthorized = errors.New("authentication failed, check the token and the token type")
+	ErrMissingScope = errors.New("the token lacks the read_api scope")
+)
+
+// New creates a client whose requests are aborted after requestTimeout, 0 disables the timeout
+func New(url string, token string, tokenType string, requestTimeout time.Duration) (*Gitlab, error) {
+	httpClient := &http.Client{Timeout: requestTimeout}
+	options := []gitlab.ClientOptionFunc{gitlab.WithBaseURL(url), gitlab.WithHTTPClient(httpClient)}
+
+	var client *gitlab.Client
+	var err error
+	switch tokenType {
+	case PersonalToken, GroupToken:
+		client, err = gitlab.NewClient(token, options...)
+	case JobToken:
+		client, err = gitlab.NewJobClient(token, options...)
+	default:
+		return nil, fmt.Errorf("unknown token type %s, use pat, group or job", tokenType)
+	}
 	if err != nil {
 		return nil, err
 	}
 
 	gl := Gitlab{
 		client: client,
+		api:    &clientAPI{client: client},
 	}
 
 	return &gl, nil
 }
 
-func (gl *Gitlab) GetActiveGitlabProjects(groupPath string, progress func(string)) ([]*Project, []error) {
+// NewWithAPI creates a Gitlab that lists projects and takes the remote lock through api, e.g. a fakegitlab.Gitlab
+// in tests. Everything else needs a real client
+func NewWithAPI(api API) *Gitlab {
+	return &Gitlab{api: api}
+}
+
+// CloneUsername is the user that goes with the token when cloning over https
+func CloneUsername(tokenType string) string {
+	if tokenType == JobToken {
+		return "gitlab-ci-token"
+	}
+	return "oauth2"
+}
+
+// CheckToken fetches the group with a single cheap request, so a bad token fails with a clear error
+// instead of somewhere deep in the listing. A missing group is fine, it may be a username. Without a group
+// the version is fetched, which needs a valid token too.
+// Failures caused by the local clock being off are returned as *ClockSkewError
+func (gl *Gitlab) CheckToken(ctx context.Context, groupPath string) error {
+	var resp *gitlab.Response
+	var err error
+	if groupPath == "" {
+		_, resp, err = gl.client.Version.GetVersion(gitlab.WithContext(ctx))
+	} else {
+		_, resp, err = gl.client.Groups.GetGroup(groupPath, &gitlab.GetGroupOptions{WithProjects: gitlab.Ptr(false)}, gitlab.WithContext(ctx))
+	}
+	var httpResp *http.Response
+	if resp != nil {
+		httpResp = resp.Response
+		switch resp.StatusCode {
+		case http.StatusUnauthorized:
+			err = ErrUnauthorized
+		case http.StatusForbidden:
+			return ErrMissingScope
+		case http.StatusNotFound:
+			return nil
+		}
+	}
+	if err != nil {
+		return gl.blameClock(ctx, httpResp, err) // a wrong clock fails tokens and certificates alike
+	}
+	return nil
+}
+
+type Event int
+
+const (
+	GroupDiscovered Event = iota
+	GroupListed
+)
+
+// Progress describes a step of the listing together with the totals so far
+type Progress struct {
+	Event    Event
+	Group    string
+	Projects int // projects in Group, only set for GroupListed
+
+	GroupsSeen    int
+	GroupsListed  int
+	ProjectsFound int
+}
+
+// progressReporter keeps the totals and makes sure the callback is never called concurrently
+type progressReporter struct {
+	mu     sync.Mutex
+	report func(Progress)
+	total  Progress
+}
+
+func (r *progressReporter) discovered(group string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.total.GroupsSeen++
+	r.send(GroupDiscovered, group, 0)
+}
 
-	group, err := getGroupByPath(gl.client, groupPath)
+func (r *progressReporter) listed(group string, projects int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.total.GroupsListed++
+	r.total.ProjectsFound += projects
+	r.send(GroupListed, group, projects)
+}
+
+func (r *progressReporter) send(event Event, group string, projects int) {
+	progress := r.total
+	progress.Event = event
+	progress.Group = group
+	progress.Projects = projects
+	r.report(progress)
+}
+
+// GetActiveGitlabProjects lists all projects below groupPath until ctx is done, descending at most depth levels
+// of subgroups. A negative depth means unlimited.
+// Failing subgroups are reported as *ListError next to the projects that could be listed
+func (gl *Gitlab) GetActiveGitlabProjects(ctx context.Context, groupPath string, depth int, report func(Progress)) ([]*Project, []error) {
+	var result []*Project
+	errs := gl.ListActiveGitlabProjects(ctx, groupPath, depth, report, func(project *Project) {
+		result = append(result, project)
+	})
+	return result, errs
+}
+
+// ListActiveGitlabProjects is GetActiveGitlabProjects handing every project to yield as soon as its page arrived.
+// Pages are converted right away, so the much bigger structs of the API never pile up. yield is never called
+// concurrently, the listing waits while it runs
+func (gl *Gitlab) ListActiveGitlabProjects(ctx context.Context, groupPath string, depth int, report func(Progress), yield func(*Project)) []error {
+	_, errs := gl.ResumeActiveGitlabProjects(ctx, groupPath, depth, nil, report, yield)
+	return errs
+}
+
+// ResumeActiveGitlabProjects is ListActiveGitlabProjects continuing resume, the checkpoint of an earlier listing that
+// failed part way. Endpoints it completed aren't requested again, the others continue after their last listed page.
+// A nil checkpoint or one of another group or depth lists from scratch.
+// The returned checkpoint holds what this listing got done, to resume it in turn
+func (gl *Gitlab) ResumeActiveGitlabProjects(ctx context.Context, groupPath string, depth int, resume *Checkpoint, report func(Progress), yield func(*Project)) (*Checkpoint, []error) {
+	if resume != nil && (resume.Group != groupPath || resume.Depth != depth) {
+		resume = nil
+	}
+	checkpoint := newCheckpoint(groupPath, depth, resume)
+	unchanged := checkpoint // nothing was listed, what there was to resume still is
+	if resume != nil {
+		unchanged = resume
+	}
+
+	group, err := getGroupByPath(ctx, gl.api, groupPath)
 	if err != nil {
-		return nil, []error{err}
+		return unchanged, []error{err}
 	}
 
+	var user *gitlab.User
 	if group == nil {
-		return nil, []error{fmt.Errorf("group %s not found", groupPath)}
+		// Not a group, maybe it's the personal namespace of a user
+		user, err = getUserByUsername(ctx, gl.api, groupPath)
+		if err != nil {
+			return unchanged, []error{err}
+		}
 	}
 
-	var resChan = make(chan *gitlab.Project)
-	var errChan = make(chan error)
+	if group == nil && user == nil {
+		return unchanged, []error{fmt.Errorf("group %s not found", groupPath)}
+	}
 
-	var pwg sync.WaitGroup
-	listProjectsRecursively(gl.client, group, progress, resChan, errChan, &pwg)
+	l := gl.newLister(ctx, groupPath, report, resume, checkpoint)
+	if group != nil {
+		l.listProjectsRecursively(&ListedGroup{ID: group.ID, FullPath: group.FullPath}, depth)
+	} else {
+		l.listUserProjects(user)
+	}
+	return checkpoint, l.collect(yield)
+}
 
-	var result []*Project
+// newLister prepares a listing whose project paths are relative to root, the diagnostics start over with it
+func (gl *Gitlab) newLister(ctx context.Context, root string, report func(Progress), resume *Checkpoint, checkpoint *Checkpoint) *lister {
+	gl.diagnostics = &ListDiagnostics{Limit: max(gl.listConcurrency, 0)}
+	l := &lister{
+		ctx:         ctx,
+		api:         gl.api,
+		root:        root,
+		progress:    &progressReporter{report: report},
+		resume:      resume,
+		checkpoint:  checkpoint,
+		diagnostics: gl.diagnostics,
+		resChan:     make(chan *Project),
+		errChan:     make(chan error),
+	}
+	if gl.listConcurrency > 0 {
+		l.requests = make(chan struct{}, gl.listConcurrency)
+	}
+	return l
+}
+
+// collect hands the listed projects to yield until the listing is done, returning the errors it ran into
+func (l *lister) collect(yield func(*Project)) []error {
 	var errors []error
 
 	var cwg sync.WaitGroup
@@ -56,41 +292,92 @@ func (gl *Gitlab) GetActiveGitlabProjects(groupPath string, progress func(string
 	go func() {
 		defer cwg.Done()
 
-		pwg.Wait()
-		close(resChan)
-		close(errChan)
+		l.wg.Wait()
+		close(l.resChan)
+		close(l.errChan)
 	}()
 
 	go func() {
 		defer cwg.Done()
 
-		for project := range resChan {
-			if !project.Archived && len(project.SharedWithGroups) == 0 {
-				result = append(result, &Project{
-					Path:          strings.TrimPrefix(project.PathWithNamespace, groupPath+"/"),
-					DefaultBranch: project.DefaultBranch,
-					CloneUrl:      project.SSHURLToRepo,
-				})
-			}
+		for project := range l.resChan {
+			yield(project)
 		}
 	}()
 
 	go func() {
 		defer cwg.Done()
 
-		for err := range errChan {
+		for err := range l.errChan {
 			errors = append(errors, err)
 		}
 	}()
 
 	cwg.Wait()
-	return result, errors
+	return errors
+}
+
+// toProject keeps what gls needs of a listed project. Archived and shared projects are kept too,
+// whether they are synced is up to the planner
+func toProject(project *gitlab.Project, root string) *Project {
+	return &Project{
+		ID:            project.ID,
+		Path:          strings.TrimPrefix(project.PathWithNamespace, root+"/"),
+		DefaultBranch: project.DefaultBranch,
+		CloneUrl:      project.SSHURLToRepo,
+		HttpUrl:       project.HTTPURLToRepo,
+		Topics:        project.Topics,
+		WikiEnabled:   wikiEnabled(project),
+		Archived:      project.Archived,
+		Shared:        len(project.SharedWithGroups) > 0,
+		LastActivity:  lastActivity(project),
+		Size:          repositorySize(project),
+		AccessLevel:   accessLevel(project),
+		Visibility:    string(project.Visibility),
+	}
+}
+
+// accessLevel is the higher of the access the token has on the project itself and on its group
+func accessLevel(project *gitlab.Project) int {
+	if project.Permissions == nil {
+		return 0
+	}
+	level := 0
+	if project.Permissions.ProjectAccess != nil {
+		level = int(project.Permissions.ProjectAccess.AccessLevel)
+	}
+	if project.Permissions.GroupAccess != nil {
+		level = max(level, int(project.Permissions.GroupAccess.AccessLevel))
+	}
+	return level
+}
+
+func lastActivity(project *gitlab.Project) time.Time {
+	if project.LastActivityAt == nil {
+		return time.Time{}
+	}
+	return *project.LastActivityAt
 }
 
-func getGroupByPath(gl *gitlab.Client, path string) (*gitlab.Group, error) {
-	groups, _, err := gl.Groups.SearchGroup(path)
+// repositorySize is only known when the token may read the statistics of the project, reporters and up
+func repositorySize(project *gitlab.Project) int64 {
+	if project.Statistics == nil {
+		return 0
+	}
+	return project.Statistics.RepositorySize
+}
+
+func wikiEnabled(project *gitlab.Project) bool {
+	if project.WikiAccessLevel != "" {
+		return project.WikiAccessLevel != gitlab.DisabledAccessControl
+	}
+	return project.WikiEnabled // older instances only send the deprecated flag
+}
+
+func getGroupByPath(ctx context.Context, api API, path string) (*gitlab.Group, error) {
+	groups, err := api.SearchGroup(ctx, path)
 	if err != nil {
-		return nil, err
+		return nil, &ListError{Group: path, Endpoint: "groups?search", Err: err}
 	}
 
 	for _, group := range groups {
@@ -102,31 +389,169 @@ func getGroupByPath(gl *gitlab.Client, path string) (*gitlab.Group, error) {
 	return nil, nil
 }
 
-func listProjectsRecursively(gl *gitlab.Client, group *gitlab.Group, progress func(string), resChan chan *gitlab.Project, errChan chan error, wg *sync.WaitGroup) {
-	progress(group.FullPath)
-	wg.Add(2)
+func getUserByUsername(ctx context.Context, api API, username string) (*gitlab.User, error) {
+	users, err := api.ListUsers(ctx, username)
+	if err != nil {
+		return nil, &ListError{Group: username, Endpoint: "users?username", Err: err}
+	}
+
+	for _, user := range users {
+		if user.Username == username {
+			return user, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// listPageSize is the most projects or subgroups Gitlab returns per request
+const listPageSize = 100
+
+// lister walks a group and its subgroups concurrently, every endpoint is listed in a goroutine of its own.
+// The requests they make wait for a slot in requests, unless it is nil
+type lister struct {
+	ctx         context.Context
+	api         API
+	root        string
+	progress    *progressReporter
+	resume      *Checkpoint // of an earlier listing, read only
+	checkpoint  *Checkpoint // of this listing
+	requests    chan struct{}
+	diagnostics *ListDiagnostics
+	resChan     chan *Project
+	errChan     chan error
+	wg          sync.WaitGroup
+}
+
+// request runs a single API request once a slot is free
+func (l *lister) request(call func() error) error {
+	start := time.Now()
+	if l.requests != nil {
+		select {
+		case l.requests <- struct{}{}:
+		case <-l.ctx.Done():
+			return l.ctx.Err()
+		}
+		defer func() { <-l.requests }()
+	}
+
+	l.diagnostics.QueueWait.Observe(time.Since(start))
+	l.diagnostics.requestStarted()
+	defer l.diagnostics.requestFinished()
+	return call()
+}
+
+// projectPage converts a page of projects, so only what gls needs of them is kept
+func (l *lister) projectPage(projects []*gitlab.Project, next int) *EndpointProgress {
+	page := &EndpointProgress{NextPage: next}
+	for _, project := range projects {
+		page.Projects = append(page.Projects, toProject(project, l.root))
+	}
+	return page
+}
+
+// sendPage sends the projects of a page on, returning how many projects the page had
+func (l *lister) sendPage(page *EndpointProgress) int {
+	for _, project := range page.Projects {
+		l.resChan <- project
+	}
+	return len(page.Projects)
+}
+
+func (l *lister) listUserProjects(user *gitlab.User) {
+	l.progress.discovered(user.Username)
+	l.wg.Add(1)
+	l.diagnostics.Goroutines.Add(1)
 
 	go func() {
-		defer wg.Done()
-		projects, _, err := gl.Groups.ListGroupProjects(group.ID, nil)
+		defer l.wg.Done()
+
+		projectCount := 0
+		endpoint := fmt.Sprintf("users/%d/projects", user.ID)
+		err := l.listPages(endpoint, func(page int) (*EndpointProgress, error) {
+			var projects []*gitlab.Project
+			var next int
+			err := l.request(func() (err error) {
+				projects, next, err = l.api.ListUserProjects(l.ctx, user.ID, page)
+				return err
+			})
+			return l.projectPage(projects, next), err
+		}, func(page *EndpointProgress) {
+			projectCount += l.sendPage(page)
+		})
 		if err != nil {
-			errChan <- err
+			l.errChan <- &ListError{Group: user.Username, Endpoint: endpoint, Err: err}
 		}
+		l.progress.listed(user.Username, projectCount)
+	}()
+}
 
-		for _, project := range projects {
-			resChan <- project
-		}
+func (l *lister) listProjectsRecursively(group *ListedGroup, depth int) {
+	l.progress.discovered(group.FullPath)
+	l.wg.Add(3)
+	l.diagnostics.Goroutines.Add(3)
+	start := time.Now()
+
+	// The group counts as listed once both its projects and subgroups are, so subgroups are always discovered first
+	var gwg sync.WaitGroup
+	gwg.Add(2)
+	projectCount := 0
+
+	go func() {
+		defer l.wg.Done()
+		gwg.Wait()
+		l.diagnostics.groupListed(group.FullPath, time.Since(start))
+		l.progress.listed(group.FullPath, projectCount)
 	}()
 
 	go func() {
-		defer wg.Done()
-		subgroups, _, err := gl.Groups.ListSubGroups(group.ID, nil)
+		defer l.wg.Done()
+		defer gwg.Done()
+
+		endpoint := fmt.Sprintf("groups/%d/projects", group.ID)
+		err := l.listPages(endpoint, func(page int) (*EndpointProgress, error) {
+			var projects []*gitlab.Project
+			var next int
+			err := l.request(func() (err error) {
+				projects, next, err = l.api.ListGroupProjects(l.ctx, group.ID, page)
+				return err
+			})
+			return l.projectPage(projects, next), err
+		}, func(page *EndpointProgress) {
+			projectCount += l.sendPage(page)
+		})
 		if err != nil {
-			errChan <- err
+			l.errChan <- &ListError{Group: group.FullPath, Endpoint: endpoint, Err: err}
+		}
+	}()
+
+	go func() {
+		defer l.wg.Done()
+		defer gwg.Done()
+		if depth == 0 {
+			return // deep enough
 		}
 
-		for _, subgroup := range subgroups {
-			listProjectsRecursively(gl, subgroup, progress, resChan, errChan, wg)
+		endpoint := fmt.Sprintf("groups/%d/subgroups", group.ID)
+		err := l.listPages(endpoint, func(page int) (*EndpointProgress, error) {
+			var subgroups []*gitlab.Group
+			var next int
+			err := l.request(func() (err error) {
+				subgroups, next, err = l.api.ListSubGroups(l.ctx, group.ID, page)
+				return err
+			})
+			listed := &EndpointProgress{NextPage: next}
+			for _, subgroup := range subgroups {
+				listed.Subgroups = append(listed.Subgroups, &ListedGroup{ID: subgroup.ID, FullPath: subgroup.FullPath})
+			}
+			return listed, err
+		}, func(page *EndpointProgress) {
+			for _, subgroup := range page.Subgroups {
+				l.listProjectsRecursively(subgroup, depth-1)
+			}
+		})
+		if err != nil {
+			l.errChan <- &ListError{Group: group.FullPath, Endpoint: endpoint, Err: err}
 		}
 	}()
 }
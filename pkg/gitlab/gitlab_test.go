@@ -0,0 +1,197 @@
+package gitlab_test
+
+import (
+	"context"
+	"errors"
+	gls "gls/pkg/gitlab"
+	"gls/pkg/gitlab/fakegitlab"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// list lists groupPath and returns the projects by path, failing the test on projects listed twice
+func list(t *testing.T, fake *fakegitlab.Gitlab, groupPath string, depth int) (map[string]*gls.Project, []error) {
+	t.Helper()
+	projects, errs := gls.NewWithAPI(fake).GetActiveGitlabProjects(context.Background(), groupPath, depth, func(gls.Progress) {})
+
+	byPath := make(map[string]*gls.Project, len(projects))
+	for _, project := range projects {
+		if byPath[project.Path] != nil {
+			t.Errorf("%s was listed twice", project.Path)
+		}
+		byPath[project.Path] = project
+	}
+	return byPath, errs
+}
+
+func paths(projects map[string]*gls.Project) []string {
+	result := make([]string, 0, len(projects))
+	for path := range projects {
+		result = append(result, path)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func TestListingTraversal(t *testing.T) {
+	fake := fakegitlab.New()
+	fake.AddProject("acme/api")
+	fake.AddProject("acme/web")
+	fake.AddProject("acme/docs") // a third project puts it on a second page
+	fake.AddProject("acme/team-x/svc")
+	fake.AddProject("acme/team-x/deep/down/tool")
+	fake.AddProject("acme/team-y/lib")
+	fake.AddProject("other/unrelated")
+
+	tests := []struct {
+		name  string
+		group string
+		depth int
+		want  []string
+	}{
+		{name: "unlimited", group: "acme", depth: -1, want: []string{"api", "docs", "team-x/deep/down/tool", "team-x/svc", "team-y/lib", "web"}},
+		{name: "only the group", group: "acme", depth: 0, want: []string{"api", "docs", "web"}},
+		{name: "one level", group: "acme", depth: 1, want: []string{"api", "docs", "team-x/svc", "team-y/lib", "web"}},
+		{name: "subgroup", group: "acme/team-x", depth: -1, want: []string{"deep/down/tool", "svc"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			projects, errs := list(t, fake, test.group, test.depth)
+			if len(errs) > 0 {
+				t.Fatal(errs)
+			}
+			if got := paths(projects); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestListingKeepsProjectDetails(t *testing.T) {
+	fake := fakegitlab.New()
+	fake.AddProject("acme/api", fakegitlab.DefaultBranch("develop"), fakegitlab.Topics("go", "critical"))
+
+	projects, errs := list(t, fake, "acme", -1)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	api := projects["api"]
+	if api == nil {
+		t.Fatalf("api wasn't listed: %q", paths(projects))
+	}
+	if api.DefaultBranch != "develop" || !reflect.DeepEqual(api.Topics, []string{"go", "critical"}) {
+		t.Errorf("got branch %s and topics %q", api.DefaultBranch, api.Topics)
+	}
+	if api.CloneUrl != "git@gitlab.example.com:acme/api.git" || api.HttpUrl != "https://gitlab.example.com/acme/api.git" {
+		t.Errorf("got clone urls %s and %s", api.CloneUrl, api.HttpUrl)
+	}
+}
+
+func TestListingArchivedAndShared(t *testing.T) {
+	fake := fakegitlab.New()
+	fake.AddProject("acme/active")
+	fake.AddProject("acme/old", fakegitlab.Archived())
+	fake.AddProject("acme/common", fakegitlab.SharedWith("partner"))
+	fake.AddProject("acme/team/both", fakegitlab.Archived(), fakegitlab.SharedWith("partner"))
+
+	// The listing keeps them all, the planner decides whether they are synced
+	tests := []struct {
+		path     string
+		archived bool
+		shared   bool
+	}{
+		{path: "active"},
+		{path: "old", archived: true},
+		{path: "common", shared: true},
+		{path: "team/both", archived: true, shared: true},
+	}
+
+	projects, errs := list(t, fake, "acme", -1)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if len(projects) != len(tests) {
+		t.Fatalf("got %q", paths(projects))
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			project := projects[test.path]
+			if project == nil {
+				t.Fatal("not listed")
+			}
+			if project.Archived != test.archived || project.Shared != test.shared {
+				t.Errorf("got archived %v and shared %v, want %v and %v", project.Archived, project.Shared, test.archived, test.shared)
+			}
+		})
+	}
+}
+
+func TestListingGroupNotFound(t *testing.T) {
+	fake := fakegitlab.New()
+	fake.AddProject("acme/api")
+
+	tests := []struct {
+		name  string
+		group string
+	}{
+		{name: "missing", group: "nope"},
+		{name: "only a prefix of a group", group: "acm"},
+		{name: "missing subgroup", group: "acme/nope"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			projects, errs := list(t, fake, test.group, -1)
+			if len(projects) > 0 {
+				t.Errorf("listed %q", paths(projects))
+			}
+			if len(errs) != 1 || !strings.Contains(errs[0].Error(), "group "+test.group+" not found") {
+				t.Errorf("got errors %v", errs)
+			}
+		})
+	}
+}
+
+func TestListingUserNamespace(t *testing.T) {
+	fake := fakegitlab.New()
+	fake.AddGroup("acme")
+	fake.AddUserProject("jane", "dotfiles")
+	fake.AddUserProject("jane", "notes")
+	fake.AddUserProject("jane", "scratch")
+	fake.AddUserProject("john", "other")
+
+	projects, errs := list(t, fake, "jane", -1)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if got, want := paths(projects), []string{"dotfiles", "notes", "scratch"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if fake.Calls("ListSubGroups") != 0 {
+		t.Errorf("a user has no subgroups to list")
+	}
+}
+
+func TestListingFailingSubgroup(t *testing.T) {
+	fake := fakegitlab.New()
+	fake.AddProject("acme/api")
+	fake.AddProject("acme/broken/svc")
+	fake.Fail("acme/broken", errors.New("boom"))
+
+	projects, errs := list(t, fake, "acme", -1)
+	if got := paths(projects); !reflect.DeepEqual(got, []string{"api"}) {
+		t.Errorf("got %q", got)
+	}
+	if len(errs) == 0 {
+		t.Fatal("the failing subgroup wasn't reported")
+	}
+	for _, err := range errs {
+		var listErr *gls.ListError
+		if !errors.As(err, &listErr) || listErr.Group != "acme/broken" {
+			t.Errorf("got %v, want a ListError of acme/broken", err)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package gitlab
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gitlab.com/gitlab-org/api/client-go"
+	"net/http"
+	"time"
+)
+
+// ErrLockConflict means the lock file changed between reading and writing it, someone else got there first
+var ErrLockConflict = errors.New("the lock file was changed concurrently")
+
+// LockHeldError tells who holds the lock and until when, in the time of the Gitlab server
+type LockHeldError struct {
+	Holder  string
+	Expires time.Time
+}
+
+func (e *LockHeldError) Error() string {
+	return fmt.Sprintf("locked by %s until %s", e.Holder, e.Expires.Local().Format("2006-01-02 15:04:05"))
+}
+
+// Lease is the content of the lock file. Times are those of the Gitlab server, so machines with skewed clocks agree
+type Lease struct {
+	Holder   string    `json:"holder"`
+	Acquired time.Time `json:"acquired"`
+	Expires  time.Time `json:"expires"`
+}
+
+// RemoteLock is a lease stored in a file of a Gitlab project. Every write is a commit that only succeeds if the file
+// is still at the commit it was last seen at, which makes it a compare-and-swap
+type RemoteLock struct {
+	api     API
+	project string
+	file    string
+	branch  string
+	holder  string
+	lease   time.Duration
+
+	commit string        // the last commit of the lock file, written by us while the lock is held
+	skew   time.Duration // server time minus local time
+}
+
+// NewRemoteLock prepares a lock on file in the default branch of project, held by holder for lease at a time
+func (gl *Gitlab) NewRemoteLock(ctx context.Context, project string, file string, holder string, lease time.Duration) (*RemoteLock, error) {
+	p, err := gl.api.GetProjectByPath(ctx, project)
+	if err != nil {
+		return nil, fmt.Errorf("lock project %s: %w", project, err)
+	}
+	if p.DefaultBranch == "" {
+		return nil, fmt.Errorf("lock project %s is empty, it needs a commit to have a branch", project)
+	}
+
+	return &RemoteLock{
+		api:     gl.api,
+		project: project,
+		file:    file,
+		branch:  p.DefaultBranch,
+		holder:  holder,
+		lease:   lease,
+	}, nil
+}
+
+// Acquire takes the lock if nobody holds it, its lease expired or we already hold it.
+// Returns a *LockHeldError if someone else holds it and ErrLockConflict if someone else was faster
+func (l *RemoteLock) Acquire(ctx context.Context) error {
+	file, serverNow, err := l.api.GetFile(ctx, l.project, l.file, l.branch)
+	if err != nil {
+		return err
+	}
+	l.skew = time.Until(serverNow)
+
+	action, lastCommit := gitlab.FileCreate, ""
+	if file != nil {
+		lease, err := decodeLease(file)
+		if err != nil {
+			return err
+		}
+		if lease.Holder != l.holder && l.now().Before(lease.Expires) {
+			return &LockHeldError{Holder: lease.Holder, Expires: lease.Expires}
+		}
+		action, lastCommit = gitlab.FileUpdate, file.LastCommitID
+	}
+
+	now := l.now()
+	return l.write(ctx, action, lastCommit, &Lease{Holder: l.holder, Acquired: now, Expires: now.Add(l.lease)}, "Acquire")
+}
+
+// Renew extends the lease. ErrLockConflict means the lock was taken over, most likely because the lease expired
+func (l *RemoteLock) Renew(ctx context.Context) error {
+	now := l.now()
+	return l.write(ctx, gitlab.FileUpdate, l.commit, &Lease{Holder: l.holder, Acquired: now, Expires: now.Add(l.lease)}, "Renew")
+}
+
+// Release removes the lock file, unless someone else took over the lock meanwhile
+func (l *RemoteLock) Release(ctx context.Context) error {
+	return l.write(ctx, gitlab.FileDelete, l.commit, nil, "Release")
+}
+
+func (l *RemoteLock) write(ctx context.Context, action gitlab.FileActionValue, lastCommit string, lease *Lease, verb string) error {
+	commitAction := &gitlab.CommitActionOptions{
+		Action:   gitlab.Ptr(action),
+		FilePath: gitlab.Ptr(l.file),
+	}
+	if lastCommit != "" {
+		commitAction.LastCommitID = gitlab.Ptr(lastCommit)
+	}
+	if lease != nil {
+		content, err := json.MarshalIndent(lease, "", "  ")
+		if err != nil {
+			return err
+		}
+		commitAction.Content = gitlab.Ptr(string(content))
+	}
+
+	commit, err := l.api.CreateCommit(ctx, l.project, &gitlab.CreateCommitOptions{
+		Branch:        gitlab.Ptr(l.branch),
+		CommitMessage: gitlab.Ptr(fmt.Sprintf("%s gls lock for %s", verb, l.holder)),
+		Actions:       []*gitlab.CommitActionOptions{commitAction},
+	})
+	if err != nil {
+		return err
+	}
+
+	l.commit = commit.ID
+	return nil
+}
+
+// now is the current time of the Gitlab server, as far as it is known
+func (l *RemoteLock) now() time.Time {
+	return time.Now().Add(l.skew).UTC().Truncate(time.Second)
+}
+
+func decodeLease(file *gitlab.File) (*Lease, error) {
+	content, err := base64.StdEncoding.DecodeString(file.Content)
+	if err != nil {
+		return nil, fmt.Errorf("lock file %s: %w", file.FilePath, err)
+	}
+
+	var lease Lease
+	err = json.Unmarshal(content, &lease)
+	if err != nil {
+		return nil, fmt.Errorf("lock file %s: %w", file.FilePath, err)
+	}
+	return &lease, nil
+}
+
+// serverTime reads the Date header of a response, falling back to the local time without one
+func serverTime(resp *gitlab.Response) time.Time {
+	date, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return time.Now()
+	}
+	return date
+}
@@ -0,0 +1,294 @@
+package gitlab_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	gls "gls/pkg/gitlab"
+	"gls/pkg/gitlab/fakegitlab"
+	"testing"
+	"time"
+)
+
+const lockProject, lockFile = "ops/locks", "gls.lock"
+
+// holder reads who holds the lock from the lock file, empty without one
+func holder(t *testing.T, fake *fakegitlab.Gitlab) string {
+	t.Helper()
+	content, ok := fake.File(lockProject, lockFile)
+	if !ok {
+		return ""
+	}
+	var lease gls.Lease
+	if err := json.Unmarshal([]byte(content), &lease); err != nil {
+		t.Fatal(err)
+	}
+	return lease.Holder
+}
+
+func TestRemoteLock(t *testing.T) {
+	type step struct {
+		op     string // acquire, renew or release by holder, race to let holder take the lock before the next commit, or expire
+		holder string
+		want   string // the error, empty for none
+	}
+
+	tests := []struct {
+		name   string
+		steps  []step
+		holder string // of the lock file at the end, empty if there is none
+	}{
+		{
+			name:   "free",
+			steps:  []step{{op: "acquire", holder: "a"}},
+			holder: "a",
+		},
+		{
+			name: "held",
+			steps: []step{
+				{op: "acquire", holder: "a"},
+				{op: "acquire", holder: "b", want: "locked by a"},
+			},
+			holder: "a",
+		},
+		{
+			name: "acquired again by its holder",
+			steps: []step{
+				{op: "acquire", holder: "a"},
+				{op: "acquire", holder: "a"},
+				{op: "renew", holder: "a"},
+			},
+			holder: "a",
+		},
+		{
+			name: "renewed",
+			steps: []step{
+				{op: "acquire", holder: "a"},
+				{op: "renew", holder: "a"},
+				{op: "renew", holder: "a"},
+				{op: "acquire", holder: "b", want: "locked by a"},
+			},
+			holder: "a",
+		},
+		{
+			name: "released",
+			steps: []step{
+				{op: "acquire", holder: "a"},
+				{op: "release", holder: "a"},
+			},
+		},
+		{
+			name: "released and taken",
+			steps: []step{
+				{op: "acquire", holder: "a"},
+				{op: "release", holder: "a"},
+				{op: "acquire", holder: "b"},
+			},
+			holder: "b",
+		},
+		{
+			name: "taken over once expired",
+			steps: []step{
+				{op: "acquire", holder: "a"},
+				{op: "expire"},
+				{op: "acquire", holder: "b"},
+			},
+			holder: "b",
+		},
+		{
+			name: "renewal lost after a takeover",
+			steps: []step{
+				{op: "acquire", holder: "a"},
+				{op: "expire"},
+				{op: "acquire", holder: "b"},
+				{op: "renew", holder: "a", want: "changed concurrently"},
+				{op: "acquire", holder: "a", want: "locked by b"},
+			},
+			holder: "b",
+		},
+		{
+			name: "release after a takeover leaves the lock alone",
+			steps: []step{
+				{op: "acquire", holder: "a"},
+				{op: "expire"},
+				{op: "acquire", holder: "b"},
+				{op: "release", holder: "a", want: "changed concurrently"},
+			},
+			holder: "b",
+		},
+		{
+			name: "renewal lost after a release",
+			steps: []step{
+				{op: "acquire", holder: "a"},
+				{op: "release", holder: "a"},
+				{op: "renew", holder: "a", want: "changed concurrently"},
+			},
+		},
+		{
+			name: "conflict creating the lock file",
+			steps: []step{
+				{op: "race", holder: "b"},
+				{op: "acquire", holder: "a", want: "changed concurrently"},
+				{op: "acquire", holder: "a", want: "locked by b"},
+			},
+			holder: "b",
+		},
+		{
+			name: "conflict taking over",
+			steps: []step{
+				{op: "acquire", holder: "a"},
+				{op: "expire"},
+				{op: "race", holder: "c"},
+				{op: "acquire", holder: "b", want: "changed concurrently"},
+				{op: "acquire", holder: "b", want: "locked by c"},
+			},
+			holder: "c",
+		},
+		{
+			name: "conflict renewing",
+			steps: []step{
+				{op: "acquire", holder: "a"},
+				{op: "expire"},
+				{op: "race", holder: "b"},
+				{op: "renew", holder: "a", want: "changed concurrently"},
+			},
+			holder: "b",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			fake := fakegitlab.New()
+			fake.AddProject(lockProject)
+			var skew time.Duration
+			fake.Now = func() time.Time {
+				return time.Now().Add(skew)
+			}
+			gl := gls.NewWithAPI(fake)
+
+			locks := make(map[string]*gls.RemoteLock)
+			lock := func(holder string) *gls.RemoteLock {
+				if locks[holder] == nil {
+					var err error
+					locks[holder], err = gl.NewRemoteLock(ctx, lockProject, lockFile, holder, time.Minute)
+					if err != nil {
+						t.Fatal(err)
+					}
+				}
+				return locks[holder]
+			}
+
+			for i, step := range test.steps {
+				var err error
+				switch step.op {
+				case "acquire":
+					err = lock(step.holder).Acquire(ctx)
+				case "renew":
+					err = lock(step.holder).Renew(ctx)
+				case "release":
+					err = lock(step.holder).Release(ctx)
+				case "expire":
+					// Only the server moves on, as if the holder hadn't renewed for longer than the lease
+					skew += 2 * time.Minute
+				case "race":
+					racer := lock(step.holder)
+					fake.BeforeCommit = func() {
+						fake.BeforeCommit = nil
+						if err := racer.Acquire(ctx); err != nil {
+							t.Errorf("%s lost the race it was meant to win: %v", step.holder, err)
+						}
+					}
+				}
+
+				switch {
+				case step.want == "" && err != nil:
+					t.Fatalf("step %d, %s by %s: %v", i, step.op, step.holder, err)
+				case step.want != "" && (err == nil || !matches(err, step.want)):
+					t.Fatalf("step %d, %s by %s: got %v, want %s", i, step.op, step.holder, err, step.want)
+				}
+			}
+
+			if got := holder(t, fake); got != test.holder {
+				t.Errorf("the lock file is held by %q, want %q", got, test.holder)
+			}
+		})
+	}
+}
+
+// matches tells whether err is the one a step wants
+func matches(err error, want string) bool {
+	var held *gls.LockHeldError
+	if errors.As(err, &held) {
+		return "locked by "+held.Holder == want
+	}
+	return errors.Is(err, gls.ErrLockConflict) && want == "changed concurrently"
+}
+
+// TestRemoteLockServerTime checks that leases are in the time of the Gitlab server, however wrong the local clock is
+func TestRemoteLockServerTime(t *testing.T) {
+	ctx := context.Background()
+	fake := fakegitlab.New()
+	fake.AddProject(lockProject)
+	fake.Now = func() time.Time {
+		return time.Now().Add(-3 * time.Hour)
+	}
+	gl := gls.NewWithAPI(fake)
+
+	first, err := gl.NewRemoteLock(ctx, lockProject, lockFile, "a", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := first.Acquire(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	content, _ := fake.File(lockProject, lockFile)
+	var lease gls.Lease
+	if err := json.Unmarshal([]byte(content), &lease); err != nil {
+		t.Fatal(err)
+	}
+	if since := fake.Now().Sub(lease.Acquired); since < 0 || since > 2*time.Second {
+		t.Errorf("acquired at %s, the server says it is %s", lease.Acquired, fake.Now())
+	}
+	if lease.Expires.Sub(lease.Acquired) != time.Minute {
+		t.Errorf("leased from %s to %s", lease.Acquired, lease.Expires)
+	}
+
+	// Hours behind the local clock, the lease is still running for the server
+	second, err := gl.NewRemoteLock(ctx, lockProject, lockFile, "b", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var held *gls.LockHeldError
+	if err := second.Acquire(ctx); !errors.As(err, &held) || !held.Expires.Equal(lease.Expires) {
+		t.Errorf("got %v, want it held until %s", err, lease.Expires)
+	}
+}
+
+func TestNewRemoteLock(t *testing.T) {
+	ctx := context.Background()
+	fake := fakegitlab.New()
+	fake.AddProject("ops/empty", fakegitlab.DefaultBranch(""))
+	fake.AddProject("broken/locks")
+	fake.Fail("broken", errors.New("503 Service Unavailable"))
+	gl := gls.NewWithAPI(fake)
+
+	tests := []struct {
+		project string
+		err     string
+	}{
+		{project: "ops/missing", err: "lock project ops/missing: 404 Project Not Found"},
+		{project: "ops/empty", err: "lock project ops/empty is empty, it needs a commit to have a branch"},
+		{project: "broken/locks", err: "lock project broken/locks: 503 Service Unavailable"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.project, func(t *testing.T) {
+			_, err := gl.NewRemoteLock(ctx, test.project, lockFile, "a", time.Minute)
+			if err == nil || err.Error() != test.err {
+				t.Errorf("got %v, want %s", err, test.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package gitlab
+
+import (
+	"context"
+	"errors"
+	"gitlab.com/gitlab-org/api/client-go"
+	"net/http"
+	"strings"
+)
+
+// Namespace is a group or user a project lives in, directly or further up
+type Namespace struct {
+	FullPath string
+	User     bool // the personal namespace of a user, it has no subgroups
+	Projects int  // projects within it including subgroups, -1 when Gitlab doesn't tell
+}
+
+// ProjectNamespaces returns the namespaces above a project, the outermost first, with how many projects they hold.
+// Groups further up that the token can't read are left out, they can't be synced anyway
+func (gl *Gitlab) ProjectNamespaces(ctx context.Context, projectPath string) ([]*Namespace, error) {
+	project, _, err := gl.client.Projects.GetProject(projectPath, nil, gitlab.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if project.Namespace == nil {
+		return nil, errors.New("gitlab didn't tell the namespace of " + projectPath)
+	}
+
+	if project.Namespace.Kind == "user" {
+		opt := &gitlab.ListProjectsOptions{ListOptions: gitlab.ListOptions{PerPage: 1}}
+		projects, resp, err := gl.client.Projects.ListUserProjects(project.Namespace.FullPath, opt, gitlab.WithContext(ctx))
+		if err != nil {
+			return nil, err
+		}
+		return []*Namespace{{FullPath: project.Namespace.FullPath, User: true, Projects: totalItems(resp, len(projects))}}, nil
+	}
+
+	var namespaces []*Namespace
+	segments := strings.Split(project.Namespace.FullPath, "/")
+	for i := range segments {
+		fullPath := strings.Join(segments[:i+1], "/")
+		opt := &gitlab.ListGroupProjectsOptions{IncludeSubGroups: gitlab.Ptr(true), ListOptions: gitlab.ListOptions{PerPage: 1}}
+		projects, resp, err := gl.client.Groups.ListGroupProjects(fullPath, opt, gitlab.WithContext(ctx))
+		if resp != nil && (resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusForbidden) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		namespaces = append(namespaces, &Namespace{FullPath: fullPath, Projects: totalItems(resp, len(projects))})
+	}
+	return namespaces, nil
+}
+
+// totalItems is the number of items of a paged listing, Gitlab leaves it out for more than 10000 of them
+func totalItems(resp *gitlab.Response, listed int) int {
+	if resp.TotalItems == 0 && listed > 0 {
+		return -1
+	}
+	return resp.TotalItems
+}
@@ -0,0 +1,50 @@
+package gitlab
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+const versionEndpoint = "/api/v4/version"
+
+// DetectMove follows permanent redirects of the GitLab API and returns the URL the instance moved to.
+// Returns an empty string if the instance did not move
+func DetectMove(baseUrl string) (string, error) {
+	client := &http.Client{
+		Timeout: 30 * time.Second,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse // look at every hop ourselves
+		},
+	}
+
+	start := strings.TrimSuffix(baseUrl, "/")
+	current := start
+	for hops := 0; hops < 10; hops++ {
+		resp, err := client.Get(current + versionEndpoint)
+		if err != nil {
+			return "", err
+		}
+		_ = resp.Body.Close()
+
+		if resp.StatusCode != http.StatusMovedPermanently && resp.StatusCode != http.StatusPermanentRedirect {
+			break // temporary redirects don't mean the instance moved
+		}
+
+		location, err := resp.Location()
+		if err != nil {
+			return "", err
+		}
+
+		next, ok := strings.CutSuffix(location.String(), versionEndpoint)
+		if !ok {
+			break // redirected somewhere that isn't the API, e.g. a login page
+		}
+		current = strings.TrimSuffix(next, "/")
+	}
+
+	if current == start {
+		return "", nil
+	}
+	return current, nil
+}
@@ -0,0 +1,68 @@
+package gitlab_test
+
+import (
+	gls "gls/pkg/gitlab"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDetectMove(t *testing.T) {
+	// Each instance answers the version endpoint below its prefix, or redirects it
+	redirects := map[string]struct {
+		status   int
+		location string
+	}{
+		"/old":       {http.StatusMovedPermanently, "/new"},
+		"/chained":   {http.StatusPermanentRedirect, "/old"},
+		"/trailing":  {http.StatusMovedPermanently, "/new/"},
+		"/temporary": {http.StatusFound, "/new"},
+		"/login":     {http.StatusMovedPermanently, "/users/sign_in"},
+		"/loop":      {http.StatusMovedPermanently, "/loop"},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for prefix, redirect := range redirects {
+			if r.URL.Path == prefix+"/api/v4/version" {
+				location := redirect.location
+				if location != "/users/sign_in" {
+					location += "/api/v4/version"
+				}
+				http.Redirect(w, r, location, redirect.status)
+				return
+			}
+		}
+		_, _ = w.Write([]byte(`{"version": "17.0.0"}`))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		base string
+		want string
+	}{
+		{base: "/new"},
+		{base: "/old", want: "/new"},
+		{base: "/old/", want: "/new"},
+		{base: "/chained", want: "/new"},
+		{base: "/trailing", want: "/new"},
+		{base: "/temporary"},
+		{base: "/login"},
+		{base: "/loop"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.base, func(t *testing.T) {
+			want := ""
+			if test.want != "" {
+				want = server.URL + test.want
+			}
+			got, err := gls.DetectMove(server.URL + test.base)
+			if err != nil || got != want {
+				t.Errorf("got %q, %v, want %q", got, err, want)
+			}
+		})
+	}
+
+	if _, err := gls.DetectMove("http://127.0.0.1:1"); err == nil {
+		t.Error("an unreachable instance isn't reported")
+	}
+}
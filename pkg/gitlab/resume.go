@@ -0,0 +1,140 @@
+package gitlab
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Checkpoint is how far a listing got, so a listing that failed part way can be resumed by the next run.
+// Endpoints are keyed like in ListError, e.g. groups/42/projects
+type Checkpoint struct {
+	Group     string                       `json:"group"`
+	Depth     int                          `json:"depth"`
+	StartedAt time.Time                    `json:"startedAt"` // when the oldest page in it was listed
+	Endpoints map[string]*EndpointProgress `json:"endpoints"`
+
+	Resumed bool `json:"-"` // pages of an earlier listing were used instead of asking Gitlab again
+
+	mu sync.Mutex
+}
+
+// EndpointProgress holds the pages of an endpoint listed so far, or a single page while listing
+type EndpointProgress struct {
+	NextPage  int            `json:"nextPage"` // 0 once every page was listed
+	Projects  []*Project     `json:"projects,omitempty"`
+	Subgroups []*ListedGroup `json:"subgroups,omitempty"`
+}
+
+// ListedGroup is what the listing needs of a subgroup to descend into it
+type ListedGroup struct {
+	ID       int    `json:"id"`
+	FullPath string `json:"fullPath"`
+}
+
+func newCheckpoint(groupPath string, depth int, resume *Checkpoint) *Checkpoint {
+	checkpoint := &Checkpoint{
+		Group:     groupPath,
+		Depth:     depth,
+		StartedAt: time.Now(),
+		Endpoints: make(map[string]*EndpointProgress),
+	}
+	if resume != nil {
+		checkpoint.StartedAt = resume.StartedAt
+	}
+	return checkpoint
+}
+
+// progress returns what the checkpoint has of endpoint, nil for none or no checkpoint
+func (c *Checkpoint) progress(endpoint string) *EndpointProgress {
+	if c == nil {
+		return nil
+	}
+	return c.Endpoints[endpoint]
+}
+
+// add appends a page of endpoint. Projects are copied, as the listing hands the originals on to be changed
+func (c *Checkpoint) add(endpoint string, page *EndpointProgress) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	progress, ok := c.Endpoints[endpoint]
+	if !ok {
+		progress = &EndpointProgress{}
+		c.Endpoints[endpoint] = progress
+	}
+	for _, project := range page.Projects {
+		saved := *project
+		progress.Projects = append(progress.Projects, &saved)
+	}
+	progress.Subgroups = append(progress.Subgroups, page.Subgroups...)
+	progress.NextPage = page.NextPage
+}
+
+func (c *Checkpoint) resumed() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Resumed = true
+}
+
+// without drops what was already seen on an endpoint and marks the rest as seen. Resumed pages can overlap
+// with the new ones, projects created or deleted in between shift the entries from page to page
+func (p *EndpointProgress) without(seen map[string]bool) *EndpointProgress {
+	page := &EndpointProgress{NextPage: p.NextPage}
+	for _, project := range p.Projects {
+		if !seen[project.Path] {
+			seen[project.Path] = true
+			page.Projects = append(page.Projects, project)
+		}
+	}
+	for _, group := range p.Subgroups {
+		if key := strconv.Itoa(group.ID); !seen[key] {
+			seen[key] = true
+			page.Subgroups = append(page.Subgroups, group)
+		}
+	}
+	return page
+}
+
+// listPages requests the pages of endpoint one after the other, handing each to handle. Pages the checkpoint to
+// resume has of the endpoint are handed over first without asking Gitlab, the listing continues after them.
+// When Gitlab refuses to continue there the saved pages are dropped and the endpoint is listed from the start
+func (l *lister) listPages(endpoint string, fetch func(page int) (*EndpointProgress, error), handle func(*EndpointProgress)) error {
+	saved := l.resume.progress(endpoint)
+
+	var page *EndpointProgress
+	var err error
+	switch {
+	case saved == nil:
+		page, err = fetch(1)
+	case saved.NextPage != 0:
+		page, err = fetch(saved.NextPage)
+		if err != nil && l.ctx.Err() == nil {
+			// E.g. the page is out of range now, the endpoint lost entries in between
+			first, firstErr := fetch(1)
+			if firstErr == nil {
+				saved, page, err = nil, first, nil
+			}
+		}
+	}
+
+	seen := make(map[string]bool)
+	if saved != nil {
+		l.checkpoint.resumed()
+		saved = saved.without(seen)
+		l.checkpoint.add(endpoint, saved)
+		handle(saved)
+	}
+
+	for err == nil && page != nil {
+		page = page.without(seen)
+		l.checkpoint.add(endpoint, page)
+		handle(page)
+		if page.NextPage == 0 {
+			break
+		}
+
+		page, err = fetch(page.NextPage)
+	}
+	return err
+}
@@ -0,0 +1,77 @@
+package gitlab_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	gls "gls/pkg/gitlab"
+	"gls/pkg/gitlab/fakegitlab"
+	"slices"
+	"testing"
+)
+
+func TestResumeActiveGitlabProjects(t *testing.T) {
+	blip := errors.New("502 Bad Gateway")
+	all := []string{"core/db", "core/queue", "edge/cdn", "edge/dns", "fleet-1", "fleet-2", "fleet-3", "fleet-4", "fleet-5"}
+
+	tests := []struct {
+		name     string
+		fail     string // the group whose page fails in the first listing
+		page     int
+		depth    int // of the second listing
+		requests int // of pages of projects in the second listing
+		resumed  bool
+	}{
+		{name: "after the failed page", fail: "fleet", page: 2, depth: -1, requests: 2, resumed: true},
+		{name: "on the first page", fail: "fleet", page: 1, depth: -1, requests: 3, resumed: true},
+		{name: "completed subgroups", fail: "fleet/core", page: 1, depth: -1, requests: 1, resumed: true},
+		{name: "another depth", fail: "fleet", page: 2, depth: 5, requests: 5},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := fakegitlab.New()
+			fake.PageSize = 2
+			for _, path := range all {
+				fake.AddProject("fleet/" + path)
+			}
+			fake.FailPage(test.fail, test.page, blip)
+			gl := gls.NewWithAPI(fake)
+			gl.SetListConcurrency(1)
+
+			checkpoint, errs := gl.ResumeActiveGitlabProjects(context.Background(), "fleet", -1, nil, func(gls.Progress) {}, func(*gls.Project) {})
+			if len(errs) != 1 || !errors.Is(errs[0], blip) {
+				t.Fatalf("the first listing got %v", errs)
+			}
+
+			// The next run reads it from disk
+			saved, err := json.Marshal(checkpoint)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var resume gls.Checkpoint
+			if err := json.Unmarshal(saved, &resume); err != nil {
+				t.Fatal(err)
+			}
+
+			before := fake.Calls("ListGroupProjects")
+			var listed []string
+			checkpoint, errs = gl.ResumeActiveGitlabProjects(context.Background(), "fleet", test.depth, &resume, func(gls.Progress) {}, func(project *gls.Project) {
+				listed = append(listed, project.Path)
+			})
+			if len(errs) > 0 {
+				t.Fatal(errs)
+			}
+			slices.Sort(listed)
+			if !slices.Equal(listed, all) {
+				t.Errorf("listed %q", listed)
+			}
+			if requests := fake.Calls("ListGroupProjects") - before; requests != test.requests {
+				t.Errorf("requested %d pages of projects, want %d", requests, test.requests)
+			}
+			if checkpoint.Resumed != test.resumed || checkpoint.StartedAt.Equal(resume.StartedAt) != test.resumed {
+				t.Errorf("resumed: %t, started at %s, want %t", checkpoint.Resumed, checkpoint.StartedAt, test.resumed)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package gitlab
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// SkewThreshold is how far the local clock may be off before it is blamed for failing requests
+const SkewThreshold = 2 * time.Minute
+
+// ClockSkewError is a failed request that is most likely caused by the local clock being off.
+// Skew is positive when the local clock is ahead of the server
+type ClockSkewError struct {
+	Skew time.Duration
+	Err  error
+}
+
+func (e *ClockSkewError) Error() string {
+	return fmt.Sprintf("%v (the local clock is off by %s)", e.Err, e.Skew.Abs().Round(time.Second))
+}
+
+func (e *ClockSkewError) Unwrap() error {
+	return e.Err
+}
+
+// blameClock wraps err in a *ClockSkewError if the local clock is too far off from the server.
+// Only authentication and certificate date errors are judged, resp is the response of the failed request if any.
+// Without a response, e.g. because the certificate was rejected, the server's clock is read without verifying it
+func (gl *Gitlab) blameClock(ctx context.Context, resp *http.Response, err error) error {
+	var skew time.Duration
+	var ok bool
+	switch {
+	case resp != nil && resp.StatusCode == http.StatusUnauthorized:
+		skew, ok = clockSkew(resp.Header, time.Now())
+	case isCertificateDateError(err):
+		skew, ok = gl.probeClockSkew(ctx)
+	}
+
+	if !ok || skew.Abs() < SkewThreshold {
+		return err
+	}
+	return &ClockSkewError{Skew: skew, Err: err}
+}
+
+// clockSkew compares now with the Date header of a response
+func clockSkew(header http.Header, now time.Time) (time.Duration, bool) {
+	date, err := http.ParseTime(header.Get("Date"))
+	if err != nil {
+		return 0, false
+	}
+	return now.Sub(date), true
+}
+
+// isCertificateDateError tells whether a certificate was rejected for being expired or not yet valid,
+// x509 reports both the same way
+func isCertificateDateError(err error) bool {
+	var invalid x509.CertificateInvalidError
+	return errors.As(err, &invalid) && invalid.Reason == x509.Expired
+}
+
+// probeClockSkew reads the Date header of the instance without verifying its certificate.
+// Nothing is sent but a plain request without the token, the response is only used to read the date
+func (gl *Gitlab) probeClockSkew(ctx context.Context) (time.Duration, bool) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	client := &http.Client{Transport: transport, Timeout: 10 * time.Second}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, gl.client.BaseURL().String()+"version", nil)
+	if err != nil {
+		return 0, false
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, false
+	}
+	_ = resp.Body.Close()
+	return clockSkew(resp.Header, time.Now())
+}
@@ -0,0 +1,62 @@
+package gitlab_test
+
+import (
+	"context"
+	"errors"
+	gls "gls/pkg/gitlab"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCheckTokenClockSkew(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		offset time.Duration // of the server's clock
+		noDate bool
+		skew   time.Duration // rounded to minutes, zero for no *ClockSkewError
+		err    error
+	}{
+		{name: "local clock ahead", status: http.StatusUnauthorized, offset: -7 * time.Minute, skew: 7 * time.Minute, err: gls.ErrUnauthorized},
+		{name: "local clock behind", status: http.StatusUnauthorized, offset: 3 * time.Hour, skew: -3 * time.Hour, err: gls.ErrUnauthorized},
+		{name: "within the threshold", status: http.StatusUnauthorized, offset: 30 * time.Second, err: gls.ErrUnauthorized},
+		{name: "no date", status: http.StatusUnauthorized, offset: time.Hour, noDate: true, err: gls.ErrUnauthorized},
+		{name: "missing scope", status: http.StatusForbidden, offset: time.Hour, err: gls.ErrMissingScope},
+		{name: "fine", status: http.StatusOK, offset: time.Hour},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if test.noDate {
+					w.Header()["Date"] = nil // not sent at all
+				} else {
+					w.Header().Set("Date", time.Now().Add(test.offset).UTC().Format(http.TimeFormat))
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(test.status)
+				_, _ = w.Write([]byte(`{"id": 1, "full_path": "platform"}`))
+			}))
+			defer server.Close()
+
+			gl, err := gls.New(server.URL, "token", gls.PersonalToken, time.Minute)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = gl.CheckToken(context.Background(), "platform")
+
+			if !errors.Is(err, test.err) || (err == nil) != (test.err == nil) {
+				t.Fatalf("got %v, want %v", err, test.err)
+			}
+			var skewErr *gls.ClockSkewError
+			if errors.As(err, &skewErr) != (test.skew != 0) {
+				t.Fatalf("got %v", err)
+			}
+			if skewErr != nil && skewErr.Skew.Round(time.Minute) != test.skew {
+				t.Errorf("skew %s, want %s", skewErr.Skew, test.skew)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package gitlab
+
+import (
+	"context"
+	"fmt"
+	"gitlab.com/gitlab-org/api/client-go"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kinds of sources. A group source lists a group or user with everything below it, the others pick projects
+// from anywhere on the instance
+const (
+	GroupSource   = "group"
+	StarredSource = "starred"
+	IdsSource     = "ids"
+)
+
+// Source is where a listing gets its projects from
+type Source struct {
+	Kind string
+	IDs  []int // only for IdsSource
+}
+
+// ParseSource reads a source written as group, starred or ids:1,2,3
+func ParseSource(value string) (*Source, error) {
+	kind, ids, hasIds := strings.Cut(strings.TrimSpace(value), ":")
+	switch {
+	case kind == GroupSource && !hasIds, kind == StarredSource && !hasIds:
+		return &Source{Kind: kind}, nil
+	case kind != IdsSource:
+		return nil, fmt.Errorf("unknown source %q, use group, starred or ids:1,2,3", value)
+	}
+
+	source := &Source{Kind: IdsSource}
+	for _, id := range strings.Split(ids, ",") {
+		id = strings.TrimSpace(id)
+		if id == "" {
+			continue
+		}
+		number, err := strconv.Atoi(id)
+		if err != nil || number <= 0 {
+			return nil, fmt.Errorf("%q in source %q is no project id", id, value)
+		}
+		source.IDs = append(source.IDs, number)
+	}
+	if len(source.IDs) == 0 {
+		return nil, fmt.Errorf("source %q names no project ids", value)
+	}
+	return source, nil
+}
+
+// Group tells whether the source is a group, whose project paths are relative to it
+func (s *Source) Group() bool {
+	return s.Kind == GroupSource
+}
+
+func (s *Source) String() string {
+	if s.Kind != IdsSource {
+		return s.Kind
+	}
+	ids := make([]string, len(s.IDs))
+	for i, id := range s.IDs {
+		ids[i] = strconv.Itoa(id)
+	}
+	return IdsSource + ":" + strings.Join(ids, ",")
+}
+
+// GetSourceProjects is GetActiveGitlabProjects for any source
+func (gl *Gitlab) GetSourceProjects(ctx context.Context, source *Source, groupPath string, depth int, report func(Progress)) ([]*Project, []error) {
+	var result []*Project
+	_, errs := gl.ResumeSourceProjects(ctx, source, groupPath, depth, nil, report, func(project *Project) {
+		result = append(result, project)
+	})
+	return result, errs
+}
+
+// ResumeSourceProjects is ResumeActiveGitlabProjects for any source. groupPath and depth only matter for a group,
+// projects of the other sources keep their full path, as they can come from anywhere on the instance
+func (gl *Gitlab) ResumeSourceProjects(ctx context.Context, source *Source, groupPath string, depth int, resume *Checkpoint, report func(Progress), yield func(*Project)) (*Checkpoint, []error) {
+	if source.Group() {
+		return gl.ResumeActiveGitlabProjects(ctx, groupPath, depth, resume, report, yield)
+	}
+
+	if resume != nil && resume.Group != source.String() {
+		resume = nil
+	}
+	checkpoint := newCheckpoint(source.String(), -1, resume)
+
+	l := gl.newLister(ctx, "", report, resume, checkpoint)
+	if source.Kind == StarredSource {
+		l.listStarredProjects()
+	} else {
+		l.listProjectsByID(source.IDs)
+	}
+	return checkpoint, l.collect(yield)
+}
+
+// listStarredProjects lists the projects starred by the user of the token
+func (l *lister) listStarredProjects() {
+	l.progress.discovered(StarredSource)
+	l.wg.Add(1)
+	l.diagnostics.Goroutines.Add(1)
+
+	go func() {
+		defer l.wg.Done()
+
+		projectCount := 0
+		endpoint := "projects?starred"
+		err := l.listPages(endpoint, func(page int) (*EndpointProgress, error) {
+			var projects []*gitlab.Project
+			var next int
+			err := l.request(func() (err error) {
+				projects, next, err = l.api.ListStarredProjects(l.ctx, page)
+				return err
+			})
+			return l.projectPage(projects, next), err
+		}, func(page *EndpointProgress) {
+			projectCount += l.sendPage(page)
+		})
+		if err != nil {
+			l.errChan <- &ListError{Group: StarredSource, Endpoint: endpoint, Err: err}
+		}
+		l.progress.listed(StarredSource, projectCount)
+	}()
+}
+
+// listProjectsByID fetches the projects one by one, those that don't exist or can't be read are left out
+func (l *lister) listProjectsByID(ids []int) {
+	l.progress.discovered(IdsSource)
+	l.wg.Add(len(ids) + 1)
+	l.diagnostics.Goroutines.Add(int64(len(ids) + 1))
+	start := time.Now()
+
+	var mu sync.Mutex
+	var pwg sync.WaitGroup
+	pwg.Add(len(ids))
+	projectCount := 0
+
+	go func() {
+		defer l.wg.Done()
+		pwg.Wait()
+		l.diagnostics.groupListed(IdsSource, time.Since(start))
+		l.progress.listed(IdsSource, projectCount)
+	}()
+
+	for _, id := range ids {
+		go func() {
+			defer l.wg.Done()
+			defer pwg.Done()
+
+			endpoint := fmt.Sprintf("projects/%d", id)
+			err := l.listPages(endpoint, func(int) (*EndpointProgress, error) {
+				var project *gitlab.Project
+				err := l.request(func() (err error) {
+					project, err = l.api.GetProject(l.ctx, id)
+					return err
+				})
+				if project == nil {
+					return &EndpointProgress{}, err
+				}
+				return l.projectPage([]*gitlab.Project{project}, 0), err
+			}, func(page *EndpointProgress) {
+				sent := l.sendPage(page)
+				mu.Lock()
+				projectCount += sent
+				mu.Unlock()
+			})
+			if err != nil {
+				l.errChan <- &ListError{Group: IdsSource, Endpoint: endpoint, Err: err}
+			}
+		}()
+	}
+}
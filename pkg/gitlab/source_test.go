@@ -0,0 +1,91 @@
+package gitlab_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gitlab.com/gitlab-org/api/client-go"
+	gls "gls/pkg/gitlab"
+	"gls/pkg/gitlab/fakegitlab"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseSource(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string // as the source prints itself
+		group bool
+		err   string
+	}{
+		{value: "group", want: "group", group: true},
+		{value: " starred ", want: "starred"},
+		{value: "ids:42", want: "ids:42"},
+		{value: "ids: 7, 1024 ,,3", want: "ids:7,1024,3"},
+		{value: "ids:", err: "names no project ids"},
+		{value: "ids:7,seven", err: `"seven" in source "ids:7,seven" is no project id`},
+		{value: "ids:-3", err: "is no project id"},
+		{value: "starred:1", err: "unknown source"},
+		{value: "groups", err: "unknown source"},
+		{value: "", err: "unknown source"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			source, err := gls.ParseSource(test.value)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("got %v, %v, want %s", source, err, test.err)
+				}
+				return
+			}
+			if err != nil || source.String() != test.want || source.Group() != test.group {
+				t.Errorf("got %v, %v", source, err)
+			}
+		})
+	}
+}
+
+func TestSourceProjects(t *testing.T) {
+	fake := fakegitlab.New()
+	fake.PageSize = 2
+	radar := fake.AddProject("observatory/radar")
+	optics := fake.AddProject("observatory/lab/optics")
+	fake.AddProject("observatory/lab/archive", fakegitlab.Archived())
+	mirror := fake.AddProject("partners/mirror")
+	locked := fake.AddProject("restricted/vault")
+	for _, project := range []*gitlab.Project{radar, optics, mirror} {
+		fake.Star(project)
+	}
+	fake.Fail("restricted", errors.New("403 Forbidden"))
+
+	tests := []struct {
+		source string
+		want   []string
+		errs   int
+	}{
+		{source: "group", want: []string{"lab/archive", "lab/optics", "radar"}},
+		{source: "starred", want: []string{"observatory/lab/optics", "observatory/radar", "partners/mirror"}},
+		{source: fmt.Sprintf("ids:%d,%d,999", mirror.ID, optics.ID), want: []string{"observatory/lab/optics", "partners/mirror"}}, // 999 doesn't exist
+		{source: fmt.Sprintf("ids:%d,%d", radar.ID, locked.ID), want: []string{"observatory/radar"}, errs: 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.source, func(t *testing.T) {
+			source, err := gls.ParseSource(test.source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			projects, errs := gls.NewWithAPI(fake).GetSourceProjects(context.Background(), source, "observatory", -1, func(gls.Progress) {})
+			var got []string
+			for _, project := range projects {
+				got = append(got, project.Path)
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, test.want) || len(errs) != test.errs {
+				t.Errorf("listed %q with %v", got, errs)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package gitlab_test
+
+import (
+	"context"
+	"fmt"
+	gls "gls/pkg/gitlab"
+	"gls/pkg/gitlab/fakegitlab"
+	"runtime"
+	"testing"
+)
+
+// seedProjects adds count projects to a fake with pages of 100 like Gitlab, spread over subgroups of 1000
+func seedProjects(count int) *fakegitlab.Gitlab {
+	fake := fakegitlab.New()
+	fake.PageSize = 100
+	for i := range count {
+		fake.AddProject(fmt.Sprintf("acme/sub-%02d/project-%05d", i/1000, i))
+	}
+	return fake
+}
+
+func TestListingHandsOutProjectsAsTheyArrive(t *testing.T) {
+	fake := seedProjects(5000)
+	gl := gls.NewWithAPI(fake)
+	gl.SetListConcurrency(1)
+
+	var yielded, pagesAtFirst int
+	errs := gl.ListActiveGitlabProjects(context.Background(), "acme", -1, func(gls.Progress) {}, func(*gls.Project) {
+		if yielded == 0 {
+			pagesAtFirst = fake.Calls("ListGroupProjects")
+		}
+		yielded++
+	})
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if yielded != 5000 {
+		t.Fatalf("yielded %d projects, want 5000", yielded)
+	}
+	if pages := fake.Calls("ListGroupProjects"); pagesAtFirst >= pages {
+		t.Errorf("the first project was handed out after %d of %d pages", pagesAtFirst, pages)
+	}
+}
+
+// heapInUse is the live heap after a collection
+func heapInUse() uint64 {
+	runtime.GC()
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return stats.HeapAlloc
+}
+
+// BenchmarkListing40k lists 40k projects, streamed and collected like a sync does, and reports the heap still in
+// use once the listing is done, on top of the fake holding them
+func BenchmarkListing40k(b *testing.B) {
+	fake := seedProjects(40000)
+
+	benchmarks := []struct {
+		name    string
+		collect bool
+	}{
+		{name: "streamed"},
+		{name: "collected", collect: true},
+	}
+
+	for _, benchmark := range benchmarks {
+		b.Run(benchmark.name, func(b *testing.B) {
+			b.ReportAllocs()
+			var retained uint64
+			for b.Loop() {
+				base := heapInUse()
+				var projects []*gls.Project
+				yielded := 0
+				errs := gls.NewWithAPI(fake).ListActiveGitlabProjects(context.Background(), "acme", -1, func(gls.Progress) {}, func(project *gls.Project) {
+					if benchmark.collect {
+						projects = append(projects, project)
+					}
+					yielded++
+				})
+				if len(errs) > 0 || yielded != 40000 {
+					b.Fatalf("yielded %d projects: %v", yielded, errs)
+				}
+				if inUse := heapInUse(); inUse > base {
+					retained = max(retained, inUse-base)
+				}
+				runtime.KeepAlive(projects)
+			}
+			b.ReportMetric(float64(retained)/(1<<20), "retained-MB")
+		})
+	}
+}
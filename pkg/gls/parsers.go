@@ -0,0 +1,140 @@
+package gls
+
+import (
+	"gls/pkg/git"
+	"regexp"
+	"strconv"
+)
+
+// The parsers gls comes with. Hooks print whatever they like, so their output isn't parsed unless a parser is
+// registered for them, e.g. NewPercentParser
+func init() {
+	Register(CloneTask, NewGitParser)
+	Register(PullTask, NewGitParser)
+	Register(FetchTask, NewGitParser)
+	Register(HookTask, NewNullParser)
+}
+
+// ratePattern matches the transfer rate git and git-lfs print after a pipe, e.g. | 2.00 MiB/s
+var ratePattern = regexp.MustCompile(`\| *([\d.]+ [KMGT]?i?B/s)`)
+
+func rate(line string) string {
+	matches := ratePattern.FindStringSubmatch(line)
+	if matches == nil {
+		return ""
+	}
+	return matches[1]
+}
+
+// gitParser maps the phases of git's progress onto a single one in basis points, see git.ProgressParser
+type gitParser struct {
+	parser *git.ProgressParser
+}
+
+// NewGitParser follows clones, pulls and fetches
+func NewGitParser(debug func(string)) Parser {
+	return &gitParser{parser: &git.ProgressParser{Debug: debug}}
+}
+
+func (p *gitParser) Feed(line string) (Progress, bool) {
+	points, ok := p.parser.Parse(line)
+	if !ok {
+		return Progress{}, false
+	}
+	return Progress{Phase: p.parser.Phase(), Current: points, Total: git.ProgressScale, Rate: rate(line)}, true
+}
+
+// lfsPattern matches the progress of git-lfs, e.g. Downloading LFS objects:  50% (1/2), 1.2 MB | 300 KB/s
+var lfsPattern = regexp.MustCompile(`^(Downloading LFS objects|Uploading LFS objects|Filtering content):\s+\d+% \((\d+)/(\d+)\)`)
+
+// lfsParser counts the objects git-lfs transferred
+type lfsParser struct {
+	debug func(string)
+}
+
+// NewLfsParser follows git lfs pull and fetch and the smudge filter of clones
+func NewLfsParser(debug func(string)) Parser {
+	return &lfsParser{debug: debug}
+}
+
+func (p *lfsParser) Feed(line string) (Progress, bool) {
+	matches := lfsPattern.FindStringSubmatch(line)
+	if matches == nil {
+		return Progress{}, false
+	}
+	current, err1 := strconv.ParseInt(matches[2], 10, 64)
+	total, err2 := strconv.ParseInt(matches[3], 10, 64)
+	if err1 != nil || err2 != nil || total <= 0 {
+		p.debug("ignoring lfs progress " + matches[2] + "/" + matches[3])
+		return Progress{}, false
+	}
+	return Progress{Phase: matches[1], Current: current, Total: total, Rate: rate(line)}, true
+}
+
+var (
+	submoduleRegistered = regexp.MustCompile(`^Submodule '[^']*' \([^)]*\) registered for path '([^']*)'`)
+	submoduleDone       = regexp.MustCompile(`^Submodule path '([^']*)': checked out`)
+)
+
+// submoduleParser counts the submodules checked out against those registered, git prints no progress of its own
+type submoduleParser struct {
+	registered map[string]bool
+	done       map[string]bool
+}
+
+// NewSubmoduleParser follows git submodule update
+func NewSubmoduleParser(func(string)) Parser {
+	return &submoduleParser{registered: make(map[string]bool), done: make(map[string]bool)}
+}
+
+func (p *submoduleParser) Feed(line string) (Progress, bool) {
+	if matches := submoduleRegistered.FindStringSubmatch(line); matches != nil {
+		p.registered[matches[1]] = true
+	} else if matches := submoduleDone.FindStringSubmatch(line); matches != nil {
+		p.done[matches[1]] = true
+		p.registered[matches[1]] = true // registered by an earlier run
+	} else {
+		return Progress{}, false
+	}
+	return Progress{Phase: "Updating submodules", Current: int64(len(p.done)), Total: int64(len(p.registered))}, true
+}
+
+// percentPattern matches a percentage, the last one of a line counts
+var percentPattern = regexp.MustCompile(`(?:^|[^\d.])(\d{1,3})%`)
+
+// percentParser follows anything printing percentages, e.g. hooks or downloads. It never goes backwards
+type percentParser struct {
+	debug func(string)
+	value int64
+}
+
+// NewPercentParser follows anything printing percentages
+func NewPercentParser(debug func(string)) Parser {
+	return &percentParser{debug: debug}
+}
+
+func (p *percentParser) Feed(line string) (Progress, bool) {
+	matches := percentPattern.FindAllStringSubmatch(line, -1)
+	if matches == nil {
+		return Progress{}, false
+	}
+	percent, _ := strconv.ParseInt(matches[len(matches)-1][1], 10, 64)
+	if percent > 100 {
+		p.debug("ignoring progress " + matches[len(matches)-1][1] + "%")
+		return Progress{}, false
+	}
+	p.value = max(p.value, percent)
+	return Progress{Current: p.value, Total: 100, Rate: rate(line)}, true
+}
+
+// nullParser is for output without any progress
+type nullParser struct{}
+
+// NewNullParser ignores every line
+func NewNullParser(func(string)) Parser {
+	return nullParser{}
+}
+
+func (nullParser) Feed(string) (Progress, bool) {
+	return Progress{}, false
+}
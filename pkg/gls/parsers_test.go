@@ -0,0 +1,187 @@
+package gls
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files of the transcripts")
+
+// replay feeds a transcript line by line and describes every line the parser reported progress for, and every
+// debug message it wrote
+func replay(t *testing.T, factory ParserFactory, transcript string) string {
+	t.Helper()
+	file, err := os.Open(filepath.Join("testdata", transcript))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var result strings.Builder
+	parser := factory(func(message string) {
+		fmt.Fprintf(&result, "  debug: %s\n", message)
+	})
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		progress, ok := parser.Feed(scanner.Text())
+		if ok {
+			fmt.Fprintf(&result, "%s => %q %d/%d %q\n", scanner.Text(), progress.Phase, progress.Current, progress.Total, progress.Rate)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return result.String()
+}
+
+func TestParserTranscripts(t *testing.T) {
+	tests := []struct {
+		name       string
+		parser     ParserFactory
+		transcript string
+	}{
+		{name: "git-clone", parser: NewGitParser, transcript: "git-clone.txt"},
+		{name: "git-pull", parser: NewGitParser, transcript: "git-pull.txt"},
+		{name: "git-fetch-two-remotes", parser: NewGitParser, transcript: "git-fetch-two-remotes.txt"},
+		{name: "git-odd", parser: NewGitParser, transcript: "git-odd.txt"},
+		{name: "lfs", parser: NewLfsParser, transcript: "lfs.txt"},
+		{name: "submodule", parser: NewSubmoduleParser, transcript: "submodule.txt"},
+		{name: "percent", parser: NewPercentParser, transcript: "percent.txt"},
+		{name: "null-git-clone", parser: NewNullParser, transcript: "git-clone.txt"},
+		{name: "null-percent", parser: NewNullParser, transcript: "percent.txt"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := replay(t, test.parser, test.transcript)
+			golden := filepath.Join("testdata", test.name+".golden")
+			if *update {
+				err := os.WriteFile(golden, []byte(got), 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != string(want) {
+				t.Errorf("%s differs, run with -update to accept\ngot:\n%s\nwant:\n%s", golden, got, want)
+			}
+		})
+	}
+}
+
+// TestGitParserNeverGoesBackwards checks what the progress bar relies on for every git transcript
+func TestGitParserNeverGoesBackwards(t *testing.T) {
+	transcripts, err := filepath.Glob(filepath.Join("testdata", "git-*.txt"))
+	if err != nil || len(transcripts) == 0 {
+		t.Fatalf("no transcripts: %v", err)
+	}
+
+	for _, transcript := range transcripts {
+		t.Run(filepath.Base(transcript), func(t *testing.T) {
+			content, err := os.ReadFile(transcript)
+			if err != nil {
+				t.Fatal(err)
+			}
+			parser := NewGitParser(func(string) {})
+			var last int64
+			for _, line := range strings.Split(string(content), "\n") {
+				progress, ok := parser.Feed(line)
+				if !ok {
+					continue
+				}
+				if progress.Current < last || progress.Current < 0 || progress.Current > progress.Total {
+					t.Errorf("%q went from %d to %d/%d", line, last, progress.Current, progress.Total)
+				}
+				last = progress.Current
+			}
+		})
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	if got, want := strings.Join(Tasks(), ","), "clone,fetch,hook,pull"; got != want {
+		t.Errorf("got tasks %s, want %s", got, want)
+	}
+	if _, ok := NewParser(CloneTask, nil).Feed("Receiving objects:  50% (1/2)"); !ok {
+		t.Error("clones aren't followed by default")
+	}
+	if _, ok := NewParser(HookTask, nil).Feed("50%"); ok {
+		t.Error("hooks are followed by default")
+	}
+	if _, ok := NewParser("unknown", nil).Feed("Receiving objects:  50% (1/2)"); ok {
+		t.Error("a task without a parser got one")
+	}
+
+	// Replacing the parser of hooks is what programs building on gls do
+	Register(HookTask, NewPercentParser)
+	t.Cleanup(func() {
+		Register(HookTask, NewNullParser)
+	})
+	progress, ok := NewParser(HookTask, nil).Feed("installing 40%")
+	if !ok || progress.Current != 40 || progress.Total != 100 {
+		t.Errorf("got %+v, %v from the registered parser", progress, ok)
+	}
+	if got := strings.Join(Tasks(), ","); got != "clone,fetch,hook,pull" {
+		t.Errorf("replacing a parser changed the tasks to %s", got)
+	}
+
+	// Every task gets a parser of its own, they keep state
+	first, second := NewParser(HookTask, nil), NewParser(HookTask, nil)
+	first.Feed("90%")
+	if progress, _ := second.Feed("10%"); progress.Current != 10 {
+		t.Errorf("parsers share their state, got %d", progress.Current)
+	}
+}
+
+// TestParserCatalog checks that NewParser hands out every registered parser and falls back to the null parser
+func TestParserCatalog(t *testing.T) {
+	tests := []struct {
+		task   string
+		line   string
+		wantOk bool
+	}{
+		{task: CloneTask, line: "Receiving objects:  25% (3/12), 1.50 MiB | 750.00 KiB/s", wantOk: true},
+		{task: PullTask, line: "Resolving deltas: 100% (4/4), done.", wantOk: true},
+		{task: FetchTask, line: "From gitlab.example.com:tools/relay", wantOk: false},
+		{task: HookTask, line: "npm install 60%", wantOk: false},
+		{task: "lfs", line: "Downloading LFS objects:  50% (2/4), 8 MB | 2.0 MB/s", wantOk: false},
+		{task: "backup", line: "copied 75%", wantOk: false},
+	}
+
+	registryMu.RLock()
+	catalog := maps.Clone(registry)
+	registryMu.RUnlock()
+	for _, task := range Tasks() {
+		if catalog[task] == nil {
+			t.Errorf("%s is listed without a parser", task)
+		}
+	}
+
+	for _, test := range tests {
+		t.Run(test.task, func(t *testing.T) {
+			parser := NewParser(test.task, nil)
+			want := NewNullParser(nil)
+			if factory := catalog[test.task]; factory != nil {
+				want = factory(func(string) {})
+			}
+			if got := reflect.TypeOf(parser); got != reflect.TypeOf(want) {
+				t.Errorf("got a %s, want a %s", got, reflect.TypeOf(want))
+			}
+
+			progress, ok := parser.Feed(test.line)
+			if ok != test.wantOk || ok && progress.Total <= 0 {
+				t.Errorf("%q gave %+v, %t, want progress %t", test.line, progress, ok, test.wantOk)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+// Package gls holds what programs building on gls can extend, like the parsers following the progress of tasks
+package gls
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Progress is how far a task got according to a line of its output. Total is 0 when the line only told the phase
+type Progress struct {
+	Phase   string
+	Current int64
+	Total   int64
+	Rate    string // as the command printed it, e.g. 2.00 MiB/s, empty if it didn't
+}
+
+// Parser follows the output of a single task. Feed is called with every line and returns the progress if the line
+// reports any. Parsers are used by one task only, so they may keep state between lines
+type Parser interface {
+	Feed(line string) (Progress, bool)
+}
+
+// ParserFactory creates a parser for a task. Debug, which is never nil, takes messages about odd lines for the
+// transcript of the task
+type ParserFactory func(debug func(string)) Parser
+
+// Tasks whose output gls parses, Register replaces the parser of one of them
+const (
+	CloneTask = "clone"
+	PullTask  = "pull"
+	FetchTask = "fetch"
+	HookTask  = "hook" // the post clone and post pull hooks
+)
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]ParserFactory)
+)
+
+// Register sets the parser for the output of a type of task, replacing the one registered before
+func Register(task string, factory ParserFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[task] = factory
+}
+
+// NewParser creates the parser for a type of task, a null parser if there is none for it
+func NewParser(task string, debug func(string)) Parser {
+	if debug == nil {
+		debug = func(string) {}
+	}
+
+	registryMu.RLock()
+	factory := registry[task]
+	registryMu.RUnlock()
+	if factory == nil {
+		return NewNullParser(debug)
+	}
+	return factory(debug)
+}
+
+// Tasks lists the types of tasks with a parser, sorted
+func Tasks() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	tasks := make([]string, 0, len(registry))
+	for task := range registry {
+		tasks = append(tasks, task)
+	}
+	sort.Strings(tasks)
+	return tasks
+}
+
+// Tracker is what shows the progress of a task, the trackers of go-pretty for one
+type Tracker interface {
+	UpdateTotal(total int64)
+	SetValue(value int64)
+}
+
+// TrackerAdapter passes progress on to a tracker, at most once per interval. Progress within the interval is held
+// back until the next update after it or Flush, only reaching the total passes right away
+type TrackerAdapter struct {
+	tracker  Tracker
+	interval time.Duration
+	now      func() time.Time
+
+	mu      sync.Mutex
+	last    time.Time
+	pending *Progress
+}
+
+func NewTrackerAdapter(tracker Tracker, interval time.Duration) *TrackerAdapter {
+	return &TrackerAdapter{tracker: tracker, interval: interval, now: time.Now}
+}
+
+// Update shows progress on the tracker, progress without a total only names a phase and isn't shown
+func (a *TrackerAdapter) Update(progress Progress) {
+	if progress.Total <= 0 {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := a.now()
+	if now.Sub(a.last) < a.interval && progress.Current < progress.Total {
+		a.pending = &progress
+		return
+	}
+	a.apply(progress, now)
+}
+
+// Flush shows the progress held back by the interval, if any
+func (a *TrackerAdapter) Flush() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.pending != nil {
+		a.apply(*a.pending, a.now())
+	}
+}
+
+func (a *TrackerAdapter) apply(progress Progress, now time.Time) {
+	a.tracker.UpdateTotal(progress.Total)
+	a.tracker.SetValue(min(progress.Current, progress.Total))
+	a.last = now
+	a.pending = nil
+}
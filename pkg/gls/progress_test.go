@@ -0,0 +1,139 @@
+package gls
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recordingTracker records what it was told as total:value
+type recordingTracker struct {
+	total   int64
+	updates []string
+}
+
+func (r *recordingTracker) UpdateTotal(total int64) {
+	r.total = total
+}
+
+func (r *recordingTracker) SetValue(value int64) {
+	r.updates = append(r.updates, fmt.Sprintf("%d:%d", r.total, value))
+}
+
+func TestTrackerAdapter(t *testing.T) {
+	type step struct {
+		after    time.Duration // since the previous step
+		progress *Progress     // nil flushes
+	}
+
+	tests := []struct {
+		name  string
+		steps []step
+		want  string
+	}{
+		{
+			name:  "first update passes",
+			steps: []step{{progress: &Progress{Current: 1, Total: 10}}},
+			want:  "10:1",
+		},
+		{
+			name: "updates within the interval are held back",
+			steps: []step{
+				{progress: &Progress{Current: 1, Total: 10}},
+				{after: 10 * time.Millisecond, progress: &Progress{Current: 2, Total: 10}},
+				{after: 10 * time.Millisecond, progress: &Progress{Current: 3, Total: 10}},
+				{after: 100 * time.Millisecond, progress: &Progress{Current: 4, Total: 10}},
+			},
+			want: "10:1 10:4",
+		},
+		{
+			name: "held back progress is flushed",
+			steps: []step{
+				{progress: &Progress{Current: 1, Total: 10}},
+				{after: 10 * time.Millisecond, progress: &Progress{Current: 5, Total: 10}},
+				{after: 10 * time.Millisecond},
+				{after: 10 * time.Millisecond},
+			},
+			want: "10:1 10:5",
+		},
+		{
+			name: "reaching the total passes right away",
+			steps: []step{
+				{progress: &Progress{Current: 1, Total: 10}},
+				{after: time.Millisecond, progress: &Progress{Current: 10, Total: 10}},
+			},
+			want: "10:1 10:10",
+		},
+		{
+			name: "phases without a total aren't shown",
+			steps: []step{
+				{progress: &Progress{Phase: "Enumerating objects"}},
+				{after: 100 * time.Millisecond, progress: &Progress{Current: 3, Total: -1}},
+				{after: 100 * time.Millisecond},
+			},
+		},
+		{
+			name: "beyond the total is clamped",
+			steps: []step{
+				{progress: &Progress{Current: 12, Total: 10}},
+			},
+			want: "10:10",
+		},
+		{
+			name: "a new total",
+			steps: []step{
+				{progress: &Progress{Current: 4, Total: 4}},
+				{after: time.Millisecond, progress: &Progress{Current: 1, Total: 2}},
+				{after: 100 * time.Millisecond, progress: &Progress{Current: 2, Total: 2}},
+			},
+			want: "4:4 2:2",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tracker := &recordingTracker{}
+			now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+			adapter := NewTrackerAdapter(tracker, 50*time.Millisecond)
+			adapter.now = func() time.Time { return now }
+
+			for _, step := range test.steps {
+				now = now.Add(step.after)
+				if step.progress == nil {
+					adapter.Flush()
+				} else {
+					adapter.Update(*step.progress)
+				}
+			}
+			if got := strings.Join(tracker.updates, " "); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+// TestTrackerAdapterTranscript replays a whole clone the way a task shows it
+func TestTrackerAdapterTranscript(t *testing.T) {
+	tracker := &recordingTracker{}
+	adapter := NewTrackerAdapter(tracker, time.Hour)
+	parser := NewGitParser(func(string) {})
+
+	transcript, err := os.ReadFile(filepath.Join("testdata", "git-clone.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(string(transcript), "\n") {
+		if progress, ok := parser.Feed(line); ok {
+			adapter.Update(progress)
+		}
+	}
+	adapter.Flush()
+
+	// Within the hour only the first update and reaching the total pass
+	if got := strings.Join(tracker.updates, " "); got != "10000:0 10000:10000" {
+		t.Errorf("got %q", got)
+	}
+}
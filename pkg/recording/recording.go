@@ -0,0 +1,66 @@
+package recording
+
+import (
+	"encoding/json"
+	"fmt"
+	"gls/pkg/git"
+	"gls/pkg/gitlab"
+	"gls/pkg/storage"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const FileName = "recording.json"
+
+// Version is increased whenever the layout changes in a way older gls versions can't read
+const Version = 1
+
+// Recording is what a sync saw before planning, so the planner can be run again on it with another config
+type Recording struct {
+	Version    int               `json:"version"`
+	RecordedAt time.Time         `json:"recordedAt"`
+	Group      string            `json:"group"`
+	Depth      int               `json:"depth"`
+	Gitlab     []*gitlab.Project `json:"gitlab"` // as listed, before any clone url was rewritten
+	Local      []*git.Project    `json:"local"`  // as found below the local path, before anything was ignored
+}
+
+// Save writes the recording into dir, creating it if needed
+func (r *Recording) Save(dir string) error {
+	r.Version = Version
+	r.RecordedAt = time.Now()
+
+	content, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+	return storage.WriteFile(filepath.Join(dir, FileName), content, 0644)
+}
+
+// Load reads the recording in dir. Recordings of a newer gls are rejected, as fields could be missing silently
+func Load(dir string) (*Recording, error) {
+	content, err := os.ReadFile(filepath.Join(dir, FileName))
+	if err != nil {
+		return nil, err
+	}
+
+	var recording Recording
+	err = json.Unmarshal(content, &recording)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Join(dir, FileName), err)
+	}
+
+	switch {
+	case recording.Version == 0:
+		return nil, fmt.Errorf("%s is not a recording, it has no version", filepath.Join(dir, FileName))
+	case recording.Version > Version:
+		return nil, fmt.Errorf("%s was recorded by a newer gls, version %d is not supported", filepath.Join(dir, FileName), recording.Version)
+	}
+	return &recording, nil
+}
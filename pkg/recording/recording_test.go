@@ -0,0 +1,76 @@
+package recording
+
+import (
+	"gls/pkg/git"
+	"gls/pkg/gitlab"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSaveLoad(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "recordings", "monday") // created on saving
+	saved := &Recording{
+		Group: "acme",
+		Depth: 2,
+		Gitlab: []*gitlab.Project{
+			{ID: 7, Path: "acme/api", DefaultBranch: "main", CloneUrl: "git@gitlab.example.com:acme/api.git", HttpUrl: "https://gitlab.example.com/acme/api.git",
+				Topics: []string{"go"}, WikiEnabled: true, LastActivity: time.Date(2026, 3, 4, 5, 6, 7, 0, time.UTC), Size: 1024, AccessLevel: 30, Visibility: "private"},
+			{ID: 8, Path: "acme/old", DefaultBranch: "master", Archived: true, Shared: true},
+		},
+		Local: []*git.Project{
+			{Path: "acme/api", Branch: "main", Commit: "4b825dc642cb6eb9a060e54bf8d69288fbee4904"},
+			{Path: "acme/scratch", Branch: git.DetachedBranch, Detached: true},
+			{Path: "acme/empty", Branch: "main", Unborn: true},
+		},
+	}
+	if err := saved.Save(dir); err != nil {
+		t.Fatal(err)
+	}
+	if saved.Version != Version || time.Since(saved.RecordedAt) > time.Minute {
+		t.Errorf("saved as version %d at %s", saved.Version, saved.RecordedAt)
+	}
+
+	loaded, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.RecordedAt.Equal(saved.RecordedAt) {
+		t.Errorf("recorded at %s, want %s", loaded.RecordedAt, saved.RecordedAt)
+	}
+	loaded.RecordedAt = saved.RecordedAt // without the monotonic clock reading
+	if !reflect.DeepEqual(loaded, saved) {
+		t.Errorf("loaded %+v, want %+v", loaded, saved)
+	}
+}
+
+func TestLoadRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		err     string
+	}{
+		{name: "missing", err: "no such file"},
+		{name: "not json", content: "group: acme", err: "invalid character"},
+		{name: "no version", content: `{"group": "acme"}`, err: "is not a recording, it has no version"},
+		{name: "newer version", content: `{"version": 2, "group": "acme"}`, err: "was recorded by a newer gls, version 2 is not supported"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if test.content != "" {
+				if err := os.WriteFile(filepath.Join(dir, FileName), []byte(test.content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			recording, err := Load(dir)
+			if err == nil || recording != nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("got %+v, %v, want %s", recording, err, test.err)
+			}
+		})
+	}
+}
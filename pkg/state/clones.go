@@ -0,0 +1,62 @@
+package state
+
+import (
+	"encoding/json"
+	"gls/pkg/storage"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const ClonesFileName = ".gls-clones.json"
+
+// Clone is a clone gls started. It is complete once git finished and left a repository, with HEAD resolving or
+// unborn for an empty project
+type Clone struct {
+	StartedAt  time.Time `json:"startedAt"`
+	VerifiedAt time.Time `json:"verifiedAt,omitzero"`
+}
+
+func (c *Clone) Complete() bool {
+	return !c.VerifiedAt.IsZero()
+}
+
+// Clones are kept apart from the state cache, so interrupted clones are known with the cache turned off too
+type Clones struct {
+	Clones map[string]*Clone `json:"clones"` // by project path
+}
+
+// LoadClones reads the clones in localPath, a missing file results in none
+func LoadClones(localPath string) (*Clones, error) {
+	content, err := storage.ReadChecked(filepath.Join(localPath, ClonesFileName))
+	if os.IsNotExist(err) {
+		return &Clones{Clones: make(map[string]*Clone)}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	clones := Clones{Clones: make(map[string]*Clone)}
+	err = json.Unmarshal(content, &clones)
+	if err != nil {
+		return nil, err
+	}
+	if clones.Clones == nil {
+		clones.Clones = make(map[string]*Clone)
+	}
+	return &clones, nil
+}
+
+func (c *Clones) Save(localPath string) error {
+	content, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return storage.WriteChecked(filepath.Join(localPath, ClonesFileName), content, 0644)
+}
+
+// Interrupted tells whether gls started cloning the project at path without the clone ever completing
+func (c *Clones) Interrupted(path string) bool {
+	clone := c.Clones[path]
+	return clone != nil && !clone.Complete()
+}
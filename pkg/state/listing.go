@@ -0,0 +1,47 @@
+package state
+
+import (
+	"encoding/json"
+	"gls/pkg/gitlab"
+	"gls/pkg/storage"
+	"os"
+	"path/filepath"
+)
+
+const ListingFileName = ".gls-listing.json"
+
+// LoadListing reads the checkpoint of a listing that failed part way in localPath, nil if there is none
+func LoadListing(localPath string) (*gitlab.Checkpoint, error) {
+	content, err := storage.ReadChecked(filepath.Join(localPath, ListingFileName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var checkpoint gitlab.Checkpoint
+	err = json.Unmarshal(content, &checkpoint)
+	if err != nil {
+		return nil, err
+	}
+	return &checkpoint, nil
+}
+
+// SaveListing keeps the checkpoint of a listing that failed part way, for the next run to resume it
+func SaveListing(localPath string, checkpoint *gitlab.Checkpoint) error {
+	content, err := json.Marshal(checkpoint) // not indented, it can hold tens of thousands of projects
+	if err != nil {
+		return err
+	}
+	return storage.WriteChecked(filepath.Join(localPath, ListingFileName), content, 0644)
+}
+
+// ClearListing removes the checkpoint once a listing completed, a missing one is fine
+func ClearListing(localPath string) error {
+	err := os.Remove(filepath.Join(localPath, ListingFileName))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
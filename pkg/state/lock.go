@@ -0,0 +1,164 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const LockFileName = ".gls.lock"
+
+// LocalLock is what the lock file tells about the gls run holding it
+type LocalLock struct {
+	PID       int       `json:"pid"`
+	Host      string    `json:"host"`
+	StartedAt time.Time `json:"startedAt"`
+}
+
+// LockedError means another gls run holds the lock of the local path
+type LockedError struct {
+	Holder *LocalLock
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("locked by pid %d on %s since %s", e.Holder.PID, e.Holder.Host, e.Holder.StartedAt.Local().Format("2006-01-02 15:04:05"))
+}
+
+// AcquireLock creates the lock file in localPath, so no other gls run syncs the same tree at the same time.
+// A lock whose process is gone is taken over and returned as stale, a lock held on another host can't be checked
+// and counts as live. force removes any lock first. The returned function removes the lock again
+func AcquireLock(localPath string, force bool) (release func() error, stale *LocalLock, err error) {
+	path := filepath.Join(localPath, LockFileName)
+	if force {
+		err = os.Remove(path)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, nil, err
+		}
+	}
+
+	hostname, _ := os.Hostname()
+	lock := &LocalLock{PID: os.Getpid(), Host: hostname, StartedAt: time.Now()}
+	content, err := json.Marshal(lock)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// A second attempt is only made after removing a stale lock, whoever wins the race for it holds the lock
+	for attempt := 1; ; attempt++ {
+		err = createLock(path, content)
+		if err == nil {
+			return func() error { return releaseLock(path, content) }, stale, nil
+		}
+		if !os.IsExist(err) || attempt == 2 {
+			return nil, nil, err
+		}
+
+		holder, err := readLock(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		// A lock with our own pid is stale too, e.g. gls always runs as pid 1 in a container
+		if holder != nil && (holder.Host != hostname || holder.PID != lock.PID && processAlive(holder.PID)) {
+			return nil, nil, &LockedError{Holder: holder}
+		}
+
+		stale = holder
+		err = os.Remove(path)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, nil, err
+		}
+	}
+}
+
+// createLock puts the lock file in place with its content in one step, so another run never reads it half
+// written. The content goes to a temporary file that is then linked to path, which fails if path exists.
+// Filesystems without hard links get the lock file created exclusively and written afterwards
+func createLock(path string, content []byte) error {
+	temp, err := os.CreateTemp(filepath.Dir(path), LockFileName+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+
+	_, err = temp.Write(content)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	err = os.Link(temp.Name(), path)
+	if err == nil || os.IsExist(err) {
+		return err
+	}
+	return createLockExclusively(path, content)
+}
+
+func createLockExclusively(path string, content []byte) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(content)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(path)
+	}
+	return err
+}
+
+// lockWriteGrace is how long an empty or unreadable lock file may be on its way to being written by another run
+const lockWriteGrace = 5 * time.Second
+
+// readLock returns who holds the lock, nil for a lock file that is gone or was left unreadable, e.g. empty after a
+// crash. An unreadable lock file younger than lockWriteGrace may still be written, it is read again until it is
+// complete or old enough to be left over
+func readLock(path string) (*LocalLock, error) {
+	for {
+		info, err := os.Stat(path)
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		content, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var lock LocalLock
+		if json.Unmarshal(content, &lock) == nil && lock.PID != 0 {
+			return &lock, nil
+		}
+		if time.Since(info.ModTime()) >= lockWriteGrace {
+			return nil, nil
+		}
+		time.Sleep(lockWriteGrace / 50)
+	}
+}
+
+// releaseLock removes the lock file, unless --force-unlock handed it to another run meanwhile
+func releaseLock(path string, content []byte) error {
+	current, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if string(current) != string(content) {
+		return errors.New("the lock was taken over by another run")
+	}
+	return os.Remove(path)
+}
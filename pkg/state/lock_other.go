@@ -0,0 +1,14 @@
+//go:build !windows
+
+package state
+
+import (
+	"errors"
+	"syscall"
+)
+
+// processAlive tells whether a process with pid runs, signal 0 only checks whether it could be signalled
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
@@ -0,0 +1,225 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeLock(t *testing.T, dir string, lock *LocalLock) {
+	t.Helper()
+	content, err := json.Marshal(lock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(dir, LockFileName), content, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readLockFile(t *testing.T, dir string) *LocalLock {
+	t.Helper()
+	lock, err := readLock(filepath.Join(dir, LockFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return lock
+}
+
+// exitedPid is the pid of a process that ran and is gone
+func exitedPid(t *testing.T) int {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	err := cmd.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cmd.Process.Pid
+}
+
+func TestAcquireLock(t *testing.T) {
+	hostname, _ := os.Hostname()
+
+	tests := []struct {
+		name   string
+		holder func(t *testing.T) *LocalLock // nil for no lock file
+		force  bool
+		locked bool
+		stale  bool
+	}{
+		{name: "unlocked"},
+		{
+			name: "live",
+			holder: func(t *testing.T) *LocalLock {
+				return &LocalLock{PID: os.Getppid(), Host: hostname, StartedAt: time.Now()}
+			},
+			locked: true,
+		},
+		{
+			name: "stale",
+			holder: func(t *testing.T) *LocalLock {
+				return &LocalLock{PID: exitedPid(t), Host: hostname, StartedAt: time.Now()}
+			},
+			stale: true,
+		},
+		{
+			name: "own pid after a restart",
+			holder: func(t *testing.T) *LocalLock {
+				return &LocalLock{PID: os.Getpid(), Host: hostname, StartedAt: time.Now()}
+			},
+			stale: true,
+		},
+		{
+			name: "foreign host",
+			holder: func(t *testing.T) *LocalLock {
+				return &LocalLock{PID: exitedPid(t), Host: "elsewhere", StartedAt: time.Now()}
+			},
+			locked: true,
+		},
+		{
+			name: "force unlock of a live lock",
+			holder: func(t *testing.T) *LocalLock {
+				return &LocalLock{PID: os.Getppid(), Host: hostname, StartedAt: time.Now()}
+			},
+			force: true,
+		},
+		{
+			name:   "force unlock of a foreign host",
+			holder: func(t *testing.T) *LocalLock { return &LocalLock{PID: 1, Host: "elsewhere", StartedAt: time.Now()} },
+			force:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			var holder *LocalLock
+			if test.holder != nil {
+				holder = test.holder(t)
+				writeLock(t, dir, holder)
+			}
+
+			release, stale, err := AcquireLock(dir, test.force)
+			var locked *LockedError
+			if test.locked {
+				if !errors.As(err, &locked) {
+					t.Fatalf("got %v, want a LockedError", err)
+				}
+				if locked.Holder.PID != holder.PID || locked.Holder.Host != holder.Host {
+					t.Errorf("got holder %+v, want %+v", locked.Holder, holder)
+				}
+				if current := readLockFile(t, dir); current == nil || current.PID != holder.PID {
+					t.Errorf("the lock of the holder was changed to %+v", current)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if test.stale != (stale != nil) {
+				t.Errorf("got stale lock %+v, want one: %v", stale, test.stale)
+			}
+			if stale != nil && stale.PID != holder.PID {
+				t.Errorf("got stale lock %+v, want %+v", stale, holder)
+			}
+			if current := readLockFile(t, dir); current == nil || current.PID != os.Getpid() || current.Host != hostname {
+				t.Errorf("the lock file holds %+v", current)
+			}
+
+			err = release()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := os.Stat(filepath.Join(dir, LockFileName)); !os.IsNotExist(err) {
+				t.Errorf("the lock file is still there: %v", err)
+			}
+		})
+	}
+}
+
+func TestAcquireLockLeavesNoTemporaryFiles(t *testing.T) {
+	dir := t.TempDir()
+	release, _, err := AcquireLock(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != LockFileName {
+		t.Errorf("got %v", entries)
+	}
+}
+
+func TestReleaseAfterForceUnlock(t *testing.T) {
+	dir := t.TempDir()
+	release, _, err := AcquireLock(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Another run removes the lock with --force-unlock and takes it
+	writeLock(t, dir, &LocalLock{PID: os.Getppid(), Host: "elsewhere", StartedAt: time.Now()})
+
+	if err := release(); err == nil {
+		t.Error("releasing a lock taken over by another run succeeded")
+	}
+	if current := readLockFile(t, dir); current == nil || current.Host != "elsewhere" {
+		t.Errorf("the lock of the other run was changed to %+v", current)
+	}
+}
+
+func TestAcquireLockLeftEmpty(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, LockFileName)
+	err := os.WriteFile(path, nil, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Minute)
+	err = os.Chtimes(path, old, old)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	release, stale, err := AcquireLock(dir, false)
+	if err != nil {
+		t.Fatalf("a lock left empty by a crash wasn't taken over: %v", err)
+	}
+	defer release()
+	if stale != nil {
+		t.Errorf("got stale lock %+v for an empty file", stale)
+	}
+}
+
+func TestAcquireLockBeingWritten(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, LockFileName)
+	err := os.WriteFile(path, nil, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Another run created the lock file and writes it a moment later, it must not be removed meanwhile
+	holder := &LocalLock{PID: os.Getppid(), Host: "elsewhere", StartedAt: time.Now()}
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		content, _ := json.Marshal(holder)
+		_ = os.WriteFile(path, content, 0644)
+	}()
+
+	_, _, err = AcquireLock(dir, false)
+	var locked *LockedError
+	if !errors.As(err, &locked) || locked.Holder.Host != "elsewhere" {
+		t.Fatalf("got %v, want the lock held by the other run", err)
+	}
+}
@@ -0,0 +1,17 @@
+//go:build windows
+
+package state
+
+import (
+	"os"
+)
+
+// processAlive tells whether a process with pid runs, finding a process opens it on windows, which fails once it exited
+func processAlive(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	_ = process.Release()
+	return true
+}
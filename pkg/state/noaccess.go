@@ -0,0 +1,84 @@
+package state
+
+import (
+	"encoding/json"
+	"gls/pkg/storage"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const NoAccessFileName = ".gls-no-access.json"
+
+// NoAccessProject is a project the token can list but not read, it is skipped until its access level changes
+type NoAccessProject struct {
+	Path        string    `json:"path"`
+	AccessLevel int       `json:"accessLevel"` // the one Gitlab listed when reading failed
+	Since       time.Time `json:"since"`
+	Error       string    `json:"error"`
+}
+
+// NoAccess is kept apart from the state cache, so projects stay skipped with the cache turned off
+type NoAccess struct {
+	Projects []*NoAccessProject `json:"projects"`
+}
+
+// LoadNoAccess reads the projects without access in localPath, a missing file results in none
+func LoadNoAccess(localPath string) (*NoAccess, error) {
+	content, err := storage.ReadChecked(filepath.Join(localPath, NoAccessFileName))
+	if os.IsNotExist(err) {
+		return &NoAccess{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var noAccess NoAccess
+	err = json.Unmarshal(content, &noAccess)
+	if err != nil {
+		return nil, err
+	}
+	return &noAccess, nil
+}
+
+func (n *NoAccess) Save(localPath string) error {
+	content, err := json.MarshalIndent(n, "", "  ")
+	if err != nil {
+		return err
+	}
+	return storage.WriteChecked(filepath.Join(localPath, NoAccessFileName), content, 0644)
+}
+
+// Find returns the project at path, nil if the token isn't known to lack access to it. It can be called on nil NoAccess
+func (n *NoAccess) Find(path string) *NoAccessProject {
+	if n == nil {
+		return nil
+	}
+	for _, project := range n.Projects {
+		if project.Path == path {
+			return project
+		}
+	}
+	return nil
+}
+
+// Add records that the token can't read the project, replacing an earlier record of it
+func (n *NoAccess) Add(project *NoAccessProject) {
+	n.Remove(project.Path)
+	n.Projects = append(n.Projects, project)
+	sort.Slice(n.Projects, func(i, j int) bool {
+		return n.Projects[i].Path < n.Projects[j].Path
+	})
+}
+
+// Remove forgets the project at path, it returns false if it wasn't known
+func (n *NoAccess) Remove(path string) bool {
+	for i, project := range n.Projects {
+		if project.Path == path {
+			n.Projects = append(n.Projects[:i], n.Projects[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
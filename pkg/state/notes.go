@@ -0,0 +1,131 @@
+package state
+
+import (
+	"encoding/json"
+	"gls/pkg/gitlab"
+	"gls/pkg/storage"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const NotesFileName = ".gls-notes.json"
+
+// Note is something the user wants to remember about a project, shown wherever gls asks or reports about it
+type Note struct {
+	ProjectID int       `json:"projectId,omitempty"` // unknown until a sync found the project on Gitlab
+	Path      string    `json:"path"`                // follows the project when it moves on Gitlab
+	Text      string    `json:"text"`
+	Written   time.Time `json:"written"`
+	GoneSince time.Time `json:"goneSince,omitzero"` // since when the project is missing from Gitlab
+}
+
+// Notes are kept apart from the state cache, which can be turned off or refreshed without losing them
+type Notes struct {
+	Notes []*Note `json:"notes"`
+}
+
+// LoadNotes reads the notes in localPath, a missing file results in no notes
+func LoadNotes(localPath string) (*Notes, error) {
+	content, err := storage.ReadChecked(filepath.Join(localPath, NotesFileName))
+	if os.IsNotExist(err) {
+		return &Notes{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var notes Notes
+	err = json.Unmarshal(content, &notes)
+	if err != nil {
+		return nil, err
+	}
+	return &notes, nil
+}
+
+func (n *Notes) Save(localPath string) error {
+	content, err := json.MarshalIndent(n, "", "  ")
+	if err != nil {
+		return err
+	}
+	return storage.WriteChecked(filepath.Join(localPath, NotesFileName), content, 0644)
+}
+
+// Find returns the note of the project at path, nil if it has none. It can be called on nil Notes
+func (n *Notes) Find(path string) *Note {
+	if n == nil {
+		return nil
+	}
+	for _, note := range n.Notes {
+		if note.Path == path {
+			return note
+		}
+	}
+	return nil
+}
+
+// Set replaces the note of the project at path, or adds one
+func (n *Notes) Set(path string, text string, now time.Time) {
+	if note := n.Find(path); note != nil {
+		note.Text = text
+		note.Written = now
+		return
+	}
+
+	n.Notes = append(n.Notes, &Note{Path: path, Text: text, Written: now})
+	sort.Slice(n.Notes, func(i, j int) bool {
+		return n.Notes[i].Path < n.Notes[j].Path
+	})
+}
+
+// Remove deletes the note of the project at path, false if it had none
+func (n *Notes) Remove(path string) bool {
+	for i, note := range n.Notes {
+		if note.Path == path {
+			n.Notes = append(n.Notes[:i], n.Notes[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Reconcile matches the notes with a complete listing of the group. Notes follow their project by ID when it moved,
+// notes of projects missing from the listing are kept for retention after they went missing, 0 keeps them forever.
+// within tells whether the listing covers a path at all, notes of paths it doesn't cover are left alone
+func (n *Notes) Reconcile(projects []*gitlab.Project, within func(string) bool, now time.Time, retention time.Duration) {
+	byID := make(map[int]*gitlab.Project)
+	byPath := make(map[string]*gitlab.Project)
+	for _, project := range projects {
+		if project.ID != 0 {
+			byID[project.ID] = project // wikis have none, their notes go by path
+		}
+		byPath[project.Path] = project
+	}
+
+	var kept []*Note
+	for _, note := range n.Notes {
+		project := byID[note.ProjectID]
+		if note.ProjectID == 0 {
+			project = byPath[note.Path]
+		}
+
+		switch {
+		case project != nil:
+			note.ProjectID = project.ID
+			note.Path = project.Path
+			note.GoneSince = time.Time{}
+		case !within(note.Path):
+		case note.GoneSince.IsZero():
+			note.GoneSince = now
+		case retention > 0 && now.Sub(note.GoneSince) > retention:
+			continue
+		}
+		kept = append(kept, note)
+	}
+
+	n.Notes = kept
+	sort.Slice(n.Notes, func(i, j int) bool {
+		return n.Notes[i].Path < n.Notes[j].Path
+	})
+}
@@ -0,0 +1,114 @@
+package state
+
+import (
+	"gls/pkg/gitlab"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNotesReconcile(t *testing.T) {
+	now := time.Date(2026, 9, 1, 12, 0, 0, 0, time.UTC)
+	written := time.Date(2023, 4, 2, 0, 0, 0, 0, time.UTC)
+	listed := []*gitlab.Project{
+		{ID: 11, Path: "payments/ledger"},
+		{ID: 12, Path: "archive/settlement"}, // moved from payments/settlement
+		{Path: "payments/ledger.wiki"},
+	}
+
+	tests := []struct {
+		name      string
+		note      Note
+		retention time.Duration
+		want      *Note // nil when dropped
+	}{
+		{
+			name: "found by path",
+			note: Note{Path: "payments/ledger", Text: "contains prod secrets", Written: written},
+			want: &Note{ProjectID: 11, Path: "payments/ledger", Text: "contains prod secrets", Written: written},
+		},
+		{
+			name: "follows its project",
+			note: Note{ProjectID: 12, Path: "payments/settlement", Text: "owned by finance", Written: written},
+			want: &Note{ProjectID: 12, Path: "archive/settlement", Text: "owned by finance", Written: written},
+		},
+		{
+			name: "wiki by path",
+			note: Note{Path: "payments/ledger.wiki", Text: "outdated", Written: written},
+			want: &Note{Path: "payments/ledger.wiki", Text: "outdated", Written: written},
+		},
+		{
+			name: "back again",
+			note: Note{ProjectID: 11, Path: "payments/ledger", Text: "flaky CI", Written: written, GoneSince: now.AddDate(0, 0, -3)},
+			want: &Note{ProjectID: 11, Path: "payments/ledger", Text: "flaky CI", Written: written},
+		},
+		{
+			name:      "just gone",
+			note:      Note{ProjectID: 13, Path: "payments/refunds", Text: "deprecated", Written: written},
+			retention: 24 * time.Hour,
+			want:      &Note{ProjectID: 13, Path: "payments/refunds", Text: "deprecated", Written: written, GoneSince: now},
+		},
+		{
+			name:      "gone within the retention",
+			note:      Note{Path: "payments/refunds", Text: "deprecated", Written: written, GoneSince: now.Add(-23 * time.Hour)},
+			retention: 24 * time.Hour,
+			want:      &Note{Path: "payments/refunds", Text: "deprecated", Written: written, GoneSince: now.Add(-23 * time.Hour)},
+		},
+		{
+			name:      "gone for longer than the retention",
+			note:      Note{Path: "payments/refunds", Text: "deprecated", Written: written, GoneSince: now.Add(-25 * time.Hour)},
+			retention: 24 * time.Hour,
+		},
+		{
+			name: "gone, kept forever",
+			note: Note{Path: "payments/refunds", Text: "deprecated", Written: written, GoneSince: now.AddDate(-2, 0, 0)},
+			want: &Note{Path: "payments/refunds", Text: "deprecated", Written: written, GoneSince: now.AddDate(-2, 0, 0)},
+		},
+		{
+			name:      "below the depth",
+			note:      Note{Path: "payments/eu/sepa", Text: "talk to Kai first", Written: written},
+			retention: time.Nanosecond,
+			want:      &Note{Path: "payments/eu/sepa", Text: "talk to Kai first", Written: written},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			note := test.note
+			notes := &Notes{Notes: []*Note{&note}}
+			notes.Reconcile(listed, func(path string) bool {
+				return strings.Count(path, "/") <= 1
+			}, now, test.retention)
+
+			switch {
+			case test.want == nil && len(notes.Notes) != 0:
+				t.Errorf("kept %+v", *notes.Notes[0])
+			case test.want != nil && (len(notes.Notes) != 1 || !reflect.DeepEqual(notes.Notes[0], test.want)):
+				t.Errorf("got %+v, want %+v", notes.Notes, *test.want)
+			}
+		})
+	}
+}
+
+func TestNotesSetRemove(t *testing.T) {
+	notes := &Notes{}
+	first := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	notes.Set("web/shop", "frozen until Q3", first)
+	notes.Set("api/orders", "ask Robin", first)
+	notes.Set("web/shop", "frozen until Q4", first.AddDate(0, 1, 0))
+
+	want := []*Note{
+		{Path: "api/orders", Text: "ask Robin", Written: first},
+		{Path: "web/shop", Text: "frozen until Q4", Written: first.AddDate(0, 1, 0)},
+	}
+	if !reflect.DeepEqual(notes.Notes, want) {
+		t.Errorf("got %+v", notes.Notes)
+	}
+	if !notes.Remove("api/orders") || notes.Remove("api/orders") || notes.Find("api/orders") != nil {
+		t.Error("removed api/orders differently")
+	}
+	if (*Notes)(nil).Find("web/shop") != nil {
+		t.Error("found a note without notes")
+	}
+}
@@ -0,0 +1,96 @@
+package state
+
+import (
+	"encoding/json"
+	"gls/pkg/storage"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const ShadowFileName = ".gls-shadow.json"
+
+// ShadowDeletion is a project that would have been deleted, aggregated over all runs in shadow mode
+type ShadowDeletion struct {
+	Path      string    `json:"path"`
+	Reason    string    `json:"reason"`             // why it would have been deleted, as of the last run
+	Unpushed  []string  `json:"unpushed,omitempty"` // work that would have been lost, as of the last run
+	Unknown   bool      `json:"unknown,omitempty"`  // the unpushed work couldn't be assessed
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+	Runs      int       `json:"runs"`
+}
+
+// Shadow collects the would-be deletions of the runs in shadow mode
+type Shadow struct {
+	LastRun   time.Time         `json:"lastRun"`
+	Runs      int               `json:"runs"`
+	Deletions []*ShadowDeletion `json:"deletions"`
+}
+
+// LoadShadow reads the shadow records in localPath, a missing file results in empty records
+func LoadShadow(localPath string) (*Shadow, error) {
+	content, err := storage.ReadChecked(filepath.Join(localPath, ShadowFileName))
+	if os.IsNotExist(err) {
+		return &Shadow{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var shadow Shadow
+	err = json.Unmarshal(content, &shadow)
+	if err != nil {
+		return nil, err
+	}
+	return &shadow, nil
+}
+
+// StartRun counts a run, the deletions it records are those with LastSeen equal to LastRun
+func (s *Shadow) StartRun(now time.Time) {
+	s.LastRun = now
+	s.Runs++
+}
+
+// Record adds a would-be deletion of the current run, or updates the one recorded by earlier runs
+func (s *Shadow) Record(deletion *ShadowDeletion) {
+	deletion.LastSeen = s.LastRun
+	for i, recorded := range s.Deletions {
+		if recorded.Path == deletion.Path {
+			deletion.FirstSeen = recorded.FirstSeen
+			deletion.Runs = recorded.Runs + 1
+			s.Deletions[i] = deletion
+			return
+		}
+	}
+
+	deletion.FirstSeen = s.LastRun
+	deletion.Runs = 1
+	s.Deletions = append(s.Deletions, deletion)
+	sort.Slice(s.Deletions, func(i, j int) bool {
+		return s.Deletions[i].Path < s.Deletions[j].Path
+	})
+}
+
+// Current tells whether the last run would still have deleted a project
+func (s *Shadow) Current(deletion *ShadowDeletion) bool {
+	return deletion.LastSeen.Equal(s.LastRun)
+}
+
+func (s *Shadow) Save(localPath string) error {
+	content, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return storage.WriteChecked(filepath.Join(localPath, ShadowFileName), content, 0644)
+}
+
+// ClearShadow removes the shadow records, returns whether there were any
+func ClearShadow(localPath string) (bool, error) {
+	err := os.Remove(filepath.Join(localPath, ShadowFileName))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
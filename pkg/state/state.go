@@ -0,0 +1,58 @@
+package state
+
+import (
+	"encoding/json"
+	"gls/pkg/git"
+	"gls/pkg/gitlab"
+	"gls/pkg/storage"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const FileName = ".gls-state.json"
+
+type State struct {
+	UpdatedAt time.Time      `json:"updatedAt"`
+	Projects  []*git.Project `json:"projects"`
+	Listing   *Listing       `json:"listing,omitempty"` // the last complete listing, for gls stats
+	Failed    []string       `json:"failed,omitempty"`  // projects whose tasks failed in the last run
+}
+
+// Listing is what Gitlab listed for a source at ListedAt
+type Listing struct {
+	ListedAt time.Time         `json:"listedAt"`
+	Source   string            `json:"source"` // the listing of another source, group or depth says nothing
+	Projects []*gitlab.Project `json:"projects"`
+}
+
+// Load reads the state file in localPath. A missing file results in an empty state,
+// a corrupt one in an empty state plus the error, so callers can warn and carry on. Corrupt files are quarantined
+func Load(localPath string) (*State, error) {
+	content, err := storage.ReadChecked(filepath.Join(localPath, FileName))
+	if os.IsNotExist(err) {
+		return &State{}, nil
+	}
+	if err != nil {
+		return &State{}, err
+	}
+
+	var state State
+	err = json.Unmarshal(content, &state)
+	if err != nil {
+		return &State{}, err
+	}
+
+	return &state, nil
+}
+
+func (s *State) Save(localPath string) error {
+	s.UpdatedAt = time.Now()
+
+	content, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return storage.WriteChecked(filepath.Join(localPath, FileName), content, 0644)
+}
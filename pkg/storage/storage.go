@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrCorrupt is returned for files whose checksum doesn't match, usually because a write was interrupted
+var ErrCorrupt = errors.New("file is corrupt")
+
+// footerPrefix starts the last line of checked files, followed by the hex encoded sha256 of everything before it
+var footerPrefix = []byte("\n#sha256:")
+
+// WriteFile replaces path atomically: the content goes to a temporary file in the same directory,
+// which is synced and then renamed over path. A crash leaves either the old or the new file, never a mix
+func WriteFile(path string, content []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+
+	file, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := file.Name()
+
+	err = writeAndSync(file, content, perm)
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+
+	err = os.Rename(tmpPath, path)
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+
+	syncDir(dir)
+	return nil
+}
+
+func writeAndSync(file *os.File, content []byte, perm os.FileMode) error {
+	_, err := file.Write(content)
+	if err == nil {
+		err = file.Sync()
+	}
+	if err == nil {
+		err = file.Chmod(perm)
+	}
+
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// syncDir makes the rename itself durable. Not every platform can sync directories, so errors are ignored
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	_ = d.Sync()
+	_ = d.Close()
+}
+
+// WriteChecked writes content atomically like WriteFile, followed by a checksum footer ReadChecked verifies
+func WriteChecked(path string, content []byte, perm os.FileMode) error {
+	sum := sha256.Sum256(content)
+
+	checked := make([]byte, 0, len(content)+len(footerPrefix)+2*len(sum)+1)
+	checked = append(checked, content...)
+	checked = append(checked, footerPrefix...)
+	checked = append(checked, hex.EncodeToString(sum[:])...)
+	checked = append(checked, '\n')
+
+	return WriteFile(path, checked, perm)
+}
+
+// ReadChecked reads a file written by WriteChecked and returns its content without the footer.
+// A file with a missing or wrong checksum is quarantined, so the next run starts fresh,
+// and an error wrapping ErrCorrupt is returned
+func ReadChecked(path string) ([]byte, error) {
+	checked, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	content, ok := verify(checked)
+	if ok {
+		return content, nil
+	}
+
+	quarantined, err := Quarantine(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w, quarantining it failed: %v", path, ErrCorrupt, err)
+	}
+	return nil, fmt.Errorf("%s: %w, moved it to %s", path, ErrCorrupt, quarantined)
+}
+
+func verify(checked []byte) ([]byte, bool) {
+	i := bytes.LastIndex(checked, footerPrefix)
+	if i < 0 {
+		return nil, false
+	}
+
+	content := checked[:i]
+	footer := bytes.TrimSpace(checked[i+len(footerPrefix):])
+
+	sum := sha256.Sum256(content)
+	return content, string(footer) == hex.EncodeToString(sum[:])
+}
+
+// Quarantine moves a corrupt file out of the way, keeping it around for inspection
+func Quarantine(path string) (string, error) {
+	target := fmt.Sprintf("%s.corrupt-%s", path, time.Now().Format("20060102-150405"))
+	return target, os.Rename(path, target)
+}
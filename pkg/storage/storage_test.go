@@ -0,0 +1,214 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// files lists the names in dir
+func files(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+func TestWriteAndReadChecked(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+
+	for _, content := range []string{`{"a":1}`, "", "two\nlines\n", `{"b":2}`} {
+		err := WriteChecked(path, []byte(content), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		read, err := ReadChecked(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(read) != content {
+			t.Errorf("read %q, want %q", read, content)
+		}
+	}
+
+	if names := files(t, dir); len(names) != 1 {
+		t.Errorf("temporary files were left: %q", names)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 && os.PathSeparator == '/' {
+		t.Errorf("got permissions %v", perm)
+	}
+}
+
+// TestReadCheckedCorrupt simulates what crashes and other writers leave behind
+func TestReadCheckedCorrupt(t *testing.T) {
+	content := []byte(`{"projects":["acme/api","acme/web"]}`)
+
+	tests := []struct {
+		name    string
+		corrupt func(checked []byte) []byte
+		valid   bool
+	}{
+		{name: "intact", corrupt: func(checked []byte) []byte { return checked }, valid: true},
+		{name: "footer line ending changed", corrupt: func(checked []byte) []byte {
+			return append(bytes.TrimSuffix(checked, []byte("\n")), "\r\n"...)
+		}, valid: true},
+		{name: "truncated in the content", corrupt: func(checked []byte) []byte { return checked[:len(content)/2] }},
+		{name: "truncated in the footer", corrupt: func(checked []byte) []byte { return checked[:len(checked)-10] }},
+		{name: "empty", corrupt: func(checked []byte) []byte { return nil }},
+		{name: "content changed", corrupt: func(checked []byte) []byte {
+			return bytes.Replace(checked, []byte("web"), []byte("wab"), 1)
+		}},
+		{name: "footer changed", corrupt: func(checked []byte) []byte {
+			changed := bytes.Clone(checked)
+			changed[len(changed)-2] ^= 1
+			return changed
+		}},
+		{name: "written without footer", corrupt: func([]byte) []byte { return content }},
+		{name: "appended to", corrupt: func(checked []byte) []byte { return append(bytes.Clone(checked), "more\n"...) }},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "state.json")
+			err := WriteChecked(path, content, 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checked, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = os.WriteFile(path, test.corrupt(checked), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			read, readErr := ReadChecked(path)
+			if test.valid {
+				if readErr != nil || !bytes.Equal(read, content) {
+					t.Fatalf("read %q, %v", read, readErr)
+				}
+				return
+			}
+
+			if !errors.Is(readErr, ErrCorrupt) {
+				t.Fatalf("got %v, want ErrCorrupt", readErr)
+			}
+			if _, err := os.Stat(path); !os.IsNotExist(err) {
+				t.Errorf("the corrupt file is still in place: %v", err)
+			}
+			names := files(t, dir)
+			if len(names) != 1 || !strings.HasPrefix(names[0], "state.json.corrupt-") {
+				t.Fatalf("got %q, want the quarantined file", names)
+			}
+			quarantined, err := os.ReadFile(filepath.Join(dir, names[0]))
+			if err != nil || !bytes.Equal(quarantined, test.corrupt(checked)) {
+				t.Errorf("the quarantined file holds %q, %v", quarantined, err)
+			}
+			if !strings.Contains(readErr.Error(), names[0]) {
+				t.Errorf("the error doesn't tell where the file went: %v", readErr)
+			}
+
+			// The next run starts fresh
+			err = WriteChecked(path, content, 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if read, err := ReadChecked(path); err != nil || !bytes.Equal(read, content) {
+				t.Errorf("read %q, %v after writing anew", read, err)
+			}
+		})
+	}
+}
+
+func TestReadCheckedMissing(t *testing.T) {
+	_, err := ReadChecked(filepath.Join(t.TempDir(), "state.json"))
+	if !os.IsNotExist(err) {
+		t.Errorf("got %v, want a not exist error", err)
+	}
+}
+
+// TestCrashBeforeRename simulates a crash after the temporary file was written but before it was renamed
+func TestCrashBeforeRename(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+	err := WriteChecked(path, []byte("old"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(dir, "state.json.tmp-123"), []byte("new, half writ"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := ReadChecked(path)
+	if err != nil || string(read) != "old" {
+		t.Fatalf("read %q, %v, want the old content", read, err)
+	}
+
+	err = WriteChecked(path, []byte("newer"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read, err = ReadChecked(path)
+	if err != nil || string(read) != "newer" {
+		t.Errorf("read %q, %v", read, err)
+	}
+}
+
+func TestWriteFileFailingRename(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+	err := os.MkdirAll(filepath.Join(path, "in-the-way"), 0755) // a directory can't be replaced by a file
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = WriteChecked(path, []byte("content"), 0644)
+	if err == nil {
+		t.Fatal("replacing a directory succeeded")
+	}
+	if names := files(t, dir); len(names) != 1 || names[0] != "state.json" {
+		t.Errorf("the temporary file was left: %q", names)
+	}
+}
+
+func TestQuarantine(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+	err := os.WriteFile(path, []byte("broken"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target, err := Quarantine(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Dir(target) != dir || !strings.HasPrefix(filepath.Base(target), "state.json.corrupt-") {
+		t.Errorf("quarantined to %s", target)
+	}
+	if content, err := os.ReadFile(target); err != nil || string(content) != "broken" {
+		t.Errorf("the quarantined file holds %q, %v", content, err)
+	}
+
+	_, err = Quarantine(path)
+	if err == nil {
+		t.Error("quarantining a missing file succeeded")
+	}
+}